@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ghosteye/arsenal"
+	"ghosteye/database"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// ArsenalFilesHandler 列出用户的托管文件
+func ArsenalFilesHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	files, err := database.GetArsenalFiles(username)
+	if err != nil {
+		log.Printf("Failed to get arsenal files: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get arsenal files"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal files retrieved",
+		Data: map[string]interface{}{
+			"files":   files,
+			"running": arsenal.Running(),
+		},
+	})
+}
+
+// ArsenalUploadHandler 上传工具文件，multipart表单包含file以及可选的name、os、arch、description字段
+func ArsenalUploadHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	upload, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing form field: file"})
+		return
+	}
+	defer upload.Close()
+
+	name := r.FormValue("name")
+	if name == "" {
+		name = header.Filename
+	}
+
+	file, err := arsenal.SaveFile(username, name, r.FormValue("os"), r.FormValue("arch"), r.FormValue("description"), upload)
+	if err != nil {
+		log.Printf("Failed to save arsenal file: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal file uploaded",
+		Data:    file,
+	})
+}
+
+// ArsenalDeleteHandler 删除托管文件及其下载链接
+func ArsenalDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: id"})
+		return
+	}
+
+	if err := arsenal.DeleteFile(username, id); err != nil {
+		log.Printf("Failed to delete arsenal file: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal file deleted",
+	})
+}
+
+// ArsenalLinksHandler 列出下载链接，可通过file_id筛选
+func ArsenalLinksHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	fileID, _ := strconv.ParseInt(r.URL.Query().Get("file_id"), 10, 64)
+	links, err := database.GetArsenalLinks(username, fileID)
+	if err != nil {
+		log.Printf("Failed to get arsenal links: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get arsenal links"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal links retrieved",
+		Data:    links,
+	})
+}
+
+// ArsenalCreateLinkHandler 为托管文件创建随机下载链接并生成下载命令。
+// host为目标主机访问GhostEye使用的地址，缺省时使用访问面板的主机名
+func ArsenalCreateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var req struct {
+		FileID     int64    `json:"file_id"`
+		OneTime    bool     `json:"one_time"`
+		ExpiresIn  int      `json:"expires_in"` // 有效期（秒），0表示不过期
+		AllowedIPs []string `json:"allowed_ips"`
+		Host       string   `json:"host"`
+		Dest       string   `json:"dest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	if req.ExpiresIn < 0 {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid parameter: expires_in"})
+		return
+	}
+
+	if req.Host == "" {
+		req.Host = defaultLHost(r, "")
+	}
+	baseURL, err := arsenal.BaseURL(req.Host)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	link, file, err := arsenal.CreateLink(username, req.FileID, req.OneTime, time.Duration(req.ExpiresIn)*time.Second, req.AllowedIPs)
+	if err != nil {
+		log.Printf("Failed to create arsenal link: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	fileURL := arsenal.LinkURL(baseURL, link, file)
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal link created",
+		Data: map[string]interface{}{
+			"link":      link,
+			"url":       fileURL,
+			"oneliners": arsenal.OneLiners(fileURL, file, req.Dest),
+		},
+	})
+}
+
+// ArsenalRevokeLinkHandler 撤销下载链接
+func ArsenalRevokeLinkHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: token"})
+		return
+	}
+
+	if err := database.RevokeArsenalLink(username, token); err != nil {
+		log.Printf("Failed to revoke arsenal link: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal link revoked",
+	})
+}
+
+// ArsenalDownloadsHandler 获取下载日志，包含被拒绝的请求
+func ArsenalDownloadsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	fileID, _ := strconv.ParseInt(r.URL.Query().Get("file_id"), 10, 64)
+	downloads, err := database.GetArsenalDownloads(username, fileID)
+	if err != nil {
+		log.Printf("Failed to get arsenal downloads: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get arsenal downloads"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Arsenal downloads retrieved",
+		Data:    downloads,
+	})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"ghosteye/backend"
+	"ghosteye/codec"
+	"ghosteye/connector"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// ConnectBindShellHandler 主动连接目标主机上的绑定Shell
+func ConnectBindShellHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	if req.Target == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Target is required"})
+		return
+	}
+
+	terminalID, err := connector.ConnectBindShell(username, req.Target)
+	if err != nil {
+		log.Printf("Failed to connect bind shell: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Bind shell connected",
+		Data:    map[string]string{"terminal_id": terminalID},
+	})
+}
+
+// ConnectSSHHandler 通过SSH连接目标主机并创建终端会话
+func ConnectSSHHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		Host       string `json:"host"`
+		Port       int    `json:"port"`
+		User       string `json:"user"`
+		Password   string `json:"password"`
+		PrivateKey string `json:"private_key"`
+		Passphrase string `json:"passphrase"`
+		Term       string `json:"term"`
+		Cols       uint16 `json:"cols"`
+		Rows       uint16 `json:"rows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	terminalID, fingerprint, err := connector.ConnectSSH(username, backend.SSHOptions{
+		Host:       req.Host,
+		Port:       req.Port,
+		User:       req.User,
+		Password:   req.Password,
+		PrivateKey: req.PrivateKey,
+		Passphrase: req.Passphrase,
+		Term:       req.Term,
+		Cols:       req.Cols,
+		Rows:       req.Rows,
+	})
+	if err != nil {
+		log.Printf("Failed to connect SSH session: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "SSH session connected",
+		Data: map[string]string{
+			"terminal_id":          terminalID,
+			"host_key_fingerprint": fingerprint,
+		},
+	})
+}
+
+// ConnectWebshellHandler 连接HTTP webshell并创建终端会话
+func ConnectWebshellHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		URL      string            `json:"url"`
+		Method   string            `json:"method"`
+		Param    string            `json:"param"`
+		Headers  map[string]string `json:"headers"`
+		Cookies  string            `json:"cookies"`
+		OS       string            `json:"os"`
+		Timeout  int               `json:"timeout"`
+		RawBody  bool              `json:"raw_body"`
+		Encoders []codec.Spec      `json:"encoders"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	if req.URL == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "URL is required"})
+		return
+	}
+
+	// 按顺序组合请求编码器
+	var encoder codec.Codec
+	if len(req.Encoders) > 0 {
+		chain, err := codec.NewChain(req.Encoders)
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+			return
+		}
+		encoder = chain
+	}
+
+	terminalID, err := connector.ConnectWebshell(username, backend.WebshellOptions{
+		URL:     req.URL,
+		Method:  req.Method,
+		Param:   req.Param,
+		Headers: req.Headers,
+		Cookies: req.Cookies,
+		OS:      req.OS,
+		Timeout: time.Duration(req.Timeout) * time.Second,
+		RawBody: req.RawBody,
+		Codec:   encoder,
+	})
+	if err != nil {
+		log.Printf("Failed to connect webshell: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Webshell connected",
+		Data:    map[string]string{"terminal_id": terminalID},
+	})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ghosteye/codec"
+	"ghosteye/encoder"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// EncodersHandler 列出可用的包装器和数据编码器
+func EncodersHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Encoders retrieved",
+		Data: map[string]interface{}{
+			"wrappers": encoder.Names(),
+			"codecs":   codec.Names(),
+		},
+	})
+}
+
+// EncodeHandler 使用编码流水线转换命令，流水线可以是文本形式（pipeline）或配置列表（encoders）
+func EncodeHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var req struct {
+		Command  string       `json:"command"`
+		Pipeline string       `json:"pipeline"`
+		Encoders []codec.Spec `json:"encoders"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	if req.Command == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: command"})
+		return
+	}
+
+	specs := req.Encoders
+	if req.Pipeline != "" {
+		specs = append(codec.ParseSpecs(req.Pipeline), specs...)
+	}
+	pipeline, err := encoder.NewPipeline(specs)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	encoded, err := pipeline.Apply(req.Command)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Command encoded",
+		Data: map[string]interface{}{
+			"encoded": encoded,
+			"length":  len(encoded),
+		},
+	})
+}
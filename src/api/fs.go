@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/filemgr"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/terminal"
+	"ghosteye/utils"
+)
+
+// 单次上传的最大文件大小
+const maxUploadSize = 100 << 20
+
+// fileManager 根据路径中的终端ID获取webshell会话的文件管理器，失败时写入错误响应
+func fileManager(w http.ResponseWriter, r *http.Request) (string, string, *filemgr.Manager, bool) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return "", "", nil, false
+	}
+
+	terminalID := r.PathValue("id")
+	session := terminal.GetTerminalSession(username, terminalID)
+	if session == nil || session.Backend == nil || !session.Active {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Terminal session is not active"})
+		return "", "", nil, false
+	}
+
+	// 只有能够执行独立命令的后端支持文件管理
+	executor, ok := session.Backend.(filemgr.Executor)
+	if !ok {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "File manager is only available for webshell sessions"})
+		return "", "", nil, false
+	}
+
+	manager := filemgr.New(executor)
+	if size, err := strconv.Atoi(r.URL.Query().Get("chunk_size")); err == nil && size > 0 {
+		manager.ChunkSize = size
+	}
+
+	return username, terminalID, manager, true
+}
+
+// FSListHandler 列出远程目录
+func FSListHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	dir := r.URL.Query().Get("path")
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := manager.List(dir)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Directory listed",
+		Data:    files,
+	})
+}
+
+// FSDownloadHandler 下载远程文件
+func FSDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	username, terminalID, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	remotePath := r.URL.Query().Get("path")
+	if remotePath == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: path"})
+		return
+	}
+
+	data, err := manager.Download(remotePath)
+	if err != nil {
+		log.Printf("Failed to download %s from terminal session %s: %v", remotePath, terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	hash := filemgr.Sum(data)
+	if err := database.AddFileTransfer(username, terminalID, database.TransferDownload, "webshell", remotePath, int64(len(data)), hash); err != nil {
+		log.Printf("Failed to log file transfer: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(strings.ReplaceAll(remotePath, "\\", "/"))))
+	w.Header().Set("X-Content-SHA256", hash)
+	w.Write(data)
+}
+
+// FSUploadHandler 上传文件到远程路径，支持multipart表单的file字段或原始请求体
+func FSUploadHandler(w http.ResponseWriter, r *http.Request) {
+	username, terminalID, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	remotePath := r.URL.Query().Get("path")
+	if remotePath == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: path"})
+		return
+	}
+
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing form field: file"})
+			return
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to read upload"})
+		return
+	}
+
+	if err := manager.Upload(remotePath, data); err != nil {
+		log.Printf("Failed to upload %s to terminal session %s: %v", remotePath, terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	hash := filemgr.Sum(data)
+	if err := database.AddFileTransfer(username, terminalID, database.TransferUpload, "webshell", remotePath, int64(len(data)), hash); err != nil {
+		log.Printf("Failed to log file transfer: %v", err)
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "File uploaded",
+		Data: map[string]interface{}{
+			"path":   remotePath,
+			"size":   len(data),
+			"sha256": hash,
+		},
+	})
+}
+
+// FSDeleteHandler 删除远程文件或目录
+func FSDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	if err := manager.Delete(req.Path); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "File deleted"})
+}
+
+// FSRenameHandler 重命名或移动远程文件
+func FSRenameHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	if err := manager.Rename(req.From, req.To); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "File renamed"})
+}
+
+// FSTouchHandler 修改远程文件时间戳，mtime为Unix时间戳，reference为参考文件
+func FSTouchHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, manager, ok := fileManager(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Path      string `json:"path"`
+		MTime     int64  `json:"mtime"`
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	var mtime time.Time
+	if req.MTime > 0 {
+		mtime = time.Unix(req.MTime, 0)
+	}
+
+	if err := manager.Touch(req.Path, mtime, req.Reference); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "File timestamp updated"})
+}
+
+// FSTransfersHandler 查询会话的文件传输记录
+func FSTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	transfers, err := database.GetFileTransfers(username, r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to get file transfers: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get file transfers"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "File transfers retrieved",
+		Data:    transfers,
+	})
+}
@@ -4,81 +4,34 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	
 	"ghosteye/auth"
 	"ghosteye/database"
+	"ghosteye/encoder"
+	"ghosteye/listener"
 	"ghosteye/middleware"
 	"ghosteye/models"
 	"ghosteye/utils"
 	"ghosteye/terminal"
+	"ghosteye/vt"
 )
 
-// StartHandler 用于接收启动指令
-func StartHandler(w http.ResponseWriter, r *http.Request) {
-	userState := middleware.GetUserState(r)
-	if userState == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to get user state"))
-		return
-	}
-
-	userState.Mutex.Lock()
-	defer userState.Mutex.Unlock()
-
-	// 获取命令参数
-	cmd := r.URL.Query().Get("cmd")
-	if cmd == "" {
-		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: cmd"})
-		return
-	}
-
-	// 更新用户状态
-	userState.IsRunning = true
-	userState.Command = cmd
-
-	// 返回成功响应
-	utils.WriteJSON(w, models.Response{Code: 0, Message: "Command received", Data: map[string]string{"cmd": cmd}})
-}
-
-// StopHandler 用于接收停止指令
-func StopHandler(w http.ResponseWriter, r *http.Request) {
-	userState := middleware.GetUserState(r)
-	if userState == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to get user state"))
-		return
-	}
-
-	userState.Mutex.Lock()
-	defer userState.Mutex.Unlock()
-
-	// 更新用户状态
-	userState.IsRunning = false
-	userState.Command = ""
-
-	// 返回成功响应
-	utils.WriteJSON(w, models.Response{Code: 0, Message: "Command stopped"})
-}
-
-// StatusHandler 用于查询命令状态
+// StatusHandler 用于查询服务状态，前端同时用它校验令牌是否有效
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	userState := middleware.GetUserState(r)
-	if userState == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to get user state"))
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
 		return
 	}
 
-	userState.Mutex.Lock()
-	defer userState.Mutex.Unlock()
-
-	// 返回状态
+	// 返回运行中的监听器数量
 	utils.WriteJSON(w, models.Response{
 		Code:    0,
 		Message: "Status retrieved",
 		Data: map[string]interface{}{
-			"is_running": userState.IsRunning,
-			"command":    userState.Command,
+			"running_listeners": len(listener.GetUserListeners(username)),
 		},
 	})
 }
@@ -147,6 +100,21 @@ func GetUserCommandsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 指定了编码流水线的命令同时返回编码后的结果
+	for _, cmd := range commands {
+		pipeline, _ := cmd["encoders"].(string)
+		command, _ := cmd["command"].(string)
+		if pipeline == "" || command == "" {
+			continue
+		}
+		encoded, err := encoder.Encode(command, pipeline)
+		if err != nil {
+			log.Printf("Failed to encode command %s: %v", cmd["name"], err)
+			continue
+		}
+		cmd["encoded"] = encoded
+	}
+
 	utils.WriteJSON(w, models.Response{
 		Code:    0,
 		Message: "Commands retrieved",
@@ -168,6 +136,7 @@ func AddUserCommandHandler(w http.ResponseWriter, r *http.Request) {
 		Name        string `json:"name"`
 		Command     string `json:"command"`
 		Description string `json:"description"`
+		Encoders    string `json:"encoders"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
 		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
@@ -179,9 +148,13 @@ func AddUserCommandHandler(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSON(w, models.Response{Code: 1, Message: "Name and command are required"})
 		return
 	}
+	if _, err := encoder.Parse(cmd.Encoders); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
 
 	// 添加命令
-	err := database.AddUserCommand(username, cmd.Name, cmd.Command, cmd.Description)
+	err := database.AddUserCommand(username, cmd.Name, cmd.Command, cmd.Description, cmd.Encoders)
 	if err != nil {
 		log.Printf("Failed to add user command: %v", err)
 		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
@@ -208,6 +181,7 @@ func UpdateUserCommandHandler(w http.ResponseWriter, r *http.Request) {
 		Name        string `json:"name"`
 		Command     string `json:"command"`
 		Description string `json:"description"`
+		Encoders    string `json:"encoders"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
 		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
@@ -219,9 +193,13 @@ func UpdateUserCommandHandler(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSON(w, models.Response{Code: 1, Message: "Name and command are required"})
 		return
 	}
+	if _, err := encoder.Parse(cmd.Encoders); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
 
 	// 更新命令
-	err := database.UpdateUserCommand(username, cmd.Name, cmd.Command, cmd.Description)
+	err := database.UpdateUserCommand(username, cmd.Name, cmd.Command, cmd.Description, cmd.Encoders)
 	if err != nil {
 		log.Printf("Failed to update user command: %v", err)
 		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
@@ -315,4 +293,156 @@ func KillTerminalHandler(w http.ResponseWriter, r *http.Request) {
 		Code:    0,
 		Message: "Terminal session terminated",
 	})
-} 
+}
+
+// UpgradeTerminalHandler 将反弹Shell升级为PTY
+func UpgradeTerminalHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	// 获取终端ID
+	terminalID := r.URL.Query().Get("terminal_id")
+	if terminalID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: terminal_id"})
+		return
+	}
+
+	method, err := terminal.UpgradeSession(username, terminalID)
+	if err != nil {
+		log.Printf("Failed to upgrade terminal session: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	// 通知已连接的客户端切换为原始模式
+	if session := terminal.GetTerminalSession(username, terminalID); session != nil {
+		terminal.BroadcastMessage(session, terminalID, "upgrade", map[string]interface{}{
+			"success": true,
+			"method":  method,
+		})
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Terminal session upgraded",
+		Data:    map[string]string{"method": method},
+	})
+}
+
+// SyncTerminalSizeHandler 将客户端窗口大小同步到已升级的远程PTY
+func SyncTerminalSizeHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	terminalID := r.URL.Query().Get("terminal_id")
+	if terminalID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: terminal_id"})
+		return
+	}
+
+	if err := terminal.SyncRemoteSize(username, terminalID); err != nil {
+		log.Printf("Failed to sync terminal size: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "Terminal size synced"})
+}
+
+// TerminalScreenHandler 返回终端模拟器中当前屏幕的文本，scrollback=1时包含滚动缓冲，format=text时返回纯文本
+func TerminalScreenHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+	
+	terminalID := r.PathValue("id")
+	session := terminal.GetTerminalSession(username, terminalID)
+	if session == nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Terminal session not found"})
+		return
+	}
+	
+	contents := session.Buffer.Contents(r.URL.Query().Get("scrollback") == "1")
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(contents.Text()))
+		return
+	}
+	
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Terminal screen retrieved",
+		Data: struct {
+			vt.Contents
+			Text string `json:"text"`
+		}{contents, contents.Text()},
+	})
+}
+
+// TerminalOutputHandler 返回会话输出流中[from, to)范围内的原始输出，from默认为最早仍保留的输出，
+// to默认为当前末尾，单次最多返回4MB。format=raw时直接返回输出，范围放在响应头中
+func TerminalOutputHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+	
+	from, err := parseOffset(r, "from")
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid parameter: from"})
+		return
+	}
+	to, err := parseOffset(r, "to")
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid parameter: to"})
+		return
+	}
+	
+	output, err := terminal.ReadOutput(username, r.PathValue("id"), from, to)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+	
+	if r.URL.Query().Get("format") == "raw" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Output-From", strconv.FormatInt(output.From, 10))
+		w.Header().Set("X-Output-To", strconv.FormatInt(output.To, 10))
+		w.Header().Set("X-Output-Start", strconv.FormatInt(output.Start, 10))
+		w.Header().Set("X-Output-End", strconv.FormatInt(output.End, 10))
+		w.Write(output.Data)
+		return
+	}
+	
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Terminal output retrieved",
+		Data:    output,
+	})
+}
+
+// parseOffset 解析输出流偏移参数，未指定时返回-1
+func parseOffset(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return -1, nil
+	}
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err == nil && offset < 0 {
+		err = strconv.ErrRange
+	}
+	return offset, err
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ghosteye/database"
+	"ghosteye/hosts"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// HostsHandler 列出用户的主机清单及关联的会话
+func HostsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	list, err := database.GetHosts(username)
+	if err != nil {
+		log.Printf("Failed to get hosts: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get hosts"})
+		return
+	}
+
+	sessions, err := database.GetHostSessions(username, 0)
+	if err != nil {
+		log.Printf("Failed to get host sessions: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get host sessions"})
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(list))
+	for _, host := range list {
+		hostSessions := sessions[host.ID]
+		if hostSessions == nil {
+			hostSessions = []map[string]interface{}{}
+		}
+		result = append(result, map[string]interface{}{
+			"host":     host,
+			"sessions": hostSessions,
+		})
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Hosts retrieved",
+		Data:    result,
+	})
+}
+
+// DeleteHostHandler 删除主机，关联的会话保留但不再指向该主机
+func DeleteHostHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid host ID"})
+		return
+	}
+
+	if err := database.DeleteHost(username, id); err != nil {
+		log.Printf("Failed to delete host: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "Host deleted"})
+}
+
+// ProbeHostHandler 在活跃会话中手动执行主机探测
+func ProbeHostHandler(w http.ResponseWriter, r *http.Request) {
+	username, terminalID, session, ok := streamSession(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	host, err := hosts.Probe(username, terminalID, session)
+	if err != nil {
+		log.Printf("Failed to probe host of terminal session %s: %v", terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Host probed",
+		Data:    host,
+	})
+}
+
+// ProbeStepsHandler 列出主机探测命令，os参数可选
+func ProbeStepsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	steps, err := database.GetProbeSteps(r.URL.Query().Get("os"))
+	if err != nil {
+		log.Printf("Failed to get probe steps: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get probe steps"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Probe steps retrieved",
+		Data:    steps,
+	})
+}
+
+// SaveProbeStepHandler 添加或修改主机探测命令，内置命令可以修改和停用
+func SaveProbeStepHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var step models.ProbeStep
+	if err := json.NewDecoder(r.Body).Decode(&step); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	if step.Name == "" || step.Command == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Name and command are required"})
+		return
+	}
+	if step.OS != models.OSLinux && step.OS != models.OSWindows {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Unsupported os: " + step.OS})
+		return
+	}
+
+	if err := database.SaveProbeStep(step); err != nil {
+		log.Printf("Failed to save probe step: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to save probe step"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "Probe step saved"})
+}
+
+// DeleteProbeStepHandler 删除自定义主机探测命令
+func DeleteProbeStepHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	query := r.URL.Query()
+	if err := database.DeleteProbeStep(query.Get("name"), query.Get("os")); err != nil {
+		log.Printf("Failed to delete probe step: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "Probe step deleted"})
+}
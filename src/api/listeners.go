@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	
+	"ghosteye/certs"
+	"ghosteye/database"
+	"ghosteye/listener"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/payloads"
+	"ghosteye/utils"
+)
+
+// ListListenersHandler 列出用户的监听器
+func ListListenersHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	records, err := database.GetUserListeners(username)
+	if err != nil {
+		log.Printf("Failed to get user listeners: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get listeners"})
+		return
+	}
+
+	listeners := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		// 以内存中的监听器为准判断是否在运行
+		running := false
+		fingerprint := ""
+		if l := listener.GetListener(record.ListenerID); l != nil {
+			running = true
+			fingerprint = l.Fingerprint
+		}
+
+		listeners = append(listeners, map[string]interface{}{
+			"listener_id": record.ListenerID,
+			"bind_addr":   record.BindAddr,
+			"port":        record.Port,
+			"multi":       record.Multi,
+			"protocol":    record.Protocol,
+			"fingerprint": fingerprint,
+			"accepted":    record.Accepted,
+			"running":     running,
+			"created_at":  record.CreatedAt,
+		})
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Listeners retrieved",
+		Data:    listeners,
+	})
+}
+
+// CreateListenerHandler 创建并启动监听器
+func CreateListenerHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		BindAddr string   `json:"bind_addr"`
+		Port     int      `json:"port"`
+		Multi    bool     `json:"multi"`
+		Protocol string   `json:"protocol"`
+		Hosts    []string `json:"hosts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	// 验证参数
+	if req.Port == 0 {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Port is required"})
+		return
+	}
+
+	l, err := listener.StartListener(username, req.BindAddr, req.Port, req.Multi, req.Protocol, req.Hosts)
+	if err != nil {
+		log.Printf("Failed to start listener: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Listener started",
+		Data: map[string]interface{}{
+			"listener_id": l.ID,
+			"bind_addr":   l.BindAddr,
+			"port":        l.Port,
+			"multi":       l.Multi,
+			"protocol":    l.Protocol,
+			"fingerprint": l.Fingerprint,
+		},
+	})
+}
+
+// StopListenerHandler 停止监听器
+func StopListenerHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	listenerID := r.URL.Query().Get("listener_id")
+	if listenerID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: listener_id"})
+		return
+	}
+
+	if err := listener.StopListener(username, listenerID); err != nil {
+		log.Printf("Failed to stop listener: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Listener stopped",
+	})
+}
+
+// DeleteListenerHandler 停止并删除监听器记录
+func DeleteListenerHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	listenerID := r.URL.Query().Get("listener_id")
+	if listenerID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: listener_id"})
+		return
+	}
+
+	// 如果仍在运行，先停止
+	if l := listener.GetListener(listenerID); l != nil {
+		listener.StopListener(username, listenerID)
+	}
+
+	if err := database.DeleteListener(username, listenerID); err != nil {
+		log.Printf("Failed to delete listener: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	// 删除监听器证书
+	if err := certs.DeleteListenerCertificate(listenerID); err != nil {
+		log.Printf("Failed to delete listener certificate: %v", err)
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Listener deleted",
+	})
+}
+
+// ListenerSessionsHandler 列出监听器产生的终端会话
+func ListenerSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	listenerID := r.URL.Query().Get("listener_id")
+	if listenerID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: listener_id"})
+		return
+	}
+
+	sessions, err := database.GetListenerTerminalSessions(username, listenerID)
+	if err != nil {
+		log.Printf("Failed to get listener terminal sessions: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get listener sessions"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Listener sessions retrieved",
+		Data:    sessions,
+	})
+}
+
+// ListenerPayloadsHandler 使用监听器的端口和协议生成客户端命令
+func ListenerPayloadsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	listenerID := r.URL.Query().Get("listener_id")
+	if listenerID == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: listener_id"})
+		return
+	}
+
+	record, err := database.GetListener(listenerID)
+	if err != nil || record == nil || record.Username != username {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Listener does not exist"})
+		return
+	}
+
+	lhost := r.URL.Query().Get("lhost")
+	if lhost == "" {
+		lhost = defaultLHost(r, record.BindAddr)
+	}
+
+	result, err := payloads.ForListener(record, lhost, r.URL.Query().Get("platform"))
+	if err != nil {
+		log.Printf("Failed to generate payloads: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payloads generated",
+		Data:    result,
+	})
+}
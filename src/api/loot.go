@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ghosteye/database"
+	"ghosteye/loot"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/terminal"
+	"ghosteye/utils"
+)
+
+// LootHandler 搜索用户的战利品，支持q、type、tag、host_id和terminal_id参数
+func LootHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.LootFilter{
+		Query:      query.Get("q"),
+		Type:       query.Get("type"),
+		Tag:        query.Get("tag"),
+		TerminalID: query.Get("terminal_id"),
+	}
+	if hostID := query.Get("host_id"); hostID != "" {
+		id, err := strconv.ParseInt(hostID, 10, 64)
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid host ID"})
+			return
+		}
+		filter.HostID = id
+	}
+
+	entries, err := database.SearchLoot(username, filter)
+	if err != nil {
+		log.Printf("Failed to search loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to search loot"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Loot retrieved",
+		Data:    entries,
+	})
+}
+
+// AddLootHandler 手动添加战利品
+func AddLootHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var entry models.Loot
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	entry.Username = username
+
+	saved, err := loot.Add(&entry)
+	if err != nil {
+		log.Printf("Failed to add loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Loot added",
+		Data:    saved,
+	})
+}
+
+// UpdateLootHandler 修改战利品
+func UpdateLootHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	// 只覆盖请求中出现的字段，未提交的来源和输出片段保持不变
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	existing, err := database.GetLoot(username, req.ID)
+	if err != nil {
+		log.Printf("Failed to get loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get loot"})
+		return
+	}
+	if existing == nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Loot not found"})
+		return
+	}
+
+	entry := *existing
+	if err := json.Unmarshal(body, &entry); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	entry.ID = existing.ID
+	entry.Username = username
+
+	if err := loot.Normalize(&entry); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+	if err := database.UpdateLoot(&entry); err != nil {
+		log.Printf("Failed to update loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	saved, err := database.GetLoot(username, entry.ID)
+	if err != nil {
+		log.Printf("Failed to get loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get loot"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Loot updated",
+		Data:    saved,
+	})
+}
+
+// DeleteLootHandler 删除战利品
+func DeleteLootHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid loot ID"})
+		return
+	}
+
+	if err := database.DeleteLoot(username, id); err != nil {
+		log.Printf("Failed to delete loot: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{Code: 0, Message: "Loot deleted"})
+}
+
+// SessionLootHandler 将会话输出缓冲区中选中的区域保存为战利品
+func SessionLootHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	terminalID := r.PathValue("id")
+	session := terminal.GetTerminalSession(username, terminalID)
+	if session == nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Terminal session not found"})
+		return
+	}
+
+	var req struct {
+		models.Loot
+		Region loot.Region `json:"region"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+
+	saved, err := loot.FromSession(username, terminalID, session, &req.Loot, req.Region)
+	if err != nil {
+		log.Printf("Failed to save loot from terminal session %s: %v", terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Loot added",
+		Data:    saved,
+	})
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ghosteye/database"
+	"ghosteye/middleware"
+	"ghosteye/models"
+)
+
+// TestMain 在临时目录中初始化数据库
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "api-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// response 接口返回的JSON
+type response struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// call 以username的身份调用接口，pathID不为空时作为路径中的{id}
+func call(t *testing.T, handler http.HandlerFunc, username, method, target, pathID, body string) response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if pathID != "" {
+		req.SetPathValue("id", pathID)
+	}
+	req = middleware.SetUsernameInContext(req, username)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: %d %q", method, target, w.Code, w.Body.String())
+	}
+	return resp
+}
+
+// addLoot 通过接口为username添加战利品
+func addLoot(t *testing.T, username, body string) models.Loot {
+	t.Helper()
+
+	resp := call(t, AddLootHandler, username, http.MethodPost, "/api/loot/add", "", body)
+	var l models.Loot
+	if resp.Code != 0 || json.Unmarshal(resp.Data, &l) != nil {
+		t.Fatalf("add loot: %+v", resp)
+	}
+	return l
+}
+
+// searchLoot 通过接口查询username的战利品
+func searchLoot(t *testing.T, username, query string) []models.Loot {
+	t.Helper()
+
+	resp := call(t, LootHandler, username, http.MethodGet, "/api/loot?"+query, "", "")
+	var entries []models.Loot
+	if resp.Code != 0 || json.Unmarshal(resp.Data, &entries) != nil {
+		t.Fatalf("search loot: %+v", resp)
+	}
+	return entries
+}
+
+func TestLootOwnership(t *testing.T) {
+	l := addLoot(t, "alice", `{"type":"password","account":"root","secret":"hunter2","tags":["ssh"," ssh ","db,prod"]}`)
+	if l.Username != "alice" || strings.Join(l.Tags, "|") != "ssh|db prod" {
+		t.Fatalf("added loot = %+v", l)
+	}
+	id := strconv.FormatInt(l.ID, 10)
+
+	// 请求中的用户名被忽略
+	forged := addLoot(t, "alice", `{"type":"hash","username":"bob","secret":"x"}`)
+	if forged.Username != "alice" {
+		t.Errorf("loot was added for %s", forged.Username)
+	}
+
+	if entries := searchLoot(t, "bob", "q=hunter2"); len(entries) != 0 {
+		t.Errorf("bob found alice's loot: %+v", entries)
+	}
+	if entries := searchLoot(t, "alice", "q=hunter2"); len(entries) != 1 || entries[0].ID != l.ID {
+		t.Errorf("alice's search = %+v", entries)
+	}
+
+	resp := call(t, UpdateLootHandler, "bob", http.MethodPost, "/api/loot/update", "", `{"id":`+id+`,"secret":"owned"}`)
+	if resp.Code == 0 {
+		t.Errorf("bob updated alice's loot: %+v", resp)
+	}
+	resp = call(t, DeleteLootHandler, "bob", http.MethodPost, "/api/loot/delete?id="+id, "", "")
+	if resp.Code == 0 {
+		t.Errorf("bob deleted alice's loot: %+v", resp)
+	}
+	if saved, err := database.GetLoot("alice", l.ID); err != nil || saved == nil || saved.Secret != "hunter2" {
+		t.Fatalf("alice's loot after bob's requests = %+v, %v", saved, err)
+	}
+
+	// 修改只覆盖提交的字段
+	resp = call(t, UpdateLootHandler, "alice", http.MethodPost, "/api/loot/update", "", `{"id":`+id+`,"notes":"reused on db01"}`)
+	var updated models.Loot
+	if resp.Code != 0 || json.Unmarshal(resp.Data, &updated) != nil {
+		t.Fatalf("update loot: %+v", resp)
+	}
+	if updated.Notes != "reused on db01" || updated.Secret != "hunter2" || updated.Account != "root" {
+		t.Errorf("updated loot = %+v", updated)
+	}
+
+	resp = call(t, DeleteLootHandler, "alice", http.MethodPost, "/api/loot/delete?id="+id, "", "")
+	if resp.Code != 0 {
+		t.Fatalf("delete loot: %+v", resp)
+	}
+	if saved, _ := database.GetLoot("alice", l.ID); saved != nil {
+		t.Error("loot was not deleted")
+	}
+}
+
+func TestLootSourceOwnership(t *testing.T) {
+	transferID, err := database.StartFileTransfer("bob", "bobterm", "download", "base64", "/etc/shadow", 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不能引用其他用户的下载记录
+	resp := call(t, AddLootHandler, "alice", http.MethodPost, "/api/loot/add", "", fmt.Sprintf(`{"type":"file","transfer_id":%d}`, transferID))
+	if resp.Code == 0 {
+		t.Errorf("alice referenced bob's transfer: %+v", resp)
+	}
+	l := addLoot(t, "bob", fmt.Sprintf(`{"type":"file","transfer_id":%d}`, transferID))
+	if l.Secret != "/etc/shadow" || l.TerminalID != "bobterm" {
+		t.Errorf("file loot = %+v", l)
+	}
+
+	// 会话的主机按会话所属用户查找
+	if err := database.SaveTerminalSessionToDB("bob", "shared", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetTerminalSessionHost("bob", "shared", 42); err != nil {
+		t.Fatal(err)
+	}
+	if l := addLoot(t, "alice", `{"type":"token","secret":"t","terminal_id":"shared"}`); l.HostID != 0 {
+		t.Errorf("alice's loot took host %d from bob's session", l.HostID)
+	}
+	if l := addLoot(t, "bob", `{"type":"token","secret":"t","terminal_id":"shared"}`); l.HostID != 42 {
+		t.Errorf("bob's loot host = %d, want 42", l.HostID)
+	}
+}
+
+func TestSessionLoot(t *testing.T) {
+	session := &models.TerminalSession{ID: "loot01", Buffer: models.OutputBuffer{Max: 4096}}
+	session.Buffer.Data = []byte("$ cat .env\r\nDB_PASSWORD=s3cret\r\n$ ")
+	models.TerminalSessionsMux.Lock()
+	models.TerminalSessions["alice"] = map[string]*models.TerminalSession{"loot01": session}
+	models.TerminalSessionsMux.Unlock()
+	defer func() {
+		models.TerminalSessionsMux.Lock()
+		delete(models.TerminalSessions, "alice")
+		models.TerminalSessionsMux.Unlock()
+	}()
+
+	body := `{"type":"password","account":"db","region":{"lines":2}}`
+	if resp := call(t, SessionLootHandler, "bob", http.MethodPost, "/api/terminals/loot01/loot", "loot01", body); resp.Code == 0 {
+		t.Errorf("bob saved loot from alice's session: %+v", resp)
+	}
+	if entries := searchLoot(t, "bob", "terminal_id=loot01"); len(entries) != 0 {
+		t.Errorf("bob has loot from alice's session: %+v", entries)
+	}
+
+	resp := call(t, SessionLootHandler, "alice", http.MethodPost, "/api/terminals/loot01/loot", "loot01", body)
+	var l models.Loot
+	if resp.Code != 0 || json.Unmarshal(resp.Data, &l) != nil {
+		t.Fatalf("session loot: %+v", resp)
+	}
+	if l.Secret != "DB_PASSWORD=s3cret\n$" || l.TerminalID != "loot01" || l.Username != "alice" {
+		t.Errorf("session loot = %+v", l)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ghosteye/database"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/oob"
+	"ghosteye/utils"
+)
+
+// defaultHitLimit 默认返回的交互记录条数
+const defaultHitLimit = 100
+
+// OOBTokensHandler 列出用户的带外交互令牌及示例命令，host参数为目标主机访问GhostEye使用的地址
+func OOBTokensHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	tokens, err := database.GetOOBTokens(username)
+	if err != nil {
+		log.Printf("Failed to get OOB tokens: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get OOB tokens"})
+		return
+	}
+
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		host = defaultLHost(r, "")
+	}
+	for _, token := range tokens {
+		token["examples"] = oob.Examples(token["token"].(string), host)
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "OOB tokens retrieved",
+		Data:    tokens,
+	})
+}
+
+// CreateOOBTokenHandler 创建带外交互令牌
+func CreateOOBTokenHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var req struct {
+		Label string `json:"label"`
+		Host  string `json:"host"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return
+	}
+	if req.Host == "" {
+		req.Host = defaultLHost(r, "")
+	}
+
+	token, err := oob.CreateToken(username, req.Label)
+	if err != nil {
+		log.Printf("Failed to create OOB token: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "OOB token created",
+		Data: map[string]interface{}{
+			"token":    token,
+			"label":    req.Label,
+			"examples": oob.Examples(token, req.Host),
+		},
+	})
+}
+
+// DeleteOOBTokenHandler 删除带外交互令牌及其记录
+func DeleteOOBTokenHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: token"})
+		return
+	}
+
+	if err := database.DeleteOOBToken(username, token); err != nil {
+		log.Printf("Failed to delete OOB token: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "OOB token deleted",
+	})
+}
+
+// OOBHitsHandler 获取带外交互记录，可通过token筛选，limit限制条数
+func OOBHitsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultHitLimit
+	}
+
+	hits, err := database.GetOOBHits(username, r.URL.Query().Get("token"), limit)
+	if err != nil {
+		log.Printf("Failed to get OOB hits: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get OOB hits"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "OOB hits retrieved",
+		Data:    hits,
+	})
+}
+
+// ClearOOBHitsHandler 清空带外交互记录，token为空时清空所有令牌的记录
+func ClearOOBHitsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	if err := database.ClearOOBHits(username, r.URL.Query().Get("token")); err != nil {
+		log.Printf("Failed to clear OOB hits: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "OOB hits cleared",
+	})
+}
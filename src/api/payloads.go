@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"ghosteye/database"
+	"ghosteye/encoder"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/payloads"
+	"ghosteye/utils"
+)
+
+// PayloadsHandler 生成反弹Shell命令。
+// 指定listener_id时使用监听器的端口和协议，否则使用lport和protocol参数；lhost缺省时取监听器绑定地址或面板访问地址；
+// encode参数为编码流水线，例如 "bash-b64|url"
+func PayloadsHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	query := r.URL.Query()
+	target := payloads.Target{
+		LHost:    query.Get("lhost"),
+		Protocol: query.Get("protocol"),
+	}
+
+	if listenerID := query.Get("listener_id"); listenerID != "" {
+		record, err := database.GetListener(listenerID)
+		if err != nil || record == nil || record.Username != username {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Listener does not exist"})
+			return
+		}
+		target.ListenerID = record.ListenerID
+		target.LPort = record.Port
+		target.Protocol = record.Protocol
+		if target.LHost == "" {
+			target.LHost = defaultLHost(r, record.BindAddr)
+		}
+	} else {
+		port, err := strconv.Atoi(query.Get("lport"))
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: listener_id or lport"})
+			return
+		}
+		target.LPort = port
+		if target.LHost == "" {
+			target.LHost = defaultLHost(r, "")
+		}
+	}
+
+	result, err := payloads.Generate(target, query.Get("platform"))
+	if err != nil {
+		log.Printf("Failed to generate payloads: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	// encode参数指定的编码流水线应用到每条命令
+	if text := query.Get("encode"); text != "" {
+		pipeline, err := encoder.Parse(text)
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+			return
+		}
+		for i := range result {
+			if result[i].Command, err = pipeline.Apply(result[i].Command); err != nil {
+				utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+				return
+			}
+		}
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payloads generated",
+		Data:    result,
+	})
+}
+
+// PayloadTemplatesHandler 列出命令模板及可用变量
+func PayloadTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	templates, err := database.GetPayloadTemplates(r.URL.Query().Get("protocol"))
+	if err != nil {
+		log.Printf("Failed to get payload templates: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get payload templates"})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payload templates retrieved",
+		Data: map[string]interface{}{
+			"templates": templates,
+			"variables": payloads.Variables,
+		},
+	})
+}
+
+// AddPayloadTemplateHandler 添加自定义命令模板
+func AddPayloadTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	template, ok := decodePayloadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := database.AddPayloadTemplate(username, template); err != nil {
+		log.Printf("Failed to add payload template: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payload template added",
+	})
+}
+
+// UpdatePayloadTemplateHandler 更新自定义命令模板，内置模板不可修改
+func UpdatePayloadTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	template, ok := decodePayloadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := database.UpdatePayloadTemplate(username, template); err != nil {
+		log.Printf("Failed to update payload template: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payload template updated",
+	})
+}
+
+// DeletePayloadTemplateHandler 删除自定义命令模板，内置模板不可删除
+func DeletePayloadTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: name"})
+		return
+	}
+
+	if err := database.DeletePayloadTemplate(username, name); err != nil {
+		log.Printf("Failed to delete payload template: %v", err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "Payload template deleted",
+	})
+}
+
+// decodePayloadTemplate 解析并校验请求体中的命令模板，失败时写入错误响应
+func decodePayloadTemplate(w http.ResponseWriter, r *http.Request) (models.PayloadTemplate, bool) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return models.PayloadTemplate{}, false
+	}
+
+	var template models.PayloadTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid request format"})
+		return template, false
+	}
+	if template.Platform == "" {
+		template.Platform = models.OSLinux
+	}
+	if template.Protocol == "" {
+		template.Protocol = payloads.ProtocolTCP
+	}
+
+	if err := payloads.Validate(template); err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return template, false
+	}
+	return template, true
+}
+
+// defaultLHost 返回默认的回连地址：监听器绑定了具体地址时使用该地址，否则使用访问面板的主机名
+func defaultLHost(r *http.Request, bindAddr string) string {
+	if ip := net.ParseIP(bindAddr); ip != nil && !ip.IsUnspecified() {
+		return bindAddr
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"ghosteye/database"
+	"ghosteye/middleware"
+	"ghosteye/models"
+	"ghosteye/terminal"
+	"ghosteye/utils"
+)
+
+// streamSession 根据路径中的终端ID获取活跃会话，并按os参数设置目标系统，失败时写入错误响应
+func streamSession(w http.ResponseWriter, r *http.Request) (string, string, *models.TerminalSession, bool) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return "", "", nil, false
+	}
+
+	terminalID := r.PathValue("id")
+	session := terminal.GetTerminalSession(username, terminalID)
+	if session == nil || session.Backend == nil || !session.Active {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Terminal session is not active"})
+		return "", "", nil, false
+	}
+
+	switch os := r.URL.Query().Get("os"); os {
+	case models.OSLinux, models.OSWindows:
+		session.OS = os
+	case "":
+	default:
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Unsupported os: " + os})
+		return "", "", nil, false
+	}
+
+	return username, terminalID, session, true
+}
+
+// StreamUploadHandler 通过终端流将文件写入会话所在主机，适用于任意活跃会话包括原始反弹Shell
+func StreamUploadHandler(w http.ResponseWriter, r *http.Request) {
+	username, terminalID, session, ok := streamSession(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	remotePath := r.URL.Query().Get("path")
+	if remotePath == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: path"})
+		return
+	}
+
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing form field: file"})
+			return
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to read upload"})
+		return
+	}
+
+	transfer, err := terminal.UploadFile(username, terminalID, session, remotePath, data)
+	if err != nil {
+		log.Printf("Failed to upload %s via terminal session %s: %v", remotePath, terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "File uploaded",
+		Data:    transfer,
+	})
+}
+
+// StreamDownloadHandler 通过终端流从会话所在主机下载文件并保存到服务端，
+// 可通过resume参数指定未完成的传输记录ID继续下载
+func StreamDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	username, terminalID, session, ok := streamSession(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
+		return
+	}
+
+	var resumeID int64
+	if resume := r.URL.Query().Get("resume"); resume != "" {
+		id, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || id <= 0 {
+			utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid parameter: resume"})
+			return
+		}
+		resumeID = id
+	}
+
+	remotePath := r.URL.Query().Get("path")
+	if remotePath == "" && resumeID == 0 {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Missing parameter: path"})
+		return
+	}
+
+	transfer, err := terminal.DownloadFile(username, terminalID, session, remotePath, resumeID)
+	if err != nil {
+		log.Printf("Failed to download %s via terminal session %s: %v", remotePath, terminalID, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: err.Error()})
+		return
+	}
+
+	utils.WriteJSON(w, models.Response{
+		Code:    0,
+		Message: "File downloaded",
+		Data: map[string]interface{}{
+			"transfer": transfer,
+			"url":      fmt.Sprintf("/api/transfers/%s/file", transfer.ID),
+		},
+	})
+}
+
+// TransferFileHandler 返回已完成下载的文件内容
+func TransferFileHandler(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsernameFromContext(r)
+	if username == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Invalid transfer ID"})
+		return
+	}
+
+	record, err := database.GetFileTransfer(username, id)
+	if err != nil {
+		log.Printf("Failed to get file transfer %d: %v", id, err)
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Failed to get file transfer"})
+		return
+	}
+	if record == nil || record["local_path"] == "" {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "File not found"})
+		return
+	}
+	if record["status"] != database.TransferComplete {
+		utils.WriteJSON(w, models.Response{Code: 1, Message: "Transfer is not complete"})
+		return
+	}
+
+	remotePath := record["remote_path"].(string)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(strings.ReplaceAll(remotePath, "\\", "/"))))
+	w.Header().Set("X-Content-SHA256", record["sha256"].(string))
+	http.ServeFile(w, r, record["local_path"].(string))
+}
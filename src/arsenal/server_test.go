@@ -0,0 +1,217 @@
+package arsenal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/models"
+)
+
+// TestMain 在临时目录中初始化数据库，托管文件也保存在其中
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "arsenal-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// saveFile 保存alice的测试文件
+func saveFile(t *testing.T) *models.ArsenalFile {
+	t.Helper()
+
+	file, err := SaveFile("alice", "../tools/linpeas.sh", "linux", "amd64", "", strings.NewReader("#!/bin/sh\necho hi\n"))
+	if err != nil {
+		t.Fatalf("SaveFile: %v", err)
+	}
+	return file
+}
+
+// fetch 以remoteIP为来源请求下载链接
+func fetch(t *testing.T, method, token, remoteIP string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/"+token+"/linpeas.sh", nil)
+	req.RemoteAddr = remoteIP + ":40000"
+	w := httptest.NewRecorder()
+	serveLink(w, req)
+	return w
+}
+
+// statuses 返回链接的下载日志中的结果，按时间顺序
+func statuses(t *testing.T, token string) []string {
+	t.Helper()
+
+	downloads, err := database.GetArsenalDownloads("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for i := len(downloads) - 1; i >= 0; i-- {
+		if downloads[i]["token"] == token {
+			result = append(result, downloads[i]["status"].(string))
+		}
+	}
+	return result
+}
+
+func TestServeLink(t *testing.T) {
+	file := saveFile(t)
+	if file.Name != "linpeas.sh" || file.Size != 18 {
+		t.Fatalf("saved file = %+v", file)
+	}
+
+	t.Run("served", func(t *testing.T) {
+		link, _, err := CreateLink("alice", file.ID, false, time.Hour, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			w := fetch(t, http.MethodGet, link.Token, "203.0.113.5")
+			if body, _ := io.ReadAll(w.Body); w.Code != http.StatusOK || string(body) != "#!/bin/sh\necho hi\n" {
+				t.Fatalf("fetch %d: %d %q", i, w.Code, body)
+			}
+		}
+		if got := statuses(t, link.Token); strings.Join(got, ",") != "served,served" {
+			t.Errorf("download log = %v", got)
+		}
+	})
+
+	t.Run("one time", func(t *testing.T) {
+		link, _, err := CreateLink("alice", file.ID, true, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// HEAD不占用一次性链接
+		if w := fetch(t, http.MethodHead, link.Token, "203.0.113.5"); w.Code != http.StatusOK {
+			t.Fatalf("HEAD: %d", w.Code)
+		}
+		if w := fetch(t, http.MethodGet, link.Token, "203.0.113.5"); w.Code != http.StatusOK {
+			t.Fatalf("first fetch: %d", w.Code)
+		}
+		if w := fetch(t, http.MethodGet, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("second fetch: %d, want 404", w.Code)
+		}
+		if w := fetch(t, http.MethodHead, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("HEAD after use: %d, want 404", w.Code)
+		}
+		if got := statuses(t, link.Token); strings.Join(got, ",") != "served,used" {
+			t.Errorf("download log = %v", got)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		link := &models.ArsenalLink{Token: "expired-token", FileID: file.ID, Username: "alice", ExpiresAt: time.Now().Add(-time.Second).Unix()}
+		if err := database.AddArsenalLink(link); err != nil {
+			t.Fatal(err)
+		}
+		if w := fetch(t, http.MethodGet, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("fetch: %d, want 404", w.Code)
+		}
+		if got := statuses(t, link.Token); strings.Join(got, ",") != StatusExpired {
+			t.Errorf("download log = %v", got)
+		}
+	})
+
+	t.Run("allowed ips", func(t *testing.T) {
+		link, _, err := CreateLink("alice", file.ID, true, 0, []string{"10.0.0.0/8", " 203.0.113.5 ", ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ip := range []string{"198.51.100.1", "203.0.113.6", "11.0.0.1"} {
+			if w := fetch(t, http.MethodGet, link.Token, ip); w.Code != http.StatusNotFound {
+				t.Errorf("fetch from %s: %d, want 404", ip, w.Code)
+			}
+		}
+		// 被拒绝的请求不占用一次性链接
+		if w := fetch(t, http.MethodGet, link.Token, "10.1.2.3"); w.Code != http.StatusOK {
+			t.Errorf("fetch from allowed CIDR: %d", w.Code)
+		}
+		if got := statuses(t, link.Token); strings.Join(got, ",") != "forbidden,forbidden,forbidden,served" {
+			t.Errorf("download log = %v", got)
+		}
+
+		if _, _, err := CreateLink("alice", file.ID, false, 0, []string{"not-an-ip"}); err == nil {
+			t.Error("invalid allowed IP was accepted")
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		link, _, err := CreateLink("alice", file.ID, false, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.RevokeArsenalLink("bob", link.Token); err == nil {
+			t.Error("bob revoked alice's link")
+		}
+		if err := database.RevokeArsenalLink("alice", link.Token); err != nil {
+			t.Fatal(err)
+		}
+		if w := fetch(t, http.MethodGet, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("fetch: %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		if w := fetch(t, http.MethodGet, "unknown", "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("unknown token: %d", w.Code)
+		}
+		link, _, _ := CreateLink("alice", file.ID, false, 0, nil)
+		if w := fetch(t, http.MethodPost, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+			t.Errorf("POST: %d", w.Code)
+		}
+	})
+}
+
+func TestOwnership(t *testing.T) {
+	file := saveFile(t)
+
+	if _, _, err := CreateLink("bob", file.ID, false, 0, nil); err == nil {
+		t.Error("bob created a link for alice's file")
+	}
+	if err := DeleteFile("bob", file.ID); err == nil {
+		t.Error("bob deleted alice's file")
+	}
+	if _, err := os.Stat(file.Path); err != nil {
+		t.Fatalf("file was removed: %v", err)
+	}
+
+	link, _, err := CreateLink("alice", file.ID, false, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFile("alice", file.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+		t.Errorf("file was not removed: %v", err)
+	}
+	// 删除文件后链接失效
+	if w := fetch(t, http.MethodGet, link.Token, "203.0.113.5"); w.Code != http.StatusNotFound {
+		t.Errorf("fetch after delete: %d", w.Code)
+	}
+}
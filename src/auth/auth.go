@@ -33,27 +33,32 @@ func ValidateSessionToken(token string) (string, bool) {
 	return ValidateToken(token)
 }
 
-// RemoveToken 删除会话token
-func RemoveToken(token string) {
+// GetTokens 获取所有会话token的副本，升级时移交给新进程
+func GetTokens() map[string]string {
 	models.SessionTokensMux.Lock()
 	defer models.SessionTokensMux.Unlock()
 	
-	delete(models.SessionTokens, token)
+	tokens := make(map[string]string, len(models.SessionTokens))
+	for token, username := range models.SessionTokens {
+		tokens[token] = username
+	}
+	return tokens
 }
 
-// GetUserState 获取用户状态
-func GetUserState(username string) *models.UserState {
-	models.UserStatesMux.Lock()
-	defer models.UserStatesMux.Unlock()
+// RestoreTokens 恢复升级前的会话token，已登录的浏览器无需重新登录
+func RestoreTokens(tokens map[string]string) {
+	models.SessionTokensMux.Lock()
+	defer models.SessionTokensMux.Unlock()
 	
-	userState, exists := models.UserStates[username]
-	if !exists {
-		userState = &models.UserState{
-			IsRunning: false,
-			Command:   "",
-		}
-		models.UserStates[username] = userState
+	for token, username := range tokens {
+		models.SessionTokens[token] = username
 	}
+}
+
+// RemoveToken 删除会话token
+func RemoveToken(token string) {
+	models.SessionTokensMux.Lock()
+	defer models.SessionTokensMux.Unlock()
 	
-	return userState
-} 
\ No newline at end of file
+	delete(models.SessionTokens, token)
+}
@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrUnsupported 后端不支持该操作
+var ErrUnsupported = errors.New("Operation not supported by backend")
+
+// Backend 终端会话后端，WebSocket、缓冲和持久化层只通过该接口与本地PTY、管道、TCP、SSH等实现交互
+type Backend interface {
+	io.ReadWriteCloser
+
+	// Resize 调整远端终端窗口大小，不支持时返回ErrUnsupported
+	Resize(cols, rows uint16) error
+
+	// Signal 向远端进程发送信号，不支持时返回ErrUnsupported
+	Signal(sig os.Signal) error
+
+	// ExitStatus 返回进程退出码，进程未退出或无法获知时exited为false
+	ExitStatus() (code int, exited bool)
+
+	// TTY 远端是否有终端驱动处理回显和回车
+	TTY() bool
+}
+
+// Detachable 底层为单个文件描述符的后端，可以交给会话保持进程在GhostEye重启期间保持连接
+type Detachable interface {
+	Backend
+
+	// SyscallConn 返回底层文件描述符，不支持时返回ErrUnsupported
+	SyscallConn() (syscall.RawConn, error)
+
+	// SetReadDeadline 设置读取超时，移交描述符前用于停止读取
+	SetReadDeadline(t time.Time) error
+}
+
+// Options 创建后端的参数
+type Options map[string]string
+
+// Factory 根据参数创建后端
+type Factory func(opts Options) (Backend, error)
+
+// 已注册的后端
+var (
+	factories    = make(map[string]Factory)
+	factoriesMux sync.RWMutex
+)
+
+// Register 注册后端类型
+func Register(name string, factory Factory) {
+	factoriesMux.Lock()
+	defer factoriesMux.Unlock()
+
+	factories[name] = factory
+}
+
+// New 使用已注册的后端类型创建后端
+func New(name string, opts Options) (Backend, error) {
+	factoriesMux.RLock()
+	factory, exists := factories[name]
+	factoriesMux.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Unknown backend type: %s", name)
+	}
+	if opts == nil {
+		opts = Options{}
+	}
+
+	return factory(opts)
+}
+
+// Names 返回所有已注册的后端类型
+func Names() []string {
+	factoriesMux.RLock()
+	defer factoriesMux.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Get 返回参数值，不存在时使用默认值
+func (o Options) Get(key, def string) string {
+	if value, ok := o[key]; ok && value != "" {
+		return value
+	}
+	return def
+}
+
+// exitState 记录进程退出状态
+type exitState struct {
+	code   int
+	exited bool
+	sync.Mutex
+}
+
+// set 记录退出码
+func (s *exitState) set(code int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.code = code
+	s.exited = true
+}
+
+// get 读取退出码
+func (s *exitState) get() (int, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.code, s.exited
+}
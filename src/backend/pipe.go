@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+func init() {
+	Register("pipe", func(opts Options) (Backend, error) {
+		return NewPipe(exec.Command(opts.Get("command", "/bin/bash")))
+	})
+}
+
+// Pipe 通过标准管道交互的进程，用于无法分配PTY的环境
+type Pipe struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output *io.PipeReader
+	exit   exitState
+}
+
+// NewPipe 以标准管道方式启动命令，标准输出和标准错误合并读取
+func NewPipe(cmd *exec.Cmd) (*Pipe, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	b := &Pipe{cmd: cmd, stdin: stdin, output: r}
+	go func() {
+		b.cmd.Wait()
+		b.exit.set(b.cmd.ProcessState.ExitCode())
+		w.Close()
+	}()
+
+	return b, nil
+}
+
+func (b *Pipe) Read(p []byte) (int, error) {
+	return b.output.Read(p)
+}
+
+func (b *Pipe) Write(p []byte) (int, error) {
+	return b.stdin.Write(p)
+}
+
+// Resize 管道没有窗口大小
+func (b *Pipe) Resize(cols, rows uint16) error {
+	return ErrUnsupported
+}
+
+// Signal 向进程发送信号
+func (b *Pipe) Signal(sig os.Signal) error {
+	if b.cmd.Process == nil {
+		return os.ErrProcessDone
+	}
+	return b.cmd.Process.Signal(sig)
+}
+
+// Close 关闭标准输入和输出
+func (b *Pipe) Close() error {
+	b.output.Close()
+	return b.stdin.Close()
+}
+
+// ExitStatus 返回进程退出码
+func (b *Pipe) ExitStatus() (int, bool) {
+	return b.exit.get()
+}
+
+// TTY 管道没有终端驱动
+func (b *Pipe) TTY() bool {
+	return false
+}
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func init() {
+	Register("local", func(opts Options) (Backend, error) {
+		cols, rows := parseSize(opts)
+		return NewLocalPTY(exec.Command(opts.Get("command", "/bin/bash")), cols, rows)
+	})
+}
+
+// LocalPTY 在本地伪终端中运行的进程
+type LocalPTY struct {
+	cmd     *exec.Cmd
+	process *os.Process
+	ptmx    *os.File
+	exit    exitState
+
+	attached bool // 接管的伪终端，进程不是当前程序的子进程
+}
+
+// NewLocalPTY 在伪终端中启动命令
+func NewLocalPTY(cmd *exec.Cmd, cols, rows uint16) (*LocalPTY, error) {
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: rows, Cols: cols})
+	if err != nil {
+		return nil, err
+	}
+
+	b := &LocalPTY{cmd: cmd, process: cmd.Process, ptmx: ptmx}
+	go b.wait()
+
+	return b, nil
+}
+
+// AttachLocalPTY 接管已有的伪终端主设备，pid为其中运行的进程。
+// 进程不是当前程序的子进程，无法获知退出码。pid来自重启前保存的元数据，
+// 只有它仍是以该伪终端为控制终端的会话首进程时才记录，避免向复用了该pid的无关进程发送信号
+func AttachLocalPTY(ptmx *os.File, pid int) *LocalPTY {
+	b := &LocalPTY{ptmx: ptmx, attached: true}
+	if pid > 0 && ownsPTY(ptmx, pid) {
+		if process, err := os.FindProcess(pid); err == nil {
+			b.process = process
+		}
+	}
+	return b
+}
+
+// ownsPTY pid是否为以ptmx为控制终端的会话首进程
+func ownsPTY(ptmx *os.File, pid int) bool {
+	sid, err := ptySession(ptmx)
+	return err == nil && sid == pid
+}
+
+// Pid 返回伪终端中运行的进程ID，未知时返回0
+func (b *LocalPTY) Pid() int {
+	if b.process == nil {
+		return 0
+	}
+	return b.process.Pid
+}
+
+// SyscallConn 返回伪终端主设备的文件描述符
+func (b *LocalPTY) SyscallConn() (syscall.RawConn, error) {
+	return b.ptmx.SyscallConn()
+}
+
+// SetReadDeadline 设置读取超时
+func (b *LocalPTY) SetReadDeadline(t time.Time) error {
+	return b.ptmx.SetReadDeadline(t)
+}
+
+// wait 回收进程并记录退出码
+func (b *LocalPTY) wait() {
+	b.cmd.Wait()
+	b.exit.set(b.cmd.ProcessState.ExitCode())
+}
+
+func (b *LocalPTY) Read(p []byte) (int, error) {
+	return b.ptmx.Read(p)
+}
+
+func (b *LocalPTY) Write(p []byte) (int, error) {
+	return b.ptmx.Write(p)
+}
+
+// Resize 设置伪终端窗口大小
+func (b *LocalPTY) Resize(cols, rows uint16) error {
+	return pty.Setsize(b.ptmx, &pty.Winsize{Rows: rows, Cols: cols})
+}
+
+// Signal 向进程发送信号。接管的进程在发送前重新确认仍是伪终端的会话首进程，
+// 进程退出后pid可能已被复用
+func (b *LocalPTY) Signal(sig os.Signal) error {
+	if b.process == nil {
+		return os.ErrProcessDone
+	}
+	if b.attached && !ownsPTY(b.ptmx, b.process.Pid) {
+		return os.ErrProcessDone
+	}
+	return b.process.Signal(sig)
+}
+
+// Close 关闭伪终端主设备
+func (b *LocalPTY) Close() error {
+	return b.ptmx.Close()
+}
+
+// ExitStatus 返回进程退出码
+func (b *LocalPTY) ExitStatus() (int, bool) {
+	return b.exit.get()
+}
+
+// TTY 伪终端由内核终端驱动处理
+func (b *LocalPTY) TTY() bool {
+	return true
+}
+
+// parseSize 解析cols和rows参数，缺省为80x24
+func parseSize(opts Options) (uint16, uint16) {
+	cols, err := strconv.ParseUint(opts.Get("cols", "80"), 10, 16)
+	if err != nil || cols == 0 {
+		cols = 80
+	}
+	rows, err := strconv.ParseUint(opts.Get("rows", "24"), 10, 16)
+	if err != nil || rows == 0 {
+		rows = 24
+	}
+	return uint16(cols), uint16(rows)
+}
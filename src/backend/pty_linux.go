@@ -0,0 +1,28 @@
+package backend
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ptySession 返回以伪终端为控制终端的会话ID，对主设备执行TIOCGSID得到从设备所属的会话
+func ptySession(ptmx *os.File) (int, error) {
+	rc, err := ptmx.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var sid int32
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGSID, uintptr(unsafe.Pointer(&sid)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(sid), nil
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startPTY 在伪终端中启动sleep，返回后端和主设备的副本
+func startPTY(t *testing.T) (*LocalPTY, *os.File) {
+	t.Helper()
+
+	b, err := NewLocalPTY(exec.Command("sleep", "30"), 80, 24)
+	if err != nil {
+		t.Fatalf("NewLocalPTY: %v", err)
+	}
+	t.Cleanup(func() {
+		b.process.Kill()
+		b.Close()
+	})
+
+	fd, err := syscall.Dup(int(b.ptmx.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, os.NewFile(uintptr(fd), "ptmx")
+}
+
+func TestAttachLocalPTY(t *testing.T) {
+	b, ptmx := startPTY(t)
+	defer ptmx.Close()
+
+	if sid, err := ptySession(ptmx); err != nil || sid != b.Pid() {
+		t.Fatalf("ptySession = %d, %v; want %d", sid, err, b.Pid())
+	}
+
+	attached := AttachLocalPTY(ptmx, b.Pid())
+	if attached.Pid() != b.Pid() {
+		t.Fatalf("attached pid = %d, want %d", attached.Pid(), b.Pid())
+	}
+	if err := attached.Signal(syscall.SIGKILL); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+	if code, exited := waitExit(b); !exited || code != -1 {
+		t.Errorf("process after SIGKILL: code %d exited %v", code, exited)
+	}
+
+	// 会话首进程退出后不再向该pid发送信号
+	if err := attached.Signal(syscall.SIGKILL); err != os.ErrProcessDone {
+		t.Errorf("Signal after exit = %v, want ErrProcessDone", err)
+	}
+}
+
+func TestAttachLocalPTYForeignPid(t *testing.T) {
+	_, ptmx := startPTY(t)
+	defer ptmx.Close()
+
+	// 元数据中的pid已被与该伪终端无关的进程复用
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Process.Kill()
+
+	attached := AttachLocalPTY(ptmx, other.Process.Pid)
+	if attached.Pid() != 0 {
+		t.Errorf("attached pid = %d for a process that does not own the pty", attached.Pid())
+	}
+	if err := attached.Signal(syscall.SIGKILL); err != os.ErrProcessDone {
+		t.Errorf("Signal = %v, want ErrProcessDone", err)
+	}
+	if err := other.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Errorf("unrelated process was signalled: %v", err)
+	}
+}
+
+// waitExit 等待进程退出并返回退出码
+func waitExit(b *LocalPTY) (int, bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if code, exited := b.ExitStatus(); exited {
+			return code, true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return 0, false
+}
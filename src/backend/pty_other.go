@@ -0,0 +1,14 @@
+//go:build !linux
+
+package backend
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ptySession 其他平台无法从主设备获知会话，接管的进程不会收到信号
+func ptySession(ptmx *os.File) (int, error) {
+	return 0, fmt.Errorf("Cannot query pty session on %s", runtime.GOOS)
+}
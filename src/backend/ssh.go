@@ -0,0 +1,250 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH保活间隔
+const sshKeepAliveInterval = 30 * time.Second
+
+func init() {
+	Register("ssh", func(opts Options) (Backend, error) {
+		port, _ := strconv.Atoi(opts.Get("port", "22"))
+		cols, rows := parseSize(opts)
+		return NewSSH(SSHOptions{
+			Host:       opts.Get("host", ""),
+			Port:       port,
+			User:       opts.Get("user", ""),
+			Password:   opts.Get("password", ""),
+			PrivateKey: opts.Get("private_key", ""),
+			Passphrase: opts.Get("passphrase", ""),
+			Term:       opts.Get("term", ""),
+			Cols:       cols,
+			Rows:       rows,
+		})
+	})
+}
+
+// SSHOptions SSH会话连接参数
+type SSHOptions struct {
+	Host       string // 目标主机
+	Port       int    // 目标端口，默认22
+	User       string // 登录用户名
+	Password   string // 密码，同时用于keyboard-interactive认证
+	PrivateKey string // PEM格式私钥
+	Passphrase string // 私钥密码
+	Term       string // 终端类型，默认xterm-256color
+	Cols       uint16 // 初始终端列数
+	Rows       uint16 // 初始终端行数
+}
+
+// SSH 分配了PTY的SSH Shell会话
+type SSH struct {
+	Addr        string // 目标地址
+	Fingerprint string // 主机密钥SHA256指纹
+
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	exit    exitState
+}
+
+// NewSSH 连接目标主机，请求PTY并启动Shell
+func NewSSH(opts SSHOptions) (*SSH, error) {
+	if opts.Host == "" || opts.User == "" {
+		return nil, fmt.Errorf("Host and user are required")
+	}
+	if opts.Port == 0 {
+		opts.Port = 22
+	}
+	if opts.Term == "" {
+		opts.Term = "xterm-256color"
+	}
+	if opts.Cols == 0 || opts.Rows == 0 {
+		opts.Cols, opts.Rows = 80, 24
+	}
+
+	auth, err := sshAuthMethods(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &SSH{Addr: net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))}
+
+	// 目标多为临时据点，不校验主机密钥，仅记录指纹
+	config := &ssh.ClientConfig{
+		User: opts.User,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			b.Fingerprint = ssh.FingerprintSHA256(key)
+			return nil
+		},
+		Timeout: DialTimeout,
+	}
+
+	b.client, err = ssh.Dial("tcp", b.Addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to %s: %v", b.Addr, err)
+	}
+
+	if err := b.startShell(opts); err != nil {
+		b.client.Close()
+		return nil, err
+	}
+
+	go b.wait()
+	go b.keepAlive()
+
+	return b, nil
+}
+
+// startShell 请求PTY并启动远程Shell
+func (b *SSH) startShell(opts SSHOptions) error {
+	var err error
+	b.session, err = b.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("Failed to create SSH session: %v", err)
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 38400,
+		ssh.TTY_OP_OSPEED: 38400,
+	}
+	if err := b.session.RequestPty(opts.Term, int(opts.Rows), int(opts.Cols), modes); err != nil {
+		return fmt.Errorf("Failed to request PTY: %v", err)
+	}
+
+	b.stdin, err = b.session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("Failed to get SSH stdin: %v", err)
+	}
+	b.stdout, err = b.session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("Failed to get SSH stdout: %v", err)
+	}
+
+	if err := b.session.Shell(); err != nil {
+		return fmt.Errorf("Failed to start remote shell: %v", err)
+	}
+
+	return nil
+}
+
+// wait 等待远程Shell退出并记录退出码
+func (b *SSH) wait() {
+	err := b.session.Wait()
+	if err == nil {
+		b.exit.set(0)
+	} else if exitErr, ok := err.(*ssh.ExitError); ok {
+		b.exit.set(exitErr.ExitStatus())
+	}
+}
+
+// keepAlive 定期发送保活请求，连接失效时关闭客户端以结束会话
+func (b *SSH) keepAlive() {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, _, err := b.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			b.client.Close()
+			return
+		}
+	}
+}
+
+func (b *SSH) Read(p []byte) (int, error) {
+	return b.stdout.Read(p)
+}
+
+func (b *SSH) Write(p []byte) (int, error) {
+	return b.stdin.Write(p)
+}
+
+// Resize 发送window-change请求
+func (b *SSH) Resize(cols, rows uint16) error {
+	return b.session.WindowChange(int(rows), int(cols))
+}
+
+// Signal 通过SSH signal请求转发信号
+func (b *SSH) Signal(sig os.Signal) error {
+	name, ok := sshSignals[sig]
+	if !ok {
+		return ErrUnsupported
+	}
+	return b.session.Signal(name)
+}
+
+// Close 关闭会话和客户端连接
+func (b *SSH) Close() error {
+	b.session.Close()
+	return b.client.Close()
+}
+
+// ExitStatus 返回远程Shell退出码
+func (b *SSH) ExitStatus() (int, bool) {
+	return b.exit.get()
+}
+
+// TTY 已请求远程PTY
+func (b *SSH) TTY() bool {
+	return true
+}
+
+// 本地信号到SSH信号名的映射
+var sshSignals = map[os.Signal]ssh.Signal{
+	syscall.SIGHUP:  ssh.SIGHUP,
+	syscall.SIGINT:  ssh.SIGINT,
+	syscall.SIGQUIT: ssh.SIGQUIT,
+	syscall.SIGKILL: ssh.SIGKILL,
+	syscall.SIGTERM: ssh.SIGTERM,
+	syscall.SIGUSR1: ssh.SIGUSR1,
+	syscall.SIGUSR2: ssh.SIGUSR2,
+}
+
+// sshAuthMethods 根据提供的凭据构造认证方式
+func sshAuthMethods(opts SSHOptions) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if opts.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if opts.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(opts.PrivateKey), []byte(opts.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(opts.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse private key: %v", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if opts.Password != "" {
+		password := opts.Password
+		methods = append(methods, ssh.Password(password))
+		methods = append(methods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		}))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("Password or private key is required")
+	}
+
+	return methods, nil
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// DialTimeout TCP连接超时
+const DialTimeout = 10 * time.Second
+
+func init() {
+	Register("tcp", func(opts Options) (Backend, error) {
+		target := opts.Get("target", "")
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, fmt.Errorf("Invalid target %s, expected host:port", target)
+		}
+
+		conn, err := net.DialTimeout("tcp", target, DialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to %s: %v", target, err)
+		}
+		return NewTCP(conn), nil
+	})
+}
+
+// TCP 原始TCP连接上的Shell，例如反弹Shell和绑定Shell
+type TCP struct {
+	conn net.Conn
+}
+
+// NewTCP 包装已建立的连接
+func NewTCP(conn net.Conn) *TCP {
+	return &TCP{conn: conn}
+}
+
+// RemoteAddr 返回对端地址
+func (b *TCP) RemoteAddr() string {
+	return b.conn.RemoteAddr().String()
+}
+
+func (b *TCP) Read(p []byte) (int, error) {
+	return b.conn.Read(p)
+}
+
+func (b *TCP) Write(p []byte) (int, error) {
+	return b.conn.Write(p)
+}
+
+// SyscallConn 返回连接的文件描述符，TLS等有用户态状态的连接不支持
+func (b *TCP) SyscallConn() (syscall.RawConn, error) {
+	conn, ok := b.conn.(syscall.Conn)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return conn.SyscallConn()
+}
+
+// SetReadDeadline 设置读取超时
+func (b *TCP) SetReadDeadline(t time.Time) error {
+	return b.conn.SetReadDeadline(t)
+}
+
+// Resize 原始连接无法传递窗口大小
+func (b *TCP) Resize(cols, rows uint16) error {
+	return ErrUnsupported
+}
+
+// Signal 原始连接无法传递信号
+func (b *TCP) Signal(sig os.Signal) error {
+	return ErrUnsupported
+}
+
+// Close 关闭连接
+func (b *TCP) Close() error {
+	return b.conn.Close()
+}
+
+// ExitStatus 原始连接无法获知退出码
+func (b *TCP) ExitStatus() (int, bool) {
+	return 0, false
+}
+
+// TTY 原始连接的对端默认没有终端驱动
+func (b *TCP) TTY() bool {
+	return false
+}
@@ -0,0 +1,434 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ghosteye/codec"
+)
+
+// 默认webshell请求超时
+const webshellTimeout = 60 * time.Second
+
+func init() {
+	Register("webshell", func(opts Options) (Backend, error) {
+		headers := make(map[string]string)
+		for _, line := range strings.Split(opts.Get("headers", ""), "\n") {
+			if key, value, ok := strings.Cut(line, ":"); ok {
+				headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		chain, err := codec.ParseChain(opts.Get("encoders", ""))
+		if err != nil {
+			return nil, err
+		}
+		var c codec.Codec
+		if len(chain) > 0 {
+			c = chain
+		}
+		return NewWebshell(WebshellOptions{
+			URL:     opts.Get("url", ""),
+			Method:  opts.Get("method", ""),
+			Param:   opts.Get("param", ""),
+			Headers: headers,
+			Cookies: opts.Get("cookies", ""),
+			OS:      opts.Get("os", ""),
+			RawBody: opts.Get("raw_body", "") == "true",
+			Codec:   c,
+		})
+	})
+}
+
+// WebshellOptions webshell连接参数
+type WebshellOptions struct {
+	URL     string            // webshell地址
+	Method  string            // 请求方法: GET / POST，默认POST
+	Param   string            // 传递命令的参数名，默认cmd
+	Headers map[string]string // 附加请求头
+	Cookies string            // Cookie请求头
+	OS      string            // 目标系统: linux / windows，默认linux
+	Timeout time.Duration     // 单次请求超时
+	RawBody bool              // POST时将编码后的命令直接作为请求体，而不是表单参数
+	Codec   codec.Codec       // 命令和响应的编码器，为nil时明文传输
+	Client  *http.Client      // 自定义HTTP客户端，为nil时使用默认客户端
+}
+
+// Webshell 通过HTTP webshell逐行执行命令的后端，每行输入发送一次请求，
+// 响应体作为终端输出，并在请求之间跟踪当前工作目录
+type Webshell struct {
+	opts   WebshellOptions
+	client *http.Client
+	marker string // 标记响应中工作目录所在行
+
+	cwd    string
+	cwdMux sync.Mutex
+
+	input   bytes.Buffer // 尚未提交的输入
+	lines   chan string  // 待执行的命令
+	output  *io.PipeReader
+	writer  *io.PipeWriter
+	ctx     context.Context
+	cancel  context.CancelFunc
+	closeMu sync.Once
+}
+
+// NewWebshell 创建webshell后端，并执行一次请求获取初始工作目录以验证连通性
+func NewWebshell(opts WebshellOptions) (*Webshell, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("Invalid webshell URL: %s", opts.URL)
+	}
+
+	opts.Method = strings.ToUpper(opts.Method)
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Method != http.MethodGet && opts.Method != http.MethodPost {
+		return nil, fmt.Errorf("Unsupported webshell method: %s", opts.Method)
+	}
+	if opts.Param == "" {
+		opts.Param = "cmd"
+	}
+	if opts.OS == "" {
+		opts.OS = "linux"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = webshellTimeout
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	r, w := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Webshell{
+		opts:   opts,
+		client: client,
+		marker: fmt.Sprintf("GEcwd%08x:", rand.Uint32()),
+		lines:  make(chan string, 64),
+		output: r,
+		writer: w,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// 获取初始工作目录
+	if err := b.run("", io.Discard); err != nil {
+		cancel()
+		return nil, err
+	}
+	if b.Cwd() == "" {
+		cancel()
+		return nil, fmt.Errorf("Webshell response did not contain command output")
+	}
+
+	go b.loop()
+
+	return b, nil
+}
+
+// Host 返回webshell所在主机
+func (b *Webshell) Host() string {
+	u, _ := url.Parse(b.opts.URL)
+	return u.Host
+}
+
+// Cwd 返回当前工作目录
+func (b *Webshell) Cwd() string {
+	b.cwdMux.Lock()
+	defer b.cwdMux.Unlock()
+
+	return b.cwd
+}
+
+// OS 返回目标系统类型
+func (b *Webshell) OS() string {
+	return b.opts.OS
+}
+
+// Exec 在当前工作目录执行命令并返回解码后的完整输出，不经过终端，供文件管理等功能使用
+func (b *Webshell) Exec(command string) ([]byte, error) {
+	if cwd := b.Cwd(); cwd != "" {
+		if b.opts.OS == "windows" {
+			command = fmt.Sprintf("cd /d \"%s\" & %s", cwd, command)
+		} else {
+			command = fmt.Sprintf("cd '%s' 2>/dev/null; %s", strings.ReplaceAll(cwd, "'", `'\''`), command)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, b.opts.Timeout)
+	defer cancel()
+
+	resp, err := b.do(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read webshell response: %v", err)
+	}
+	if b.opts.Codec != nil {
+		if body, err = b.opts.Codec.Decode(body); err != nil {
+			return nil, fmt.Errorf("Failed to decode webshell response: %v", err)
+		}
+	}
+
+	return body, nil
+}
+
+// loop 按顺序执行提交的命令，并在每条命令后输出提示符
+func (b *Webshell) loop() {
+	b.writer.Write([]byte(b.prompt()))
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case line := <-b.lines:
+			if strings.TrimSpace(line) != "" {
+				if err := b.run(line, b.writer); err != nil {
+					if b.ctx.Err() != nil {
+						return
+					}
+					fmt.Fprintf(b.writer, "\r\n[webshell] %v\r\n", err)
+				}
+			}
+			b.writer.Write([]byte(b.prompt()))
+		}
+	}
+}
+
+// prompt 生成带工作目录的提示符
+func (b *Webshell) prompt() string {
+	if b.opts.OS == "windows" {
+		return b.Cwd() + "> "
+	}
+	return b.Cwd() + "$ "
+}
+
+// wrap 包装命令，使其在当前工作目录执行并在结束后输出新的工作目录
+func (b *Webshell) wrap(line string) string {
+	cwd := b.Cwd()
+
+	if b.opts.OS == "windows" {
+		var cmd strings.Builder
+		if cwd != "" {
+			fmt.Fprintf(&cmd, "cd /d \"%s\" & ", cwd)
+		}
+		if line != "" {
+			fmt.Fprintf(&cmd, "%s 2>&1 & ", line)
+		}
+		fmt.Fprintf(&cmd, "echo %s%%CD%%", b.marker)
+		return cmd.String()
+	}
+
+	var cmd strings.Builder
+	if cwd != "" {
+		fmt.Fprintf(&cmd, "cd '%s' 2>/dev/null; ", strings.ReplaceAll(cwd, "'", `'\''`))
+	}
+	if line != "" {
+		fmt.Fprintf(&cmd, "{ %s\n} 2>&1; ", line)
+	}
+	fmt.Fprintf(&cmd, "echo %s$(pwd)", b.marker)
+	return cmd.String()
+}
+
+// run 发送一次请求执行命令，将响应体流式写入out，并从标记行更新工作目录
+func (b *Webshell) run(line string, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(b.ctx, b.opts.Timeout)
+	defer cancel()
+
+	resp, err := b.do(ctx, b.wrap(line))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if b.opts.Codec == nil {
+		return b.filterOutput(resp.Body, out)
+	}
+
+	// 编码后的响应需要完整读取后才能解码
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read webshell response: %v", err)
+	}
+	decoded, err := b.opts.Codec.Decode(body)
+	if err != nil {
+		return fmt.Errorf("Failed to decode webshell response: %v", err)
+	}
+	return b.filterOutput(bytes.NewReader(decoded), out)
+}
+
+// do 发送携带命令的请求，返回状态码为200的响应
+func (b *Webshell) do(ctx context.Context, command string) (*http.Response, error) {
+	req, err := b.newRequest(command)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Webshell request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Webshell returned HTTP %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// newRequest 构造携带命令的HTTP请求
+func (b *Webshell) newRequest(command string) (*http.Request, error) {
+	if b.opts.Codec != nil {
+		encoded, err := b.opts.Codec.Encode([]byte(command))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode webshell command: %v", err)
+		}
+		command = string(encoded)
+	}
+
+	values := url.Values{}
+	values.Set(b.opts.Param, command)
+
+	var req *http.Request
+	var err error
+	if b.opts.Method == http.MethodPost && b.opts.RawBody {
+		req, err = http.NewRequest(http.MethodPost, b.opts.URL, strings.NewReader(command))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+	} else if b.opts.Method == http.MethodGet {
+		u, _ := url.Parse(b.opts.URL)
+		query := u.Query()
+		query.Set(b.opts.Param, command)
+		u.RawQuery = query.Encode()
+		req, err = http.NewRequest(http.MethodGet, u.String(), nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, b.opts.URL, strings.NewReader(values.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create webshell request: %v", err)
+	}
+
+	for key, value := range b.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	if b.opts.Cookies != "" {
+		req.Header.Set("Cookie", b.opts.Cookies)
+	}
+
+	return req, nil
+}
+
+// filterOutput 逐行转发响应内容，截取工作目录标记行并将换行转换为回车换行
+func (b *Webshell) filterOutput(body io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if idx := strings.Index(line, b.marker); idx >= 0 {
+			cwd := strings.TrimRight(line[idx+len(b.marker):], "\r\n")
+			b.cwdMux.Lock()
+			b.cwd = cwd
+			b.cwdMux.Unlock()
+
+			// 命令输出末尾没有换行时补上，避免与提示符连在一起
+			line = line[:idx]
+			if line != "" {
+				line += "\n"
+			}
+		}
+
+		if line != "" {
+			line = strings.ReplaceAll(strings.TrimSuffix(line, "\n"), "\r", "")
+			if _, werr := io.WriteString(out, strings.ReplaceAll(line, "\n", "\r\n")+"\r\n"); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read webshell response: %v", err)
+		}
+	}
+}
+
+func (b *Webshell) Read(p []byte) (int, error) {
+	return b.output.Read(p)
+}
+
+// Write 缓存输入，每收到一整行提交一次命令
+func (b *Webshell) Write(p []byte) (int, error) {
+	if b.ctx.Err() != nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	for _, c := range p {
+		if c != '\n' && c != '\r' {
+			b.input.WriteByte(c)
+			continue
+		}
+		if c == '\r' {
+			continue
+		}
+
+		line := b.input.String()
+		b.input.Reset()
+		select {
+		case b.lines <- line:
+		case <-b.ctx.Done():
+			return 0, io.ErrClosedPipe
+		}
+	}
+
+	return len(p), nil
+}
+
+// Resize webshell没有终端窗口
+func (b *Webshell) Resize(cols, rows uint16) error {
+	return ErrUnsupported
+}
+
+// Signal webshell请求无法中断远端进程
+func (b *Webshell) Signal(sig os.Signal) error {
+	return ErrUnsupported
+}
+
+// Close 取消进行中的请求并结束输出
+func (b *Webshell) Close() error {
+	b.closeMu.Do(func() {
+		b.cancel()
+		b.writer.Close()
+	})
+	return nil
+}
+
+// ExitStatus webshell没有持续运行的进程
+func (b *Webshell) ExitStatus() (int, bool) {
+	return 0, false
+}
+
+// TTY webshell不回显输入
+func (b *Webshell) TTY() bool {
+	return false
+}
@@ -0,0 +1,279 @@
+package backend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn 在本机执行请求参数中命令的webshell替身，记录收到的请求
+type standIn struct {
+	param string
+	raw   bool // 命令为整个请求体
+
+	mutex    sync.Mutex
+	requests []*http.Request
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var command string
+	if s.raw {
+		body, _ := io.ReadAll(r.Body)
+		command = string(body)
+	} else {
+		command = r.FormValue(s.param)
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Clone(r.Context()))
+	s.mutex.Unlock()
+
+	output, _ := exec.Command("/bin/sh", "-c", command).CombinedOutput()
+	w.Write(output)
+}
+
+// last 返回最近一次请求
+func (s *standIn) last() *http.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[len(s.requests)-1]
+}
+
+// reader 在后台持续读取后端输出，供测试等待期望的内容
+type reader struct {
+	mutex  sync.Mutex
+	output strings.Builder
+}
+
+func newReader(b Backend) *reader {
+	r := &reader{}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := b.Read(buf)
+			r.mutex.Lock()
+			r.output.Write(buf[:n])
+			r.mutex.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// waitFor 等待输出中出现s，返回到目前为止的全部输出
+func (r *reader) waitFor(t *testing.T, s string) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mutex.Lock()
+		output := r.output.String()
+		r.mutex.Unlock()
+		if strings.Contains(output, s) {
+			return output
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q in output %q", s, r.output.String())
+	return ""
+}
+
+func newTestWebshell(t *testing.T, handler *standIn, opts WebshellOptions) *Webshell {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts.URL = server.URL + "/shell.php"
+	b, err := NewWebshell(opts)
+	if err != nil {
+		t.Fatalf("NewWebshell: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestWebshellOutput(t *testing.T) {
+	b := newTestWebshell(t, &standIn{param: "cmd"}, WebshellOptions{})
+	out := newReader(b)
+	out.waitFor(t, "$ ")
+
+	b.Write([]byte("printf 'one\\ntwo\\n'; echo three >&2\n"))
+	output := out.waitFor(t, "three\r\n")
+
+	if !strings.Contains(output, "one\r\ntwo\r\n") {
+		t.Errorf("output lines not converted to CRLF: %q", output)
+	}
+	if strings.Contains(output, b.marker) {
+		t.Errorf("cwd marker leaked into output: %q", output)
+	}
+	if strings.Count(output, "$ ") != 2 {
+		t.Errorf("expected a prompt before and after the command: %q", output)
+	}
+}
+
+func TestWebshellStreaming(t *testing.T) {
+	release := make(chan struct{})
+	shell := &standIn{param: "cmd"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.FormValue("cmd"), "slow") {
+			shell.ServeHTTP(w, r)
+			return
+		}
+		// 先返回一部分输出，等测试确认收到后再结束命令
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer server.Close()
+
+	b, err := NewWebshell(WebshellOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewWebshell: %v", err)
+	}
+	defer b.Close()
+	out := newReader(b)
+	out.waitFor(t, "$ ")
+
+	b.Write([]byte("slow\n"))
+	if output := out.waitFor(t, "first\r\n"); strings.Contains(output, "second") {
+		t.Fatalf("output arrived out of order: %q", output)
+	}
+	close(release)
+	out.waitFor(t, "second\r\n")
+}
+
+func TestWebshellCwd(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "it's here")
+
+	b := newTestWebshell(t, &standIn{param: "cmd"}, WebshellOptions{})
+	out := newReader(b)
+	out.waitFor(t, "$ ")
+
+	b.Write([]byte("mkdir \"" + sub + "\" && cd \"" + sub + "\"\n"))
+	out.waitFor(t, sub+"$ ")
+	if got := b.Cwd(); got != sub {
+		t.Fatalf("Cwd() = %q, want %q", got, sub)
+	}
+
+	// 后续命令在跟踪的工作目录中执行
+	b.Write([]byte("pwd\n"))
+	out.waitFor(t, sub+"\r\n"+sub+"$ ")
+
+	output, err := b.Exec("pwd")
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if strings.TrimSpace(string(output)) != sub {
+		t.Errorf("Exec ran in %q, want %q", output, sub)
+	}
+
+	b.Write([]byte("cd ..\n"))
+	out.waitFor(t, dir+"$ ")
+	if got := b.Cwd(); got != dir {
+		t.Errorf("Cwd() after cd .. = %q, want %q", got, dir)
+	}
+}
+
+func TestWebshellHeaders(t *testing.T) {
+	handler := &standIn{param: "cmd"}
+	b := newTestWebshell(t, handler, WebshellOptions{
+		Headers: map[string]string{"X-Token": "s3cret", "User-Agent": "Mozilla/5.0"},
+		Cookies: "PHPSESSID=abc; auth=1",
+	})
+
+	if _, err := b.Exec("true"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	req := handler.last()
+	if got := req.Header.Get("X-Token"); got != "s3cret" {
+		t.Errorf("X-Token = %q", got)
+	}
+	if got := req.Header.Get("User-Agent"); got != "Mozilla/5.0" {
+		t.Errorf("User-Agent = %q", got)
+	}
+	if c, err := req.Cookie("PHPSESSID"); err != nil || c.Value != "abc" {
+		t.Errorf("PHPSESSID cookie = %v, %v", c, err)
+	}
+	if c, err := req.Cookie("auth"); err != nil || c.Value != "1" {
+		t.Errorf("auth cookie = %v, %v", c, err)
+	}
+}
+
+func TestWebshellMethods(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        WebshellOptions
+		raw         bool
+		method      string
+		contentType string
+		inQuery     bool
+	}{
+		{"default post", WebshellOptions{}, false, http.MethodPost, "application/x-www-form-urlencoded", false},
+		{"get", WebshellOptions{Method: "get"}, false, http.MethodGet, "", true},
+		{"raw body", WebshellOptions{RawBody: true}, true, http.MethodPost, "application/octet-stream", false},
+		{"custom param", WebshellOptions{Param: "x"}, false, http.MethodPost, "application/x-www-form-urlencoded", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := tt.opts.Param
+			if param == "" {
+				param = "cmd"
+			}
+			handler := &standIn{param: param, raw: tt.raw}
+			b := newTestWebshell(t, handler, tt.opts)
+
+			// 参数编码需要保留&、=、+和%
+			output, err := b.Exec("echo 'a&b=c+d %20'")
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if got := strings.TrimSpace(string(output)); got != "a&b=c+d %20" {
+				t.Errorf("output = %q", got)
+			}
+
+			req := handler.last()
+			if req.Method != tt.method {
+				t.Errorf("method = %s, want %s", req.Method, tt.method)
+			}
+			if got := req.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := req.URL.Query().Has(param); got != tt.inQuery {
+				t.Errorf("command in query = %v, want %v", got, tt.inQuery)
+			}
+		})
+	}
+
+	if _, err := NewWebshell(WebshellOptions{URL: "http://127.0.0.1:1/", Method: "PUT"}); err == nil {
+		t.Error("NewWebshell accepted an unsupported method")
+	}
+}
+
+func TestWebshellHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewWebshell(WebshellOptions{URL: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("NewWebshell error = %v, want HTTP 403", err)
+	}
+}
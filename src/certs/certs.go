@@ -0,0 +1,266 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	
+	"ghosteye/database"
+)
+
+// CommonName 监听器证书使用的通用名称，客户端校验主机名时使用
+const CommonName = "ghosteye"
+
+// 数据库中CA证书的名称
+const caName = "ca"
+
+// 生成CA时加锁，避免并发创建多个CA
+var caMutex sync.Mutex
+
+// GetCA 获取GhostEye本地CA，不存在时自动生成
+func GetCA() (*x509.Certificate, *ecdsa.PrivateKey, string, error) {
+	caMutex.Lock()
+	defer caMutex.Unlock()
+	
+	certPEM, keyPEM, _, err := database.GetCertificate(caName)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	
+	if certPEM == "" {
+		certPEM, keyPEM, err = generateCA()
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	
+	cert, key, err := parseKeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("Failed to parse CA certificate: %v", err)
+	}
+	
+	return cert, key, certPEM, nil
+}
+
+// ListenerCertificate 获取监听器证书，不存在时由本地CA签发。
+// hosts为证书额外包含的主机名或IP，返回TLS证书及其SHA256指纹
+func ListenerCertificate(listenerID string, hosts []string) (tls.Certificate, string, error) {
+	name := "listener:" + listenerID
+	
+	certPEM, keyPEM, fingerprint, err := database.GetCertificate(name)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	
+	if certPEM == "" {
+		certPEM, keyPEM, fingerprint, err = issueCertificate(listenerID, hosts)
+		if err != nil {
+			return tls.Certificate{}, "", err
+		}
+		if err := database.SaveCertificate(name, certPEM, keyPEM, fingerprint); err != nil {
+			return tls.Certificate{}, "", err
+		}
+	}
+	
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("Failed to load listener certificate: %v", err)
+	}
+	
+	return cert, fingerprint, nil
+}
+
+// ListenerCertificatePEM 获取监听器证书的PEM内容
+func ListenerCertificatePEM(listenerID string) (string, error) {
+	certPEM, _, _, err := database.GetCertificate("listener:" + listenerID)
+	if err != nil {
+		return "", err
+	}
+	if certPEM == "" {
+		return "", fmt.Errorf("Listener %s has no certificate", listenerID)
+	}
+	return certPEM, nil
+}
+
+// DeleteListenerCertificate 删除监听器证书
+func DeleteListenerCertificate(listenerID string) error {
+	return database.DeleteCertificate("listener:" + listenerID)
+}
+
+// ListenerCertificateHosts 获取监听器证书包含的主机名和IP
+func ListenerCertificateHosts(listenerID string) ([]string, error) {
+	certPEM, err := ListenerCertificatePEM(listenerID)
+	if err != nil {
+		return nil, err
+	}
+	
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("Invalid certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	hosts := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts, nil
+}
+
+// Fingerprint 计算证书的SHA256指纹，格式与openssl一致（AA:BB:...）
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// generateCA 生成并保存新的本地CA
+func generateCA() (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to generate CA key: %v", err)
+	}
+	
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "GhostEye Local CA", Organization: []string{"GhostEye"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to create CA certificate: %v", err)
+	}
+	
+	certPEM, keyPEM, err := encodeKeyPair(der, key)
+	if err != nil {
+		return "", "", err
+	}
+	
+	if err := database.SaveCertificate(caName, certPEM, keyPEM, Fingerprint(der)); err != nil {
+		return "", "", err
+	}
+	
+	return certPEM, keyPEM, nil
+}
+
+// issueCertificate 使用本地CA签发监听器证书
+func issueCertificate(listenerID string, hosts []string) (string, string, string, error) {
+	caCert, caKey, _, err := GetCA()
+	if err != nil {
+		return "", "", "", err
+	}
+	
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Failed to generate listener key: %v", err)
+	}
+	
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: CommonName, OrganizationalUnit: []string{listenerID}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(2, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{CommonName, "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	
+	// 加入本机所有接口地址和调用方指定的主机
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Failed to create listener certificate: %v", err)
+	}
+	
+	certPEM, keyPEM, err := encodeKeyPair(der, key)
+	if err != nil {
+		return "", "", "", err
+	}
+	
+	return certPEM, keyPEM, Fingerprint(der), nil
+}
+
+// encodeKeyPair 将证书和私钥编码为PEM
+func encodeKeyPair(der []byte, key *ecdsa.PrivateKey) (string, string, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to encode private key: %v", err)
+	}
+	
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM), nil
+}
+
+// parseKeyPair 解析PEM格式的证书和私钥
+func parseKeyPair(certPEM, keyPEM string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("Invalid certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("Invalid private key PEM")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	return cert, key, nil
+}
+
+// randomSerial 生成随机证书序列号
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
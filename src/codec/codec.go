@@ -0,0 +1,134 @@
+package codec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec 对webshell请求进行编码并对响应进行解码
+type Codec interface {
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// Options 创建编码器的参数
+type Options map[string]string
+
+// Factory 根据参数创建编码器
+type Factory func(opts Options) (Codec, error)
+
+// 已注册的编码器
+var (
+	factories    = make(map[string]Factory)
+	factoriesMux sync.RWMutex
+)
+
+// Register 注册编码器
+func Register(name string, factory Factory) {
+	factoriesMux.Lock()
+	defer factoriesMux.Unlock()
+
+	factories[name] = factory
+}
+
+// New 使用已注册的编码器名称创建编码器
+func New(name string, opts Options) (Codec, error) {
+	factoriesMux.RLock()
+	factory, exists := factories[name]
+	factoriesMux.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Unknown encoder: %s", name)
+	}
+	if opts == nil {
+		opts = Options{}
+	}
+
+	return factory(opts)
+}
+
+// Names 返回所有已注册的编码器名称
+func Names() []string {
+	factoriesMux.RLock()
+	defer factoriesMux.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Chain 按顺序组合的编码器，编码时依次执行，解码时逆序执行
+type Chain []Codec
+
+// Encode 依次编码
+func (c Chain) Encode(data []byte) ([]byte, error) {
+	var err error
+	for _, codec := range c {
+		if data, err = codec.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Decode 逆序解码
+func (c Chain) Decode(data []byte) ([]byte, error) {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if data, err = c[i].Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Spec 编码器配置
+type Spec struct {
+	Name    string  `json:"name"`
+	Options Options `json:"options"`
+}
+
+// NewChain 根据配置创建编码器链
+func NewChain(specs []Spec) (Chain, error) {
+	chain := make(Chain, 0, len(specs))
+	for _, spec := range specs {
+		codec, err := New(spec.Name, spec.Options)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, codec)
+	}
+	return chain, nil
+}
+
+// ParseChain 解析文本形式的编码器链，例如 "aes-cbc:key=0123456789abcdef|base64"
+func ParseChain(text string) (Chain, error) {
+	return NewChain(ParseSpecs(text))
+}
+
+// ParseSpecs 解析文本形式的编码器配置列表，各项以|分隔，参数以name:key=value;key=value的形式给出
+func ParseSpecs(text string) []Spec {
+	var specs []Spec
+	for _, part := range strings.Split(text, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, params, _ := strings.Cut(part, ":")
+		spec := Spec{Name: strings.TrimSpace(name), Options: Options{}}
+		for _, param := range strings.Split(params, ";") {
+			if key, value, ok := strings.Cut(param, "="); ok {
+				spec.Options[strings.TrimSpace(key)] = value
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
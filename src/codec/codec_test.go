@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer 模拟使用同样编码链的webshell：解码请求体，记录明文后原样编码返回
+func echoServer(t *testing.T, spec string, received *[]byte) *httptest.Server {
+	t.Helper()
+
+	chain, err := ParseChain(spec)
+	if err != nil {
+		t.Fatalf("ParseChain(%q): %v", spec, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		plain, err := chain.Decode(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*received = plain
+
+		encoded, err := chain.Encode(plain)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(encoded)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// roundTrip 用spec编码data发送给echoServer，解码响应并检查两端得到的明文
+func roundTrip(t *testing.T, spec string, data []byte) {
+	t.Helper()
+
+	var received []byte
+	server := echoServer(t, spec, &received)
+
+	chain, err := ParseChain(spec)
+	if err != nil {
+		t.Fatalf("ParseChain(%q): %v", spec, err)
+	}
+	encoded, err := chain.Encode(data)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(data) > 4 && bytes.Contains(encoded, data) {
+		t.Errorf("encoded request contains the plaintext: %q", encoded)
+	}
+
+	resp, err := http.Post(server.URL, "application/octet-stream", bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("server returned %d: %s", resp.StatusCode, body)
+	}
+	if !bytes.Equal(received, data) {
+		t.Errorf("server decoded %q, want %q", received, data)
+	}
+
+	decoded, err := chain.Decode(body)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("client decoded %q, want %q", decoded, data)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	const key16 = "0123456789abcdef"
+	const key32 = "0123456789abcdef0123456789abcdef"
+	text := []byte("id; echo 'héllo 你好' && cat /etc/passwd\n")
+	binary := []byte{0x00, 0xff, 0xfe, 0x80, 'a', 0x1b, '\n', 0xc3}
+
+	tests := []struct {
+		name string
+		spec string
+		data []byte
+	}{
+		{"base64", "base64", binary},
+		{"hex", "hex", binary},
+		{"xor", "xor:key=k3y", binary},
+		{"aes-cbc", "aes-cbc:key=" + key16, binary},
+		{"aes-cbc block aligned", "aes-cbc:key=" + key16, []byte(key32)},
+		{"aes-cbc empty", "aes-cbc:key=" + key16, []byte{}},
+		{"aes-gcm", "aes-gcm:key=" + key32, binary},
+		{"json", "json", text},
+		{"json custom field", "json:field=cmd", text},
+		{"url", "url:all=true", text},
+		{"utf16le base64", "utf16le|base64", text},
+		{"aes-cbc base64", "aes-cbc:key=" + key16 + "|base64", text},
+		{"xor hex json", "xor:key=k|hex|json:field=c", binary},
+		{"aes-gcm base64 url", "aes-gcm:key=" + key16 + "|base64|url", binary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, tt.spec, tt.data)
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	chain, err := ParseChain("aes-cbc:key=0123456789abcdef|base64")
+	if err != nil {
+		t.Fatalf("ParseChain: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("chain has %d codecs, want 2", len(chain))
+	}
+
+	encoded, err := chain.Encode([]byte("whoami"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	// 最后一步为base64，解码base64后应得到IV加一个分组的密文
+	raw, err := Base64{}.Decode(encoded)
+	if err != nil {
+		t.Fatalf("encoded output is not base64: %q", encoded)
+	}
+	if len(raw) != 32 {
+		t.Errorf("ciphertext length = %d, want 32", len(raw))
+	}
+	if plain, err := chain[0].Decode(raw); err != nil || string(plain) != "whoami" {
+		t.Errorf("AES-CBC decode of inner layer = %q, %v", plain, err)
+	}
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	envelope := JSONEnvelope{Field: "data"}
+
+	encoded, err := envelope.Encode([]byte("a\"b\\c\n你"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if want := `{"data":"a\"b\\c\n你"}`; string(encoded) != want {
+		t.Errorf("Encode = %s, want %s", encoded, want)
+	}
+
+	// 非UTF-8数据直接放入JSON字符串会被替换为U+FFFD，必须拒绝
+	if _, err := envelope.Encode([]byte{'a', 0xff, 0xfe}); err == nil || !strings.Contains(err.Error(), "UTF-8") {
+		t.Errorf("Encode of invalid UTF-8 error = %v", err)
+	}
+	chain, err := ParseChain("aes-cbc:key=0123456789abcdef|json")
+	if err != nil {
+		t.Fatalf("ParseChain: %v", err)
+	}
+	if _, err := chain.Encode([]byte("ls")); err == nil {
+		t.Error("Encode put raw ciphertext into a JSON envelope")
+	}
+
+	if _, err := envelope.Decode([]byte(`{"data":1}`)); err == nil {
+		t.Error("Decode accepted a non-string field")
+	}
+	if _, err := envelope.Decode([]byte(`{"other":"x"}`)); err == nil {
+		t.Error("Decode accepted an envelope without the field")
+	}
+	if _, err := envelope.Decode([]byte(`not json`)); err == nil {
+		t.Error("Decode accepted invalid JSON")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"unknown codec", "rot13"},
+		{"xor without key", "xor"},
+		{"aes bad key length", "aes-cbc:key=short"},
+		{"aes-gcm bad key length", "aes-gcm:key=0123456789abcde"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseChain(tt.spec); err == nil {
+				t.Errorf("ParseChain(%q) succeeded", tt.spec)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cbc, _ := New("aes-cbc", Options{"key": "0123456789abcdef"})
+	gcm, _ := New("aes-gcm", Options{"key": "0123456789abcdef"})
+
+	if _, err := cbc.Decode(make([]byte, 20)); err == nil {
+		t.Error("AES-CBC accepted a truncated ciphertext")
+	}
+	if _, err := cbc.Decode(make([]byte, 32)); err == nil {
+		t.Error("AES-CBC accepted invalid padding")
+	}
+
+	sealed, _ := gcm.Encode([]byte("secret"))
+	sealed[len(sealed)-1] ^= 1
+	if _, err := gcm.Decode(sealed); err == nil {
+		t.Error("AES-GCM accepted a tampered ciphertext")
+	}
+}
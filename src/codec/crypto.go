@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+func init() {
+	Register("xor", func(opts Options) (Codec, error) {
+		if opts["key"] == "" {
+			return nil, fmt.Errorf("XOR encoder requires a key")
+		}
+		return XOR{Key: []byte(opts["key"])}, nil
+	})
+	Register("aes-cbc", func(opts Options) (Codec, error) {
+		block, err := newAESBlock(opts["key"])
+		if err != nil {
+			return nil, err
+		}
+		return AESCBC{block: block}, nil
+	})
+	Register("aes-gcm", func(opts Options) (Codec, error) {
+		block, err := newAESBlock(opts["key"])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create AES-GCM: %v", err)
+		}
+		return AESGCM{aead: aead}, nil
+	})
+}
+
+// newAESBlock 使用16、24或32字节的共享密钥创建AES分组密码
+func newAESBlock(key string) (cipher.Block, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("AES key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	return aes.NewCipher([]byte(key))
+}
+
+// XOR 使用循环密钥异或
+type XOR struct {
+	Key []byte
+}
+
+func (x XOR) Encode(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, c := range data {
+		out[i] = c ^ x.Key[i%len(x.Key)]
+	}
+	return out, nil
+}
+
+func (x XOR) Decode(data []byte) ([]byte, error) {
+	return x.Encode(data)
+}
+
+// AESCBC AES-CBC加密，PKCS7填充，随机IV放在密文前
+type AESCBC struct {
+	block cipher.Block
+}
+
+func (c AESCBC) Encode(data []byte) ([]byte, error) {
+	size := c.block.BlockSize()
+	padding := size - len(data)%size
+	plain := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	out := make([]byte, size+len(plain))
+	iv := out[:size]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("Failed to generate IV: %v", err)
+	}
+	cipher.NewCBCEncrypter(c.block, iv).CryptBlocks(out[size:], plain)
+
+	return out, nil
+}
+
+func (c AESCBC) Decode(data []byte) ([]byte, error) {
+	size := c.block.BlockSize()
+	if len(data) < 2*size || len(data)%size != 0 {
+		return nil, fmt.Errorf("Invalid AES-CBC ciphertext length %d", len(data))
+	}
+
+	plain := make([]byte, len(data)-size)
+	cipher.NewCBCDecrypter(c.block, data[:size]).CryptBlocks(plain, data[size:])
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > size || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("Invalid AES-CBC padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// AESGCM AES-GCM加密，随机nonce放在密文前
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+func (c AESGCM) Encode(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("Failed to generate nonce: %v", err)
+	}
+	return c.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c AESGCM) Decode(data []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("Invalid AES-GCM ciphertext length %d", len(data))
+	}
+
+	plain, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt AES-GCM: %v", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,142 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("base64", func(opts Options) (Codec, error) {
+		return Base64{}, nil
+	})
+	Register("hex", func(opts Options) (Codec, error) {
+		return Hex{}, nil
+	})
+	Register("json", func(opts Options) (Codec, error) {
+		field := opts["field"]
+		if field == "" {
+			field = "data"
+		}
+		return JSONEnvelope{Field: field}, nil
+	})
+	Register("url", func(opts Options) (Codec, error) {
+		return URL{All: opts["all"] == "true"}, nil
+	})
+	Register("utf16le", func(opts Options) (Codec, error) {
+		return UTF16LE{}, nil
+	})
+}
+
+// Base64 标准Base64编码
+type Base64 struct{}
+
+func (Base64) Encode(data []byte) ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func (Base64) Decode(data []byte) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode base64: %v", err)
+	}
+	return decoded, nil
+}
+
+// Hex 十六进制编码
+type Hex struct{}
+
+func (Hex) Encode(data []byte) ([]byte, error) {
+	return []byte(hex.EncodeToString(data)), nil
+}
+
+func (Hex) Decode(data []byte) ([]byte, error) {
+	decoded, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode hex: %v", err)
+	}
+	return decoded, nil
+}
+
+// JSONEnvelope 将数据放入JSON对象的指定字段，适用于以JSON收发的webshell。
+// JSON字符串只能承载UTF-8文本，二进制数据需先经过base64或hex
+type JSONEnvelope struct {
+	Field string
+}
+
+func (e JSONEnvelope) Encode(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("Failed to encode JSON envelope: input is not valid UTF-8")
+	}
+	return json.Marshal(map[string]string{e.Field: string(data)})
+}
+
+func (e JSONEnvelope) Decode(data []byte) ([]byte, error) {
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("Failed to decode JSON envelope: %v", err)
+	}
+	value, ok := envelope[e.Field].(string)
+	if !ok {
+		return nil, fmt.Errorf("JSON envelope has no string field %s", e.Field)
+	}
+	return []byte(value), nil
+}
+
+// URL 百分号编码，默认保留字母数字和-_.~，All为true时编码所有字节，适用于注入点
+type URL struct {
+	All bool
+}
+
+func (e URL) Encode(data []byte) ([]byte, error) {
+	const digits = "0123456789ABCDEF"
+	encoded := make([]byte, 0, len(data)*3)
+	for _, b := range data {
+		if !e.All && (b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~') {
+			encoded = append(encoded, b)
+			continue
+		}
+		encoded = append(encoded, '%', digits[b>>4], digits[b&0x0f])
+	}
+	return encoded, nil
+}
+
+func (URL) Decode(data []byte) ([]byte, error) {
+	decoded, err := url.PathUnescape(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode URL encoding: %v", err)
+	}
+	return []byte(decoded), nil
+}
+
+// UTF16LE 将UTF-8文本转换为UTF-16LE，与base64组合即为PowerShell -EncodedCommand的格式
+type UTF16LE struct{}
+
+func (UTF16LE) Encode(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("Failed to encode UTF-16LE: input is not valid UTF-8")
+	}
+	units := utf16.Encode([]rune(string(data)))
+	encoded := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(encoded[i*2:], u)
+	}
+	return encoded, nil
+}
+
+func (UTF16LE) Decode(data []byte) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("Failed to decode UTF-16LE: odd length %d", len(data))
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
@@ -8,13 +8,24 @@ type Config struct {
 	RandomUsers  int
 	WhitelistIPs string
 	ShowUsers    bool
+	ArsenalAddr  string // 工具托管HTTP服务监听地址，为空时不启动
+	ArsenalURL   string // 生成下载命令时使用的外部访问地址
+	OOBHTTPAddr  string // 带外交互HTTP监听地址，为空时不启动
+	OOBDNSAddr   string // 带外交互DNS(UDP)监听地址，为空时不启动
+	OOBDomain    string // 解析到DNS监听器的域名，用于生成DNS回连地址
+	OOBIP        string // DNS监听器对A记录查询返回的IP，为空时不返回记录
+	HolderSocket string // 会话保持进程的Unix套接字，为空时不启用
+
+	ScrollbackDir       string // 会话输出日志目录，为空时只在内存中保留输出
+	ScrollbackRetention int64  // 每个会话的输出日志保留的字节数
+	ScrollbackHot       int    // 每个会话在内存中保留的最近输出字节数
 }
 
 // 全局配置实例
 var AppConfig Config
 
 // Initialize 初始化应用程序配置
-func Initialize(serverPort, username, password string, randomUsers int, whitelistIPs string, showUsers bool) {
+func Initialize(serverPort, username, password string, randomUsers int, whitelistIPs string, showUsers bool, arsenalAddr, arsenalURL string) {
 	AppConfig = Config{
 		ServerPort:   serverPort,
 		Username:     username,
@@ -22,6 +33,8 @@ func Initialize(serverPort, username, password string, randomUsers int, whitelis
 		RandomUsers:  randomUsers,
 		WhitelistIPs: whitelistIPs,
 		ShowUsers:    showUsers,
+		ArsenalAddr:  arsenalAddr,
+		ArsenalURL:   arsenalURL,
 	}
 }
 
@@ -53,4 +66,74 @@ func GetWhitelistIPs() string {
 // ShouldShowUsers 是否显示所有用户
 func ShouldShowUsers() bool {
 	return AppConfig.ShowUsers
-} 
\ No newline at end of file
+} 
+
+// GetArsenalAddr 获取工具托管服务监听地址
+func GetArsenalAddr() string {
+	return AppConfig.ArsenalAddr
+}
+
+// GetArsenalURL 获取工具托管服务的外部访问地址
+func GetArsenalURL() string {
+	return AppConfig.ArsenalURL
+}
+
+// InitializeOOB 初始化带外交互监听配置
+func InitializeOOB(httpAddr, dnsAddr, domain, ip string) {
+	AppConfig.OOBHTTPAddr = httpAddr
+	AppConfig.OOBDNSAddr = dnsAddr
+	AppConfig.OOBDomain = domain
+	AppConfig.OOBIP = ip
+}
+
+// GetOOBHTTPAddr 获取带外交互HTTP监听地址
+func GetOOBHTTPAddr() string {
+	return AppConfig.OOBHTTPAddr
+}
+
+// GetOOBDNSAddr 获取带外交互DNS监听地址
+func GetOOBDNSAddr() string {
+	return AppConfig.OOBDNSAddr
+}
+
+// GetOOBDomain 获取带外交互域名
+func GetOOBDomain() string {
+	return AppConfig.OOBDomain
+}
+
+// GetOOBIP 获取DNS监听器返回的A记录IP
+func GetOOBIP() string {
+	return AppConfig.OOBIP
+}
+
+// InitializeHolder 初始化会话保持进程配置
+func InitializeHolder(socket string) {
+	AppConfig.HolderSocket = socket
+}
+
+// GetHolderSocket 获取会话保持进程的Unix套接字
+func GetHolderSocket() string {
+	return AppConfig.HolderSocket
+}
+
+// InitializeScrollback 初始化会话输出日志配置，retentionMB为每个会话保留的MB数，hotKB为内存中保留的KB数
+func InitializeScrollback(dir string, retentionMB, hotKB int) {
+	AppConfig.ScrollbackDir = dir
+	AppConfig.ScrollbackRetention = int64(retentionMB) << 20
+	AppConfig.ScrollbackHot = hotKB << 10
+}
+
+// GetScrollbackDir 获取会话输出日志目录
+func GetScrollbackDir() string {
+	return AppConfig.ScrollbackDir
+}
+
+// GetScrollbackRetention 获取每个会话的输出日志保留的字节数
+func GetScrollbackRetention() int64 {
+	return AppConfig.ScrollbackRetention
+}
+
+// GetScrollbackHot 获取每个会话在内存中保留的输出字节数
+func GetScrollbackHot() int {
+	return AppConfig.ScrollbackHot
+}
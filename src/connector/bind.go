@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"ghosteye/backend"
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/terminal"
+)
+
+// 重连参数
+const (
+	initialBackoff    = time.Second
+	maxBackoff        = time.Minute
+	maxReconnectTries = 10
+)
+
+// ConnectBindShell 连接目标主机上的绑定Shell并创建终端会话，返回终端ID
+func ConnectBindShell(username, target string) (string, error) {
+	b, err := backend.New("tcp", backend.Options{"target": target})
+	if err != nil {
+		return "", err
+	}
+
+	// 记录用户输入的目标地址，便于重连
+	terminalID := terminal.GenerateTerminalID()
+	session := terminal.NewRemoteSession(username, terminalID, models.SessionKindBind, "", target, b, nil)
+
+	go maintainConnection(session, username, terminalID, target)
+
+	return terminalID, nil
+}
+
+// RestoreBindSessions 重启后重新连接仍处于活跃状态的绑定Shell
+func RestoreBindSessions() {
+	records, err := database.GetActiveTerminalSessionsByKind(models.SessionKindBind)
+	if err != nil {
+		log.Printf("Failed to load bind shell sessions: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		// 已从会话保持进程接管的连接无需重连
+		if terminal.GetTerminalSession(record.Username, record.TerminalID) != nil {
+			continue
+		}
+
+		go func(record models.TerminalSessionRecord) {
+			b, err := reconnect(nil, record.RemoteAddr)
+			if err != nil {
+				log.Printf("Failed to restore bind shell %s to %s: %v", record.TerminalID, record.RemoteAddr, err)
+				database.SetTerminalSessionState(record.Username, record.TerminalID, models.SessionStateClosed)
+				database.SetTerminalSessionActive(record.Username, record.TerminalID, false)
+				return
+			}
+
+			session := terminal.NewRemoteSession(record.Username, record.TerminalID, models.SessionKindBind, "", record.RemoteAddr, b, record.Buffer)
+			terminal.BroadcastOutput(session, record.TerminalID, []byte("\r\n--- Bind shell reconnected ---\r\n"))
+
+			log.Printf("Bind shell %s restored to %s", record.TerminalID, record.RemoteAddr)
+			maintainConnection(session, record.Username, record.TerminalID, record.RemoteAddr)
+		}(record)
+	}
+}
+
+// maintainConnection 转发连接输出，连接断开时按指数退避重连
+func maintainConnection(session *models.TerminalSession, username, terminalID, target string) {
+	for {
+		terminal.PumpRemoteOutput(session, terminalID)
+
+		if terminal.IsSessionKilled(session) {
+			return
+		}
+
+		log.Printf("Bind shell %s to %s dropped, reconnecting", terminalID, target)
+		terminal.BroadcastOutput(session, terminalID, []byte("\r\n--- Connection lost, reconnecting ---\r\n"))
+		terminal.SetSessionState(session, username, terminalID, models.SessionStateReconnecting)
+
+		b, err := reconnect(session, target)
+		if err != nil {
+			if !terminal.IsSessionKilled(session) {
+				log.Printf("Giving up on bind shell %s to %s: %v", terminalID, target, err)
+				terminal.FinishRemoteSession(session, username, terminalID)
+			}
+			return
+		}
+
+		terminal.ReplaceBackend(username, terminalID, session, b)
+		terminal.HoldSession(username, terminalID, session)
+		terminal.SetSessionState(session, username, terminalID, models.SessionStateConnected)
+		terminal.BroadcastOutput(session, terminalID, []byte("--- Reconnected ---\r\n"))
+		log.Printf("Bind shell %s reconnected to %s", terminalID, target)
+	}
+}
+
+// reconnect 按指数退避重试连接，会话被终止时放弃
+func reconnect(session *models.TerminalSession, target string) (backend.Backend, error) {
+	backoff := initialBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= maxReconnectTries; attempt++ {
+		if session != nil {
+			select {
+			case <-session.Done:
+				return nil, fmt.Errorf("Terminal session closed")
+			case <-time.After(backoff):
+			}
+		} else {
+			time.Sleep(backoff)
+		}
+
+		b, err := backend.New("tcp", backend.Options{"target": target})
+		if err == nil {
+			// 等待期间会话可能已被终止
+			if session != nil && terminal.IsSessionKilled(session) {
+				b.Close()
+				return nil, fmt.Errorf("Terminal session closed")
+			}
+			return b, nil
+		}
+
+		lastErr = err
+		log.Printf("Reconnect attempt %d to %s failed: %v", attempt, target, err)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("Failed after %d attempts: %v", maxReconnectTries, lastErr)
+}
@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+
+	"ghosteye/backend"
+	"ghosteye/database"
+	"ghosteye/holder"
+	"ghosteye/models"
+	"ghosteye/terminal"
+	"ghosteye/upgrade"
+)
+
+// reattachedBanner 重新接管的会话中显示的提示
+const reattachedBanner = "\r\n--- Session reattached after GhostEye restart ---\r\n"
+
+// RestoreUpgradedSessions 接管升级时旧进程移交的会话，应在RestoreHeldSessions之前调用
+func RestoreUpgradedSessions() {
+	for _, entry := range upgrade.Sessions() {
+		restoreEntry(entry)
+	}
+}
+
+// RestoreHeldSessions 重启后从会话保持进程重新接管仍在运行的本地Shell和反弹、绑定Shell，
+// 应在RestoreBindSessions之前调用，已接管的绑定Shell不会再重新连接
+func RestoreHeldSessions() {
+	entries, err := holder.List()
+	if err != nil {
+		log.Printf("Failed to list held sessions: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		restoreEntry(entry)
+	}
+}
+
+// restoreEntry 接管一个会话，已由升级移交接管的会话直接跳过
+func restoreEntry(entry holder.Entry) {
+	var held models.HeldSession
+	if err := json.Unmarshal(entry.Meta, &held); err != nil || held.Username == "" {
+		log.Printf("Discarding held session %s with invalid metadata: %v", entry.ID, err)
+		entry.File.Close()
+		terminal.ReleaseSession(entry.ID)
+		return
+	}
+
+	if terminal.GetTerminalSession(held.Username, held.TerminalID) != nil {
+		entry.File.Close()
+		return
+	}
+
+	if err := resumeHeldSession(held, entry); err != nil {
+		log.Printf("Failed to reattach held session %s: %v", entry.ID, err)
+		terminal.ReleaseSession(entry.ID)
+		return
+	}
+	log.Printf("Reattached %s terminal session %s for user %s", held.Kind, held.TerminalID, held.Username)
+}
+
+// resumeHeldSession 按会话类型重建后端和终端会话
+func resumeHeldSession(held models.HeldSession, entry holder.Entry) error {
+	// 崩溃前未保存过的会话没有历史输出
+	buffer, _, err := database.LoadTerminalSessionFromDB(held.Username, held.TerminalID)
+	if err != nil {
+		entry.File.Close()
+		return err
+	}
+	if buffer == nil {
+		buffer = []byte{}
+	}
+
+	var session *models.TerminalSession
+	switch held.Kind {
+	case models.SessionKindLocal:
+		b := backend.AttachLocalPTY(entry.File, held.Pid)
+		session = terminal.ResumeLocalSession(held.Username, held.TerminalID, b, buffer)
+	case models.SessionKindReverse, models.SessionKindBind:
+		conn, err := net.FileConn(entry.File)
+		entry.File.Close()
+		if err != nil {
+			return err
+		}
+		b := backend.NewTCP(conn)
+		if held.Kind == models.SessionKindBind {
+			session = terminal.NewRemoteSession(held.Username, held.TerminalID, held.Kind, "", held.RemoteAddr, b, buffer)
+			go maintainConnection(session, held.Username, held.TerminalID, held.RemoteAddr)
+		} else {
+			session = terminal.ResumeBackendSession(held.Username, held.TerminalID, held.Kind, held.ListenerID, held.RemoteAddr, b, buffer)
+		}
+	default:
+		entry.File.Close()
+		return fmt.Errorf("Unsupported held session kind: %s", held.Kind)
+	}
+
+	terminal.ApplyHeldSession(session, held)
+	terminal.BroadcastOutput(session, held.TerminalID, []byte(reattachedBanner))
+	return database.SetTerminalSessionActive(held.Username, held.TerminalID, true)
+}
@@ -0,0 +1,23 @@
+package connector
+
+import (
+	"log"
+
+	"ghosteye/backend"
+	"ghosteye/models"
+	"ghosteye/terminal"
+)
+
+// ConnectSSH 使用SSH客户端连接目标主机并创建终端会话，返回终端ID和主机密钥指纹
+func ConnectSSH(username string, opts backend.SSHOptions) (string, string, error) {
+	b, err := backend.NewSSH(opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	terminalID := terminal.GenerateTerminalID()
+	terminal.AttachBackendSession(username, terminalID, models.SessionKindSSH, "", b.Addr, b)
+	log.Printf("SSH session %s connected to %s@%s, host key %s", terminalID, opts.User, b.Addr, b.Fingerprint)
+
+	return terminalID, b.Fingerprint, nil
+}
@@ -0,0 +1,27 @@
+package connector
+
+import (
+	"log"
+
+	"ghosteye/backend"
+	"ghosteye/models"
+	"ghosteye/terminal"
+)
+
+// ConnectWebshell 连接HTTP webshell并创建终端会话，返回终端ID
+func ConnectWebshell(username string, opts backend.WebshellOptions) (string, error) {
+	b, err := backend.NewWebshell(opts)
+	if err != nil {
+		return "", err
+	}
+
+	terminalID := terminal.GenerateTerminalID()
+	session := terminal.AttachBackendSession(username, terminalID, models.SessionKindWebshell, "", b.Host(), b)
+
+	// webshell不回显输入，由服务端行编辑器负责回显和历史记录
+	session.OS = b.OS()
+	terminal.SetLineMode(username, terminalID, session, true)
+	log.Printf("Webshell session %s connected to %s, cwd %s", terminalID, opts.URL, b.Cwd())
+
+	return terminalID, nil
+}
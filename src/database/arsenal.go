@@ -0,0 +1,215 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	
+	"ghosteye/models"
+)
+
+// AddArsenalFile 添加托管文件记录并返回其ID
+func AddArsenalFile(file *models.ArsenalFile) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO arsenal_files (username, name, path, size, sha256, os, arch, description) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		file.Username, file.Name, file.Path, file.Size, file.SHA256, file.OS, file.Arch, file.Description,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to add arsenal file: %v", err)
+	}
+	
+	return result.LastInsertId()
+}
+
+// GetArsenalFile 获取托管文件记录，不存在时返回nil
+func GetArsenalFile(id int64) (*models.ArsenalFile, error) {
+	files, err := queryArsenalFiles("SELECT id, username, name, path, size, sha256, os, arch, description, created_at FROM arsenal_files WHERE id = ?", id)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// GetArsenalFiles 获取用户的托管文件
+func GetArsenalFiles(username string) ([]models.ArsenalFile, error) {
+	return queryArsenalFiles("SELECT id, username, name, path, size, sha256, os, arch, description, created_at FROM arsenal_files WHERE username = ? ORDER BY id DESC", username)
+}
+
+// DeleteArsenalFile 删除用户的托管文件记录及其下载链接
+func DeleteArsenalFile(username string, id int64) error {
+	result, err := db.Exec("DELETE FROM arsenal_files WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete arsenal file: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Arsenal file %d does not exist or does not belong to user %s", id, username)
+	}
+	
+	if _, err := db.Exec("DELETE FROM arsenal_links WHERE file_id = ?", id); err != nil {
+		return fmt.Errorf("Failed to delete arsenal links: %v", err)
+	}
+	return nil
+}
+
+// queryArsenalFiles 查询托管文件记录
+func queryArsenalFiles(query string, args ...interface{}) ([]models.ArsenalFile, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query arsenal files: %v", err)
+	}
+	defer rows.Close()
+	
+	files := make([]models.ArsenalFile, 0)
+	for rows.Next() {
+		var f models.ArsenalFile
+		if err := rows.Scan(&f.ID, &f.Username, &f.Name, &f.Path, &f.Size, &f.SHA256, &f.OS, &f.Arch, &f.Description, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan arsenal file data: %v", err)
+		}
+		files = append(files, f)
+	}
+	
+	return files, nil
+}
+
+// AddArsenalLink 添加下载链接
+func AddArsenalLink(link *models.ArsenalLink) error {
+	_, err := db.Exec(
+		"INSERT INTO arsenal_links (token, file_id, username, one_time, expires_at, allowed_ips) VALUES (?, ?, ?, ?, ?, ?)",
+		link.Token, link.FileID, link.Username, link.OneTime, link.ExpiresAt, strings.Join(link.AllowedIPs, ","),
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add arsenal link: %v", err)
+	}
+	
+	return nil
+}
+
+// GetArsenalLink 获取下载链接，不存在时返回nil
+func GetArsenalLink(token string) (*models.ArsenalLink, error) {
+	links, err := queryArsenalLinks("SELECT token, file_id, username, one_time, expires_at, allowed_ips, downloads, revoked, created_at FROM arsenal_links WHERE token = ?", token)
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+	return &links[0], nil
+}
+
+// GetArsenalLinks 获取用户的下载链接，fileID为0时返回所有文件的链接
+func GetArsenalLinks(username string, fileID int64) ([]models.ArsenalLink, error) {
+	return queryArsenalLinks(
+		"SELECT token, file_id, username, one_time, expires_at, allowed_ips, downloads, revoked, created_at FROM arsenal_links WHERE username = ? AND (? = 0 OR file_id = ?) ORDER BY id DESC",
+		username, fileID, fileID,
+	)
+}
+
+// ClaimArsenalLink 为一次下载占用链接，一次性链接已被使用或链接已撤销时返回false
+func ClaimArsenalLink(token string) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE arsenal_links SET downloads = downloads + 1 WHERE token = ? AND revoked = 0 AND (one_time = 0 OR downloads = 0)",
+		token,
+	)
+	if err != nil {
+		return false, fmt.Errorf("Failed to claim arsenal link: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// RevokeArsenalLink 撤销用户的下载链接
+func RevokeArsenalLink(username, token string) error {
+	result, err := db.Exec("UPDATE arsenal_links SET revoked = 1 WHERE username = ? AND token = ?", username, token)
+	if err != nil {
+		return fmt.Errorf("Failed to revoke arsenal link: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Arsenal link %s does not exist or does not belong to user %s", token, username)
+	}
+	return nil
+}
+
+// queryArsenalLinks 查询下载链接
+func queryArsenalLinks(query string, args ...interface{}) ([]models.ArsenalLink, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query arsenal links: %v", err)
+	}
+	defer rows.Close()
+	
+	links := make([]models.ArsenalLink, 0)
+	for rows.Next() {
+		var link models.ArsenalLink
+		var oneTime, revoked int
+		var allowedIPs string
+		if err := rows.Scan(&link.Token, &link.FileID, &link.Username, &oneTime, &link.ExpiresAt, &allowedIPs, &link.Downloads, &revoked, &link.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan arsenal link data: %v", err)
+		}
+		link.OneTime = oneTime == 1
+		link.Revoked = revoked == 1
+		link.AllowedIPs = []string{}
+		if allowedIPs != "" {
+			link.AllowedIPs = strings.Split(allowedIPs, ",")
+		}
+		links = append(links, link)
+	}
+	
+	return links, nil
+}
+
+// AddArsenalDownload 记录一次下载请求
+func AddArsenalDownload(token string, fileID int64, username, remoteIP, userAgent, status string) error {
+	_, err := db.Exec(
+		"INSERT INTO arsenal_downloads (token, file_id, username, remote_ip, user_agent, status) VALUES (?, ?, ?, ?, ?, ?)",
+		token, fileID, username, remoteIP, userAgent, status,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add arsenal download: %v", err)
+	}
+	
+	return nil
+}
+
+// GetArsenalDownloads 获取用户文件的下载日志，fileID为0时返回所有文件的日志
+func GetArsenalDownloads(username string, fileID int64) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT d.id, d.token, d.file_id, COALESCE(f.name, ''), d.remote_ip, d.user_agent, d.status, d.created_at FROM arsenal_downloads d LEFT JOIN arsenal_files f ON f.id = d.file_id WHERE d.username = ? AND (? = 0 OR d.file_id = ?) ORDER BY d.id DESC",
+		username, fileID, fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query arsenal downloads: %v", err)
+	}
+	defer rows.Close()
+	
+	downloads := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id, fid int64
+		var token, name, remoteIP, userAgent, status, createdAt string
+		if err := rows.Scan(&id, &token, &fid, &name, &remoteIP, &userAgent, &status, &createdAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan arsenal download data: %v", err)
+		}
+		
+		downloads = append(downloads, map[string]interface{}{
+			"id":         id,
+			"token":      token,
+			"file_id":    fid,
+			"name":       name,
+			"remote_ip":  remoteIP,
+			"user_agent": userAgent,
+			"status":     status,
+			"created_at": createdAt,
+		})
+	}
+	
+	return downloads, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// SaveCertificate 保存证书和私钥，同名证书会被覆盖
+func SaveCertificate(name, certPEM, keyPEM, fingerprint string) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO certificates (name, cert_pem, key_pem, fingerprint) VALUES (?, ?, ?, ?)",
+		name, certPEM, keyPEM, fingerprint,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to save certificate: %v", err)
+	}
+	
+	log.Printf("Certificate %s saved, fingerprint %s", name, fingerprint)
+	return nil
+}
+
+// GetCertificate 获取证书和私钥，不存在时返回空字符串
+func GetCertificate(name string) (string, string, string, error) {
+	var certPEM, keyPEM, fingerprint string
+	err := db.QueryRow(
+		"SELECT cert_pem, key_pem, fingerprint FROM certificates WHERE name = ?",
+		name,
+	).Scan(&certPEM, &keyPEM, &fingerprint)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return "", "", "", nil
+		}
+		return "", "", "", fmt.Errorf("Failed to query certificate: %v", err)
+	}
+	
+	return certPEM, keyPEM, fingerprint, nil
+}
+
+// DeleteCertificate 删除证书
+func DeleteCertificate(name string) error {
+	_, err := db.Exec("DELETE FROM certificates WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("Failed to delete certificate: %v", err)
+	}
+	
+	return nil
+}
@@ -6,10 +6,10 @@ import (
 )
 
 // AddUserCommand 添加用户命令
-func AddUserCommand(username, name, command, description string) error {
+func AddUserCommand(username, name, command, description, encoders string) error {
 	_, err := db.Exec(
-		"INSERT INTO user_commands (username, name, command, description) VALUES (?, ?, ?, ?)",
-		username, name, command, description,
+		"INSERT INTO user_commands (username, name, command, description, encoders) VALUES (?, ?, ?, ?, ?)",
+		username, name, command, description, encoders,
 	)
 	if err != nil {
 		return fmt.Errorf("Failed to add user command: %v", err)
@@ -20,10 +20,10 @@ func AddUserCommand(username, name, command, description string) error {
 }
 
 // UpdateUserCommand 更新用户命令
-func UpdateUserCommand(username, name, command, description string) error {
+func UpdateUserCommand(username, name, command, description, encoders string) error {
 	result, err := db.Exec(
-		"UPDATE user_commands SET command = ?, description = ? WHERE username = ? AND name = ?",
-		command, description, username, name,
+		"UPDATE user_commands SET command = ?, description = ?, encoders = ? WHERE username = ? AND name = ?",
+		command, description, encoders, username, name,
 	)
 	if err != nil {
 		return fmt.Errorf("Failed to update user command: %v", err)
@@ -68,7 +68,7 @@ func DeleteUserCommand(username, name string) error {
 // GetUserCommands 获取用户命令
 func GetUserCommands(username string) ([]map[string]interface{}, error) {
 	rows, err := db.Query(
-		"SELECT id, name, command, description, created_at FROM user_commands WHERE username = ? ORDER BY name",
+		"SELECT id, name, command, description, COALESCE(encoders, ''), created_at FROM user_commands WHERE username = ? ORDER BY name",
 		username,
 	)
 	if err != nil {
@@ -79,8 +79,8 @@ func GetUserCommands(username string) ([]map[string]interface{}, error) {
 	commands := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var id int
-		var name, command, description, createdAt string
-		if err := rows.Scan(&id, &name, &command, &description, &createdAt); err != nil {
+		var name, command, description, encoders, createdAt string
+		if err := rows.Scan(&id, &name, &command, &description, &encoders, &createdAt); err != nil {
 			return nil, fmt.Errorf("Failed to scan user command data: %v", err)
 		}
 		
@@ -89,6 +89,7 @@ func GetUserCommands(username string) ([]map[string]interface{}, error) {
 			"name":        name,
 			"command":     command,
 			"description": description,
+			"encoders":    encoders,
 			"created_at":  createdAt,
 		})
 	}
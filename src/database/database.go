@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	
 	_ "modernc.org/sqlite"
 )
@@ -14,8 +15,8 @@ var db *sql.DB
 // InitDatabase 初始化数据库
 func InitDatabase() error {
 	var err error
-	// 打开SQLite数据库连接
-	db, err = sql.Open("sqlite", "./ghosteye.db")
+	// 打开SQLite数据库连接，多个会话并发写入时等待锁释放而不是直接失败
+	db, err = sql.Open("sqlite", "./ghosteye.db?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return fmt.Errorf("Failed to open database: %v", err)
 	}
@@ -62,6 +63,11 @@ func InitDatabase() error {
 		return fmt.Errorf("Failed to create user commands table: %v", err)
 	}
 
+	// 命令模板可以指定编码流水线
+	if err = addColumnIfMissing("user_commands", "encoders", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
 	// 创建终端会话表，用于持久化终端会话
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS terminal_sessions (
@@ -79,10 +85,334 @@ func InitDatabase() error {
 		return fmt.Errorf("Failed to create terminal sessions table: %v", err)
 	}
 
+	// 为旧版本数据库补充远程会话字段
+	if err = addColumnIfMissing("terminal_sessions", "kind", "TEXT DEFAULT 'local'"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("terminal_sessions", "remote_addr", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("terminal_sessions", "listener_id", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("terminal_sessions", "state", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("terminal_sessions", "host_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("terminal_sessions", "buffer_start", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 创建监听器表，用于重启后恢复监听器
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS listeners (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			listener_id TEXT UNIQUE NOT NULL,
+			username TEXT NOT NULL,
+			bind_addr TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			accepted INTEGER DEFAULT 0,
+			running INTEGER DEFAULT 1,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create listeners table: %v", err)
+	}
+
+	// 多会话模式的监听器接收连接后继续监听
+	if err = addColumnIfMissing("listeners", "multi", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	// TLS监听器使用本地CA签发的证书
+	if err = addColumnIfMissing("listeners", "protocol", "TEXT DEFAULT 'tcp'"); err != nil {
+		return err
+	}
+
+	// 创建证书表，保存本地CA和监听器证书
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS certificates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			cert_pem TEXT NOT NULL,
+			key_pem TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create certificates table: %v", err)
+	}
+
+	// 创建Shell历史命令表，用于服务端行编辑
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS shell_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			terminal_id TEXT NOT NULL,
+			host TEXT NOT NULL,
+			line TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create shell history table: %v", err)
+	}
+
+	// 创建文件传输记录表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS file_transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			terminal_id TEXT NOT NULL,
+			direction TEXT NOT NULL,
+			method TEXT NOT NULL,
+			remote_path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			sha256 TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create file transfers table: %v", err)
+	}
+
+	// 下载记录需要保存进度和本地路径以支持断点续传
+	if err = addColumnIfMissing("file_transfers", "status", "TEXT DEFAULT 'complete'"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("file_transfers", "transferred", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("file_transfers", "local_path", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// 创建反弹Shell命令模板表，内置模板启动时写入，团队可添加自定义模板，模板名在同一用户内唯一
+	_, err = db.Exec(payloadTemplatesTable)
+	if err != nil {
+		return fmt.Errorf("Failed to create payload templates table: %v", err)
+	}
+	if err = migratePayloadTemplates(); err != nil {
+		return err
+	}
+
+	// 创建托管工具文件表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS arsenal_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			name TEXT NOT NULL,
+			path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			sha256 TEXT NOT NULL DEFAULT '',
+			os TEXT NOT NULL DEFAULT '',
+			arch TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create arsenal files table: %v", err)
+	}
+
+	// 创建下载链接表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS arsenal_links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT UNIQUE NOT NULL,
+			file_id INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			one_time INTEGER DEFAULT 0,
+			expires_at INTEGER DEFAULT 0,
+			allowed_ips TEXT NOT NULL DEFAULT '',
+			downloads INTEGER DEFAULT 0,
+			revoked INTEGER DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create arsenal links table: %v", err)
+	}
+
+	// 创建下载日志表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS arsenal_downloads (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT NOT NULL,
+			file_id INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			remote_ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create arsenal downloads table: %v", err)
+	}
+
+	// 创建带外交互令牌表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oob_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT UNIQUE NOT NULL,
+			username TEXT NOT NULL,
+			label TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create OOB tokens table: %v", err)
+	}
+
+	// 创建带外交互记录表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oob_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT NOT NULL,
+			username TEXT NOT NULL,
+			protocol TEXT NOT NULL,
+			remote_addr TEXT NOT NULL,
+			request TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create OOB hits table: %v", err)
+	}
+
+	// 创建主机表，会话通过host_id关联到主机
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS hosts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			host_key TEXT NOT NULL,
+			hostname TEXT NOT NULL DEFAULT '',
+			os TEXT NOT NULL DEFAULT '',
+			os_release TEXT NOT NULL DEFAULT '',
+			kernel TEXT NOT NULL DEFAULT '',
+			user TEXT NOT NULL DEFAULT '',
+			ips TEXT NOT NULL DEFAULT '',
+			facts TEXT NOT NULL DEFAULT '{}',
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(username, host_key)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create hosts table: %v", err)
+	}
+
+	// 创建主机探测命令表，内置命令只在首次启动时写入，之后可以修改或停用
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS host_probe_steps (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			os TEXT NOT NULL,
+			command TEXT NOT NULL,
+			enabled INTEGER DEFAULT 1,
+			builtin INTEGER DEFAULT 0,
+			UNIQUE(name, os)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create host probe steps table: %v", err)
+	}
+
+	// 创建战利品表，tags以逗号分隔
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS loot (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			type TEXT NOT NULL,
+			account TEXT NOT NULL DEFAULT '',
+			secret TEXT NOT NULL DEFAULT '',
+			service TEXT NOT NULL DEFAULT '',
+			host_id INTEGER DEFAULT 0,
+			terminal_id TEXT NOT NULL DEFAULT '',
+			transfer_id INTEGER DEFAULT 0,
+			excerpt TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			notes TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create loot table: %v", err)
+	}
+
 	log.Println("Database initialized successfully")
 	return nil
 }
 
+// addColumnIfMissing 为已存在的表添加新列，列已存在时忽略
+func addColumnIfMissing(table, column, definition string) error {
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return fmt.Errorf("Failed to add column %s to table %s: %v", column, table, err)
+	}
+	return nil
+}
+
+// payloadTemplatesTable 反弹Shell命令模板表
+const payloadTemplatesTable = `
+		CREATE TABLE IF NOT EXISTS payload_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			platform TEXT NOT NULL DEFAULT 'linux',
+			protocol TEXT NOT NULL DEFAULT 'tcp',
+			pin TEXT NOT NULL DEFAULT '',
+			requires TEXT NOT NULL DEFAULT '',
+			template TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			builtin INTEGER DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(username, name)
+		)
+	`
+
+// migratePayloadTemplates 旧版本的模板名在所有用户之间唯一，重建表改为在同一用户内唯一
+func migratePayloadTemplates() error {
+	var schema string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'payload_templates'").Scan(&schema)
+	if err != nil {
+		return fmt.Errorf("Failed to read payload templates schema: %v", err)
+	}
+	if strings.Contains(schema, "UNIQUE(username, name)") {
+		return nil
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to migrate payload templates table: %v", err)
+	}
+	defer tx.Rollback()
+	
+	const columns = "id, name, platform, protocol, pin, requires, template, description, builtin, username, created_at"
+	statements := []string{
+		"ALTER TABLE payload_templates RENAME TO payload_templates_old",
+		payloadTemplatesTable,
+		"INSERT INTO payload_templates (" + columns + ") SELECT " + columns + " FROM payload_templates_old",
+		"DROP TABLE payload_templates_old",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("Failed to migrate payload templates table: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to migrate payload templates table: %v", err)
+	}
+	
+	log.Println("Migrated payload templates table to per-user template names")
+	return nil
+}
+
 // CloseDatabase 关闭数据库连接
 func CloseDatabase() {
 	if db != nil {
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"fmt"
+)
+
+// AddShellHistory 保存一条Shell历史命令
+func AddShellHistory(username, terminalID, host, line string) error {
+	_, err := db.Exec(
+		"INSERT INTO shell_history (username, terminal_id, host, line) VALUES (?, ?, ?, ?)",
+		username, terminalID, host, line,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add shell history: %v", err)
+	}
+	
+	return nil
+}
+
+// GetShellHistory 获取会话和同一主机上的历史命令，按时间先后排序
+func GetShellHistory(username, terminalID, host string, limit int) ([]string, error) {
+	rows, err := db.Query(
+		"SELECT line FROM (SELECT id, line FROM shell_history WHERE username = ? AND (terminal_id = ? OR host = ?) ORDER BY id DESC LIMIT ?) ORDER BY id",
+		username, terminalID, host, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query shell history: %v", err)
+	}
+	defer rows.Close()
+	
+	lines := make([]string, 0)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("Failed to scan shell history data: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	
+	return lines, nil
+}
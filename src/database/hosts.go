@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	
+	"ghosteye/models"
+)
+
+// SaveHost 保存主机探测结果，同一用户下host_key相同的主机会被更新，返回主机ID
+func SaveHost(host *models.Host) (int64, error) {
+	facts, err := json.Marshal(host.Facts)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to encode host facts: %v", err)
+	}
+	
+	_, err = db.Exec(
+		`INSERT INTO hosts (username, host_key, hostname, os, os_release, kernel, user, ips, facts) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username, host_key) DO UPDATE SET hostname = excluded.hostname, os = excluded.os, os_release = excluded.os_release,
+			kernel = excluded.kernel, user = excluded.user, ips = excluded.ips, facts = excluded.facts, last_seen = CURRENT_TIMESTAMP`,
+		host.Username, host.HostKey, host.Hostname, host.OS, host.OSRelease, host.Kernel, host.User, strings.Join(host.IPs, ","), string(facts),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to save host: %v", err)
+	}
+	
+	var id int64
+	err = db.QueryRow("SELECT id FROM hosts WHERE username = ? AND host_key = ?", host.Username, host.HostKey).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to query host: %v", err)
+	}
+	return id, nil
+}
+
+// GetHost 获取用户的主机，不存在时返回nil
+func GetHost(username string, id int64) (*models.Host, error) {
+	hosts, err := queryHosts("WHERE username = ? AND id = ?", username, id)
+	if err != nil || len(hosts) == 0 {
+		return nil, err
+	}
+	return &hosts[0], nil
+}
+
+// GetHosts 获取用户的所有主机
+func GetHosts(username string) ([]models.Host, error) {
+	return queryHosts("WHERE username = ? ORDER BY last_seen DESC", username)
+}
+
+// DeleteHost 删除用户的主机并解除会话关联
+func DeleteHost(username string, id int64) error {
+	result, err := db.Exec("DELETE FROM hosts WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete host: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Host %d does not exist or does not belong to user %s", id, username)
+	}
+	
+	if _, err := db.Exec("UPDATE terminal_sessions SET host_id = 0 WHERE username = ? AND host_id = ?", username, id); err != nil {
+		return fmt.Errorf("Failed to unlink host sessions: %v", err)
+	}
+	return nil
+}
+
+// queryHosts 查询主机记录
+func queryHosts(where string, args ...interface{}) ([]models.Host, error) {
+	rows, err := db.Query("SELECT id, username, host_key, hostname, os, os_release, kernel, user, ips, facts, first_seen, last_seen FROM hosts "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query hosts: %v", err)
+	}
+	defer rows.Close()
+	
+	hosts := make([]models.Host, 0)
+	for rows.Next() {
+		var host models.Host
+		var ips, facts string
+		if err := rows.Scan(&host.ID, &host.Username, &host.HostKey, &host.Hostname, &host.OS, &host.OSRelease, &host.Kernel, &host.User, &ips, &facts, &host.FirstSeen, &host.LastSeen); err != nil {
+			return nil, fmt.Errorf("Failed to scan host data: %v", err)
+		}
+		host.IPs = []string{}
+		if ips != "" {
+			host.IPs = strings.Split(ips, ",")
+		}
+		if err := json.Unmarshal([]byte(facts), &host.Facts); err != nil {
+			host.Facts = map[string]string{}
+		}
+		hosts = append(hosts, host)
+	}
+	
+	return hosts, nil
+}
+
+// SetTerminalSessionHost 将终端会话关联到主机
+func SetTerminalSessionHost(username, terminalID string, hostID int64) error {
+	_, err := db.Exec(
+		"UPDATE terminal_sessions SET host_id = ? WHERE username = ? AND terminal_id = ?",
+		hostID, username, terminalID,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to link terminal session to host: %v", err)
+	}
+	
+	return nil
+}
+
+// GetTerminalSessionHostID 获取终端会话关联的主机ID，未关联时返回0
+func GetTerminalSessionHostID(username, terminalID string) (int64, error) {
+	var hostID int64
+	err := db.QueryRow(
+		"SELECT COALESCE(host_id, 0) FROM terminal_sessions WHERE username = ? AND terminal_id = ?",
+		username, terminalID,
+	).Scan(&hostID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to query terminal session host: %v", err)
+	}
+	return hostID, nil
+}
+
+// GetHostSessions 获取关联到主机的终端会话，hostID为0时返回所有已关联的会话，结果按主机ID分组
+func GetHostSessions(username string, hostID int64) (map[int64][]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT host_id, terminal_id, COALESCE(kind, 'local'), COALESCE(remote_addr, ''), active, last_active FROM terminal_sessions WHERE username = ? AND host_id > 0 AND (? = 0 OR host_id = ?) ORDER BY last_active DESC",
+		username, hostID, hostID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query host sessions: %v", err)
+	}
+	defer rows.Close()
+	
+	sessions := make(map[int64][]map[string]interface{})
+	for rows.Next() {
+		var id int64
+		var terminalID, kind, remoteAddr, lastActive string
+		var active int
+		if err := rows.Scan(&id, &terminalID, &kind, &remoteAddr, &active, &lastActive); err != nil {
+			return nil, fmt.Errorf("Failed to scan host session data: %v", err)
+		}
+		sessions[id] = append(sessions[id], map[string]interface{}{
+			"terminal_id": terminalID,
+			"kind":        kind,
+			"remote_addr": remoteAddr,
+			"active":      active == 1,
+			"last_active": lastActive,
+		})
+	}
+	
+	return sessions, nil
+}
+
+// AddDefaultProbeSteps 写入内置探测命令，已存在的命令保持用户的修改
+func AddDefaultProbeSteps(steps []models.ProbeStep) error {
+	for _, step := range steps {
+		_, err := db.Exec(
+			"INSERT OR IGNORE INTO host_probe_steps (name, os, command, enabled, builtin) VALUES (?, ?, ?, ?, 1)",
+			step.Name, step.OS, step.Command, step.Enabled,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to add probe step %s: %v", step.Name, err)
+		}
+	}
+	
+	return nil
+}
+
+// SaveProbeStep 添加或修改探测命令
+func SaveProbeStep(step models.ProbeStep) error {
+	_, err := db.Exec(
+		`INSERT INTO host_probe_steps (name, os, command, enabled) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name, os) DO UPDATE SET command = excluded.command, enabled = excluded.enabled`,
+		step.Name, step.OS, step.Command, step.Enabled,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to save probe step: %v", err)
+	}
+	
+	return nil
+}
+
+// DeleteProbeStep 删除自定义探测命令，内置命令只能停用
+func DeleteProbeStep(name, os string) error {
+	result, err := db.Exec("DELETE FROM host_probe_steps WHERE name = ? AND os = ? AND builtin = 0", name, os)
+	if err != nil {
+		return fmt.Errorf("Failed to delete probe step: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Probe step %s for %s does not exist or is builtin", name, os)
+	}
+	return nil
+}
+
+// GetProbeSteps 获取探测命令，os为空时返回所有系统的命令
+func GetProbeSteps(os string) ([]models.ProbeStep, error) {
+	rows, err := db.Query(
+		"SELECT name, os, command, enabled, builtin FROM host_probe_steps WHERE ? = '' OR os = ? ORDER BY os, id",
+		os, os,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query probe steps: %v", err)
+	}
+	defer rows.Close()
+	
+	steps := make([]models.ProbeStep, 0)
+	for rows.Next() {
+		var step models.ProbeStep
+		var enabled, builtin int
+		if err := rows.Scan(&step.Name, &step.OS, &step.Command, &enabled, &builtin); err != nil {
+			return nil, fmt.Errorf("Failed to scan probe step data: %v", err)
+		}
+		step.Enabled = enabled == 1
+		step.Builtin = builtin == 1
+		steps = append(steps, step)
+	}
+	
+	return steps, nil
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	
+	"ghosteye/models"
+)
+
+// AddListener 保存监听器记录
+func AddListener(listenerID, username, bindAddr string, port int, multi bool, protocol string) error {
+	multiValue := 0
+	if multi {
+		multiValue = 1
+	}
+	
+	_, err := db.Exec(
+		"INSERT INTO listeners (listener_id, username, bind_addr, port, multi, protocol, running) VALUES (?, ?, ?, ?, ?, ?, 1)",
+		listenerID, username, bindAddr, port, multiValue, protocol,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add listener: %v", err)
+	}
+	
+	log.Printf("Listener %s for user %s saved to database", listenerID, username)
+	return nil
+}
+
+// SetListenerRunning 设置监听器运行状态
+func SetListenerRunning(listenerID string, running bool) error {
+	runningValue := 0
+	if running {
+		runningValue = 1
+	}
+	
+	_, err := db.Exec("UPDATE listeners SET running = ? WHERE listener_id = ?", runningValue, listenerID)
+	if err != nil {
+		return fmt.Errorf("Failed to set listener running status: %v", err)
+	}
+	
+	return nil
+}
+
+// IncrementListenerAccepted 增加监听器已接收的连接数
+func IncrementListenerAccepted(listenerID string) error {
+	_, err := db.Exec("UPDATE listeners SET accepted = accepted + 1 WHERE listener_id = ?", listenerID)
+	if err != nil {
+		return fmt.Errorf("Failed to update listener accepted count: %v", err)
+	}
+	
+	return nil
+}
+
+// DeleteListener 删除监听器记录
+func DeleteListener(username, listenerID string) error {
+	result, err := db.Exec("DELETE FROM listeners WHERE username = ? AND listener_id = ?", username, listenerID)
+	if err != nil {
+		return fmt.Errorf("Failed to delete listener: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	
+	if rowsAffected == 0 {
+		return fmt.Errorf("Listener %s does not exist or does not belong to user %s", listenerID, username)
+	}
+	
+	log.Printf("Listener %s for user %s deleted", listenerID, username)
+	return nil
+}
+
+// GetListener 获取监听器记录
+func GetListener(listenerID string) (*models.ListenerRecord, error) {
+	var record models.ListenerRecord
+	var multi, running int
+	err := db.QueryRow(
+		"SELECT listener_id, username, bind_addr, port, multi, COALESCE(protocol, 'tcp'), accepted, running, created_at FROM listeners WHERE listener_id = ?",
+		listenerID,
+	).Scan(&record.ListenerID, &record.Username, &record.BindAddr, &record.Port, &multi, &record.Protocol, &record.Accepted, &running, &record.CreatedAt)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to query listener: %v", err)
+	}
+	
+	record.Multi = multi == 1
+	record.Running = running == 1
+	return &record, nil
+}
+
+// GetUserListeners 获取用户的监听器记录
+func GetUserListeners(username string) ([]models.ListenerRecord, error) {
+	return queryListeners(
+		"SELECT listener_id, username, bind_addr, port, multi, COALESCE(protocol, 'tcp'), accepted, running, created_at FROM listeners WHERE username = ? ORDER BY created_at DESC",
+		username,
+	)
+}
+
+// GetRunningListeners 获取所有应处于运行状态的监听器
+func GetRunningListeners() ([]models.ListenerRecord, error) {
+	return queryListeners(
+		"SELECT listener_id, username, bind_addr, port, multi, COALESCE(protocol, 'tcp'), accepted, running, created_at FROM listeners WHERE running = 1",
+	)
+}
+
+// queryListeners 执行监听器查询并扫描结果
+func queryListeners(query string, args ...interface{}) ([]models.ListenerRecord, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query listeners: %v", err)
+	}
+	defer rows.Close()
+	
+	records := make([]models.ListenerRecord, 0)
+	for rows.Next() {
+		var record models.ListenerRecord
+		var multi, running int
+		if err := rows.Scan(&record.ListenerID, &record.Username, &record.BindAddr, &record.Port, &multi, &record.Protocol, &record.Accepted, &running, &record.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan listener data: %v", err)
+		}
+		record.Multi = multi == 1
+		record.Running = running == 1
+		records = append(records, record)
+	}
+	
+	return records, nil
+}
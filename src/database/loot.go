@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	
+	"ghosteye/models"
+)
+
+// lootColumns 查询战利品时的字段顺序，与scanLoot保持一致
+const lootColumns = "id, username, type, account, secret, service, host_id, terminal_id, transfer_id, excerpt, tags, notes, created_at, updated_at"
+
+// AddLoot 添加战利品并返回其ID
+func AddLoot(loot *models.Loot) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO loot (username, type, account, secret, service, host_id, terminal_id, transfer_id, excerpt, tags, notes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		loot.Username, loot.Type, loot.Account, loot.Secret, loot.Service, loot.HostID, loot.TerminalID, loot.TransferID, loot.Excerpt, strings.Join(loot.Tags, ","), loot.Notes,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to add loot: %v", err)
+	}
+	
+	return result.LastInsertId()
+}
+
+// UpdateLoot 修改用户的战利品
+func UpdateLoot(loot *models.Loot) error {
+	result, err := db.Exec(
+		`UPDATE loot SET type = ?, account = ?, secret = ?, service = ?, host_id = ?, terminal_id = ?, transfer_id = ?, excerpt = ?, tags = ?, notes = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE username = ? AND id = ?`,
+		loot.Type, loot.Account, loot.Secret, loot.Service, loot.HostID, loot.TerminalID, loot.TransferID, loot.Excerpt, strings.Join(loot.Tags, ","), loot.Notes,
+		loot.Username, loot.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to update loot: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Loot %d does not exist or does not belong to user %s", loot.ID, loot.Username)
+	}
+	return nil
+}
+
+// DeleteLoot 删除用户的战利品
+func DeleteLoot(username string, id int64) error {
+	result, err := db.Exec("DELETE FROM loot WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete loot: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("Loot %d does not exist or does not belong to user %s", id, username)
+	}
+	return nil
+}
+
+// GetLoot 获取用户的战利品，不存在时返回nil
+func GetLoot(username string, id int64) (*models.Loot, error) {
+	loot, err := queryLoot("SELECT "+lootColumns+" FROM loot WHERE username = ? AND id = ?", username, id)
+	if err != nil || len(loot) == 0 {
+		return nil, err
+	}
+	return &loot[0], nil
+}
+
+// SearchLoot 按条件查询用户的战利品，最新的在前
+func SearchLoot(username string, filter models.LootFilter) ([]models.Loot, error) {
+	where := []string{"username = ?"}
+	args := []interface{}{username}
+	
+	if filter.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Tag != "" {
+		where = append(where, `(',' || tags || ',') LIKE ? ESCAPE '\'`)
+		args = append(args, "%,"+escapeLike(filter.Tag)+",%")
+	}
+	if filter.HostID > 0 {
+		where = append(where, "host_id = ?")
+		args = append(args, filter.HostID)
+	}
+	if filter.TerminalID != "" {
+		where = append(where, "terminal_id = ?")
+		args = append(args, filter.TerminalID)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		where = append(where, `(account LIKE ? ESCAPE '\' OR secret LIKE ? ESCAPE '\' OR service LIKE ? ESCAPE '\' OR notes LIKE ? ESCAPE '\' OR excerpt LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	
+	return queryLoot("SELECT "+lootColumns+" FROM loot WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC", args...)
+}
+
+// queryLoot 查询战利品记录
+func queryLoot(query string, args ...interface{}) ([]models.Loot, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query loot: %v", err)
+	}
+	defer rows.Close()
+	
+	loot := make([]models.Loot, 0)
+	for rows.Next() {
+		var l models.Loot
+		var tags string
+		if err := rows.Scan(&l.ID, &l.Username, &l.Type, &l.Account, &l.Secret, &l.Service, &l.HostID, &l.TerminalID, &l.TransferID, &l.Excerpt, &tags, &l.Notes, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan loot data: %v", err)
+		}
+		l.Tags = []string{}
+		if tags != "" {
+			l.Tags = strings.Split(tags, ",")
+		}
+		loot = append(loot, l)
+	}
+	
+	return loot, nil
+}
+
+// escapeLike 转义LIKE模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AddOOBToken 添加带外交互令牌
+func AddOOBToken(token, username, label string) error {
+	_, err := db.Exec(
+		"INSERT INTO oob_tokens (token, username, label) VALUES (?, ?, ?)",
+		token, username, label,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add OOB token: %v", err)
+	}
+	
+	return nil
+}
+
+// DeleteOOBToken 删除用户的带外交互令牌及其记录
+func DeleteOOBToken(username, token string) error {
+	result, err := db.Exec("DELETE FROM oob_tokens WHERE username = ? AND token = ?", username, token)
+	if err != nil {
+		return fmt.Errorf("Failed to delete OOB token: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("OOB token %s does not exist or does not belong to user %s", token, username)
+	}
+	
+	return ClearOOBHits(username, token)
+}
+
+// GetOOBTokenOwner 获取令牌所属用户，令牌不存在时返回空字符串
+func GetOOBTokenOwner(token string) (string, error) {
+	var username string
+	err := db.QueryRow("SELECT username FROM oob_tokens WHERE token = ?", token).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to query OOB token: %v", err)
+	}
+	return username, nil
+}
+
+// GetOOBTokens 获取用户的带外交互令牌及命中次数
+func GetOOBTokens(username string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT t.token, t.label, t.created_at, COUNT(h.id) FROM oob_tokens t LEFT JOIN oob_hits h ON h.token = t.token WHERE t.username = ? GROUP BY t.id ORDER BY t.id DESC",
+		username,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query OOB tokens: %v", err)
+	}
+	defer rows.Close()
+	
+	tokens := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var token, label, createdAt string
+		var hits int
+		if err := rows.Scan(&token, &label, &createdAt, &hits); err != nil {
+			return nil, fmt.Errorf("Failed to scan OOB token data: %v", err)
+		}
+		
+		tokens = append(tokens, map[string]interface{}{
+			"token":      token,
+			"label":      label,
+			"hits":       hits,
+			"created_at": createdAt,
+		})
+	}
+	
+	return tokens, nil
+}
+
+// AddOOBHit 记录一次带外交互并返回记录ID
+func AddOOBHit(token, username, protocol, remoteAddr, request string) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO oob_hits (token, username, protocol, remote_addr, request) VALUES (?, ?, ?, ?, ?)",
+		token, username, protocol, remoteAddr, request,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to add OOB hit: %v", err)
+	}
+	
+	return result.LastInsertId()
+}
+
+// GetOOBHits 获取用户的带外交互记录，token为空时返回所有令牌的记录
+func GetOOBHits(username, token string, limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT id, token, protocol, remote_addr, request, created_at FROM oob_hits WHERE username = ? AND (? = '' OR token = ?) ORDER BY id DESC LIMIT ?",
+		username, token, token, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query OOB hits: %v", err)
+	}
+	defer rows.Close()
+	
+	hits := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id int64
+		var tok, protocol, remoteAddr, request, createdAt string
+		if err := rows.Scan(&id, &tok, &protocol, &remoteAddr, &request, &createdAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan OOB hit data: %v", err)
+		}
+		
+		hits = append(hits, map[string]interface{}{
+			"id":          id,
+			"token":       tok,
+			"protocol":    protocol,
+			"remote_addr": remoteAddr,
+			"request":     request,
+			"created_at":  createdAt,
+		})
+	}
+	
+	return hits, nil
+}
+
+// ClearOOBHits 清空用户令牌的带外交互记录，token为空时清空所有记录
+func ClearOOBHits(username, token string) error {
+	_, err := db.Exec("DELETE FROM oob_hits WHERE username = ? AND (? = '' OR token = ?)", username, token, token)
+	if err != nil {
+		return fmt.Errorf("Failed to clear OOB hits: %v", err)
+	}
+	
+	return nil
+}
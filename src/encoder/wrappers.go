@@ -0,0 +1,74 @@
+package encoder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"ghosteye/codec"
+	"ghosteye/utils"
+)
+
+func init() {
+	Register("bash-c", shellFactory("bash", func(shell string) Step { return ShellC{Shell: shell} }))
+	Register("sh-c", shellFactory("sh", func(shell string) Step { return ShellC{Shell: shell} }))
+	Register("bash-b64", shellFactory("bash", func(shell string) Step { return Base64Pipe{Shell: shell} }))
+	Register("sh-b64", shellFactory("sh", func(shell string) Step { return Base64Pipe{Shell: shell} }))
+	Register("powershell-enc", func(opts codec.Options) (Step, error) {
+		return PowerShellEnc{Exe: optionOr(opts, "exe", "powershell")}, nil
+	})
+	Register("python-exec", func(opts codec.Options) (Step, error) {
+		return PythonExec{Python: optionOr(opts, "python", "python3")}, nil
+	})
+}
+
+// ShellC 以 sh -c '...' 的形式执行命令
+type ShellC struct {
+	Shell string
+}
+
+func (w ShellC) Apply(command string) (string, error) {
+	return fmt.Sprintf("%s -c '%s'", w.Shell, strings.ReplaceAll(command, "'", `'\''`)), nil
+}
+
+// Base64Pipe 以 echo ...|base64 -d|sh 的形式执行命令，命令中的引号和特殊字符不再需要转义
+type Base64Pipe struct {
+	Shell string
+}
+
+func (w Base64Pipe) Apply(command string) (string, error) {
+	return fmt.Sprintf("echo %s|base64 -d|%s", base64.StdEncoding.EncodeToString([]byte(command)), w.Shell), nil
+}
+
+// PowerShellEnc 将PowerShell脚本编码为UTF-16LE Base64，以 powershell -EncodedCommand 执行
+type PowerShellEnc struct {
+	Exe string
+}
+
+func (w PowerShellEnc) Apply(script string) (string, error) {
+	return fmt.Sprintf("%s -NoProfile -NonInteractive -EncodedCommand %s", w.Exe, utils.EncodePowerShell(script)), nil
+}
+
+// PythonExec 将Python代码编码为Base64，以 python -c "exec(...)" 执行
+type PythonExec struct {
+	Python string
+}
+
+func (w PythonExec) Apply(code string) (string, error) {
+	return fmt.Sprintf(`%s -c "exec(__import__('base64').b64decode('%s'))"`, w.Python, base64.StdEncoding.EncodeToString([]byte(code))), nil
+}
+
+// shellFactory 创建可通过shell参数替换解释器的包装器
+func shellFactory(def string, build func(shell string) Step) Factory {
+	return func(opts codec.Options) (Step, error) {
+		return build(optionOr(opts, "shell", def)), nil
+	}
+}
+
+// optionOr 读取参数，未设置时返回默认值
+func optionOr(opts codec.Options, key, def string) string {
+	if value := opts[key]; value != "" {
+		return value
+	}
+	return def
+}
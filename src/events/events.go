@@ -0,0 +1,62 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer 每个订阅者缓存的事件数，客户端处理不过来时丢弃新事件
+const subscriberBuffer = 64
+
+// Event 推送给面板的事件
+type Event struct {
+	Type string      `json:"type"`
+	Time int64       `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// 用户名 -> 订阅者
+var (
+	subscribers    = make(map[string]map[chan Event]struct{})
+	subscribersMux sync.Mutex
+)
+
+// Subscribe 订阅用户的事件
+func Subscribe(username string) chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	subscribersMux.Lock()
+	defer subscribersMux.Unlock()
+
+	if subscribers[username] == nil {
+		subscribers[username] = make(map[chan Event]struct{})
+	}
+	subscribers[username][ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe 取消订阅
+func Unsubscribe(username string, ch chan Event) {
+	subscribersMux.Lock()
+	defer subscribersMux.Unlock()
+
+	delete(subscribers[username], ch)
+	if len(subscribers[username]) == 0 {
+		delete(subscribers, username)
+	}
+}
+
+// Publish 向用户所有已连接的面板推送事件，不会阻塞
+func Publish(username, eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now().Unix(), Data: data}
+
+	subscribersMux.Lock()
+	defer subscribersMux.Unlock()
+
+	for ch := range subscribers[username] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ghosteye/auth"
+)
+
+// pingInterval 保持事件连接的心跳间隔
+const pingInterval = 30 * time.Second
+
+// WebSocket升级器
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		return true // 允许所有来源
+	},
+}
+
+// Handler 面板的事件WebSocket连接，与终端连接一样通过URL参数token认证
+func Handler(w http.ResponseWriter, r *http.Request) {
+	username, valid := auth.ValidateToken(r.URL.Query().Get("token"))
+	if !valid {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v, %s", err, r.RemoteAddr)
+		return
+	}
+	defer conn.Close()
+
+	ch := Subscribe(username)
+	defer Unsubscribe(username, ch)
+
+	// 读取客户端消息只为及时发现连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-ch:
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package filemgr
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghosteye/utils"
+)
+
+// 默认分块大小
+const DefaultChunkSize = 32 * 1024
+
+// Executor 能够执行命令并返回完整输出的会话后端，例如webshell
+type Executor interface {
+	Exec(command string) ([]byte, error)
+	OS() string
+}
+
+// FileInfo 远程文件信息
+type FileInfo struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime int64  `json:"mod_time"`
+	Type    string `json:"type"` // file / dir / link / other
+}
+
+// Manager 通过会话后端执行命令实现的远程文件管理器
+type Manager struct {
+	exec      Executor
+	windows   bool
+	marker    string
+	ChunkSize int // 上传和下载的分块大小（字节）
+}
+
+// New 创建文件管理器
+func New(exec Executor) *Manager {
+	return &Manager{
+		exec:      exec,
+		windows:   exec.OS() == "windows",
+		marker:    fmt.Sprintf("GErc%08x:", rand.Uint32()),
+		ChunkSize: DefaultChunkSize,
+	}
+}
+
+// run 执行命令并检查退出码，返回去掉退出码标记后的输出
+func (m *Manager) run(unixCmd, psScript string) (string, error) {
+	var command string
+	if m.windows {
+		script := fmt.Sprintf("$ErrorActionPreference='Stop';try{%s;'%s0'}catch{$_.Exception.Message;'%s1'}", psScript, m.marker, m.marker)
+		command = "powershell -NoProfile -NonInteractive -EncodedCommand " + utils.EncodePowerShell(script)
+	} else {
+		command = fmt.Sprintf("{ %s\n} 2>&1; echo \"%s$?\"", unixCmd, m.marker)
+	}
+
+	out, err := m.exec.Exec(command)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(out)
+	idx := strings.LastIndex(text, m.marker)
+	if idx < 0 {
+		return "", fmt.Errorf("Unexpected response: %s", strings.TrimSpace(text))
+	}
+	code := strings.TrimSpace(text[idx+len(m.marker):])
+	text = text[:idx]
+	if code != "0" {
+		return "", fmt.Errorf("Command failed: %s", strings.TrimSpace(text))
+	}
+
+	return text, nil
+}
+
+// List 列出目录内容
+func (m *Manager) List(path string) ([]FileInfo, error) {
+	out, err := m.run(
+		fmt.Sprintf(`if cd -- %s; then for f in * .[!.]* ..?*; do if [ -e "$f" ] || [ -L "$f" ]; then stat -c '%%s/%%a/%%Y/%%F/%%n' -- "$f"; fi; done; true; else false; fi`, utils.QuoteShell(path)),
+		fmt.Sprintf(`Get-ChildItem -Force -LiteralPath %s | ForEach-Object { '{0}/{1}/{2}/{3}/{4}' -f $(if($_.PSIsContainer){0}else{$_.Length}), $_.Mode, [int64](($_.LastWriteTimeUtc - [datetime]'1970-01-01').TotalSeconds), $(if($_.PSIsContainer){'directory'}else{'regular file'}), $_.Name }`, quotePowerShell(path)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimRight(line, "\r"), "/", 5)
+		if len(parts) != 5 {
+			continue
+		}
+		size, _ := strconv.ParseInt(parts[0], 10, 64)
+		mtime, _ := strconv.ParseInt(parts[2], 10, 64)
+		files = append(files, FileInfo{
+			Name:    parts[4],
+			Size:    size,
+			Mode:    parts[1],
+			ModTime: mtime,
+			Type:    fileType(parts[3]),
+		})
+	}
+
+	return files, nil
+}
+
+// Size 返回远程文件大小
+func (m *Manager) Size(path string) (int64, error) {
+	out, err := m.run(
+		fmt.Sprintf("stat -c %%s -- %s", utils.QuoteShell(path)),
+		fmt.Sprintf("(Get-Item -Force -LiteralPath %s).Length", quotePowerShell(path)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+// Hash 返回远程文件的SHA256
+func (m *Manager) Hash(path string) (string, error) {
+	out, err := m.run(
+		fmt.Sprintf("(sha256sum -- %s 2>/dev/null || openssl dgst -sha256 -r %s) | cut -d' ' -f1", utils.QuoteShell(path), utils.QuoteShell(path)),
+		fmt.Sprintf("(Get-FileHash -Algorithm SHA256 -LiteralPath %s).Hash.ToLower()", quotePowerShell(path)),
+	)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(out)), nil
+}
+
+// Download 分块下载远程文件并校验SHA256
+func (m *Manager) Download(path string) ([]byte, error) {
+	size, err := m.Size(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, size)
+	for offset := int64(0); offset < size; offset += int64(m.ChunkSize) {
+		out, err := m.run(
+			fmt.Sprintf("dd if=%s bs=%d skip=%d count=1 2>/dev/null | base64", utils.QuoteShell(path), m.ChunkSize, offset/int64(m.ChunkSize)),
+			fmt.Sprintf("$f=[IO.File]::OpenRead(%s);$f.Seek(%d,0)|Out-Null;$b=New-Object byte[] %d;$n=$f.Read($b,0,%d);$f.Close();[Convert]::ToBase64String($b,0,$n)", quotePowerShell(path), offset, m.ChunkSize, m.ChunkSize),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk, err := base64.StdEncoding.DecodeString(stripSpace(out))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode chunk at offset %d: %v", offset, err)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		data = append(data, chunk...)
+	}
+
+	if err := m.verify(path, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Upload 分块上传文件并校验SHA256
+func (m *Manager) Upload(path string, data []byte) error {
+	for offset := 0; offset == 0 || offset < len(data); offset += m.ChunkSize {
+		end := offset + m.ChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		encoded := base64.StdEncoding.EncodeToString(data[offset:end])
+
+		// 第一块创建文件，后续追加；Append模式只能以Write访问打开
+		redirect, mode := ">", "Create"
+		if offset > 0 {
+			redirect, mode = ">>", "Append"
+		}
+		_, err := m.run(
+			fmt.Sprintf("printf '%%s' '%s' | base64 -d %s %s", encoded, redirect, utils.QuoteShell(path)),
+			fmt.Sprintf("$b=[Convert]::FromBase64String('%s');$f=[IO.File]::Open(%s,'%s','Write');$f.Write($b,0,$b.Length);$f.Close()", encoded, quotePowerShell(path), mode),
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to upload chunk at offset %d: %v", offset, err)
+		}
+	}
+
+	return m.verify(path, data)
+}
+
+// verify 比较远程文件与本地数据的SHA256
+func (m *Manager) verify(path string, data []byte) error {
+	remote, err := m.Hash(path)
+	if err != nil {
+		return fmt.Errorf("Failed to hash remote file: %v", err)
+	}
+	if local := Sum(data); remote != local {
+		return fmt.Errorf("SHA256 mismatch: local %s, remote %s", local, remote)
+	}
+	return nil
+}
+
+// Delete 删除文件或目录
+func (m *Manager) Delete(path string) error {
+	_, err := m.run(
+		fmt.Sprintf("rm -rf -- %s", utils.QuoteShell(path)),
+		fmt.Sprintf("Remove-Item -Recurse -Force -LiteralPath %s", quotePowerShell(path)),
+	)
+	return err
+}
+
+// Rename 重命名或移动文件
+func (m *Manager) Rename(from, to string) error {
+	_, err := m.run(
+		fmt.Sprintf("mv -- %s %s", utils.QuoteShell(from), utils.QuoteShell(to)),
+		fmt.Sprintf("Move-Item -Force -LiteralPath %s -Destination %s", quotePowerShell(from), quotePowerShell(to)),
+	)
+	return err
+}
+
+// Touch 修改文件时间戳，reference不为空时复制参考文件的时间，否则使用mtime，文件不存在时创建
+func (m *Manager) Touch(path string, mtime time.Time, reference string) error {
+	if reference != "" {
+		_, err := m.run(
+			fmt.Sprintf("touch -r %s -- %s", utils.QuoteShell(reference), utils.QuoteShell(path)),
+			fmt.Sprintf("$r=Get-Item -Force -LiteralPath %s;if(-not(Test-Path -LiteralPath %s)){New-Item -ItemType File -Path %s|Out-Null};$i=Get-Item -Force -LiteralPath %s;$i.LastWriteTimeUtc=$r.LastWriteTimeUtc;$i.CreationTimeUtc=$r.CreationTimeUtc;$i.LastAccessTimeUtc=$r.LastAccessTimeUtc",
+				quotePowerShell(reference), quotePowerShell(path), quotePowerShell(path), quotePowerShell(path)),
+		)
+		return err
+	}
+
+	if mtime.IsZero() {
+		mtime = time.Now()
+	}
+	_, err := m.run(
+		fmt.Sprintf("TZ=UTC0 touch -t %s -- %s", mtime.UTC().Format("200601021504.05"), utils.QuoteShell(path)),
+		fmt.Sprintf("if(-not(Test-Path -LiteralPath %s)){New-Item -ItemType File -Path %s|Out-Null};$i=Get-Item -Force -LiteralPath %s;$t=[datetime]::SpecifyKind([datetime]'%s','Utc');$i.LastWriteTimeUtc=$t;$i.LastAccessTimeUtc=$t",
+			quotePowerShell(path), quotePowerShell(path), quotePowerShell(path), mtime.UTC().Format("2006-01-02T15:04:05")),
+	)
+	return err
+}
+
+// Sum 计算数据的SHA256
+func Sum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileType 将stat的文件类型描述转换为简短类型
+func fileType(kind string) string {
+	switch {
+	case kind == "directory":
+		return "dir"
+	case kind == "symbolic link":
+		return "link"
+	case strings.HasPrefix(kind, "regular"):
+		return "file"
+	default:
+		return "other"
+	}
+}
+
+// quotePowerShell 使用单引号转义PowerShell参数
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// stripSpace 去掉所有空白字符
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,133 @@
+package filemgr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"ghosteye/utils"
+)
+
+// fakeExec 记录收到的命令。Unix命令在本机shell中执行，
+// Windows命令解码出PowerShell脚本后按hashes返回Get-FileHash的结果
+type fakeExec struct {
+	os       string
+	marker   string
+	hashes   map[string]string
+	commands []string
+}
+
+func (f *fakeExec) OS() string {
+	return f.os
+}
+
+func (f *fakeExec) Exec(command string) ([]byte, error) {
+	if f.os != "windows" {
+		f.commands = append(f.commands, command)
+		return exec.Command("/bin/sh", "-c", command).CombinedOutput()
+	}
+
+	script := decodePowerShell(command)
+	f.commands = append(f.commands, script)
+	for path, hash := range f.hashes {
+		if strings.Contains(script, "Get-FileHash") && strings.Contains(script, quotePowerShell(path)) {
+			return []byte(hash + "\r\n" + f.marker + "0\r\n"), nil
+		}
+	}
+	return []byte(f.marker + "0\r\n"), nil
+}
+
+// decodePowerShell 还原-EncodedCommand中的脚本
+func decodePowerShell(command string) string {
+	fields := strings.Fields(command)
+	raw, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func newTestManager(f *fakeExec, chunkSize int) *Manager {
+	m := New(f)
+	m.ChunkSize = chunkSize
+	f.marker = m.marker
+	return m
+}
+
+func TestUploadUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "it's a file")
+	data := bytes.Repeat([]byte("0123456789\x00\xff"), 10)
+
+	f := &fakeExec{os: "linux"}
+	m := newTestManager(f, 50)
+	if err := m.Upload(path, data); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Errorf("uploaded %d bytes, want %d", len(written), len(data))
+	}
+
+	// 三个分块加一次校验
+	if len(f.commands) != 4 {
+		t.Fatalf("ran %d commands, want 4", len(f.commands))
+	}
+	quoted := utils.QuoteShell(path)
+	if !strings.Contains(f.commands[0], "base64 -d > "+quoted) {
+		t.Errorf("first chunk does not create the file: %s", f.commands[0])
+	}
+	for _, command := range f.commands[1:3] {
+		if !strings.Contains(command, "base64 -d >> "+quoted) {
+			t.Errorf("later chunk does not append to the file: %s", command)
+		}
+	}
+}
+
+func TestUploadWindows(t *testing.T) {
+	path := `C:\Users\o'neil\a.txt`
+	data := bytes.Repeat([]byte("x"), 20)
+
+	f := &fakeExec{os: "windows", hashes: map[string]string{path: Sum(data)}}
+	m := newTestManager(f, 8)
+	if err := m.Upload(path, data); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if len(f.commands) != 4 {
+		t.Fatalf("ran %d commands, want 4", len(f.commands))
+	}
+	quoted := quotePowerShell(path)
+	if want := "[IO.File]::Open(" + quoted + ",'Create','Write')"; !strings.Contains(f.commands[0], want) {
+		t.Errorf("first chunk = %s, want %s", f.commands[0], want)
+	}
+	for _, script := range f.commands[1:3] {
+		if want := "[IO.File]::Open(" + quoted + ",'Append','Write')"; !strings.Contains(script, want) {
+			t.Errorf("later chunk = %s, want %s", script, want)
+		}
+	}
+	if want := base64.StdEncoding.EncodeToString(data[16:]); !strings.Contains(f.commands[2], "'"+want+"'") {
+		t.Errorf("last chunk does not carry the remaining data: %s", f.commands[2])
+	}
+	if !strings.HasPrefix(f.commands[0], "$ErrorActionPreference='Stop';") {
+		t.Errorf("script does not stop on errors: %s", f.commands[0])
+	}
+}
+
+func TestUploadHashMismatch(t *testing.T) {
+	f := &fakeExec{os: "windows", hashes: map[string]string{`C:\a`: Sum([]byte("other"))}}
+	m := newTestManager(f, DefaultChunkSize)
+	if err := m.Upload(`C:\a`, []byte("data")); err == nil {
+		t.Error("Upload succeeded with a mismatched remote hash")
+	}
+}
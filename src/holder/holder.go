@@ -0,0 +1,304 @@
+package holder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultSocket 会话保持进程默认监听的Unix套接字
+const DefaultSocket = "./ghosteye-holder.sock"
+
+// 协议操作，每个请求和响应为一个unixpacket数据包，文件描述符通过SCM_RIGHTS随包传递
+const (
+	opPing  = "ping"
+	opPut   = "put"
+	opDrop  = "drop"
+	opList  = "list"
+	opStop  = "stop"
+	opOK    = "ok"
+	opEntry = "entry"
+	opEnd   = "end"
+	opError = "error"
+)
+
+const (
+	maxPacket    = 64 * 1024
+	startTimeout = 3 * time.Second
+)
+
+// message 保持进程协议的数据包
+type message struct {
+	Op    string          `json:"op"`
+	ID    string          `json:"id,omitempty"`
+	Meta  json.RawMessage `json:"meta,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// Entry 保持进程中的一个会话
+type Entry struct {
+	ID   string          // 终端ID
+	Meta json.RawMessage // 恢复会话所需的元数据，由调用方定义
+	File *os.File        // 伪终端主设备或Shell连接
+}
+
+// 当前使用的保持进程
+var (
+	socketPath string
+	socketMux  sync.RWMutex
+)
+
+// Start 连接会话保持进程，未运行时以当前程序的holder子命令在新会话中启动它
+func Start(path string) error {
+	if err := supported(); err != nil {
+		return err
+	}
+	if err := ping(path); err != nil {
+		if err := spawn(path); err != nil {
+			return err
+		}
+	}
+
+	socketMux.Lock()
+	socketPath = path
+	socketMux.Unlock()
+	return nil
+}
+
+// Enabled 是否已连接会话保持进程
+func Enabled() bool {
+	return currentPath() != ""
+}
+
+// Hold 将文件描述符交给保持进程，相同ID的旧描述符会被替换并关闭
+func Hold(id string, meta interface{}, rc syscall.RawConn) error {
+	path := currentPath()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("Failed to encode held session metadata: %v", err)
+	}
+	_, err = call(path, message{Op: opPut, ID: id, Meta: data}, rc)
+	return err
+}
+
+// Release 通知保持进程关闭并丢弃会话的文件描述符
+func Release(id string) error {
+	path := currentPath()
+	if path == "" {
+		return nil
+	}
+
+	_, err := call(path, message{Op: opDrop, ID: id}, nil)
+	return err
+}
+
+// List 取回保持进程中所有会话的文件描述符副本，调用方负责关闭返回的文件
+func List() ([]Entry, error) {
+	path := currentPath()
+	if path == "" {
+		return nil, nil
+	}
+
+	conn, err := dial(path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := send(conn, message{Op: opList}, nil); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for {
+		msg, files, err := receive(conn)
+		if err != nil {
+			closeEntries(entries)
+			return nil, err
+		}
+		switch msg.Op {
+		case opEnd:
+			return entries, nil
+		case opEntry:
+			if len(files) != 1 {
+				closeFiles(files)
+				continue
+			}
+			entries = append(entries, Entry{ID: msg.ID, Meta: msg.Meta, File: files[0]})
+		default:
+			closeFiles(files)
+			closeEntries(entries)
+			return nil, fmt.Errorf("Unexpected holder response: %s %s", msg.Op, msg.Error)
+		}
+	}
+}
+
+// Stop 让保持进程关闭其持有的描述符并退出，此后GhostEye退出时Shell会随之结束
+func Stop(path string) error {
+	_, err := call(path, message{Op: opStop}, nil)
+	return err
+}
+
+// currentPath 返回已连接的保持进程套接字，未启用时为空
+func currentPath() string {
+	socketMux.RLock()
+	defer socketMux.RUnlock()
+
+	return socketPath
+}
+
+// spawn 启动保持进程并等待其开始监听
+func spawn(path string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to locate executable: %v", err)
+	}
+
+	logFile, err := os.OpenFile(strings.TrimSuffix(path, ".sock")+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to open holder log: %v", err)
+	}
+	defer logFile.Close()
+
+	// 新会话使保持进程不受主进程所在终端的信号影响
+	cmd := exec.Command(exe, "holder", "-socket", path)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start session holder: %v", err)
+	}
+	go cmd.Wait()
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		if err = ping(path); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Session holder did not start: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// ping 检查保持进程是否在运行
+func ping(path string) error {
+	_, err := call(path, message{Op: opPing}, nil)
+	return err
+}
+
+// call 发送一个请求并等待响应
+func call(path string, msg message, rc syscall.RawConn) (message, error) {
+	conn, err := dial(path)
+	if err != nil {
+		return message{}, err
+	}
+	defer conn.Close()
+
+	if err := send(conn, msg, rc); err != nil {
+		return message{}, err
+	}
+	resp, files, err := receive(conn)
+	closeFiles(files)
+	if err != nil {
+		return message{}, err
+	}
+	if resp.Op == opError {
+		return resp, fmt.Errorf("Session holder: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// dial 连接保持进程
+func dial(path string) (*net.UnixConn, error) {
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to session holder: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return conn, nil
+}
+
+// send 发送数据包，rc不为nil时随包传递其文件描述符
+func send(conn *net.UnixConn, msg message, rc syscall.RawConn) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Failed to encode holder message: %v", err)
+	}
+	if len(data) > maxPacket {
+		return fmt.Errorf("Holder message too large: %d bytes", len(data))
+	}
+
+	if rc == nil {
+		_, err = conn.Write(data)
+		return err
+	}
+
+	// 在Control回调中发送，保证发送期间描述符不会被关闭
+	var sendErr error
+	err = rc.Control(func(fd uintptr) {
+		_, _, sendErr = conn.WriteMsgUnix(data, syscall.UnixRights(int(fd)), nil)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to access file descriptor: %v", err)
+	}
+	return sendErr
+}
+
+// receive 读取一个数据包及其携带的文件描述符
+func receive(conn *net.UnixConn) (message, []*os.File, error) {
+	buf := make([]byte, maxPacket)
+	oob := make([]byte, syscall.CmsgSpace(4*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return message{}, nil, err
+	}
+
+	var files []*os.File
+	if oobn > 0 {
+		cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err == nil {
+			for _, cmsg := range cmsgs {
+				fds, err := syscall.ParseUnixRights(&cmsg)
+				if err != nil {
+					continue
+				}
+				for _, fd := range fds {
+					files = append(files, os.NewFile(uintptr(fd), "held"))
+				}
+			}
+		}
+	}
+
+	var msg message
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		closeFiles(files)
+		return message{}, nil, fmt.Errorf("Invalid holder message: %v", err)
+	}
+	return msg, files, nil
+}
+
+// closeFiles 关闭文件
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// closeEntries 关闭已取回的会话文件
+func closeEntries(entries []Entry) {
+	for _, entry := range entries {
+		entry.File.Close()
+	}
+}
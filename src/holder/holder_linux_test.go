@@ -0,0 +1,132 @@
+package holder
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startServer 在当前进程中运行保持进程的请求处理，并让客户端函数使用它
+func startServer(t *testing.T) *server {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "holder.sock")
+	listener, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{path: path, listener: listener, entries: make(map[string]*heldFile)}
+	go func() {
+		for {
+			conn, err := listener.AcceptUnix()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+
+	socketMux.Lock()
+	socketPath = path
+	socketMux.Unlock()
+	t.Cleanup(func() {
+		socketMux.Lock()
+		socketPath = ""
+		socketMux.Unlock()
+		listener.Close()
+		s.mux.Lock()
+		for _, entry := range s.entries {
+			entry.file.Close()
+		}
+		s.mux.Unlock()
+	})
+	return s
+}
+
+// holdPipe 将管道的读端交给保持进程，写入data后关闭写端
+func holdPipe(t *testing.T, id, data string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.Write([]byte(data))
+	w.Close()
+
+	rc, err := r.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Hold(id, map[string]string{"id": id}, rc); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+}
+
+func TestHoldListRelease(t *testing.T) {
+	startServer(t)
+	if !Enabled() {
+		t.Fatal("holder is not enabled")
+	}
+	if err := ping(currentPath()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	holdPipe(t, "a", "first")
+	holdPipe(t, "b", "second")
+	// 相同ID替换旧描述符
+	holdPipe(t, "b", "replaced")
+	if err := Release("a"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	// 释放不存在的会话不报错
+	if err := Release("missing"); err != nil {
+		t.Fatalf("Release missing: %v", err)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != "b" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	defer entries[0].File.Close()
+
+	var meta map[string]string
+	if err := json.Unmarshal(entries[0].Meta, &meta); err != nil || meta["id"] != "b" {
+		t.Errorf("meta = %s, %v", entries[0].Meta, err)
+	}
+	// 取回的是同一个管道的描述符副本
+	data, err := io.ReadAll(entries[0].File)
+	if err != nil || string(data) != "replaced" {
+		t.Errorf("read from held file = %q, %v", data, err)
+	}
+}
+
+func TestHolderDisabled(t *testing.T) {
+	if Enabled() {
+		t.Fatal("holder is enabled without Start")
+	}
+	if err := Hold("a", nil, nil); err != nil {
+		t.Errorf("Hold without holder: %v", err)
+	}
+	if entries, err := List(); entries != nil || err != nil {
+		t.Errorf("List without holder = %v, %v", entries, err)
+	}
+}
+
+func TestUnknownOperation(t *testing.T) {
+	startServer(t)
+
+	if _, err := call(currentPath(), message{Op: "bogus"}, nil); err == nil {
+		t.Error("unknown operation was accepted")
+	}
+	if _, err := call(currentPath(), message{Op: opPut, ID: "nofile"}, nil); err == nil {
+		t.Error("put without a file descriptor was accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package holder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// heldFile 保持进程中的一个会话
+type heldFile struct {
+	meta json.RawMessage
+	file *os.File
+}
+
+// server 会话保持进程，只持有文件描述符，不读写其中的数据
+type server struct {
+	path     string
+	listener *net.UnixListener
+	entries  map[string]*heldFile
+	mux      sync.Mutex
+}
+
+// Serve 作为会话保持进程运行，直到收到stop请求或终止信号
+func Serve(path string) error {
+	if err := supported(); err != nil {
+		return err
+	}
+	if ping(path) == nil {
+		return fmt.Errorf("Session holder is already running on %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s: %v", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("Failed to restrict socket permissions: %v", err)
+	}
+
+	s := &server{path: path, listener: listener, entries: make(map[string]*heldFile)}
+
+	// 主进程退出时终端可能发送SIGHUP，保持进程需要继续运行
+	signal.Ignore(syscall.SIGHUP)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		s.shutdown()
+	}()
+
+	log.Printf("Session holder listening on %s", path)
+	for {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			return nil
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle 处理一个连接上的请求
+func (s *server) handle(conn *net.UnixConn) {
+	defer conn.Close()
+
+	// 只接受与保持进程同一用户的进程
+	if uid, err := peerUID(conn); err != nil || uid != os.Getuid() {
+		log.Printf("Rejected holder connection from uid %d: %v", uid, err)
+		return
+	}
+
+	for {
+		msg, files, err := receive(conn)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Failed to read holder request: %v", err)
+			}
+			return
+		}
+
+		var resp message
+		switch msg.Op {
+		case opPing:
+			resp = message{Op: opOK}
+		case opPut:
+			if len(files) != 1 {
+				resp = message{Op: opError, Error: fmt.Sprintf("Expected one file descriptor, got %d", len(files))}
+				break
+			}
+			s.put(msg.ID, msg.Meta, files[0])
+			files = nil
+			resp = message{Op: opOK}
+		case opDrop:
+			s.drop(msg.ID)
+			resp = message{Op: opOK}
+		case opList:
+			if err := s.list(conn); err != nil {
+				log.Printf("Failed to send held sessions: %v", err)
+				return
+			}
+			continue
+		case opStop:
+			send(conn, message{Op: opOK}, nil)
+			s.shutdown()
+			return
+		default:
+			resp = message{Op: opError, Error: "Unknown operation: " + msg.Op}
+		}
+		closeFiles(files)
+
+		if err := send(conn, resp, nil); err != nil {
+			return
+		}
+	}
+}
+
+// put 保存会话描述符，替换同一ID的旧描述符
+func (s *server) put(id string, meta json.RawMessage, file *os.File) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if old, exists := s.entries[id]; exists {
+		old.file.Close()
+	}
+	s.entries[id] = &heldFile{meta: meta, file: file}
+	log.Printf("Holding session %s (%d held)", id, len(s.entries))
+}
+
+// drop 关闭并丢弃会话描述符
+func (s *server) drop(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.file.Close()
+		delete(s.entries, id)
+		log.Printf("Released session %s (%d held)", id, len(s.entries))
+	}
+}
+
+// list 逐个发送会话描述符的副本，最后发送结束标记
+func (s *server) list(conn *net.UnixConn) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for id, entry := range s.entries {
+		rc, err := entry.file.SyscallConn()
+		if err != nil {
+			return err
+		}
+		if err := send(conn, message{Op: opEntry, ID: id, Meta: entry.meta}, rc); err != nil {
+			return err
+		}
+	}
+	return send(conn, message{Op: opEnd}, nil)
+}
+
+// shutdown 关闭所有会话描述符并退出
+func (s *server) shutdown() {
+	s.mux.Lock()
+	for id, entry := range s.entries {
+		entry.file.Close()
+		delete(s.entries, id)
+	}
+	s.mux.Unlock()
+
+	s.listener.Close()
+	os.Remove(s.path)
+	log.Printf("Session holder stopped")
+	os.Exit(0)
+}
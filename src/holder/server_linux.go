@@ -0,0 +1,32 @@
+package holder
+
+import (
+	"net"
+	"syscall"
+)
+
+// supported 当前平台是否支持会话保持进程
+func supported() error {
+	return nil
+}
+
+// peerUID 获取对端进程的用户ID
+func peerUID(conn *net.UnixConn) (int, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = rc.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if credErr != nil {
+		return -1, credErr
+	}
+	return int(cred.Uid), nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package holder
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// supported 其他平台无法获取Unix套接字对端的用户ID，不启用会话保持进程
+func supported() error {
+	return fmt.Errorf("Session holder is not supported on %s", runtime.GOOS)
+}
+
+// peerUID 其他平台不支持，拒绝所有连接
+func peerUID(conn *net.UnixConn) (int, error) {
+	return -1, supported()
+}
@@ -0,0 +1,211 @@
+package hosts
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/events"
+	"ghosteye/models"
+	"ghosteye/terminal"
+)
+
+// EventHost 主机探测完成后推送给面板的事件类型
+const EventHost = "host"
+
+// 探测步骤名称，解析结果时按名称取输出
+const (
+	StepHostname  = "hostname"
+	StepID        = "id"
+	StepUname     = "uname"
+	StepIP        = "ip"
+	StepOSRelease = "os_release"
+	StepMachineID = "machine_id"
+)
+
+const (
+	probeDelay   = time.Second      // 新会话接入后等待Shell输出提示符再开始探测
+	stepTimeout  = 10 * time.Second // 单条探测命令的超时时间
+	maxFactBytes = 4096             // 每条探测命令保存的输出上限
+)
+
+// DefaultSteps 内置探测命令，只读取信息，不修改目标系统
+var DefaultSteps = []models.ProbeStep{
+	{Name: StepHostname, OS: models.OSLinux, Command: "hostname 2>/dev/null || cat /proc/sys/kernel/hostname", Enabled: true},
+	{Name: StepID, OS: models.OSLinux, Command: "id", Enabled: true},
+	{Name: StepUname, OS: models.OSLinux, Command: "uname -a", Enabled: true},
+	{Name: StepIP, OS: models.OSLinux, Command: "ip -o -4 addr show 2>/dev/null || ifconfig 2>/dev/null || hostname -I", Enabled: true},
+	{Name: StepOSRelease, OS: models.OSLinux, Command: "cat /etc/os-release 2>/dev/null", Enabled: true},
+	{Name: StepMachineID, OS: models.OSLinux, Command: "cat /etc/machine-id 2>/dev/null", Enabled: true},
+	{Name: StepHostname, OS: models.OSWindows, Command: "hostname", Enabled: true},
+	{Name: StepID, OS: models.OSWindows, Command: "whoami", Enabled: true},
+	{Name: StepUname, OS: models.OSWindows, Command: "ver", Enabled: true},
+	{Name: StepIP, OS: models.OSWindows, Command: "ipconfig", Enabled: true},
+}
+
+var (
+	inetPattern       = regexp.MustCompile(`inet (?:addr:)?(\d+\.\d+\.\d+\.\d+)`)
+	ipconfigPattern   = regexp.MustCompile(`IPv4[^:]*:\s*(\d+\.\d+\.\d+\.\d+)`)
+	ipv4Pattern       = regexp.MustCompile(`\b\d+\.\d+\.\d+\.\d+\b`)
+	prettyNamePattern = regexp.MustCompile(`(?m)^PRETTY_NAME="?([^"\r\n]*)"?`)
+	uidPattern        = regexp.MustCompile(`uid=\d+\(([^)]*)\)`)
+)
+
+// Init 写入内置探测命令并在新Shell接入时自动探测主机
+func Init() error {
+	if err := database.AddDefaultProbeSteps(DefaultSteps); err != nil {
+		return err
+	}
+
+	terminal.OnNewSession(func(username, terminalID string, session *models.TerminalSession) {
+		select {
+		case <-time.After(probeDelay):
+		case <-session.Done:
+			return
+		}
+		if _, err := Probe(username, terminalID, session); err != nil {
+			log.Printf("Failed to probe host of terminal session %s: %v", terminalID, err)
+		}
+	})
+	return nil
+}
+
+// Probe 在会话中执行已启用的探测命令，保存主机信息并将会话关联到主机
+func Probe(username, terminalID string, session *models.TerminalSession) (*models.Host, error) {
+	osName := session.OS
+	if osName == "" {
+		osName = models.OSLinux
+	}
+
+	steps, err := database.GetProbeSteps(osName)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := make(map[string]string)
+	for _, step := range steps {
+		if !step.Enabled {
+			continue
+		}
+		output, err := terminal.RunCommand(session, step.Command, stepTimeout, true)
+		if err != nil {
+			// 会话已关闭时没有继续的必要，其他错误跳过该步骤
+			select {
+			case <-session.Done:
+				return nil, err
+			default:
+			}
+			log.Printf("Probe step %s failed on terminal session %s: %v", step.Name, terminalID, err)
+			continue
+		}
+		output = strings.TrimSpace(strings.ReplaceAll(output, "\r", ""))
+		if len(output) > maxFactBytes {
+			output = output[:maxFactBytes]
+		}
+		facts[step.Name] = output
+	}
+	if len(facts) == 0 {
+		return nil, fmt.Errorf("No probe step produced output")
+	}
+
+	host := parseFacts(osName, facts)
+	host.Username = username
+	host.HostKey = hostKey(host, facts, session.RemoteAddr)
+
+	id, err := database.SaveHost(host)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetTerminalSessionHost(username, terminalID, id); err != nil {
+		return nil, err
+	}
+
+	saved, err := database.GetHost(username, id)
+	if err != nil || saved == nil {
+		return nil, fmt.Errorf("Failed to reload host %d: %v", id, err)
+	}
+	log.Printf("Terminal session %s identified as host %s (%s)", terminalID, saved.Hostname, saved.OSRelease)
+	events.Publish(username, EventHost, map[string]interface{}{
+		"terminal_id": terminalID,
+		"host":        saved,
+	})
+	return saved, nil
+}
+
+// parseFacts 从探测命令的输出中提取主机信息
+func parseFacts(osName string, facts map[string]string) *models.Host {
+	host := &models.Host{OS: osName, Facts: facts, IPs: []string{}}
+	host.Hostname = firstLine(facts[StepHostname])
+	host.Kernel = firstLine(facts[StepUname])
+
+	id := firstLine(facts[StepID])
+	if m := uidPattern.FindStringSubmatch(id); m != nil {
+		host.User = m[1]
+	} else {
+		host.User = id
+	}
+
+	if m := prettyNamePattern.FindStringSubmatch(facts[StepOSRelease]); m != nil {
+		host.OSRelease = m[1]
+	} else if osName == models.OSWindows {
+		host.OSRelease = host.Kernel
+	}
+
+	host.IPs = parseIPs(facts[StepIP])
+	return host
+}
+
+// parseIPs 提取IPv4地址，忽略回环地址
+func parseIPs(output string) []string {
+	var candidates []string
+	for _, pattern := range []*regexp.Regexp{inetPattern, ipconfigPattern} {
+		for _, m := range pattern.FindAllStringSubmatch(output, -1) {
+			candidates = append(candidates, m[1])
+		}
+	}
+	// hostname -I等只输出地址的命令
+	if len(candidates) == 0 {
+		candidates = ipv4Pattern.FindAllString(output, -1)
+	}
+
+	ips := []string{}
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		ip := net.ParseIP(candidate)
+		if ip == nil || ip.IsLoopback() || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		ips = append(ips, candidate)
+	}
+	return ips
+}
+
+// hostKey 生成识别主机的键，优先使用machine-id，其次主机名，都没有时使用来源IP
+func hostKey(host *models.Host, facts map[string]string, remoteAddr string) string {
+	if machineID := firstLine(facts[StepMachineID]); machineID != "" {
+		return "machine-id:" + machineID
+	}
+	if host.Hostname != "" {
+		return "hostname:" + strings.ToLower(host.Hostname)
+	}
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+	return "addr:" + ip
+}
+
+// firstLine 返回输出的第一个非空行
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,291 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"ghosteye/backend"
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/terminal"
+)
+
+// TestMain 在临时目录中初始化数据库并写入内置探测命令
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "hosts-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		if err := database.AddDefaultProbeSteps(DefaultSteps); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		return m.Run()
+	}())
+}
+
+// fakeHost 按探测命令回应预设的输出，未设置的命令输出为空
+type fakeHost struct {
+	session *models.TerminalSession
+	outputs map[string]string
+}
+
+var markers = regexp.MustCompile(`echo GE''(\w+)B; (.*); echo GE''(\w+)E`)
+
+func (f *fakeHost) Write(p []byte) (int, error) {
+	if m := markers.FindStringSubmatch(string(p)); m != nil {
+		output := "GE" + m[1] + "B\r\n" + f.outputs[m[2]] + "\r\nGE" + m[3] + "E\r\n$ "
+		go terminal.BroadcastOutput(f.session, f.session.ID, []byte(output))
+	}
+	return len(p), nil
+}
+
+func (f *fakeHost) Read(p []byte) (int, error)          { select {} }
+func (f *fakeHost) Close() error                        { return nil }
+func (f *fakeHost) Resize(cols, rows uint16) error      { return backend.ErrUnsupported }
+func (f *fakeHost) Signal(sig os.Signal) error          { return backend.ErrUnsupported }
+func (f *fakeHost) ExitStatus() (code int, exited bool) { return 0, false }
+func (f *fakeHost) TTY() bool                           { return false }
+
+// linuxOutputs 返回Linux主机的探测输出，machineID为空时没有machine-id
+func linuxOutputs(hostname, machineID, ip string) map[string]string {
+	outputs := make(map[string]string)
+	for _, step := range DefaultSteps {
+		if step.OS != models.OSLinux {
+			continue
+		}
+		switch step.Name {
+		case StepHostname:
+			outputs[step.Command] = hostname
+		case StepID:
+			outputs[step.Command] = "uid=33(www-data) gid=33(www-data) groups=33(www-data)"
+		case StepUname:
+			outputs[step.Command] = "Linux " + hostname + " 5.15.0-91-generic #101-Ubuntu SMP x86_64 GNU/Linux"
+		case StepIP:
+			outputs[step.Command] = "1: lo    inet 127.0.0.1/8 scope host lo\n2: eth0    inet " + ip + "/24 brd 10.0.0.255 scope global eth0"
+		case StepOSRelease:
+			outputs[step.Command] = "NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\nID=ubuntu"
+		case StepMachineID:
+			outputs[step.Command] = machineID
+		}
+	}
+	return outputs
+}
+
+// probe 探测一个新会话，会话记录保存在数据库中以便检查主机关联
+func probe(t *testing.T, username, terminalID, remoteAddr string, outputs map[string]string) *models.Host {
+	t.Helper()
+
+	if err := database.SaveTerminalSessionToDB(username, terminalID, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	shell := &fakeHost{outputs: outputs}
+	session := &models.TerminalSession{
+		ID:         terminalID,
+		Backend:    shell,
+		Done:       make(chan struct{}),
+		Active:     true,
+		Kind:       models.SessionKindReverse,
+		RemoteAddr: remoteAddr,
+		Buffer:     models.OutputBuffer{Max: 4096},
+	}
+	shell.session = session
+
+	host, err := Probe(username, terminalID, session)
+	if err != nil {
+		t.Fatalf("Probe(%s): %v", terminalID, err)
+	}
+	return host
+}
+
+// sessionHost 返回会话关联的主机ID
+func sessionHost(t *testing.T, username, terminalID string) int64 {
+	t.Helper()
+
+	id, err := database.GetTerminalSessionHostID(username, terminalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// hostCount 返回用户的主机数量
+func hostCount(t *testing.T, username string) int {
+	t.Helper()
+
+	hosts, err := database.GetHosts(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(hosts)
+}
+
+func TestParseFacts(t *testing.T) {
+	host := parseFacts(models.OSLinux, map[string]string{
+		StepHostname:  "web01\n",
+		StepID:        "uid=0(root) gid=0(root) groups=0(root)",
+		StepUname:     "Linux web01 5.15.0 x86_64",
+		StepIP:        "inet 127.0.0.1/8\ninet 10.0.0.5/24\ninet addr:10.0.0.5  Bcast\ninet 172.17.0.1/16",
+		StepOSRelease: "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"",
+	})
+	want := &models.Host{
+		OS:        models.OSLinux,
+		Hostname:  "web01",
+		User:      "root",
+		Kernel:    "Linux web01 5.15.0 x86_64",
+		OSRelease: "Debian GNU/Linux 12 (bookworm)",
+		IPs:       []string{"10.0.0.5", "172.17.0.1"},
+	}
+	host.Facts = nil
+	if !reflect.DeepEqual(host, want) {
+		t.Errorf("linux host = %+v, want %+v", host, want)
+	}
+
+	host = parseFacts(models.OSWindows, map[string]string{
+		StepHostname: "DC01",
+		StepID:       "corp\\administrator",
+		StepUname:    "\r\nMicrosoft Windows [Version 10.0.17763.5329]",
+		StepIP:       "   IPv4 Address. . . . . . . . . . . : 192.168.56.10\r\n   Subnet Mask . . . . . . . . . . . : 255.255.255.0",
+	})
+	if host.User != "corp\\administrator" || host.OSRelease != "Microsoft Windows [Version 10.0.17763.5329]" || !reflect.DeepEqual(host.IPs, []string{"192.168.56.10"}) {
+		t.Errorf("windows host = %+v", host)
+	}
+}
+
+func TestParseIPs(t *testing.T) {
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{"", []string{}},
+		{"10.0.0.5 172.17.0.1 10.0.0.5", []string{"10.0.0.5", "172.17.0.1"}},
+		{"inet 127.0.0.1/8 scope host lo", []string{}},
+		{"inet 999.1.1.1/8", []string{}},
+	}
+	for _, tt := range tests {
+		if got := parseIPs(tt.output); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIPs(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	tests := []struct {
+		hostname, machineID, remoteAddr string
+		want                            string
+	}{
+		{"web01", "0123abcd\n", "10.0.0.5:4444", "machine-id:0123abcd"},
+		{"WEB01", "", "10.0.0.5:4444", "hostname:web01"},
+		{"", "", "10.0.0.5:4444", "addr:10.0.0.5"},
+		{"", "", "pipe", "addr:pipe"},
+	}
+	for _, tt := range tests {
+		host := &models.Host{Hostname: tt.hostname}
+		if got := hostKey(host, map[string]string{StepMachineID: tt.machineID}, tt.remoteAddr); got != tt.want {
+			t.Errorf("hostKey(%q, %q, %q) = %q, want %q", tt.hostname, tt.machineID, tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestProbeDeduplicatesHosts(t *testing.T) {
+	t.Run("machine id", func(t *testing.T) {
+		first := probe(t, "alice", "m1", "10.0.0.5:40000", linuxOutputs("web01", "0123abcd", "10.0.0.5"))
+		if first.Hostname != "web01" || first.User != "www-data" || first.OSRelease != "Ubuntu 22.04.3 LTS" || first.HostKey != "machine-id:0123abcd" {
+			t.Fatalf("probed host = %+v", first)
+		}
+
+		// 同一machine-id的新会话更新已有主机
+		second := probe(t, "alice", "m2", "10.0.0.6:40000", linuxOutputs("web01-renamed", "0123abcd", "10.0.0.6"))
+		if second.ID != first.ID {
+			t.Fatalf("second session created host %d, want %d", second.ID, first.ID)
+		}
+		if second.Hostname != "web01-renamed" || !reflect.DeepEqual(second.IPs, []string{"10.0.0.6"}) {
+			t.Errorf("host was not updated: %+v", second)
+		}
+		if n := hostCount(t, "alice"); n != 1 {
+			t.Errorf("alice has %d hosts, want 1", n)
+		}
+		for _, id := range []string{"m1", "m2"} {
+			if got := sessionHost(t, "alice", id); got != first.ID {
+				t.Errorf("session %s linked to host %d, want %d", id, got, first.ID)
+			}
+		}
+
+		// 其他用户的相同主机单独保存
+		other := probe(t, "bob", "m3", "10.0.0.5:40000", linuxOutputs("web01", "0123abcd", "10.0.0.5"))
+		if other.ID == first.ID || other.Username != "bob" {
+			t.Errorf("bob's host = %+v, shares alice's host %d", other, first.ID)
+		}
+		if n := hostCount(t, "alice"); n != 1 {
+			t.Errorf("alice has %d hosts after bob's probe, want 1", n)
+		}
+	})
+
+	t.Run("hostname", func(t *testing.T) {
+		first := probe(t, "carol", "h1", "10.0.1.5:40000", linuxOutputs("DB01", "", "10.0.1.5"))
+		second := probe(t, "carol", "h2", "10.0.1.5:40001", linuxOutputs("db01", "", "10.0.1.5"))
+		if first.HostKey != "hostname:db01" || second.ID != first.ID {
+			t.Errorf("hosts = %+v and %+v, want one host keyed by hostname", first, second)
+		}
+		third := probe(t, "carol", "h3", "10.0.1.6:40000", linuxOutputs("db02", "", "10.0.1.6"))
+		if third.ID == first.ID {
+			t.Error("different hostnames were merged")
+		}
+		if n := hostCount(t, "carol"); n != 2 {
+			t.Errorf("carol has %d hosts, want 2", n)
+		}
+	})
+
+	t.Run("remote address", func(t *testing.T) {
+		outputs := linuxOutputs("", "", "10.0.2.5")
+		first := probe(t, "dave", "a1", "10.0.2.5:40000", outputs)
+		second := probe(t, "dave", "a2", "10.0.2.5:40001", outputs)
+		if first.HostKey != "addr:10.0.2.5" || second.ID != first.ID {
+			t.Errorf("hosts = %+v and %+v, want one host keyed by address", first, second)
+		}
+	})
+}
+
+func TestDeleteHost(t *testing.T) {
+	host := probe(t, "erin", "d1", "10.0.3.5:40000", linuxOutputs("app01", "feedface", "10.0.3.5"))
+
+	if err := database.DeleteHost("frank", host.ID); err == nil {
+		t.Error("frank deleted erin's host")
+	}
+	if h, err := database.GetHost("frank", host.ID); h != nil || err != nil {
+		t.Errorf("frank can read erin's host: %+v, %v", h, err)
+	}
+
+	if err := database.DeleteHost("erin", host.ID); err != nil {
+		t.Fatalf("DeleteHost: %v", err)
+	}
+	if got := sessionHost(t, "erin", "d1"); got != 0 {
+		t.Errorf("session is still linked to deleted host %d", got)
+	}
+
+	// 再次接入时重新创建主机
+	again := probe(t, "erin", "d2", "10.0.3.5:40000", linuxOutputs("app01", "feedface", "10.0.3.5"))
+	if again.ID == host.ID {
+		t.Errorf("deleted host id %d was reused", host.ID)
+	}
+}
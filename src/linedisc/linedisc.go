@@ -0,0 +1,383 @@
+package linedisc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 最多保留的历史记录条数
+const maxHistory = 1000
+
+// 提示符最多记录的字节数
+const maxPrompt = 256
+
+// Editor 服务端行编辑器，为不支持行编辑的原始Shell提供类似readline的编辑、历史和反向搜索
+type Editor struct {
+	line    []rune   // 当前编辑的行
+	cursor  int      // 光标位置（字符下标）
+	history []string // 历史命令
+	histPos int      // 当前浏览的历史位置，等于len(history)时表示正在编辑新行
+	saved   []rune   // 开始浏览历史前正在编辑的行
+	prompt  []byte   // 远程Shell最近输出的未换行内容，通常是提示符
+	pending []byte   // 未处理完的转义序列或UTF-8字节
+	lastCR  bool     // 上一个字符是否为回车，用于合并\r\n
+
+	// 反向搜索状态
+	searching   bool
+	query       []rune
+	searchIndex int
+
+	mutex sync.Mutex
+}
+
+// NewEditor 创建行编辑器并载入已有的历史记录
+func NewEditor(history []string) *Editor {
+	e := &Editor{}
+	for _, line := range history {
+		e.addHistory(line)
+	}
+	e.histPos = len(e.history)
+	return e
+}
+
+// Observe 记录远程Shell的输出，用于重绘时保留提示符
+func (e *Editor) Observe(output []byte) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if i := strings.LastIndexAny(string(output), "\r\n"); i >= 0 {
+		e.prompt = append([]byte{}, output[i+1:]...)
+	} else {
+		e.prompt = append(e.prompt, output...)
+	}
+	if len(e.prompt) > maxPrompt {
+		e.prompt = e.prompt[len(e.prompt)-maxPrompt:]
+	}
+}
+
+// Feed 处理客户端输入，返回需要回显给客户端的数据和用户提交的完整行
+func (e *Editor) Feed(input []byte) ([]byte, []string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var echo []byte
+	var lines []string
+
+	data := append(e.pending, input...)
+	e.pending = nil
+
+	for len(data) > 0 {
+		b := data[0]
+
+		// 合并\r\n，避免粘贴时提交空行
+		if b == '\n' && e.lastCR {
+			e.lastCR = false
+			data = data[1:]
+			continue
+		}
+		e.lastCR = b == '\r'
+
+		// 转义序列
+		if b == 0x1b {
+			n, key := parseEscape(data)
+			if n == 0 {
+				// 序列不完整，等待更多输入
+				e.pending = append([]byte{}, data...)
+				break
+			}
+			echo = append(echo, e.handleKey(key)...)
+			data = data[n:]
+			continue
+		}
+
+		// 控制字符
+		if b < 0x20 || b == 0x7f {
+			out, line, submitted := e.handleControl(b)
+			echo = append(echo, out...)
+			if submitted {
+				lines = append(lines, line)
+			}
+			data = data[1:]
+			continue
+		}
+
+		// 普通字符
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			e.pending = append([]byte{}, data...)
+			break
+		}
+		echo = append(echo, e.insert(r)...)
+		data = data[size:]
+	}
+
+	return echo, lines
+}
+
+// handleControl 处理控制字符，返回回显、提交的行以及是否提交
+func (e *Editor) handleControl(b byte) ([]byte, string, bool) {
+	var accepted []byte
+	if e.searching {
+		switch b {
+		case 0x12: // Ctrl-R 查找更早的匹配
+			e.searchNext(e.searchIndex - 1)
+			return e.renderSearch(), "", false
+		case 0x7f, 0x08: // 退格删除查询字符
+			if len(e.query) > 0 {
+				e.query = e.query[:len(e.query)-1]
+			}
+			e.searchNext(len(e.history) - 1)
+			return e.renderSearch(), "", false
+		case 0x03, 0x07: // Ctrl-C / Ctrl-G 取消搜索
+			e.searching = false
+			return e.render(), "", false
+		}
+		// 其他按键接受匹配结果后按普通方式处理
+		e.acceptSearch()
+		accepted = e.render()
+	}
+
+	switch b {
+	case '\r', '\n': // 提交
+		line := string(e.line)
+		e.addHistory(line)
+		e.line = nil
+		e.cursor = 0
+		e.histPos = len(e.history)
+		e.saved = nil
+		e.prompt = nil
+		return append(accepted, "\r\n"...), line, true
+	case 0x7f, 0x08: // 退格
+		if e.cursor > 0 {
+			e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+			e.cursor--
+		}
+	case 0x01: // Ctrl-A 行首
+		e.cursor = 0
+	case 0x05: // Ctrl-E 行尾
+		e.cursor = len(e.line)
+	case 0x02: // Ctrl-B 左移
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case 0x06: // Ctrl-F 右移
+		if e.cursor < len(e.line) {
+			e.cursor++
+		}
+	case 0x04: // Ctrl-D 删除光标处字符
+		if e.cursor < len(e.line) {
+			e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+		}
+	case 0x0b: // Ctrl-K 删除到行尾
+		e.line = e.line[:e.cursor]
+	case 0x15: // Ctrl-U 删除到行首
+		e.line = append([]rune{}, e.line[e.cursor:]...)
+		e.cursor = 0
+	case 0x17: // Ctrl-W 删除前一个单词
+		start := e.cursor
+		for start > 0 && e.line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && e.line[start-1] != ' ' {
+			start--
+		}
+		e.line = append(e.line[:start], e.line[e.cursor:]...)
+		e.cursor = start
+	case 0x03: // Ctrl-C 放弃当前行
+		e.line = nil
+		e.cursor = 0
+		e.histPos = len(e.history)
+		return append([]byte("^C\r\n"), e.prompt...), "", false
+	case 0x0c: // Ctrl-L 清屏
+		return append([]byte("\x1b[H\x1b[2J"), e.render()...), "", false
+	case 0x12: // Ctrl-R 反向搜索
+		e.searching = true
+		e.query = nil
+		e.searchIndex = len(e.history)
+		return e.renderSearch(), "", false
+	default:
+		return nil, "", false
+	}
+
+	return e.render(), "", false
+}
+
+// handleKey 处理方向键等转义序列
+func (e *Editor) handleKey(key string) []byte {
+	if e.searching {
+		e.acceptSearch()
+	}
+
+	switch key {
+	case "up":
+		if e.histPos > 0 {
+			if e.histPos == len(e.history) {
+				e.saved = append([]rune{}, e.line...)
+			}
+			e.histPos--
+			e.setLine([]rune(e.history[e.histPos]))
+		}
+	case "down":
+		if e.histPos < len(e.history) {
+			e.histPos++
+			if e.histPos == len(e.history) {
+				e.setLine(e.saved)
+			} else {
+				e.setLine([]rune(e.history[e.histPos]))
+			}
+		}
+	case "left":
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case "right":
+		if e.cursor < len(e.line) {
+			e.cursor++
+		}
+	case "home":
+		e.cursor = 0
+	case "end":
+		e.cursor = len(e.line)
+	case "delete":
+		if e.cursor < len(e.line) {
+			e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+		}
+	default:
+		return nil
+	}
+
+	return e.render()
+}
+
+// insert 在光标处插入字符
+func (e *Editor) insert(r rune) []byte {
+	if e.searching {
+		e.query = append(e.query, r)
+		e.searchNext(e.searchIndex)
+		return e.renderSearch()
+	}
+
+	e.line = append(e.line[:e.cursor], append([]rune{r}, e.line[e.cursor:]...)...)
+	e.cursor++
+
+	// 在行尾输入时只需回显该字符
+	if e.cursor == len(e.line) {
+		return []byte(string(r))
+	}
+	return e.render()
+}
+
+// setLine 替换当前行并将光标移到行尾
+func (e *Editor) setLine(line []rune) {
+	e.line = append([]rune{}, line...)
+	e.cursor = len(e.line)
+}
+
+// addHistory 添加历史记录，忽略空行和与上一条相同的命令
+func (e *Editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// searchNext 从指定位置向前查找包含查询内容的历史记录
+func (e *Editor) searchNext(from int) {
+	if from >= len(e.history) {
+		from = len(e.history) - 1
+	}
+	query := string(e.query)
+	for i := from; i >= 0; i-- {
+		if strings.Contains(e.history[i], query) {
+			e.searchIndex = i
+			return
+		}
+	}
+}
+
+// acceptSearch 结束搜索并将匹配结果放入编辑行
+func (e *Editor) acceptSearch() {
+	e.searching = false
+	if e.searchIndex >= 0 && e.searchIndex < len(e.history) {
+		e.setLine([]rune(e.history[e.searchIndex]))
+		e.histPos = e.searchIndex
+	}
+}
+
+// render 重绘提示符和当前行，并将光标移动到正确位置
+func (e *Editor) render() []byte {
+	out := []byte("\r")
+	out = append(out, e.prompt...)
+	out = append(out, string(e.line)...)
+	out = append(out, "\x1b[K"...)
+	if back := len(e.line) - e.cursor; back > 0 {
+		out = append(out, fmt.Sprintf("\x1b[%dD", back)...)
+	}
+	return out
+}
+
+// renderSearch 绘制反向搜索提示
+func (e *Editor) renderSearch() []byte {
+	match := ""
+	if e.searchIndex >= 0 && e.searchIndex < len(e.history) && strings.Contains(e.history[e.searchIndex], string(e.query)) {
+		match = e.history[e.searchIndex]
+	}
+	return []byte(fmt.Sprintf("\r(reverse-i-search)`%s': %s\x1b[K", string(e.query), match))
+}
+
+// parseEscape 解析转义序列，返回消耗的字节数和对应的按键名称，序列不完整时返回0
+func parseEscape(data []byte) (int, string) {
+	if len(data) < 2 {
+		return 0, ""
+	}
+
+	// ESC O x 形式（应用光标模式）
+	if data[1] == 'O' {
+		if len(data) < 3 {
+			return 0, ""
+		}
+		return 3, escapeKey(string(data[2]))
+	}
+
+	// 非CSI序列，单独的ESC忽略
+	if data[1] != '[' {
+		return 1, ""
+	}
+
+	// CSI序列以0x40-0x7e范围的字节结束
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return i + 1, escapeKey(string(data[2 : i+1]))
+		}
+	}
+	return 0, ""
+}
+
+// escapeKey 将转义序列映射为按键名称
+func escapeKey(seq string) string {
+	switch seq {
+	case "A":
+		return "up"
+	case "B":
+		return "down"
+	case "C":
+		return "right"
+	case "D":
+		return "left"
+	case "H", "1~", "7~":
+		return "home"
+	case "F", "4~", "8~":
+		return "end"
+	case "3~":
+		return "delete"
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package linedisc
+
+import (
+	"reflect"
+	"testing"
+)
+
+// feed 依次输入各段数据，返回提交的所有行
+func feed(e *Editor, inputs ...string) []string {
+	var lines []string
+	for _, input := range inputs {
+		_, submitted := e.Feed([]byte(input))
+		lines = append(lines, submitted...)
+	}
+	return lines
+}
+
+func TestFeedEditing(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"plain", "echo hi\r", []string{"echo hi"}},
+		{"crlf merged", "a\r\nb\n", []string{"a", "b"}},
+		{"backspace", "abc\x7f\x7fX\r", []string{"aX"}},
+		{"ctrl-h", "ab\x08\r", []string{"a"}},
+		{"ctrl-a insert", "world\x01hello \r", []string{"hello world"}},
+		{"ctrl-e", "bc\x01a\x05d\r", []string{"abcd"}},
+		{"ctrl-b ctrl-f", "ac\x02\x02\x06b\r", []string{"abc"}},
+		{"ctrl-d", "abc\x01\x04\r", []string{"bc"}},
+		{"ctrl-k", "abcdef\x1b[D\x1b[D\x0b\r", []string{"abcd"}},
+		{"ctrl-u", "abc\x1b[D\x15X\r", []string{"Xc"}},
+		{"ctrl-w", "foo bar  \x17baz\r", []string{"foo baz"}},
+		{"ctrl-c", "x\x03y\r", []string{"y"}},
+		{"arrows", "ac\x1b[Db\x1b[C\x1b[Cd\r", []string{"abcd"}},
+		{"home end", "bc\x1b[Ha\x1b[Fd\r", []string{"abcd"}},
+		{"tilde keys", "bc\x1b[1~a\x1b[4~d\r", []string{"abcd"}},
+		{"delete", "xab\x1b[H\x1b[3~\r", []string{"ab"}},
+		{"unknown escape ignored", "a\x1b[5~b\r", []string{"ab"}},
+		{"utf-8", "héllo\x7f\x7f\x7f\x7f\r", []string{"h"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feed(NewEditor(nil), tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Feed(%q) lines = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedEcho(t *testing.T) {
+	e := NewEditor(nil)
+	e.Observe([]byte("motd\r\nuser$ "))
+
+	if echo, _ := e.Feed([]byte("ab")); string(echo) != "ab" {
+		t.Errorf("echo at end of line = %q, want %q", echo, "ab")
+	}
+	want := "\ruser$ ab\x1b[K\x1b[1D"
+	if echo, _ := e.Feed([]byte("\x1b[D")); string(echo) != want {
+		t.Errorf("echo after left arrow = %q, want %q", echo, want)
+	}
+	if echo, _ := e.Feed([]byte("\x03")); string(echo) != "^C\r\nuser$ " {
+		t.Errorf("echo after ctrl-c = %q", echo)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"up", "\x1b[A\r", []string{"pwd"}},
+		{"up twice", "\x1b[A\x1b[A\r", []string{"ls"}},
+		{"up stops at oldest", "\x1b[A\x1b[A\x1b[A\x1b[A\r", []string{"ls"}},
+		{"down restores edited line", "cur\x1b[A\x1b[A\x1b[B\x1b[B\r", []string{"cur"}},
+		{"application cursor mode", "\x1bOA\r", []string{"pwd"}},
+		{"edit recalled line", "\x1b[A -P\r", []string{"pwd -P"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feed(NewEditor([]string{"ls", "pwd"}), tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Feed(%q) lines = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	e := NewEditor([]string{"ls", "", "ls", "id"})
+	feed(e, "id\r", "  \r", "whoami\r")
+
+	want := []string{"ls", "id", "whoami"}
+	if !reflect.DeepEqual(e.history, want) {
+		t.Errorf("history = %q, want %q", e.history, want)
+	}
+	if got := feed(e, "\x1b[A\x1b[A\r"); !reflect.DeepEqual(got, []string{"id"}) {
+		t.Errorf("recalled %q, want id", got)
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	history := []string{"git status", "ls -la", "git push"}
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"latest match", "\x12git\r", []string{"git push"}},
+		{"older match", "\x12git\x12\r", []string{"git status"}},
+		{"backspace query", "\x12lsx\x7f\r", []string{"ls -la"}},
+		{"cancel", "\x12git\x07\r", []string{""}},
+		{"accept then edit", "\x12status\x05 -s\r", []string{"git status -s"}},
+		{"accept with arrow", "\x12ls\x1b[D\x7f\r", []string{"ls -a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feed(NewEditor(history), tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Feed(%q) lines = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	e := NewEditor(history)
+	echo, _ := e.Feed([]byte("\x12push"))
+	want := "\r(reverse-i-search)`push': git push\x1b[K"
+	if string(echo[len(echo)-len(want):]) != want {
+		t.Errorf("search prompt = %q, want suffix %q", echo, want)
+	}
+}
+
+func TestSplitInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		want   []string
+	}{
+		{"csi split", []string{"\x1b", "[", "A", "\r"}, []string{"pwd"}},
+		{"tilde split", []string{"ab\x1b[H\x1b[3", "~\r"}, []string{"b"}},
+		{"ss3 split", []string{"\x1bO", "A\r"}, []string{"pwd"}},
+		{"utf-8 split", []string{"\xe4\xbd", "\xa0\r"}, []string{"你"}},
+		{"crlf split", []string{"a\r", "\nb\r"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feed(NewEditor([]string{"pwd"}), tt.inputs...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Feed(%q) lines = %q, want %q", tt.inputs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"ghosteye/certs"
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/terminal"
+	"ghosteye/upgrade"
+	"ghosteye/utils"
+)
+
+// 监听器协议
+const (
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
+// StartListener 启动一个反弹Shell监听器，每个接入的连接都会成为独立的终端会话。
+// multi为false时与nc -lvnp一致，接收一个连接后停止监听；
+// protocol为tls时使用本地CA签发的证书，hosts为证书额外包含的主机名或IP
+func StartListener(username, bindAddr string, port int, multi bool, protocol string, hosts []string) (*models.Listener, error) {
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("Invalid port: %d", port)
+	}
+	if bindAddr == "" {
+		bindAddr = "0.0.0.0"
+	}
+	if protocol == "" {
+		protocol = ProtocolTCP
+	}
+	if protocol != ProtocolTCP && protocol != ProtocolTLS {
+		return nil, fmt.Errorf("Unsupported protocol: %s", protocol)
+	}
+
+	id := utils.GenerateSessionID()[:8]
+
+	// 为TLS监听器签发证书
+	if protocol == ProtocolTLS {
+		if _, _, err := certs.ListenerCertificate(id, hosts); err != nil {
+			return nil, fmt.Errorf("Failed to issue listener certificate: %v", err)
+		}
+	}
+
+	l, err := startListener(id, username, bindAddr, port, multi, protocol, 0)
+	if err != nil {
+		if protocol == ProtocolTLS {
+			certs.DeleteListenerCertificate(id)
+		}
+		return nil, err
+	}
+
+	// 持久化监听器，重启后自动恢复
+	if err := database.AddListener(l.ID, username, bindAddr, port, multi, protocol); err != nil {
+		log.Printf("Failed to save listener: %v", err)
+	}
+
+	return l, nil
+}
+
+// RestoreListeners 恢复重启前处于运行状态的监听器
+func RestoreListeners() {
+	records, err := database.GetRunningListeners()
+	if err != nil {
+		log.Printf("Failed to load listeners from database: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		_, err := startListener(record.ListenerID, record.Username, record.BindAddr, record.Port, record.Multi, record.Protocol, record.Accepted)
+		if err != nil {
+			log.Printf("Failed to restore listener %s: %v", record.ListenerID, err)
+			database.SetListenerRunning(record.ListenerID, false)
+			continue
+		}
+		log.Printf("Listener %s restored on %s:%d", record.ListenerID, record.BindAddr, record.Port)
+	}
+}
+
+// startListener 打开TCP监听并开始接收连接
+func startListener(id, username, bindAddr string, port int, multi bool, protocol string, accepted int) (*models.Listener, error) {
+	ln, err := upgrade.Listen(socketName(id), net.JoinHostPort(bindAddr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on %s:%d: %v", bindAddr, port, err)
+	}
+
+	// TLS监听器在TCP监听之上完成握手
+	fingerprint := ""
+	if protocol == ProtocolTLS {
+		cert, fp, err := certs.ListenerCertificate(id, nil)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("Failed to load listener certificate: %v", err)
+		}
+		ln = tls.NewListener(ln, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		fingerprint = fp
+	}
+
+	l := &models.Listener{
+		ID:          id,
+		Username:    username,
+		BindAddr:    bindAddr,
+		Port:        port,
+		Multi:       multi,
+		Protocol:    protocol,
+		Fingerprint: fingerprint,
+		Created:     time.Now(),
+		Accepted:    accepted,
+		Sessions:    []string{},
+		Ln:          ln,
+		Done:        make(chan struct{}),
+	}
+
+	models.ListenersMux.Lock()
+	models.Listeners[l.ID] = l
+	models.ListenersMux.Unlock()
+
+	log.Printf("Listener %s started on %s:%d for user %s", l.ID, bindAddr, port, username)
+
+	go acceptLoop(l)
+
+	return l, nil
+}
+
+// socketName 监听器在升级移交时使用的名称
+func socketName(id string) string {
+	return "listener:" + id
+}
+
+// StopListener 停止用户的监听器，已接收的会话不受影响
+func StopListener(username, id string) error {
+	models.ListenersMux.Lock()
+	l, exists := models.Listeners[id]
+	if exists && l.Username == username {
+		delete(models.Listeners, id)
+	}
+	models.ListenersMux.Unlock()
+
+	if !exists || l.Username != username {
+		return fmt.Errorf("Listener %s is not running or does not belong to user %s", id, username)
+	}
+
+	close(l.Done)
+	l.Ln.Close()
+	upgrade.Forget(socketName(id))
+
+	if err := database.SetListenerRunning(id, false); err != nil {
+		log.Printf("Failed to update listener status: %v", err)
+	}
+
+	log.Printf("Listener %s on %s:%d stopped", l.ID, l.BindAddr, l.Port)
+	return nil
+}
+
+// GetListener 获取监听器
+func GetListener(id string) *models.Listener {
+	models.ListenersMux.Lock()
+	defer models.ListenersMux.Unlock()
+
+	return models.Listeners[id]
+}
+
+// GetUserListeners 获取用户的所有监听器
+func GetUserListeners(username string) []*models.Listener {
+	models.ListenersMux.Lock()
+	defer models.ListenersMux.Unlock()
+
+	listeners := make([]*models.Listener, 0)
+	for _, l := range models.Listeners {
+		if l.Username == username {
+			listeners = append(listeners, l)
+		}
+	}
+
+	return listeners
+}
+
+// acceptLoop 接收连接并为每个连接创建终端会话
+func acceptLoop(l *models.Listener) {
+	for {
+		conn, err := l.Ln.Accept()
+		if err != nil {
+			select {
+			case <-l.Done:
+				return
+			default:
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			// 升级移交期间暂停接收
+			if upgrade.WaitIfPaused(err) {
+				continue
+			}
+
+			// 临时错误稍后重试
+			log.Printf("Listener %s failed to accept connection: %v", l.ID, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		terminalID := terminal.GenerateTerminalID()
+
+		l.Mutex.Lock()
+		l.Accepted++
+		l.Sessions = append(l.Sessions, terminalID)
+		l.Mutex.Unlock()
+
+		if err := database.IncrementListenerAccepted(l.ID); err != nil {
+			log.Printf("Failed to update listener accepted count: %v", err)
+		}
+
+		log.Printf("Listener %s accepted connection from %s", l.ID, conn.RemoteAddr())
+
+		terminal.AttachRemoteSession(l.Username, terminalID, l.ID, conn)
+
+		// 单连接模式下接收到Shell后即停止监听
+		if !l.Multi {
+			log.Printf("Listener %s is in single mode, stopping after first connection", l.ID)
+			StopListener(l.Username, l.ID)
+			return
+		}
+	}
+}
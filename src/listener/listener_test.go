@@ -0,0 +1,230 @@
+package listener
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/upgrade"
+)
+
+// TestMain 在临时目录中创建旧版本的监听器表，再初始化数据库
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "listener-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := createLegacyListeners(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// createLegacyListeners 创建没有multi和protocol列的旧版本监听器表
+func createLegacyListeners() error {
+	legacy, err := sql.Open("sqlite", "./ghosteye.db")
+	if err != nil {
+		return err
+	}
+	defer legacy.Close()
+
+	_, err = legacy.Exec(`
+		CREATE TABLE listeners (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			listener_id TEXT UNIQUE NOT NULL,
+			username TEXT NOT NULL,
+			bind_addr TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			accepted INTEGER DEFAULT 0,
+			running INTEGER DEFAULT 1,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO listeners (listener_id, username, bind_addr, port, accepted, running) VALUES ('legacy01', 'alice', '0.0.0.0', 4444, 3, 0);
+	`)
+	return err
+}
+
+// freePort 返回一个当前空闲的本地端口
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// record 读取监听器的数据库记录
+func record(t *testing.T, id string) *models.ListenerRecord {
+	t.Helper()
+
+	r, err := database.GetListener(id)
+	if err != nil || r == nil {
+		t.Fatalf("GetListener(%s) = %v, %v", id, r, err)
+	}
+	return r
+}
+
+// waitRecord 等待监听器的数据库记录满足cond
+func waitRecord(t *testing.T, id string, cond func(*models.ListenerRecord) bool) *models.ListenerRecord {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r := record(t, id)
+		if cond(r) || time.Now().After(deadline) {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dial 连接监听器并保持连接到测试结束
+func dial(t *testing.T, l *models.Listener) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(l.BindAddr, strconv.Itoa(l.Port)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+}
+
+func TestLegacyListenerMigration(t *testing.T) {
+	r := record(t, "legacy01")
+	if r.Protocol != ProtocolTCP || r.Multi || r.Running || r.Accepted != 3 || r.Port != 4444 {
+		t.Errorf("migrated listener = %+v", r)
+	}
+}
+
+func TestMultiListener(t *testing.T) {
+	l, err := StartListener("alice", "127.0.0.1", freePort(t), true, "", nil)
+	if err != nil {
+		t.Fatalf("StartListener: %v", err)
+	}
+	if r := record(t, l.ID); !r.Multi || r.Protocol != ProtocolTCP || !r.Running || r.Username != "alice" {
+		t.Fatalf("saved listener = %+v", r)
+	}
+
+	// 多会话模式接收连接后继续监听
+	dial(t, l)
+	dial(t, l)
+	if r := waitRecord(t, l.ID, func(r *models.ListenerRecord) bool { return r.Accepted == 2 }); r.Accepted != 2 || !r.Running {
+		t.Fatalf("listener after two connections = %+v", r)
+	}
+	if GetListener(l.ID) == nil {
+		t.Fatal("multi listener stopped after accepting connections")
+	}
+
+	if err := StopListener("bob", l.ID); err == nil {
+		t.Error("bob stopped alice's listener")
+	}
+	if err := StopListener("alice", l.ID); err != nil {
+		t.Fatalf("StopListener: %v", err)
+	}
+	if r := record(t, l.ID); r.Running {
+		t.Errorf("stopped listener is still marked running")
+	}
+}
+
+func TestSingleListener(t *testing.T) {
+	l, err := StartListener("alice", "127.0.0.1", freePort(t), false, ProtocolTCP, nil)
+	if err != nil {
+		t.Fatalf("StartListener: %v", err)
+	}
+
+	// 单连接模式接收一个连接后停止监听
+	dial(t, l)
+	r := waitRecord(t, l.ID, func(r *models.ListenerRecord) bool { return !r.Running })
+	if r.Running || r.Accepted != 1 || r.Multi {
+		t.Fatalf("single listener after a connection = %+v", r)
+	}
+	if GetListener(l.ID) != nil {
+		t.Error("single listener is still running")
+	}
+}
+
+func TestRestoreListeners(t *testing.T) {
+	l, err := StartListener("alice", "127.0.0.1", freePort(t), true, ProtocolTLS, nil)
+	if err != nil {
+		t.Fatalf("StartListener: %v", err)
+	}
+	if l.Fingerprint == "" {
+		t.Fatal("TLS listener has no certificate fingerprint")
+	}
+
+	// 模拟重启：关闭监听但保留运行状态
+	models.ListenersMux.Lock()
+	delete(models.Listeners, l.ID)
+	models.ListenersMux.Unlock()
+	close(l.Done)
+	l.Ln.Close()
+	upgrade.Forget(socketName(l.ID))
+
+	RestoreListeners()
+	restored := GetListener(l.ID)
+	if restored == nil {
+		t.Fatal("listener was not restored")
+	}
+	defer StopListener("alice", l.ID)
+
+	if !restored.Multi || restored.Protocol != ProtocolTLS || restored.Port != l.Port || restored.Fingerprint != l.Fingerprint {
+		t.Errorf("restored listener = %+v, want %+v", restored, l)
+	}
+
+	// 恢复后仍使用同一证书完成TLS握手
+	conn, err := tls.Dial("tcp", net.JoinHostPort(l.BindAddr, strconv.Itoa(l.Port)), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+}
+
+func TestStartListenerErrors(t *testing.T) {
+	if _, err := StartListener("alice", "127.0.0.1", 0, false, "", nil); err == nil {
+		t.Error("port 0 was accepted")
+	}
+	if _, err := StartListener("alice", "127.0.0.1", freePort(t), false, "udp", nil); err == nil {
+		t.Error("unsupported protocol was accepted")
+	}
+
+	records, err := database.GetUserListeners("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.Protocol == "udp" {
+			t.Errorf("rejected listener was saved: %+v", r)
+		}
+	}
+}
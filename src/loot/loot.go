@@ -0,0 +1,157 @@
+package loot
+
+import (
+	"fmt"
+	"strings"
+
+	"ghosteye/database"
+	"ghosteye/events"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// 战利品类型
+const (
+	TypePassword = "password"
+	TypeHash     = "hash"
+	TypeKey      = "key"
+	TypeToken    = "token"
+	TypeFile     = "file"
+)
+
+// Types 支持的战利品类型
+var Types = []string{TypePassword, TypeHash, TypeKey, TypeToken, TypeFile}
+
+// EventLoot 新增战利品时推送给面板的事件类型
+const EventLoot = "loot"
+
+// maxExcerptBytes 输出片段的最大长度
+const maxExcerptBytes = 16 * 1024
+
+// Region 会话输出缓冲区中的一段区域，按字节偏移或最后若干行选取
+type Region struct {
+	Offset int `json:"offset"` // 起始字节偏移，负数表示从缓冲区末尾倒数
+	Length int `json:"length"` // 字节数，0表示到缓冲区末尾
+	Lines  int `json:"lines"`  // 大于0时改为选取去除控制序列后的最后N行
+}
+
+// Normalize 校验类型并整理标签
+func Normalize(l *models.Loot) error {
+	valid := false
+	for _, t := range Types {
+		if l.Type == t {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("Unsupported loot type: %s", l.Type)
+	}
+
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range l.Tags {
+		tag = strings.TrimSpace(strings.ReplaceAll(tag, ",", " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	l.Tags = tags
+
+	if len(l.Excerpt) > maxExcerptBytes {
+		l.Excerpt = l.Excerpt[len(l.Excerpt)-maxExcerptBytes:]
+	}
+	return nil
+}
+
+// Add 保存战利品，未指定来源主机时取来源会话关联的主机，文件类条目未填写内容时使用下载记录的远程路径
+func Add(l *models.Loot) (*models.Loot, error) {
+	if err := Normalize(l); err != nil {
+		return nil, err
+	}
+
+	if l.HostID == 0 && l.TerminalID != "" {
+		hostID, err := database.GetTerminalSessionHostID(l.Username, l.TerminalID)
+		if err != nil {
+			return nil, err
+		}
+		l.HostID = hostID
+	}
+
+	if l.TransferID > 0 {
+		transfer, err := database.GetFileTransfer(l.Username, l.TransferID)
+		if err != nil {
+			return nil, err
+		}
+		if transfer == nil {
+			return nil, fmt.Errorf("File transfer %d does not exist", l.TransferID)
+		}
+		if l.Secret == "" {
+			l.Secret = transfer["remote_path"].(string)
+		}
+		if l.TerminalID == "" {
+			l.TerminalID = transfer["terminal_id"].(string)
+		}
+	}
+
+	id, err := database.AddLoot(l)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := database.GetLoot(l.Username, id)
+	if err != nil || saved == nil {
+		return nil, fmt.Errorf("Failed to reload loot %d: %v", id, err)
+	}
+	events.Publish(l.Username, EventLoot, saved)
+	return saved, nil
+}
+
+// FromSession 将会话输出缓冲区中的区域保存为战利品，区域作为输出片段，未填写内容时同时作为内容
+func FromSession(username, terminalID string, session *models.TerminalSession, l *models.Loot, region Region) (*models.Loot, error) {
+	excerpt, err := Excerpt(session, region)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Username = username
+	l.TerminalID = terminalID
+	l.Excerpt = excerpt
+	if l.Secret == "" {
+		l.Secret = strings.TrimSpace(excerpt)
+	}
+	return Add(l)
+}
+
+// Excerpt 取出会话输出缓冲区中的区域并去除控制序列
+func Excerpt(session *models.TerminalSession, region Region) (string, error) {
+	session.Buffer.Lock()
+	data := string(session.Buffer.Data)
+	session.Buffer.Unlock()
+
+	if region.Lines > 0 {
+		lines := strings.Split(strings.TrimRight(utils.StripANSI(data), "\n"), "\n")
+		if len(lines) > region.Lines {
+			lines = lines[len(lines)-region.Lines:]
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	start := region.Offset
+	if start < 0 {
+		start += len(data)
+	}
+	if start < 0 || start > len(data) {
+		return "", fmt.Errorf("Offset %d is outside the output buffer of %d bytes", region.Offset, len(data))
+	}
+	end := len(data)
+	if region.Length > 0 && start+region.Length < end {
+		end = start + region.Length
+	}
+	if start == end {
+		return "", fmt.Errorf("Selected region is empty")
+	}
+	return utils.StripANSI(data[start:end]), nil
+}
@@ -9,14 +9,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 	
 	"ghosteye/api"
+	"ghosteye/arsenal"
+	"ghosteye/auth"
 	"ghosteye/config"
+	"ghosteye/connector"
 	"ghosteye/database"
+	"ghosteye/events"
+	"ghosteye/holder"
+	"ghosteye/hosts"
+	"ghosteye/listener"
 	"ghosteye/middleware"
+	"ghosteye/oob"
+	"ghosteye/payloads"
 	"ghosteye/terminal"
+	"ghosteye/upgrade"
 )
 
 //go:embed web/out/*
@@ -33,7 +45,26 @@ const (
 	colorCyan   = "\033[36m"
 )
 
+const (
+	// pidFile 运行中服务的pid，upgrade子命令据此发送信号
+	pidFile = "./ghosteye.pid"
+	// upgradeWait upgrade子命令等待新进程就绪的时间
+	upgradeWait = 35 * time.Second
+)
+
 func main() {
+	// 会话保持进程由主进程以子命令方式启动
+	if len(os.Args) > 1 && os.Args[1] == "holder" {
+		runHolder(os.Args[2:])
+		return
+	}
+	
+	// 通知运行中的服务切换到新的可执行文件
+	if len(os.Args) > 1 && os.Args[1] == "upgrade" {
+		runUpgrade(os.Args[2:])
+		return
+	}
+	
 	// 解析命令行参数
 	serverPort := flag.String("p", "8080", "Server listening port")
 	username := flag.String("user", "", "Specify admin username")
@@ -41,10 +72,28 @@ func main() {
 	randomUsers := flag.Int("U", 0, "Auto-generate specified number of random users")
 	whitelistIPs := flag.String("w", "", "Whitelist IP addresses, separate multiple IPs with commas")
 	showUsers := flag.Bool("show-users", false, "Show all user account information")
+	arsenalAddr := flag.String("arsenal", "", "Arsenal file hosting listen address, e.g. 0.0.0.0:8000 (disabled if empty)")
+	arsenalURL := flag.String("arsenal-url", "", "External base URL of the arsenal server used in download commands")
+	oobHTTP := flag.String("oob-http", "", "Out-of-band HTTP catcher listen address, e.g. 0.0.0.0:8880 (disabled if empty)")
+	oobDNS := flag.String("oob-dns", "", "Out-of-band DNS (UDP) catcher listen address, e.g. 0.0.0.0:53 (disabled if empty)")
+	oobDomain := flag.String("oob-domain", "", "Domain delegated to the DNS catcher, used in generated callbacks")
+	oobIP := flag.String("oob-ip", "", "IPv4 address returned by the DNS catcher for A queries")
+	holderSocket := flag.String("holder", holder.DefaultSocket, "Unix socket of the session holder that keeps shells alive across restarts (disabled if empty)")
+	scrollbackDir := flag.String("scrollback", "./scrollback", "Directory of the on-disk terminal output logs (disabled if empty)")
+	scrollbackRetention := flag.Int("scrollback-retention", 64, "Terminal output retained on disk per session, in MB")
+	scrollbackHot := flag.Int("scrollback-hot", 100, "Recent terminal output kept in memory per session, in KB")
 	flag.Parse()
 
 	// 初始化配置
-	config.Initialize(*serverPort, *username, *password, *randomUsers, *whitelistIPs, *showUsers)
+	config.Initialize(*serverPort, *username, *password, *randomUsers, *whitelistIPs, *showUsers, *arsenalAddr, *arsenalURL)
+	config.InitializeOOB(*oobHTTP, *oobDNS, *oobDomain, *oobIP)
+	config.InitializeHolder(*holderSocket)
+	config.InitializeScrollback(*scrollbackDir, *scrollbackRetention, *scrollbackHot)
+	
+	// 由升级启动时接收旧进程移交的套接字和会话
+	if err := upgrade.Init(); err != nil {
+		log.Fatalf("Upgrade handoff failed: %v", err)
+	}
 
 	// 初始化数据库
 	if err := database.InitDatabase(); err != nil {
@@ -52,6 +101,16 @@ func main() {
 	}
 	defer database.CloseDatabase()
 
+	// 写入内置反弹Shell命令模板
+	if err := payloads.Init(); err != nil {
+		log.Fatalf("Payload templates initialization failed: %v", err)
+	}
+
+	// 写入内置主机探测命令，新Shell接入时自动识别主机
+	if err := hosts.Init(); err != nil {
+		log.Fatalf("Host inventory initialization failed: %v", err)
+	}
+
 	// 处理白名单IP
 	if *whitelistIPs != "" {
 		ips := strings.Split(*whitelistIPs, ",")
@@ -125,16 +184,88 @@ func main() {
 	
 	// 设置WebSocket处理
 	mux.HandleFunc("/ws", middleware.IPWhitelistMiddleware(terminal.TerminalHandler))
+	mux.HandleFunc("/ws/events", middleware.IPWhitelistMiddleware(events.Handler))
 	
 	// 设置API路由
 	mux.HandleFunc("/api/login", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(api.LoginHandler)))
 	mux.HandleFunc("/api/status", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StatusHandler))))
-	mux.HandleFunc("/api/start", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StartHandler))))
-	mux.HandleFunc("/api/stop", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StopHandler))))
 	
 	// 终端会话相关API
 	mux.HandleFunc("/api/terminals", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ListTerminalSessionsHandler))))
 	mux.HandleFunc("/api/terminals/kill", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.KillTerminalHandler))))
+	mux.HandleFunc("/api/terminals/upgrade", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.UpgradeTerminalHandler))))
+	mux.HandleFunc("/api/terminals/sync-size", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.SyncTerminalSizeHandler))))
+	mux.HandleFunc("/api/terminals/connect", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ConnectBindShellHandler))))
+	mux.HandleFunc("/api/terminals/ssh", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ConnectSSHHandler))))
+	mux.HandleFunc("/api/terminals/webshell", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ConnectWebshellHandler))))
+	
+	// 文件管理路由（webshell会话）
+	mux.HandleFunc("/api/terminals/{id}/fs", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSListHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/download", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSDownloadHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/upload", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSUploadHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSDeleteHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/rename", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSRenameHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/touch", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSTouchHandler))))
+	mux.HandleFunc("/api/terminals/{id}/fs/transfers", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.FSTransfersHandler))))
+	
+	// 通过终端流传输文件（任意会话）
+	mux.HandleFunc("/api/terminals/{id}/upload", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StreamUploadHandler))))
+	mux.HandleFunc("/api/terminals/{id}/download", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StreamDownloadHandler))))
+	mux.HandleFunc("/api/transfers/{id}/file", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.TransferFileHandler))))
+	
+	// 监听器相关API
+	mux.HandleFunc("/api/listeners", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ListListenersHandler))))
+	mux.HandleFunc("/api/listeners/create", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.CreateListenerHandler))))
+	mux.HandleFunc("/api/listeners/stop", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.StopListenerHandler))))
+	mux.HandleFunc("/api/listeners/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeleteListenerHandler))))
+	mux.HandleFunc("/api/listeners/payloads", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ListenerPayloadsHandler))))
+	mux.HandleFunc("/api/listeners/sessions", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ListenerSessionsHandler))))
+	
+	// 反弹Shell命令生成
+	mux.HandleFunc("/api/payloads", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.PayloadsHandler))))
+	mux.HandleFunc("/api/payloads/templates", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.PayloadTemplatesHandler))))
+	mux.HandleFunc("/api/payloads/templates/add", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.AddPayloadTemplateHandler))))
+	mux.HandleFunc("/api/payloads/templates/update", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.UpdatePayloadTemplateHandler))))
+	mux.HandleFunc("/api/payloads/templates/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeletePayloadTemplateHandler))))
+	
+	// 命令编码流水线
+	mux.HandleFunc("/api/encoders", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.EncodersHandler))))
+	mux.HandleFunc("/api/encode", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.EncodeHandler))))
+	
+	// 工具文件托管
+	mux.HandleFunc("/api/arsenal", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalFilesHandler))))
+	mux.HandleFunc("/api/arsenal/upload", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalUploadHandler))))
+	mux.HandleFunc("/api/arsenal/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalDeleteHandler))))
+	mux.HandleFunc("/api/arsenal/links", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalLinksHandler))))
+	mux.HandleFunc("/api/arsenal/links/create", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalCreateLinkHandler))))
+	mux.HandleFunc("/api/arsenal/links/revoke", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalRevokeLinkHandler))))
+	mux.HandleFunc("/api/arsenal/downloads", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ArsenalDownloadsHandler))))
+	
+	// 带外交互记录
+	mux.HandleFunc("/api/oob/tokens", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.OOBTokensHandler))))
+	mux.HandleFunc("/api/oob/tokens/create", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.CreateOOBTokenHandler))))
+	mux.HandleFunc("/api/oob/tokens/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeleteOOBTokenHandler))))
+	mux.HandleFunc("/api/oob/hits", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.OOBHitsHandler))))
+	mux.HandleFunc("/api/oob/hits/clear", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ClearOOBHitsHandler))))
+	
+	// 主机清单
+	mux.HandleFunc("/api/hosts", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.HostsHandler))))
+	mux.HandleFunc("/api/hosts/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeleteHostHandler))))
+	mux.HandleFunc("/api/hosts/steps", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ProbeStepsHandler))))
+	mux.HandleFunc("/api/hosts/steps/save", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.SaveProbeStepHandler))))
+	mux.HandleFunc("/api/hosts/steps/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeleteProbeStepHandler))))
+	mux.HandleFunc("/api/terminals/{id}/probe", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.ProbeHostHandler))))
+	
+	// 战利品
+	mux.HandleFunc("/api/loot", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.LootHandler))))
+	mux.HandleFunc("/api/loot/add", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.AddLootHandler))))
+	mux.HandleFunc("/api/loot/update", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.UpdateLootHandler))))
+	mux.HandleFunc("/api/loot/delete", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.DeleteLootHandler))))
+	mux.HandleFunc("/api/terminals/{id}/loot", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.SessionLootHandler))))
+	
+	// 终端模拟器中当前屏幕的文本
+	mux.HandleFunc("/api/terminals/{id}/screen", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.TerminalScreenHandler))))
+	mux.HandleFunc("/api/terminals/{id}/output", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.TerminalOutputHandler))))
 	
 	// 命令相关API
 	mux.HandleFunc("/api/commands", middleware.IPWhitelistMiddleware(middleware.CorsMiddleware(middleware.TokenAuth(api.GetUserCommandsHandler))))
@@ -176,25 +307,72 @@ func main() {
 		w.Write(content)
 	}))
 	
-	// 创建HTTP服务器
+	// 创建HTTP服务器，升级时沿用旧进程的监听套接字
 	server := &http.Server{
-		Addr:    ":" + config.GetServerPort(),
 		Handler: mux,
 	}
+	httpListener, err := upgrade.Listen("http", ":"+config.GetServerPort())
+	if err != nil {
+		log.Fatalf("Server listening failed: %v", err)
+	}
 	
 	// 启动终端会话清理定时器
 	terminal.StartSessionCleaner()
 	
+	// 恢复重启前运行中的监听器
+	listener.RestoreListeners()
+	
+	// 接管升级前旧进程移交的Shell和登录token
+	connector.RestoreUpgradedSessions()
+	auth.RestoreTokens(upgrade.Tokens())
+	
+	// 启动或连接会话保持进程，重新接管重启前仍在运行的Shell
+	if socket := config.GetHolderSocket(); socket != "" {
+		if err := holder.Start(socket); err != nil {
+			log.Printf("Session holder unavailable, shells will not survive a restart: %v", err)
+		} else {
+			connector.RestoreHeldSessions()
+		}
+	}
+	
+	// 重新连接重启前活跃的绑定Shell
+	connector.RestoreBindSessions()
+	
+	// 启动工具托管服务，该端口不经过IP白名单，只响应有效的下载链接
+	if addr := config.GetArsenalAddr(); addr != "" {
+		if err := arsenal.Start(addr); err != nil {
+			log.Fatalf("Failed to start arsenal server: %v", err)
+		}
+	}
+	
+	// 启动带外交互监听器，同样不经过IP白名单
+	if addr := config.GetOOBHTTPAddr(); addr != "" {
+		if err := oob.StartHTTP(addr); err != nil {
+			log.Fatalf("Failed to start OOB HTTP listener: %v", err)
+		}
+	}
+	if addr := config.GetOOBDNSAddr(); addr != "" {
+		if err := oob.StartDNS(addr); err != nil {
+			log.Fatalf("Failed to start OOB DNS listener: %v", err)
+		}
+	}
+	
 	// 启动服务器
 	log.Printf("Server started, listening on port: %s\n", config.GetServerPort())
 	
 	// 在单独的goroutine中启动服务器，这样它就不会阻塞优雅退出的处理
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(httpListener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server listening failed: %v", err)
 		}
 	}()
 	
+	// 所有套接字和会话已接管，通知旧进程退出
+	upgrade.Ready()
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		log.Printf("Failed to write pid file: %v", err)
+	}
+	
 	// 设置优雅退出
 	gracefulShutdown()
 }
@@ -234,15 +412,97 @@ func isStaticResource(path string) bool {
 func gracefulShutdown() {
 	// 监听 Ctrl+C 和 kill 命令
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR2)
 	
-	// 阻塞直到收到终止信号
-	<-stop
+	// 阻塞直到收到终止信号，SIGUSR2时切换到新的可执行文件
+	for sig := range stop {
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		if upgradeServer() {
+			// 监听套接字和Shell已移交给新进程，不能关闭会话
+			log.Println("Upgrade complete, old process exiting")
+			return
+		}
+	}
 	
 	log.Println("Shutting down server...")
+	os.Remove(pidFile)
+	
+	// 保存会话输出，Shell本身由会话保持进程继续持有
+	terminal.SuspendSessions()
 	
 	// 这里可以添加任何优雅关闭逻辑，如关闭数据库连接等
 	database.CloseDatabase()
 	
 	log.Println("Server has been safely shut down, goodbye!")
 }
+
+// upgradeServer 暂停接收连接和读取会话输出，启动新的可执行文件并移交所有套接字和会话。
+// 移交失败时恢复运行并返回false
+func upgradeServer() bool {
+	log.Println("Upgrading server...")
+	
+	upgrade.Pause()
+	sessions := terminal.PauseSessions()
+	if err := upgrade.Exec(sessions, auth.GetTokens()); err != nil {
+		log.Printf("Upgrade failed, resuming: %v", err)
+		terminal.ResumeSessions()
+		upgrade.Resume()
+		return false
+	}
+	return true
+}
+
+// runUpgrade 向运行中的服务发送SIGUSR2，等待新进程写入pid文件
+func runUpgrade(args []string) {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	pidPath := flags.String("pid", pidFile, "Pid file of the running server")
+	flags.Parse(args)
+	
+	data, err := os.ReadFile(*pidPath)
+	if err != nil {
+		log.Fatalf("Failed to read pid file: %v", err)
+	}
+	oldPid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Fatalf("Invalid pid file: %v", err)
+	}
+	if err := syscall.Kill(oldPid, syscall.SIGUSR2); err != nil {
+		log.Fatalf("Failed to signal server %d: %v", oldPid, err)
+	}
+	
+	deadline := time.Now().Add(upgradeWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+		data, err := os.ReadFile(*pidPath)
+		if err != nil {
+			continue
+		}
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != oldPid {
+			log.Printf("Server upgraded, new pid %d", pid)
+			return
+		}
+	}
+	log.Fatalf("Server %d did not upgrade, check its log", oldPid)
+}
+
+// runHolder 运行会话保持进程，-stop时通知已运行的保持进程释放所有Shell并退出
+func runHolder(args []string) {
+	flags := flag.NewFlagSet("holder", flag.ExitOnError)
+	socket := flags.String("socket", holder.DefaultSocket, "Unix socket to listen on")
+	stop := flags.Bool("stop", false, "Stop the running session holder and release all held shells")
+	flags.Parse(args)
+	
+	if *stop {
+		if err := holder.Stop(*socket); err != nil {
+			log.Fatalf("Failed to stop session holder: %v", err)
+		}
+		log.Println("Session holder stopped")
+		return
+	}
+	
+	if err := holder.Serve(*socket); err != nil {
+		log.Fatalf("Session holder failed: %v", err)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	
 	"ghosteye/auth"
 	"ghosteye/database"
-	"ghosteye/models"
 	"ghosteye/utils"
 )
 
@@ -117,9 +116,6 @@ func TokenAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// 获取或创建用户状态
-		auth.GetUserState(username)
-
 		// 将用户名存储在请求上下文中
 		r = SetUsernameInContext(r, username)
 
@@ -139,13 +135,3 @@ func SetUsernameInContext(r *http.Request, username string) *http.Request {
 func GetUsernameFromContext(r *http.Request) string {
 	return UsernameFromContext(r.Context())
 }
-
-// GetUserState 从请求中获取用户状态
-func GetUserState(r *http.Request) *models.UserState {
-	username := GetUsernameFromContext(r)
-	if username == "" {
-		return nil
-	}
-
-	return auth.GetUserState(username)
-} 
@@ -0,0 +1,28 @@
+package models
+
+// ArsenalFile 托管的工具文件
+type ArsenalFile struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Path        string `json:"-"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// ArsenalLink 工具文件的随机下载链接
+type ArsenalLink struct {
+	Token      string   `json:"token"`
+	FileID     int64    `json:"file_id"`
+	Username   string   `json:"username"`
+	OneTime    bool     `json:"one_time"`   // 只能成功下载一次
+	ExpiresAt  int64    `json:"expires_at"` // 过期时间的Unix秒数，0表示不过期
+	AllowedIPs []string `json:"allowed_ips"`
+	Downloads  int      `json:"downloads"`
+	Revoked    bool     `json:"revoked"`
+	CreatedAt  string   `json:"created_at"`
+}
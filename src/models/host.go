@@ -0,0 +1,26 @@
+package models
+
+// Host 会话所在的主机
+type Host struct {
+	ID        int64             `json:"id"`
+	Username  string            `json:"username"`
+	HostKey   string            `json:"host_key"` // 识别同一主机的键：machine-id，没有时为主机名
+	Hostname  string            `json:"hostname"`
+	OS        string            `json:"os"`
+	OSRelease string            `json:"os_release"`
+	Kernel    string            `json:"kernel"`
+	User      string            `json:"user"`
+	IPs       []string          `json:"ips"`
+	Facts     map[string]string `json:"facts"` // 各探测步骤的原始输出
+	FirstSeen string            `json:"first_seen"`
+	LastSeen  string            `json:"last_seen"`
+}
+
+// ProbeStep 新Shell接入时执行的主机探测命令
+type ProbeStep struct {
+	Name    string `json:"name"`
+	OS      string `json:"os"`
+	Command string `json:"command"`
+	Enabled bool   `json:"enabled"`
+	Builtin bool   `json:"builtin"`
+}
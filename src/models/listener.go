@@ -0,0 +1,31 @@
+package models
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener 反弹Shell监听器
+type Listener struct {
+	ID          string        // 监听器ID
+	Username    string        // 所属用户
+	BindAddr    string        // 绑定地址
+	Port        int           // 监听端口
+	Multi       bool          // 多连接模式：持续接收连接，否则接收一个连接后停止
+	Protocol    string        // 协议: tcp / tls
+	Fingerprint string        // TLS证书SHA256指纹
+	Created     time.Time     // 创建时间
+	Accepted    int           // 已接收的连接数
+	Sessions    []string      // 该监听器产生的终端ID
+	Ln          net.Listener  // 底层TCP监听
+	Done        chan struct{} // 停止信号
+	Mutex       sync.Mutex    // 锁，确保线程安全
+}
+
+// 全局监听器管理
+var (
+	// 监听器ID -> 监听器
+	Listeners    = make(map[string]*Listener)
+	ListenersMux sync.Mutex
+)
@@ -0,0 +1,28 @@
+package models
+
+// Loot 收集到的凭据、哈希、密钥等战利品
+type Loot struct {
+	ID         int64    `json:"id"`
+	Username   string   `json:"username"`
+	Type       string   `json:"type"`        // password / hash / key / token / file
+	Account    string   `json:"account"`     // 凭据对应的账户名
+	Secret     string   `json:"secret"`      // 密码、哈希、密钥内容或文件路径
+	Service    string   `json:"service"`     // 凭据适用的服务，如 ssh://10.0.0.5
+	HostID     int64    `json:"host_id"`     // 来源主机，0表示未知
+	TerminalID string   `json:"terminal_id"` // 来源会话
+	TransferID int64    `json:"transfer_id"` // 文件类战利品对应的下载记录
+	Excerpt    string   `json:"excerpt"`     // 发现该条目的终端输出片段
+	Tags       []string `json:"tags"`
+	Notes      string   `json:"notes"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+}
+
+// LootFilter 战利品查询条件，零值字段不参与过滤
+type LootFilter struct {
+	Query      string // 在账户、内容、服务、备注和输出片段中搜索
+	Type       string
+	Tag        string
+	HostID     int64
+	TerminalID string
+}
@@ -2,15 +2,28 @@ package models
 
 import (
 	"context"
-	"io"
-	"os"
-	"os/exec"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	
+	"ghosteye/backend"
+	"ghosteye/linedisc"
+	"ghosteye/scrollback"
+	"ghosteye/vt"
+)
+
+// 终端模拟器的默认大小和滚动缓冲行数
+const (
+	defaultScreenCols = 80
+	defaultScreenRows = 24
+	screenScrollback  = 1000
 )
 
+// maxLogResume 客户端续传时最多从磁盘补发的输出，缺失更多时改为发送屏幕快照
+const maxLogResume = 1 << 20
+
 // Message WebSocket消息结构
 type Message struct {
 	Type       string      `json:"type"`
@@ -29,21 +42,31 @@ type AuthResponse struct {
 
 // OutputBuffer 输出缓冲区
 type OutputBuffer struct {
-	Data []byte
-	Max  int // 最大存储字节数
+	Data  []byte
+	Max   int   // 最大存储字节数
+	Start int64 // Data第一个字节在整个输出流中的偏移，之前的输出已被淘汰
+	Screen *vt.Screen // 由同样的输出驱动的终端模拟器，为nil时在首次使用时创建
+	Log   *scrollback.Log // 磁盘上的完整输出日志，为nil时只保留内存中的输出
+	Restored bool // Data为从数据库恢复的缓冲区，注册会话时需要恢复其起始偏移
 	sync.Mutex
 }
 
+// OutputRange 输出流中一段范围内的输出
+type OutputRange struct {
+	From  int64  `json:"from"`  // 实际返回的第一个字节的偏移
+	To    int64  `json:"to"`    // 实际返回的最后一个字节之后的偏移
+	Start int64  `json:"start"` // 仍保留的最早输出的偏移
+	End   int64  `json:"end"`   // 输出流的当前末尾偏移
+	Data  []byte `json:"data"`
+}
+
 // TerminalSession 终端会话
 type TerminalSession struct {
 	ID string // 会话ID
-	Cmd          *exec.Cmd      // 命令进程
-	Ptmx         *os.File       // PTY主设备
-	Done         chan struct{}  // 完成信号
-	Stdin        io.WriteCloser // 标准输入（用于非PTY模式）
-	IsStandardPipe bool         // 是否使用标准管道（非PTY模式）
-	LastActive   time.Time      // 上次活跃时间
-	Mutex        sync.Mutex     // 锁，确保线程安全
+	Backend      backend.Backend // 会话后端（本地PTY、管道、TCP、SSH等）
+	Done         chan struct{}   // 完成信号
+	LastActive   time.Time       // 上次活跃时间
+	Mutex        sync.Mutex      // 锁，确保线程安全
 	
 	// 新增字段
 	Clients      map[string]*websocket.Conn // 连接到该会话的客户端
@@ -52,8 +75,73 @@ type TerminalSession struct {
 	Active       bool                       // 会话是否活跃
 	Created      time.Time                  // 会话创建时间
 	CancelFunc   context.CancelFunc         // 用于取消goroutine的函数
+	
+	// 远程会话相关字段
+	Kind         string   // 会话类型: local / reverse / bind / ssh / webshell
+	RemoteAddr   string   // 远程地址
+	ListenerID   string   // 接收该连接的监听器ID
+	State        string   // 远程连接状态: connected / reconnecting / closed
+	Upgraded     bool     // 远程Shell是否已升级为PTY
+	OS           string   // 目标系统: linux / windows，为空时按linux处理
+	Cols         uint16   // 客户端终端列数，通过Size/SetSize访问
+	Rows         uint16   // 客户端终端行数，通过Size/SetSize访问
+	LineEditor   *linedisc.Editor // 服务端行编辑器，为nil时输入直接写入后端，通过Editor/SetEditor访问
+	RemoteCols   uint16           // 已通过stty同步到远程PTY的列数
+	RemoteRows   uint16           // 已通过stty同步到远程PTY的行数
+	SizeTimer    *time.Timer      // 客户端停止调整窗口大小后自动同步远程PTY的定时器
+	
+	// 命令输出截获
+	Capture      *OutputCapture // 当前进行中的输出截获
+	CaptureMutex sync.Mutex     // 截获状态的互斥锁
+	ExecMutex    sync.Mutex     // 保证同一时间只有一个截获命令在执行
+}
+
+// HeldSession 交给会话保持进程的会话元数据，GhostEye重启后据此重新接管会话
+type HeldSession struct {
+	Username   string `json:"username"`
+	TerminalID string `json:"terminal_id"`
+	Kind       string `json:"kind"`
+	RemoteAddr string `json:"remote_addr"`
+	ListenerID string `json:"listener_id"`
+	OS         string `json:"os"`
+	Upgraded   bool   `json:"upgraded"`
+	Cols       uint16 `json:"cols"`
+	Rows       uint16 `json:"rows"`
+	Pid        int    `json:"pid"` // 本地伪终端中运行的进程
 }
 
+// OutputCapture 截获会话输出中开始标记与结束标记之间的命令结果
+type OutputCapture struct {
+	Begin  string        // 开始标记
+	End    string        // 结束标记
+	Hide   bool          // 是否对客户端隐藏截获期间的输出
+	Data   []byte        // 截获开始后收到的所有输出
+	Result []byte        // 标记之间的命令结果
+	Done   chan struct{} // 截获完成信号
+}
+
+// 会话类型
+const (
+	SessionKindLocal    = "local"    // 本地PTY会话
+	SessionKindReverse  = "reverse"  // 监听器接收的反弹Shell
+	SessionKindBind     = "bind"     // 主动连接的绑定Shell
+	SessionKindSSH      = "ssh"      // 通过SSH客户端连接的会话
+	SessionKindWebshell = "webshell" // 通过HTTP webshell执行命令的会话
+)
+
+// 目标系统
+const (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+)
+
+// 远程会话连接状态
+const (
+	SessionStateConnected    = "connected"
+	SessionStateReconnecting = "reconnecting"
+	SessionStateClosed       = "closed"
+)
+
 // 全局终端会话管理
 var (
 	// 用户名 -> 终端ID -> 会话
@@ -61,11 +149,69 @@ var (
 	TerminalSessionsMux sync.Mutex
 )
 
-// Append 添加数据到缓冲区
-func (b *OutputBuffer) Append(data []byte) {
+// Size 返回客户端终端的列数和行数
+func (s *TerminalSession) Size() (cols, rows uint16) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	return s.Cols, s.Rows
+}
+
+// SetSize 记录客户端终端的列数和行数
+func (s *TerminalSession) SetSize(cols, rows uint16) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	s.Cols, s.Rows = cols, rows
+}
+
+// CurrentBackend 返回会话当前的后端以及远程Shell是否已升级为PTY，绑定Shell重连后两者会被替换
+func (s *TerminalSession) CurrentBackend() (backend.Backend, bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	return s.Backend, s.Upgraded
+}
+
+// SetUpgraded 记录远程Shell是否已升级为PTY
+func (s *TerminalSession) SetUpgraded(upgraded bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	s.Upgraded = upgraded
+}
+
+// Editor 返回会话的服务端行编辑器，未开启行编辑时返回nil
+func (s *TerminalSession) Editor() *linedisc.Editor {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	return s.LineEditor
+}
+
+// SetEditor 设置会话的服务端行编辑器，为nil时关闭行编辑
+func (s *TerminalSession) SetEditor(editor *linedisc.Editor) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	
+	s.LineEditor = editor
+}
+
+// Append 添加数据到缓冲区，返回数据第一个字节在输出流中的偏移
+func (b *OutputBuffer) Append(data []byte) int64 {
 	b.Lock()
 	defer b.Unlock()
 	
+	// 终端模拟器处理与客户端相同的输出
+	b.screen().Write(data)
+	
+	// 完整输出写入磁盘日志，内存中只保留最后的部分
+	if b.Log != nil {
+		if err := b.Log.Append(data); err != nil {
+			log.Printf("Failed to append output to scrollback: %v", err)
+		}
+	}
+	
 	// 计算新数据后的总大小
 	newSize := len(b.Data) + len(data)
 	
@@ -75,11 +221,183 @@ func (b *OutputBuffer) Append(data []byte) {
 		excess := newSize - b.Max
 		if excess < len(b.Data) {
 			b.Data = b.Data[excess:]
+			b.Start += int64(excess)
 		} else {
+			b.Start += int64(len(b.Data))
 			b.Data = []byte{}
 		}
 	}
 	
 	// 添加新数据
+	offset := b.Start + int64(len(b.Data))
 	b.Data = append(b.Data, data...)
-} 
+	return offset
+}
+
+// screen 返回终端模拟器，尚未创建时用缓冲区中已有的输出初始化，调用方需持有锁
+func (b *OutputBuffer) screen() *vt.Screen {
+	if b.Screen == nil {
+		b.Screen = vt.New(defaultScreenCols, defaultScreenRows, screenScrollback)
+		b.Screen.Write(b.Data)
+	}
+	return b.Screen
+}
+
+// Snapshot 返回重现当前屏幕和滚动缓冲的输出，以及快照对应的输出流末尾偏移
+func (b *OutputBuffer) Snapshot() ([]byte, int64) {
+	b.Lock()
+	defer b.Unlock()
+	
+	return b.screen().Snapshot(), b.Start + int64(len(b.Data))
+}
+
+// Contents 返回终端模拟器中当前屏幕的文本
+func (b *OutputBuffer) Contents(scrollback bool) vt.Contents {
+	b.Lock()
+	defer b.Unlock()
+	
+	return b.screen().Contents(scrollback)
+}
+
+// Resize 调整终端模拟器的大小，与客户端终端保持一致
+func (b *OutputBuffer) Resize(cols, rows uint16) {
+	b.Lock()
+	defer b.Unlock()
+	
+	b.screen().Resize(int(cols), int(rows))
+}
+
+// SetStart 设置缓冲区在输出流中的起始偏移，用于恢复重启前保存的缓冲区
+func (b *OutputBuffer) SetStart(start int64) {
+	b.Lock()
+	defer b.Unlock()
+	
+	b.Start = start
+}
+
+// End 返回输出流的当前末尾偏移，即下一个字节的偏移
+func (b *OutputBuffer) End() int64 {
+	b.Lock()
+	defer b.Unlock()
+	
+	return b.Start + int64(len(b.Data))
+}
+
+// Since 返回从offset开始仍在缓冲区中的输出及其起始偏移。
+// offset之后的部分输出已被淘汰时gap为true，返回的数据从缓冲区开头开始
+func (b *OutputBuffer) Since(offset int64) (data []byte, start int64, gap bool) {
+	b.Lock()
+	defer b.Unlock()
+	
+	end := b.Start + int64(len(b.Data))
+	if offset > end {
+		// 客户端的偏移来自旧的输出流，重新发送全部缓冲
+		offset = b.Start
+		gap = true
+	}
+	if offset < b.Start {
+		// 已淘汰的部分仍在磁盘日志中且不太多时从磁盘补发
+		if b.Log != nil && offset >= b.Log.Start() && b.Start-offset <= maxLogResume {
+			old, from, err := b.Log.ReadRange(offset, b.Start)
+			if err == nil && from == offset && int64(len(old)) == b.Start-offset {
+				data = append(old, b.Data...)
+				return data, offset, false
+			}
+			if err != nil {
+				log.Printf("Failed to read scrollback: %v", err)
+			}
+		}
+		offset = b.Start
+		gap = true
+	}
+	data = append([]byte(nil), b.Data[offset-b.Start:]...)
+	return data, offset, gap
+}
+
+// Range 返回[from, to)范围内仍保留的输出，有磁盘日志时从日志读取，否则只能读取内存中的部分。
+// from小于0时从最早的输出开始，to小于0或超过末尾时读到末尾，最多返回limit字节
+func (b *OutputBuffer) Range(from, to int64, limit int) (OutputRange, error) {
+	b.Lock()
+	l := b.Log
+	r := OutputRange{Start: b.Start, End: b.Start + int64(len(b.Data))}
+	if l == nil {
+		r.From, r.To = clampRange(from, to, r.Start, r.End, limit)
+		r.Data = append([]byte(nil), b.Data[r.From-b.Start:r.To-b.Start]...)
+		b.Unlock()
+		return r, nil
+	}
+	b.Unlock()
+	
+	// 读取磁盘时不持有缓冲区的锁，避免阻塞会话输出
+	r.Start, r.End = l.Start(), l.End()
+	r.From, r.To = clampRange(from, to, r.Start, r.End, limit)
+	data, start, err := l.ReadRange(r.From, r.To)
+	if err != nil {
+		return r, err
+	}
+	r.From, r.To, r.Data = start, start+int64(len(data)), data
+	return r, nil
+}
+
+// clampRange 将请求的范围限制在[start, end)之内且不超过limit字节
+func clampRange(from, to, start, end int64, limit int) (int64, int64) {
+	if from < start {
+		from = start
+	}
+	if from > end {
+		from = end
+	}
+	if to < 0 || to > end {
+		to = end
+	}
+	if to < start {
+		to = start
+	}
+	if from > to {
+		from = to
+	}
+	if limit > 0 && to-from > int64(limit) {
+		to = from + int64(limit)
+	}
+	return from, to
+}
+
+// AttachLog 为缓冲区关联磁盘日志。日志为空时写入缓冲区中已有的输出，
+// 日志比缓冲区更新时（重启前已写入日志但尚未保存到数据库）从日志加载最后的输出
+func (b *OutputBuffer) AttachLog(l *scrollback.Log) error {
+	b.Lock()
+	defer b.Unlock()
+	
+	end := b.Start + int64(len(b.Data))
+	if l.Empty() || l.End() < end {
+		if err := l.Reset(b.Start); err != nil {
+			return err
+		}
+		if err := l.Append(b.Data); err != nil {
+			return err
+		}
+		b.Log = l
+		return nil
+	}
+	
+	from := l.End() - int64(b.Max)
+	data, start, err := l.ReadRange(from, l.End())
+	if err != nil {
+		return err
+	}
+	b.Data, b.Start = data, start
+	b.Screen = nil
+	b.Log = l
+	return nil
+}
+
+// CloseLog 关闭磁盘日志的写入句柄，日志文件仍保留
+func (b *OutputBuffer) CloseLog() {
+	b.Lock()
+	defer b.Unlock()
+	
+	if b.Log != nil {
+		b.Log.Close()
+		b.Log = nil
+	}
+}
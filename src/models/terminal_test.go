@@ -0,0 +1,210 @@
+package models
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"ghosteye/scrollback"
+)
+
+// newLoggedBuffer 创建内存中保留max字节、完整输出写入临时目录日志的缓冲区
+func newLoggedBuffer(t *testing.T, max int, retention int64) *OutputBuffer {
+	t.Helper()
+
+	l, err := scrollback.Open(t.TempDir(), 8, retention)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	b := &OutputBuffer{Max: max}
+	if err := b.AttachLog(l); err != nil {
+		t.Fatalf("AttachLog: %v", err)
+	}
+	return b
+}
+
+// stream 返回输出流中[from, to)的内容，输出流为0-9a-z循环
+func stream(from, to int64) string {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		b.WriteByte(alphabet[i%int64(len(alphabet))])
+	}
+	return b.String()
+}
+
+func TestOutputBufferAppend(t *testing.T) {
+	b := &OutputBuffer{Max: 10}
+	if offset := b.Append([]byte(stream(0, 6))); offset != 0 {
+		t.Errorf("first offset = %d", offset)
+	}
+	if offset := b.Append([]byte(stream(6, 15))); offset != 6 {
+		t.Errorf("second offset = %d", offset)
+	}
+	if b.Start != 5 || string(b.Data) != stream(5, 15) || b.End() != 15 {
+		t.Errorf("buffer = %q at %d", b.Data, b.Start)
+	}
+
+	// 单次输出超过上限时旧数据全部淘汰，新输出完整保留到下一次追加
+	b.Append([]byte(stream(15, 40)))
+	if b.Start != 15 || string(b.Data) != stream(15, 40) {
+		t.Errorf("buffer after large append = %q at %d", b.Data, b.Start)
+	}
+	b.Append([]byte(stream(40, 42)))
+	if b.Start != 32 || string(b.Data) != stream(32, 42) {
+		t.Errorf("buffer after next append = %q at %d", b.Data, b.Start)
+	}
+}
+
+func TestOutputBufferRange(t *testing.T) {
+	b := newLoggedBuffer(t, 10, 0)
+	for _, chunk := range [][2]int64{{0, 7}, {7, 20}, {20, 23}, {23, 30}} {
+		b.Append([]byte(stream(chunk[0], chunk[1])))
+	}
+	if b.Start != 20 {
+		t.Fatalf("hot tail starts at %d, want 20", b.Start)
+	}
+
+	tests := []struct {
+		name     string
+		from, to int64
+		limit    int
+		wantFrom int64
+		wantTo   int64
+	}{
+		{"all", -1, -1, 0, 0, 30},
+		{"disk only", 2, 13, 0, 2, 13},
+		{"disk and hot tail", 15, 25, 0, 15, 25},
+		{"hot tail", 22, 28, 0, 22, 28},
+		{"past end", 25, 100, 0, 25, 30},
+		{"limit", 5, -1, 4, 5, 9},
+		{"empty", 30, -1, 0, 30, 30},
+		{"from past end", 40, 50, 0, 30, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := b.Range(tt.from, tt.to, tt.limit)
+			if err != nil {
+				t.Fatalf("Range: %v", err)
+			}
+			if r.From != tt.wantFrom || r.To != tt.wantTo || string(r.Data) != stream(tt.wantFrom, tt.wantTo) {
+				t.Errorf("Range(%d, %d) = [%d, %d) %q", tt.from, tt.to, r.From, r.To, r.Data)
+			}
+			if r.Start != 0 || r.End != 30 {
+				t.Errorf("retained [%d, %d), want [0, 30)", r.Start, r.End)
+			}
+		})
+	}
+
+	// 没有磁盘日志时只能读取内存中的部分
+	memory := &OutputBuffer{Max: 10}
+	for i := int64(0); i < 30; i += 5 {
+		memory.Append([]byte(stream(i, i+5)))
+	}
+	r, err := memory.Range(0, 25, 0)
+	if err != nil || r.From != 20 || r.To != 25 || r.Start != 20 || string(r.Data) != stream(20, 25) {
+		t.Errorf("memory Range = %+v, %v", r, err)
+	}
+
+	// 结束偏移早于保留的开头时返回空范围而不是越界
+	for _, to := range []int64{0, 5, 19} {
+		r, err := memory.Range(-1, to, 100)
+		if err != nil || r.From != 20 || r.To != 20 || len(r.Data) != 0 {
+			t.Errorf("memory Range(-1, %d) = %+v, %v", to, r, err)
+		}
+	}
+	if r, err := b.Range(-1, 0, 0); err != nil || r.From != 0 || r.To != 0 || len(r.Data) != 0 {
+		t.Errorf("Range(-1, 0) = %+v, %v", r, err)
+	}
+}
+
+func TestOutputBufferSince(t *testing.T) {
+	logged := newLoggedBuffer(t, 10, 16)
+	memory := &OutputBuffer{Max: 10}
+	for _, b := range []*OutputBuffer{logged, memory} {
+		for i := int64(0); i < 40; i += 5 {
+			b.Append([]byte(stream(i, i+5)))
+		}
+	}
+	// 内存中保留[30, 40)，日志保留[20, 40)
+	if start := logged.Log.Start(); start != 20 {
+		t.Fatalf("log retains from %d, want 20", start)
+	}
+
+	tests := []struct {
+		name      string
+		b         *OutputBuffer
+		offset    int64
+		wantStart int64
+		wantGap   bool
+	}{
+		{"hot tail", logged, 35, 35, false},
+		{"end", logged, 40, 40, false},
+		{"from disk", logged, 22, 22, false},
+		{"log start", logged, 20, 20, false},
+		{"before retention", logged, 19, 30, true},
+		{"future offset", logged, 50, 30, true},
+		{"memory hot tail", memory, 32, 32, false},
+		{"memory evicted", memory, 26, 30, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, start, gap := tt.b.Since(tt.offset)
+			if start != tt.wantStart || gap != tt.wantGap || string(data) != stream(tt.wantStart, 40) {
+				t.Errorf("Since(%d) = %q, %d, %v; want from %d gap %v", tt.offset, data, start, gap, tt.wantStart, tt.wantGap)
+			}
+		})
+	}
+
+	// 需要从磁盘补发的输出过多时改为从内存开头发送
+	big := newLoggedBuffer(t, 10, 0)
+	big.Append(bytes.Repeat([]byte{'x'}, maxLogResume+100))
+	big.Append(bytes.Repeat([]byte{'y'}, 10))
+	if _, start, gap := big.Since(50); !gap || start != big.Start {
+		t.Errorf("Since over maxLogResume = start %d gap %v", start, gap)
+	}
+	if _, start, gap := big.Since(big.Start - maxLogResume); gap || start != big.Start-maxLogResume {
+		t.Errorf("Since at maxLogResume = start %d gap %v", start, gap)
+	}
+}
+
+func TestOutputBufferAttachLog(t *testing.T) {
+	dir := t.TempDir()
+
+	// 空日志：写入恢复的缓冲区，偏移保持不变
+	l, err := scrollback.Open(dir, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &OutputBuffer{Max: 10, Data: []byte(stream(100, 106)), Start: 100}
+	if err := restored.AttachLog(l); err != nil {
+		t.Fatalf("AttachLog: %v", err)
+	}
+	restored.Append([]byte(stream(106, 120)))
+	restored.CloseLog()
+	if restored.Log != nil {
+		t.Error("CloseLog kept the log")
+	}
+
+	// 日志比数据库中保存的缓冲区更新时从日志加载最后的输出
+	l, err = scrollback.Open(dir, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Start() != 100 || l.End() != 120 {
+		t.Fatalf("log covers [%d, %d), want [100, 120)", l.Start(), l.End())
+	}
+	stale := &OutputBuffer{Max: 10, Data: []byte(stream(100, 106)), Start: 100}
+	if err := stale.AttachLog(l); err != nil {
+		t.Fatalf("AttachLog: %v", err)
+	}
+	if stale.Start != 110 || string(stale.Data) != stream(110, 120) {
+		t.Errorf("buffer after attach = %q at %d", stale.Data, stale.Start)
+	}
+	if got := stale.Contents(false).Screen[0]; got != stream(110, 120) {
+		t.Errorf("screen was not rebuilt from the log: %q", got)
+	}
+}
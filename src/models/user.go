@@ -4,17 +4,8 @@ import (
 	"sync"
 )
 
-// UserState 存储每个用户的状态
-type UserState struct {
-	IsRunning bool   // 是否有命令在运行
-	Command   string // 当前运行的命令
-	Mutex     sync.Mutex
-}
-
-// 全局的用户状态管理
+// 全局的会话令牌管理
 var (
-	UserStates    = make(map[string]*UserState)
-	UserStatesMux sync.Mutex
 	// 会话管理
 	SessionTokens    = make(map[string]string) // token -> username
 	SessionTokensMux sync.Mutex
@@ -54,4 +45,34 @@ type TerminalSessionRecord struct {
 	CreatedAt  string `json:"created_at"`
 	LastActive string `json:"last_active"`
 	Active     bool   `json:"active"`
-} 
\ No newline at end of file
+	Kind       string `json:"kind"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// ListenerRecord 数据库中的监听器记录
+type ListenerRecord struct {
+	ListenerID string `json:"listener_id"`
+	Username   string `json:"username"`
+	BindAddr   string `json:"bind_addr"`
+	Port       int    `json:"port"`
+	Multi      bool   `json:"multi"`
+	Protocol   string `json:"protocol"`
+	Accepted   int    `json:"accepted"`
+	Running    bool   `json:"running"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// PayloadTemplate 数据库中的反弹Shell命令模板
+type PayloadTemplate struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Platform    string `json:"platform"`
+	Protocol    string `json:"protocol"`
+	Pin         string `json:"pin"`
+	Requires    string `json:"requires"`
+	Template    string `json:"template"`
+	Description string `json:"description"`
+	Builtin     bool   `json:"builtin"`
+	Username    string `json:"username"`
+	CreatedAt   string `json:"created_at"`
+}
@@ -0,0 +1,160 @@
+package oob
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"ghosteye/config"
+	"ghosteye/upgrade"
+)
+
+// DNS报文常量
+const (
+	dnsHeaderSize  = 12
+	dnsTypeA       = 1
+	dnsClassIN     = 1
+	dnsFlagQR      = 0x8000
+	dnsFlagAA      = 0x0400
+	dnsFlagRD      = 0x0100
+	dnsMaskOpcode  = 0x7800
+	dnsRcodeNotImp = 4
+)
+
+// dnsTypes 常见查询类型的名称
+var dnsTypes = map[uint16]string{
+	1: "A", 2: "NS", 5: "CNAME", 6: "SOA", 12: "PTR", 15: "MX", 16: "TXT", 28: "AAAA", 33: "SRV", 255: "ANY",
+}
+
+// dnsQuestion 查询报文中的第一个问题
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	End   int // 问题部分在报文中的结束位置
+}
+
+// StartDNS 启动带外交互DNS(UDP)监听器，记录所有包含令牌的查询。
+// 配置了OOBIP时对A记录查询返回该IP，其余查询返回没有记录的权威应答
+func StartDNS(addr string) error {
+	conn, err := upgrade.ListenPacket("oob-dns", addr)
+	if err != nil {
+		return err
+	}
+
+	go serveDNS(conn)
+
+	log.Printf("OOB DNS listener on %s", conn.LocalAddr())
+	return nil
+}
+
+// serveDNS 处理查询直到conn关闭
+func serveDNS(conn net.PacketConn) {
+	buf := make([]byte, 4096)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if upgrade.WaitIfPaused(err) {
+				continue
+			}
+			log.Printf("OOB DNS read error: %v", err)
+			continue
+		}
+
+		packet := append([]byte(nil), buf[:n]...)
+		question, err := parseDNSQuestion(packet)
+		if err != nil {
+			continue
+		}
+
+		request := fmt.Sprintf("%s %s\n%s", question.Name, dnsTypeName(question.Type), hex.Dump(packet))
+		Record(ProtocolDNS, remote.String(), question.Name, request)
+
+		if _, err := conn.WriteTo(dnsResponse(packet, question), remote); err != nil {
+			log.Printf("OOB DNS write error: %v", err)
+		}
+	}
+}
+
+// parseDNSQuestion 解析查询报文中的第一个问题
+func parseDNSQuestion(packet []byte) (*dnsQuestion, error) {
+	if len(packet) < dnsHeaderSize {
+		return nil, fmt.Errorf("DNS packet too short")
+	}
+	if binary.BigEndian.Uint16(packet[2:])&dnsFlagQR != 0 {
+		return nil, fmt.Errorf("DNS packet is not a query")
+	}
+	if binary.BigEndian.Uint16(packet[4:]) == 0 {
+		return nil, fmt.Errorf("DNS query has no question")
+	}
+
+	var labels []string
+	offset := dnsHeaderSize
+	for {
+		if offset >= len(packet) {
+			return nil, fmt.Errorf("DNS name truncated")
+		}
+		length := int(packet[offset])
+		offset++
+		if length == 0 {
+			break
+		}
+		// 查询中的问题不应使用压缩指针
+		if length > 63 || offset+length > len(packet) {
+			return nil, fmt.Errorf("Invalid DNS label")
+		}
+		labels = append(labels, string(packet[offset:offset+length]))
+		offset += length
+	}
+	if offset+4 > len(packet) {
+		return nil, fmt.Errorf("DNS question truncated")
+	}
+
+	return &dnsQuestion{
+		Name:  strings.Join(labels, ".") + ".",
+		Type:  binary.BigEndian.Uint16(packet[offset:]),
+		Class: binary.BigEndian.Uint16(packet[offset+2:]),
+		End:   offset + 4,
+	}, nil
+}
+
+// dnsResponse 构造权威应答，只包含第一个问题
+func dnsResponse(packet []byte, question *dnsQuestion) []byte {
+	flags := binary.BigEndian.Uint16(packet[2:])
+	opcode := flags & dnsMaskOpcode
+
+	response := make([]byte, dnsHeaderSize, question.End+16)
+	copy(response, packet[:2])
+	respFlags := dnsFlagQR | dnsFlagAA | opcode | flags&dnsFlagRD
+	if opcode != 0 {
+		respFlags |= dnsRcodeNotImp
+	}
+	binary.BigEndian.PutUint16(response[2:], respFlags)
+	binary.BigEndian.PutUint16(response[4:], 1)
+	response = append(response, packet[dnsHeaderSize:question.End]...)
+
+	ip := net.ParseIP(config.GetOOBIP()).To4()
+	if opcode == 0 && question.Type == dnsTypeA && question.Class == dnsClassIN && ip != nil {
+		binary.BigEndian.PutUint16(response[6:], 1)
+		// 名称指向问题部分，TTL为0避免缓存导致后续查询无法到达
+		response = append(response, 0xc0, dnsHeaderSize, 0, dnsTypeA, 0, dnsClassIN, 0, 0, 0, 0, 0, 4)
+		response = append(response, ip...)
+	}
+
+	return response
+}
+
+// dnsTypeName 返回查询类型的名称
+func dnsTypeName(qtype uint16) string {
+	if name, ok := dnsTypes[qtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", qtype)
+}
@@ -0,0 +1,205 @@
+package oob
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"ghosteye/config"
+)
+
+// dnsQuery 构造只有一个问题的查询报文，flags为0时为设置RD的标准查询
+func dnsQuery(id uint16, flags uint16, name string, qtype uint16) []byte {
+	if flags == 0 {
+		flags = dnsFlagRD
+	}
+	packet := binary.BigEndian.AppendUint16(nil, id)
+	packet = binary.BigEndian.AppendUint16(packet, flags)
+	packet = append(packet, 0, 1, 0, 0, 0, 0, 0, 0)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			packet = append(packet, byte(len(label)))
+			packet = append(packet, label...)
+		}
+	}
+	packet = append(packet, 0)
+	packet = binary.BigEndian.AppendUint16(packet, qtype)
+	return binary.BigEndian.AppendUint16(packet, dnsClassIN)
+}
+
+// setOOBIP 临时设置A记录返回的IP
+func setOOBIP(t *testing.T, ip string) {
+	old := config.AppConfig.OOBIP
+	config.AppConfig.OOBIP = ip
+	t.Cleanup(func() { config.AppConfig.OOBIP = old })
+}
+
+func TestParseDNSQuestion(t *testing.T) {
+	header := dnsQuery(1, 0, ".", dnsTypeA)[:dnsHeaderSize]
+	withName := func(name ...byte) []byte {
+		return append(append(append([]byte{}, header...), name...), 0, dnsTypeA, 0, dnsClassIN)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   string
+		qtype  uint16
+		err    string
+	}{
+		{"a query", dnsQuery(1, 0, "abc.oob", dnsTypeA), "abc.oob.", dnsTypeA, ""},
+		{"txt query", dnsQuery(1, 0, "x.Example.COM.", 16), "x.Example.COM.", 16, ""},
+		{"root", dnsQuery(1, 0, ".", 2), ".", 2, ""},
+		{"short header", header[:11], "", 0, "too short"},
+		{"response", dnsQuery(1, dnsFlagQR, "a.oob", dnsTypeA), "", 0, "not a query"},
+		{"no question", append(header[:4:4], 0, 0, 0, 0, 0, 0, 0, 0), "", 0, "no question"},
+		{"name without terminator", append(append([]byte{}, header...), 3, 'a', 'b', 'c'), "", 0, "name truncated"},
+		{"label past end", append(append([]byte{}, header...), 10, 'a', 'b'), "", 0, "Invalid DNS label"},
+		{"label too long", withName(append([]byte{64}, bytes.Repeat([]byte{'a'}, 64)...)...), "", 0, "Invalid DNS label"},
+		{"compressed name", withName(3, 'a', 'b', 'c', 0xc0, dnsHeaderSize), "", 0, "Invalid DNS label"},
+		{"missing type", append(append([]byte{}, header...), 1, 'a', 0, 0, 1), "", 0, "question truncated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			question, err := parseDNSQuestion(tt.packet)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDNSQuestion: %v", err)
+			}
+			if question.Name != tt.want || question.Type != tt.qtype || question.Class != dnsClassIN {
+				t.Errorf("question = %+v, want %s type %d", question, tt.want, tt.qtype)
+			}
+			if question.End != len(tt.packet) {
+				t.Errorf("End = %d, want %d", question.End, len(tt.packet))
+			}
+		})
+	}
+}
+
+func TestDNSResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		ip     string
+		flags  uint16
+		qtype  uint16
+		answer bool
+		rcode  uint16
+	}{
+		{"a with ip", "192.0.2.7", 0, dnsTypeA, true, 0},
+		{"a without ip", "", 0, dnsTypeA, false, 0},
+		{"ipv6 ip ignored", "2001:db8::1", 0, dnsTypeA, false, 0},
+		{"aaaa", "192.0.2.7", 0, 28, false, 0},
+		{"no recursion desired", "192.0.2.7", dnsFlagAA, dnsTypeA, true, 0},
+		{"status opcode", "192.0.2.7", 2 << 11, dnsTypeA, false, dnsRcodeNotImp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOOBIP(t, tt.ip)
+			query := dnsQuery(0xbeef, tt.flags, "abc.oob", tt.qtype)
+			// 查询末尾的附加记录(EDNS)不应出现在应答中
+			query[11] = 1
+			query = append(query, 0, 0, 41, 0x10, 0, 0, 0, 0, 0, 0, 0)
+			question, err := parseDNSQuestion(query)
+			if err != nil {
+				t.Fatalf("parseDNSQuestion: %v", err)
+			}
+
+			response := dnsResponse(query, question)
+			if id := binary.BigEndian.Uint16(response); id != 0xbeef {
+				t.Errorf("id = %#x", id)
+			}
+			flags := binary.BigEndian.Uint16(response[2:])
+			if flags&dnsFlagQR == 0 || flags&dnsFlagAA == 0 {
+				t.Errorf("flags = %#x, want QR and AA", flags)
+			}
+			if flags&dnsFlagRD != binary.BigEndian.Uint16(query[2:])&dnsFlagRD {
+				t.Errorf("RD flag not copied: %#x", flags)
+			}
+			if flags&0x000f != tt.rcode {
+				t.Errorf("rcode = %d, want %d", flags&0x000f, tt.rcode)
+			}
+			if qd := binary.BigEndian.Uint16(response[4:]); qd != 1 {
+				t.Errorf("qdcount = %d", qd)
+			}
+			if ar := binary.BigEndian.Uint16(response[10:]); ar != 0 {
+				t.Errorf("arcount = %d", ar)
+			}
+			if !bytes.Equal(response[dnsHeaderSize:question.End], query[dnsHeaderSize:question.End]) {
+				t.Errorf("question section not echoed")
+			}
+
+			answers := binary.BigEndian.Uint16(response[6:])
+			if !tt.answer {
+				if answers != 0 || len(response) != question.End {
+					t.Errorf("unexpected answer: ancount %d, %x", answers, response[question.End:])
+				}
+				return
+			}
+			want := []byte{0xc0, dnsHeaderSize, 0, dnsTypeA, 0, dnsClassIN, 0, 0, 0, 0, 0, 4, 192, 0, 2, 7}
+			if answers != 1 || !bytes.Equal(response[question.End:], want) {
+				t.Errorf("answer = ancount %d, %x, want %x", answers, response[question.End:], want)
+			}
+		})
+	}
+}
+
+func TestServeDNS(t *testing.T) {
+	setOOBIP(t, "192.0.2.7")
+	token := newToken(t, "alice")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveDNS(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 无法解析的报文被丢弃，不影响后续查询
+	client.Write([]byte{1, 2, 3})
+	name := "x." + token + ".oob."
+	if _, err := client.Write(dnsQuery(42, 0, name, dnsTypeA)); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("no response: %v", err)
+	}
+	response := buf[:n]
+	if binary.BigEndian.Uint16(response) != 42 || binary.BigEndian.Uint16(response[6:]) != 1 {
+		t.Fatalf("response = %x", response)
+	}
+	if ip := net.IP(response[n-4:]); !ip.Equal(net.ParseIP("192.0.2.7")) {
+		t.Errorf("A record = %s", ip)
+	}
+
+	records := hits(t, "alice", token)
+	if len(records) != 1 {
+		t.Fatalf("got %d hits, want 1", len(records))
+	}
+	request := records[0]["request"].(string)
+	if records[0]["protocol"] != ProtocolDNS || !strings.HasPrefix(request, name+" A\n") {
+		t.Errorf("hit = %v", records[0])
+	}
+	if records[0]["remote_addr"] != client.LocalAddr().String() {
+		t.Errorf("remote_addr = %v, want %s", records[0]["remote_addr"], client.LocalAddr())
+	}
+}
@@ -0,0 +1,47 @@
+package oob
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"ghosteye/upgrade"
+)
+
+// maxRequestSize 记录的HTTP请求体上限
+const maxRequestSize = 64 * 1024
+
+// StartHTTP 启动带外交互HTTP监听器，记录所有包含令牌的请求
+func StartHTTP(addr string) error {
+	ln, err := upgrade.Listen("oob-http", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(handleHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("OOB HTTP server error: %v", err)
+		}
+	}()
+
+	log.Printf("OOB HTTP listener on %s", ln.Addr())
+	return nil
+}
+
+// handleHTTP 记录请求并返回空的200响应
+func handleHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	dump, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		// 请求体过大时只记录请求头
+		dump, _ = httputil.DumpRequest(r, false)
+	}
+
+	Record(ProtocolHTTP, r.RemoteAddr, r.Host+" "+r.URL.RequestURI(), string(dump))
+	w.WriteHeader(http.StatusOK)
+}
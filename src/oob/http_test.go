@@ -0,0 +1,99 @@
+package oob
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ghosteye/database"
+)
+
+func TestHandleHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleHTTP))
+	defer server.Close()
+
+	get := func(t *testing.T, path, host string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d", resp.StatusCode)
+		}
+	}
+
+	t.Run("token in path", func(t *testing.T) {
+		token := newToken(t, "alice")
+		get(t, "/"+token+"?x=1", "oob.example")
+
+		records := hits(t, "alice", token)
+		if len(records) != 1 {
+			t.Fatalf("got %d hits, want 1", len(records))
+		}
+		request := records[0]["request"].(string)
+		if records[0]["protocol"] != ProtocolHTTP || !strings.HasPrefix(request, "GET /"+token+"?x=1 HTTP/1.1\r\n") {
+			t.Errorf("hit = %v", records[0])
+		}
+		if !strings.Contains(request, "Host: oob.example\r\n") {
+			t.Errorf("request dump has no Host header: %q", request)
+		}
+	})
+
+	t.Run("token in host", func(t *testing.T) {
+		token := newToken(t, "alice")
+		get(t, "/", token+".oob.example")
+		if len(hits(t, "alice", token)) != 1 {
+			t.Errorf("token in Host was not recorded")
+		}
+	})
+
+	t.Run("body", func(t *testing.T) {
+		token := newToken(t, "alice")
+		resp, err := http.Post(server.URL+"/"+token, "text/plain", strings.NewReader("uid=0(root)"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		records := hits(t, "alice", token)
+		if len(records) != 1 || !strings.HasSuffix(records[0]["request"].(string), "\r\n\r\nuid=0(root)") {
+			t.Errorf("hits = %v", records)
+		}
+	})
+
+	t.Run("oversized body", func(t *testing.T) {
+		token := newToken(t, "alice")
+		body := strings.Repeat("a", maxRequestSize+1)
+		resp, err := http.Post(server.URL+"/"+token, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		records := hits(t, "alice", token)
+		if len(records) != 1 {
+			t.Fatalf("got %d hits, want 1", len(records))
+		}
+		if request := records[0]["request"].(string); strings.Contains(request, "aaaa") {
+			t.Errorf("oversized body was recorded (%d bytes)", len(request))
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		get(t, "/0123456789abcdef", "oob.example")
+		var count int
+		if err := database.GetDB().QueryRow("SELECT COUNT(*) FROM oob_hits WHERE token = ?", "0123456789abcdef").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("unknown token recorded %d hits", count)
+		}
+	})
+}
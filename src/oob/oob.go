@@ -0,0 +1,108 @@
+package oob
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"ghosteye/config"
+	"ghosteye/database"
+	"ghosteye/events"
+	"ghosteye/utils"
+)
+
+// 交互协议
+const (
+	ProtocolHTTP = "http"
+	ProtocolDNS  = "dns"
+)
+
+// EventHit 推送给面板的新交互事件类型
+const EventHit = "oob_hit"
+
+// maxCandidates 每个请求最多查询的令牌候选数，避免长十六进制串造成大量查询
+const maxCandidates = 8
+
+// tokenPattern 令牌为16位小写十六进制，可以出现在URL路径、查询参数、Host或DNS标签中
+var tokenPattern = regexp.MustCompile(`[0-9a-f]{16}`)
+
+// Hit 一次带外交互
+type Hit struct {
+	ID         int64  `json:"id"`
+	Token      string `json:"token"`
+	Protocol   string `json:"protocol"`
+	RemoteAddr string `json:"remote_addr"`
+	Request    string `json:"request"`
+}
+
+// CreateToken 为用户创建新的交互令牌
+func CreateToken(username, label string) (string, error) {
+	token := utils.GenerateSessionID()[:16]
+	if err := database.AddOOBToken(token, username, label); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Record 在target中查找已登记的令牌，为每个令牌记录一次交互并推送给令牌所属用户的面板
+func Record(protocol, remoteAddr, target, request string) int {
+	seen := make(map[string]bool)
+	recorded := 0
+	for _, token := range tokenPattern.FindAllString(strings.ToLower(target), maxCandidates) {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+
+		username, err := database.GetOOBTokenOwner(token)
+		if err != nil {
+			log.Printf("Failed to look up OOB token: %v", err)
+			continue
+		}
+		if username == "" {
+			continue
+		}
+
+		hit := Hit{Token: token, Protocol: protocol, RemoteAddr: remoteAddr, Request: request}
+		if hit.ID, err = database.AddOOBHit(token, username, protocol, remoteAddr, request); err != nil {
+			log.Printf("Failed to record OOB hit: %v", err)
+			continue
+		}
+		events.Publish(username, EventHit, hit)
+		log.Printf("OOB %s interaction for token %s from %s", protocol, token, remoteAddr)
+		recorded++
+	}
+	return recorded
+}
+
+// Examples 生成回连到令牌的示例命令，host为目标主机访问GhostEye使用的地址
+func Examples(token, host string) map[string]string {
+	examples := make(map[string]string)
+
+	if _, port, err := net.SplitHostPort(config.GetOOBHTTPAddr()); err == nil {
+		url := fmt.Sprintf("http://%s/%s", net.JoinHostPort(host, port), token)
+		examples["http"] = url
+		examples["curl"] = "curl " + url
+		examples["wget"] = "wget -qO- " + url
+		examples["powershell"] = "iwr -UseBasicParsing " + url
+	}
+
+	if _, port, err := net.SplitHostPort(config.GetOOBDNSAddr()); err == nil {
+		if domain := config.GetOOBDomain(); domain != "" {
+			name := token + "." + strings.TrimSuffix(domain, ".")
+			examples["dns"] = name
+			examples["nslookup"] = "nslookup " + name
+			examples["ping"] = "ping -c 1 " + name
+		} else {
+			// 没有委派域名时直接向DNS监听器查询
+			name := token + ".oob"
+			examples["dns"] = name
+			examples["dig"] = fmt.Sprintf("dig @%s -p %s %s", host, port, name)
+			examples["nslookup"] = fmt.Sprintf("nslookup -port=%s %s %s", port, name, host)
+		}
+	}
+
+	return examples
+}
@@ -0,0 +1,102 @@
+package oob
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ghosteye/database"
+	"ghosteye/events"
+)
+
+// TestMain 在临时目录中初始化数据库
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "oob-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// newToken 为测试用户创建令牌并在测试结束时删除
+func newToken(t *testing.T, username string) string {
+	t.Helper()
+
+	token, err := CreateToken(username, t.Name())
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	t.Cleanup(func() { database.DeleteOOBToken(username, token) })
+	return token
+}
+
+// hits 返回令牌的交互记录，按ID倒序
+func hits(t *testing.T, username, token string) []map[string]interface{} {
+	t.Helper()
+
+	records, err := database.GetOOBHits(username, token, 100)
+	if err != nil {
+		t.Fatalf("GetOOBHits: %v", err)
+	}
+	return records
+}
+
+func TestRecord(t *testing.T) {
+	alice, bob := newToken(t, "alice"), newToken(t, "bob")
+	ch := subscribe(t, "alice")
+
+	// 同一令牌只记录一次，大小写不敏感，未登记的候选被忽略
+	target := "/" + alice + "/" + alice + "?b=" + bob + "&x=0123456789abcdef&h=" + strings.ToUpper(alice)
+	if n := Record(ProtocolHTTP, "192.0.2.1:4444", target, "GET "+target); n != 2 {
+		t.Fatalf("Record = %d, want 2", n)
+	}
+
+	records := hits(t, "alice", alice)
+	if len(records) != 1 {
+		t.Fatalf("alice has %d hits, want 1", len(records))
+	}
+	if records[0]["protocol"] != ProtocolHTTP || records[0]["remote_addr"] != "192.0.2.1:4444" {
+		t.Errorf("hit = %v", records[0])
+	}
+	if len(hits(t, "bob", bob)) != 1 {
+		t.Errorf("bob's token was not recorded")
+	}
+	if len(hits(t, "alice", bob)) != 0 {
+		t.Errorf("bob's hit is visible to alice")
+	}
+
+	select {
+	case event := <-ch:
+		if hit, ok := event.Data.(Hit); event.Type != EventHit || !ok || hit.Token != alice {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event published for alice's hit")
+	}
+}
+
+// subscribe 订阅用户的面板事件
+func subscribe(t *testing.T, username string) chan events.Event {
+	ch := events.Subscribe(username)
+	t.Cleanup(func() { events.Unsubscribe(username, ch) })
+	return ch
+}
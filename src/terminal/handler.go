@@ -2,11 +2,9 @@ package terminal
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
-	"time"
+	"strconv"
 	
 	"github.com/gorilla/websocket"
 	
@@ -39,10 +37,8 @@ func TerminalHandler(w http.ResponseWriter, r *http.Request) {
 	// 获取终端ID（如果存在）
 	terminalID := r.URL.Query().Get("terminalId")
 	if terminalID == "" {
-		// 如果未提供终端ID，生成一个新的，格式与前端一致: term_timestamp_random
-		timestamp := time.Now().UnixNano()
-		random := rand.Intn(10000)
-		terminalID = fmt.Sprintf("%d_%d", timestamp, random)
+		// 如果未提供终端ID，生成一个新的
+		terminalID = GenerateTerminalID()
 	}
 	
 	// 检查URL参数中是否有token
@@ -113,6 +109,14 @@ func TerminalHandler(w http.ResponseWriter, r *http.Request) {
 	respBytes, _ := json.Marshal(successResp)
 	conn.WriteMessage(websocket.TextMessage, respBytes)
 	
+	// 断线重连的客户端通过offset参数提供已收到输出的末尾偏移，只补发缺失的输出
+	offset := int64(-1)
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+	
 	// 处理终端
-	HandleUnixTerminal(conn, r.RemoteAddr, terminalID, username)
+	HandleUnixTerminal(conn, r.RemoteAddr, terminalID, username, offset)
 }
@@ -0,0 +1,183 @@
+package terminal
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+	
+	"ghosteye/backend"
+	"ghosteye/holder"
+	"ghosteye/models"
+	"ghosteye/upgrade"
+)
+
+// pauseSettle 暂停读取后等待读取协程停下的时间
+const pauseSettle = 100 * time.Millisecond
+
+// HoldSession 将会话后端的文件描述符交给会话保持进程，GhostEye重启后可以重新接管。
+// 未启用保持进程或后端不支持（如SSH、Webshell、TLS连接）时不做任何事
+func HoldSession(username, terminalID string, session *models.TerminalSession) {
+	if !holder.Enabled() {
+		return
+	}
+	
+	b, ok := session.Backend.(backend.Detachable)
+	if !ok {
+		return
+	}
+	rc, err := b.SyscallConn()
+	if err != nil {
+		return
+	}
+	
+	if err := holder.Hold(terminalID, NewHeldSession(username, terminalID, session), rc); err != nil {
+		log.Printf("Failed to hand terminal session %s to session holder: %v", terminalID, err)
+	}
+}
+
+// ReleaseSession 会话结束后让保持进程关闭其文件描述符，使远端连接和本地进程能正常结束
+func ReleaseSession(terminalID string) {
+	if err := holder.Release(terminalID); err != nil {
+		log.Printf("Failed to release terminal session %s from session holder: %v", terminalID, err)
+	}
+}
+
+// NewHeldSession 生成会话的元数据
+func NewHeldSession(username, terminalID string, session *models.TerminalSession) models.HeldSession {
+	cols, rows := session.Size()
+	held := models.HeldSession{
+		Username:   username,
+		TerminalID: terminalID,
+		Kind:       session.Kind,
+		RemoteAddr: session.RemoteAddr,
+		ListenerID: session.ListenerID,
+		OS:         session.OS,
+		Upgraded:   session.Upgraded,
+		Cols:       cols,
+		Rows:       rows,
+	}
+	if held.Kind == "" {
+		held.Kind = models.SessionKindLocal
+	}
+	if p, ok := session.Backend.(interface{ Pid() int }); ok {
+		held.Pid = p.Pid()
+	}
+	return held
+}
+
+// ApplyHeldSession 将元数据中的终端状态恢复到重新接管的会话
+func ApplyHeldSession(session *models.TerminalSession, held models.HeldSession) {
+	session.OS = held.OS
+	session.SetUpgraded(held.Upgraded)
+	session.SetSize(held.Cols, held.Rows)
+	if held.Cols > 0 && held.Rows > 0 {
+		session.Buffer.Resize(held.Cols, held.Rows)
+	}
+}
+
+// sessionEntry 内存中的一个会话
+type sessionEntry struct {
+	username   string
+	terminalID string
+	session    *models.TerminalSession
+}
+
+// allSessions 返回内存中所有会话的快照
+func allSessions() []sessionEntry {
+	models.TerminalSessionsMux.Lock()
+	defer models.TerminalSessionsMux.Unlock()
+	
+	var entries []sessionEntry
+	for username, sessions := range models.TerminalSessions {
+		for terminalID, session := range sessions {
+			entries = append(entries, sessionEntry{username, terminalID, session})
+		}
+	}
+	return entries
+}
+
+// SuspendSessions 退出前保存所有会话的输出，并更新保持进程中的元数据
+func SuspendSessions() {
+	entries := allSessions()
+	for _, e := range entries {
+		SaveSessionToDatabase(e.username, e.terminalID, e.session)
+		if e.session.Backend != nil && e.session.Active {
+			HoldSession(e.username, e.terminalID, e.session)
+		}
+	}
+	log.Printf("Saved %d terminal sessions before shutdown", len(entries))
+}
+
+// PauseSessions 停止读取所有可移交会话的输出并保存缓冲区，返回会话元数据和描述符副本，用于升级时移交给新进程。
+// 只有本地PTY和原始TCP连接可以移交，SSH、Webshell和TLS会话在旧进程退出时关闭，逐个记录日志。
+// 调用前应先调用upgrade.Pause，使读取协程在超时后等待而不是结束会话
+func PauseSessions() []holder.Entry {
+	var detachable []sessionEntry
+	for _, e := range allSessions() {
+		if !e.session.Active || e.session.Backend == nil {
+			continue
+		}
+		if b, ok := e.session.Backend.(backend.Detachable); ok {
+			b.SetReadDeadline(time.Now())
+			detachable = append(detachable, e)
+			continue
+		}
+		log.Printf("Terminal session %s (%s %s) of user %s cannot be handed off and will be closed by the upgrade", e.terminalID, e.session.Kind, e.session.RemoteAddr, e.username)
+	}
+	
+	// 等待读取协程处理完已读到的输出
+	time.Sleep(pauseSettle)
+	SuspendSessions()
+	
+	var held []holder.Entry
+	for _, e := range detachable {
+		rc, err := e.session.Backend.(backend.Detachable).SyscallConn()
+		if err != nil {
+			continue
+		}
+		f, err := upgrade.DupFile(rc, e.terminalID)
+		if err != nil {
+			log.Printf("Failed to duplicate terminal session %s: %v", e.terminalID, err)
+			continue
+		}
+		meta, err := json.Marshal(NewHeldSession(e.username, e.terminalID, e.session))
+		if err != nil {
+			f.Close()
+			continue
+		}
+		held = append(held, holder.Entry{ID: e.terminalID, Meta: meta, File: f})
+	}
+	return held
+}
+
+// ResumeSessions 移交失败后恢复读取会话输出
+func ResumeSessions() {
+	for _, e := range allSessions() {
+		b, ok := e.session.Backend.(backend.Detachable)
+		if !ok {
+			continue
+		}
+		b.SetReadDeadline(time.Time{})
+		if rc, err := b.SyscallConn(); err == nil {
+			upgrade.SetNonblock(rc)
+		}
+	}
+}
+
+// ResumeLocalSession 重新接管重启前的本地伪终端会话，buffer为数据库中保存的历史输出
+func ResumeLocalSession(username, terminalID string, b backend.Backend, buffer []byte) *models.TerminalSession {
+	session := newRemoteSession(terminalID, models.SessionKindLocal, "", "", buffer)
+	session.State = ""
+	session.Backend = b
+	SaveTerminalSession(username, terminalID, session)
+	SaveSessionToDatabase(username, terminalID, session)
+	HoldSession(username, terminalID, session)
+	
+	go func() {
+		pumpOutput(session, terminalID, b)
+		b.Close()
+		ReleaseSession(terminalID)
+	}()
+	
+	return session
+}
@@ -0,0 +1,92 @@
+package terminal
+
+import (
+	"bytes"
+	"log"
+	"net"
+	
+	"ghosteye/database"
+	"ghosteye/linedisc"
+	"ghosteye/models"
+)
+
+// SetLineMode 开启或关闭会话的服务端行编辑
+func SetLineMode(username, terminalID string, session *models.TerminalSession, enabled bool) {
+	if !enabled {
+		// webshell不回显输入，必须由服务端行编辑
+		if session.Kind == models.SessionKindWebshell {
+			return
+		}
+		session.SetEditor(nil)
+		log.Printf("Line mode disabled for terminal session %s", terminalID)
+		return
+	}
+	if session.Editor() != nil {
+		return
+	}
+	
+	// 载入该会话及同一主机的历史命令
+	history, err := database.GetShellHistory(username, terminalID, historyHost(session), 1000)
+	if err != nil {
+		log.Printf("Failed to load shell history: %v", err)
+	}
+	editor := linedisc.NewEditor(history)
+	
+	// 用已有输出的最后一行作为初始提示符
+	session.Buffer.Lock()
+	tail := session.Buffer.Data
+	if len(tail) > 256 {
+		tail = tail[len(tail)-256:]
+	}
+	editor.Observe(tail)
+	session.Buffer.Unlock()
+	
+	session.SetEditor(editor)
+	log.Printf("Line mode enabled for terminal session %s with %d history entries", terminalID, len(history))
+}
+
+// handleInput 处理客户端输入，开启行编辑时由服务端编辑并在回车后整行发送
+func handleInput(username, terminalID string, session *models.TerminalSession, p []byte) error {
+	editor := session.Editor()
+	if editor == nil {
+		// 原始反弹Shell没有终端驱动转换回车，需要将回车转换为换行
+		if b, upgraded := session.CurrentBackend(); b != nil && !b.TTY() && !upgraded {
+			p = bytes.ReplaceAll(p, []byte("\r\n"), []byte("\n"))
+			p = bytes.ReplaceAll(p, []byte("\r"), []byte("\n"))
+		}
+		return writeToSession(session, p)
+	}
+	
+	echo, lines := editor.Feed(p)
+	if len(echo) > 0 {
+		sendOutput(session, terminalID, echo)
+	}
+	
+	for _, line := range lines {
+		if err := writeToSession(session, []byte(line+"\n")); err != nil {
+			return err
+		}
+		
+		if line != "" {
+			go func(line string) {
+				if err := database.AddShellHistory(username, terminalID, historyHost(session), line); err != nil {
+					log.Printf("Failed to save shell history: %v", err)
+				}
+			}(line)
+		}
+	}
+	
+	return nil
+}
+
+// historyHost 返回用于共享历史记录的主机标识
+func historyHost(session *models.TerminalSession) string {
+	if session.RemoteAddr == "" {
+		return "local"
+	}
+	host, _, err := net.SplitHostPort(session.RemoteAddr)
+	if err != nil {
+		return session.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,211 @@
+package terminal
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	
+	"github.com/gorilla/websocket"
+	
+	"ghosteye/backend"
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/upgrade"
+)
+
+// AttachRemoteSession 将监听器接收的TCP连接包装为终端会话，
+// 复用本地PTY会话的缓冲、多客户端广播和数据库持久化
+func AttachRemoteSession(username, terminalID, listenerID string, conn net.Conn) *models.TerminalSession {
+	return AttachBackendSession(username, terminalID, models.SessionKindReverse, listenerID, conn.RemoteAddr().String(), backend.NewTCP(conn))
+}
+
+// AttachBackendSession 将已建立的后端包装为远程终端会话，后端输出结束后会话标记为已关闭
+func AttachBackendSession(username, terminalID, kind, listenerID, remoteAddr string, b backend.Backend) *models.TerminalSession {
+	return ResumeBackendSession(username, terminalID, kind, listenerID, remoteAddr, b, nil)
+}
+
+// ResumeBackendSession 与AttachBackendSession相同，buffer为重新接管重启前的会话时的历史输出
+func ResumeBackendSession(username, terminalID, kind, listenerID, remoteAddr string, b backend.Backend, buffer []byte) *models.TerminalSession {
+	session := NewRemoteSession(username, terminalID, kind, listenerID, remoteAddr, b, buffer)
+	
+	go func() {
+		PumpRemoteOutput(session, terminalID)
+		b.Close()
+		
+		if code, exited := b.ExitStatus(); exited {
+			log.Printf("Remote shell of terminal session %s exited with status %d", terminalID, code)
+		}
+		FinishRemoteSession(session, username, terminalID)
+	}()
+	
+	return session
+}
+
+// SessionHook 新的远程Shell接入后执行的回调
+type SessionHook func(username, terminalID string, session *models.TerminalSession)
+
+// 已注册的回调
+var (
+	sessionHooks    []SessionHook
+	sessionHooksMux sync.Mutex
+)
+
+// OnNewSession 注册新远程Shell接入后的回调，回调在独立的goroutine中执行，恢复的会话不会触发
+func OnNewSession(hook SessionHook) {
+	sessionHooksMux.Lock()
+	defer sessionHooksMux.Unlock()
+	
+	sessionHooks = append(sessionHooks, hook)
+}
+
+// NewRemoteSession 创建远程会话并保存到内存和数据库，buffer为恢复会话时的历史输出
+func NewRemoteSession(username, terminalID, kind, listenerID, remoteAddr string, b backend.Backend, buffer []byte) *models.TerminalSession {
+	session := newRemoteSession(terminalID, kind, remoteAddr, listenerID, buffer)
+	session.Backend = b
+	registerRemoteSession(username, terminalID, session)
+	HoldSession(username, terminalID, session)
+	
+	if buffer == nil {
+		sessionHooksMux.Lock()
+		hooks := append([]SessionHook(nil), sessionHooks...)
+		sessionHooksMux.Unlock()
+		for _, hook := range hooks {
+			go hook(username, terminalID, session)
+		}
+	}
+	
+	return session
+}
+
+// newRemoteSession 构造远程会话的公共字段，buffer不为nil时为从数据库恢复的历史输出
+func newRemoteSession(terminalID, kind, remoteAddr, listenerID string, buffer []byte) *models.TerminalSession {
+	restored := buffer != nil
+	if buffer == nil {
+		buffer = []byte{}
+	}
+	
+	return &models.TerminalSession{
+		ID:         terminalID,
+		Done:       make(chan struct{}),
+		LastActive: time.Now(),
+		Clients:    make(map[string]*websocket.Conn),
+		Buffer: models.OutputBuffer{
+			Data:     buffer,
+			Max:      outputMax(),
+			Restored: restored,
+		},
+		Active:     true,
+		Created:    time.Now(),
+		Kind:       kind,
+		RemoteAddr: remoteAddr,
+		ListenerID: listenerID,
+		State:      models.SessionStateConnected,
+	}
+}
+
+// registerRemoteSession 将远程会话保存到内存和数据库
+func registerRemoteSession(username, terminalID string, session *models.TerminalSession) {
+	SaveTerminalSession(username, terminalID, session)
+	
+	// 立即持久化，使浏览器刷新后能在会话列表中看到该Shell
+	SaveSessionToDatabase(username, terminalID, session)
+	err := database.SetTerminalSessionRemote(username, terminalID, session.Kind, session.RemoteAddr, session.ListenerID)
+	if err != nil {
+		log.Printf("Failed to save remote session info: %v", err)
+	}
+	SetSessionState(session, username, terminalID, models.SessionStateConnected)
+	
+	log.Printf("Remote shell %s attached as %s terminal session %s for user %s", session.RemoteAddr, session.Kind, terminalID, username)
+}
+
+// PumpRemoteOutput 从会话后端读取输出并广播给客户端，连接断开时返回
+func PumpRemoteOutput(session *models.TerminalSession, terminalID string) {
+	pumpOutput(session, terminalID, session.Backend)
+}
+
+// pumpOutput 从远程输出流读取数据并广播给客户端，读取结束时返回
+func pumpOutput(session *models.TerminalSession, terminalID string, r io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			session.LastActive = time.Now()
+			BroadcastOutput(session, terminalID, buf[:n])
+		}
+		if err != nil {
+			// 升级移交期间读取被暂停，恢复后继续
+			if upgrade.WaitIfPaused(err) {
+				continue
+			}
+			// 伪终端中的进程退出时读取返回EIO
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !errors.Is(err, syscall.EIO) {
+				log.Printf("Failed to read from remote connection %s: %v", session.RemoteAddr, err)
+			}
+			return
+		}
+	}
+}
+
+// IsSessionKilled 判断会话是否已被终止并移除
+func IsSessionKilled(session *models.TerminalSession) bool {
+	select {
+	case <-session.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetSessionState 更新远程会话的连接状态并通知客户端
+func SetSessionState(session *models.TerminalSession, username, terminalID, state string) {
+	session.State = state
+	if err := database.SetTerminalSessionState(username, terminalID, state); err != nil {
+		log.Printf("Failed to save terminal session state: %v", err)
+	}
+	BroadcastMessage(session, terminalID, "state", map[string]interface{}{
+		"state": state,
+	})
+}
+
+// ReplaceBackend 绑定Shell重连后替换会话后端。新连接是尚未升级的原始Shell，
+// 开启了行编辑时重新创建行编辑器，不沿用旧连接的提示符和编辑状态
+func ReplaceBackend(username, terminalID string, session *models.TerminalSession, b backend.Backend) {
+	session.Mutex.Lock()
+	session.Backend = b
+	session.Upgraded = false
+	session.RemoteCols, session.RemoteRows = 0, 0
+	lineMode := session.LineEditor != nil
+	session.LineEditor = nil
+	session.Mutex.Unlock()
+	
+	if lineMode {
+		SetLineMode(username, terminalID, session, true)
+	}
+}
+
+// FinishRemoteSession 远程连接结束后将会话标记为已关闭
+func FinishRemoteSession(session *models.TerminalSession, username, terminalID string) {
+	// 会话已被终止，不再写回数据库
+	if IsSessionKilled(session) {
+		return
+	}
+	
+	log.Printf("Remote connection %s closed, terminal session %s is now inactive", session.RemoteAddr, terminalID)
+	ReleaseSession(terminalID)
+	BroadcastOutput(session, terminalID, []byte("\r\n--- Remote connection closed ---\r\n"))
+	session.Active = false
+	
+	// 保存最终输出并标记为非活跃
+	SaveSessionToDatabase(username, terminalID, session)
+	SetSessionState(session, username, terminalID, models.SessionStateClosed)
+	MarkSessionInactive(username, terminalID)
+}
+
+// isRemoteKind 判断会话类型是否为远程连接
+func isRemoteKind(kind string) bool {
+	return kind != "" && kind != models.SessionKindLocal
+}
@@ -0,0 +1,160 @@
+package terminal
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"ghosteye/config"
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/scrollback"
+)
+
+const (
+	// scrollbackSegment 输出日志每个分段文件的大小
+	scrollbackSegment = 1 << 20
+	// MaxOutputRead 一次读取输出范围时最多返回的字节数
+	MaxOutputRead = 4 << 20
+	// defaultOutputMax 未配置时内存中保留的输出字节数
+	defaultOutputMax = 100 * 1024
+)
+
+// outputMax 返回每个会话在内存中保留的输出字节数
+func outputMax() int {
+	if hot := config.GetScrollbackHot(); hot > 0 {
+		return hot
+	}
+	return defaultOutputMax
+}
+
+// outputLogDir 返回会话输出日志的目录，未启用输出日志或名称不能用作路径时返回空字符串
+func outputLogDir(username, terminalID string) string {
+	dir := config.GetScrollbackDir()
+	if dir == "" {
+		return ""
+	}
+	
+	user, id := url.PathEscape(username), url.PathEscape(terminalID)
+	if !validPathName(user) || !validPathName(id) {
+		return ""
+	}
+	return filepath.Join(dir, user, id)
+}
+
+// validPathName 转义后的名称是否能作为单独的一级目录
+func validPathName(name string) bool {
+	return name != "" && name != "." && name != ".."
+}
+
+// restoreOutput 为新注册的会话关联磁盘上的输出日志，
+// 日志中已有重启前的输出时从日志恢复缓冲区
+func restoreOutput(username, terminalID string, session *models.TerminalSession) {
+	// 从数据库恢复的缓冲区需要同时恢复其在输出流中的偏移
+	session.Buffer.Lock()
+	restored := session.Buffer.Restored
+	session.Buffer.Restored = false
+	session.Buffer.Unlock()
+	if restored {
+		start, err := database.GetTerminalSessionBufferStart(username, terminalID)
+		if err != nil {
+			log.Printf("Failed to get terminal buffer offset: %v", err)
+		}
+		session.Buffer.SetStart(start)
+	}
+	
+	dir := outputLogDir(username, terminalID)
+	if dir == "" || session.Buffer.Log != nil {
+		return
+	}
+	l, err := scrollback.Open(dir, scrollbackSegment, config.GetScrollbackRetention())
+	if err != nil {
+		log.Printf("Failed to open scrollback of terminal session %s: %v", terminalID, err)
+		return
+	}
+	if err := session.Buffer.AttachLog(l); err != nil {
+		log.Printf("Failed to attach scrollback of terminal session %s: %v", terminalID, err)
+		l.Close()
+	}
+}
+
+// removeOutputLog 删除会话的输出日志
+func removeOutputLog(username, terminalID string) {
+	dir := outputLogDir(username, terminalID)
+	if dir == "" {
+		return
+	}
+	if err := scrollback.Remove(dir); err != nil {
+		log.Printf("Failed to remove scrollback of terminal session %s: %v", terminalID, err)
+	}
+}
+
+// ReadOutput 读取会话输出流中[from, to)范围内仍保留的输出。
+// 会话不在内存中时从磁盘日志读取，没有日志时退回到数据库中保存的缓冲区
+func ReadOutput(username, terminalID string, from, to int64) (models.OutputRange, error) {
+	if session := GetTerminalSession(username, terminalID); session != nil {
+		return session.Buffer.Range(from, to, MaxOutputRead)
+	}
+	
+	if dir := outputLogDir(username, terminalID); dir != "" && scrollback.Exists(dir) {
+		l, err := scrollback.Open(dir, scrollbackSegment, 0)
+		if err != nil {
+			return models.OutputRange{}, err
+		}
+		defer l.Close()
+		
+		buffer := models.OutputBuffer{Log: l}
+		return buffer.Range(from, to, MaxOutputRead)
+	}
+	
+	data, _, err := database.LoadTerminalSessionFromDB(username, terminalID)
+	if err != nil {
+		return models.OutputRange{}, err
+	}
+	if data == nil {
+		return models.OutputRange{}, fmt.Errorf("Terminal session %s does not exist", terminalID)
+	}
+	start, err := database.GetTerminalSessionBufferStart(username, terminalID)
+	if err != nil {
+		return models.OutputRange{}, err
+	}
+	buffer := models.OutputBuffer{Data: data, Start: start}
+	return buffer.Range(from, to, MaxOutputRead)
+}
+
+// cleanOrphanOutputLogs 删除数据库和内存中都已不存在的会话的输出日志
+func cleanOrphanOutputLogs() {
+	dir := config.GetScrollbackDir()
+	if dir == "" {
+		return
+	}
+	
+	users, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		username, err := url.PathUnescape(user.Name())
+		if err != nil || !user.IsDir() {
+			continue
+		}
+		terminals, err := os.ReadDir(filepath.Join(dir, user.Name()))
+		if err != nil {
+			continue
+		}
+		for _, t := range terminals {
+			terminalID, err := url.PathUnescape(t.Name())
+			if err != nil || !t.IsDir() || GetTerminalSession(username, terminalID) != nil {
+				continue
+			}
+			exists, err := database.TerminalSessionExists(username, terminalID)
+			if err != nil || exists {
+				continue
+			}
+			scrollback.Remove(filepath.Join(dir, user.Name(), t.Name()))
+			log.Printf("Removed orphaned scrollback of terminal session %s for user %s", terminalID, username)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ghosteye/config"
+	"ghosteye/database"
+	"ghosteye/models"
+)
+
+// TestMain 在临时目录中初始化数据库
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "terminal-test")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := database.InitDatabase(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer database.CloseDatabase()
+
+		return m.Run()
+	}())
+}
+
+// useScrollback 临时启用输出日志，hotKB为内存中保留的KB数
+func useScrollback(t *testing.T, hotKB int) string {
+	old := config.AppConfig
+	dir := t.TempDir()
+	config.InitializeScrollback(dir, 1, hotKB)
+	t.Cleanup(func() { config.AppConfig = old })
+	return dir
+}
+
+func TestOutputMax(t *testing.T) {
+	useScrollback(t, 0)
+	if got := outputMax(); got != defaultOutputMax {
+		t.Errorf("outputMax() without hot size = %d, want %d", got, defaultOutputMax)
+	}
+
+	useScrollback(t, 4)
+	if got := outputMax(); got != 4096 {
+		t.Errorf("outputMax() = %d, want 4096", got)
+	}
+	session := newRemoteSession("t", models.SessionKindReverse, "", "", nil)
+	if session.Buffer.Max != 4096 || session.Buffer.Restored {
+		t.Errorf("new remote session buffer: max %d restored %v", session.Buffer.Max, session.Buffer.Restored)
+	}
+	if session := newRemoteSession("t", models.SessionKindBind, "", "", []byte("x")); !session.Buffer.Restored {
+		t.Error("remote session with a saved buffer is not marked as restored")
+	}
+}
+
+func TestRestoreOutput(t *testing.T) {
+	useScrollback(t, 1)
+	if err := database.SaveTerminalSessionToDB("alice", "saved", []byte("abc"), 500); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		restored  bool
+		wantStart int64
+	}{
+		{"restored", "abc", true, 500},
+		{"restored empty buffer", "", true, 500},
+		// 新会话在注册前已有输出时不能误用数据库中同名会话的偏移
+		{"new session with output", "abc", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &models.TerminalSession{
+				Buffer: models.OutputBuffer{Data: []byte(tt.data), Max: outputMax(), Restored: tt.restored},
+			}
+			restoreOutput("alice", "saved", session)
+			defer session.Buffer.CloseLog()
+			defer removeOutputLog("alice", "saved")
+
+			if session.Buffer.Start != tt.wantStart || session.Buffer.Restored {
+				t.Errorf("buffer start %d restored %v, want start %d", session.Buffer.Start, session.Buffer.Restored, tt.wantStart)
+			}
+			if session.Buffer.Log == nil {
+				t.Fatal("output log was not attached")
+			}
+			if start, end := session.Buffer.Log.Start(), session.Buffer.Log.End(); start != tt.wantStart || end != tt.wantStart+int64(len(tt.data)) {
+				t.Errorf("log covers [%d, %d)", start, end)
+			}
+		})
+	}
+}
+
+func TestCleanOrphanOutputLogs(t *testing.T) {
+	dir := useScrollback(t, 0)
+	if err := database.SaveTerminalSessionToDB("alice", "in-db", []byte{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	models.TerminalSessionsMux.Lock()
+	models.TerminalSessions["bob"] = map[string]*models.TerminalSession{"in-memory": {}}
+	models.TerminalSessionsMux.Unlock()
+	defer func() {
+		models.TerminalSessionsMux.Lock()
+		delete(models.TerminalSessions, "bob")
+		models.TerminalSessionsMux.Unlock()
+	}()
+
+	kept := []string{
+		outputLogDir("alice", "in-db"),
+		outputLogDir("bob", "in-memory"),
+		filepath.Join(dir, "%zz", "bad-escape"),
+	}
+	removed := []string{
+		outputLogDir("alice", "orphan"),
+		outputLogDir("a/b", "x y"),
+	}
+	for _, d := range append(append([]string{}, kept...), removed...) {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(d, "00000000000000000000.log"), []byte("x"), 0600)
+	}
+	os.WriteFile(filepath.Join(dir, "stray"), []byte("x"), 0600)
+
+	cleanOrphanOutputLogs()
+
+	for _, d := range kept {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("%s was removed: %v", d, err)
+		}
+	}
+	for _, d := range removed {
+		if _, err := os.Stat(d); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", d)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stray")); err != nil {
+		t.Errorf("stray file was removed: %v", err)
+	}
+}
@@ -3,13 +3,23 @@ package terminal
 import (
 	"fmt"
 	"log"
+	"math/rand"
+	"os"
 	"syscall"
 	"time"
 	
+	"ghosteye/backend"
 	"ghosteye/database"
 	"ghosteye/models"
 )
 
+// GenerateTerminalID 生成终端ID，格式与前端一致: timestamp_random
+func GenerateTerminalID() string {
+	timestamp := time.Now().UnixNano()
+	random := rand.Intn(10000)
+	return fmt.Sprintf("%d_%d", timestamp, random)
+}
+
 // 获取用户的终端会话
 func GetUserSessions(username string) map[string]*models.TerminalSession {
 	models.TerminalSessionsMux.Lock()
@@ -39,6 +49,9 @@ func GetTerminalSession(username, terminalID string) *models.TerminalSession {
 
 // 保存终端会话
 func SaveTerminalSession(username, terminalID string, session *models.TerminalSession) {
+	// 关联磁盘上的输出日志，恢复的会话从日志中加载最近的输出
+	restoreOutput(username, terminalID, session)
+	
 	models.TerminalSessionsMux.Lock()
 	defer models.TerminalSessionsMux.Unlock()
 	
@@ -71,18 +84,11 @@ func RemoveTerminalSession(username, terminalID string) {
 		}
 		session.ClientsMutex.Unlock()
 		
-		// 关闭PTY
-		if session.Ptmx != nil {
-			session.Ptmx.Close()
-		}
-		
-		// 关闭标准输入
-		if session.Stdin != nil {
-			session.Stdin.Close()
-		}
-		
-		// 发送完成信号
+		// 先发送完成信号，使读取协程能区分主动终止与连接断开
 		close(session.Done)
+		
+		// 关闭PTY、标准输入和远程连接
+		closeSessionIO(session)
 	}
 	
 	// 从映射中删除
@@ -92,12 +98,13 @@ func RemoveTerminalSession(username, terminalID string) {
 // 保存终端会话到数据库
 func SaveSessionToDatabase(username string, terminalID string, session *models.TerminalSession) {
 	// 获取缓冲区数据
-	session.Mutex.Lock()
+	session.Buffer.Lock()
 	buffer := session.Buffer.Data
-	session.Mutex.Unlock()
+	start := session.Buffer.Start
+	session.Buffer.Unlock()
 	
 	// 保存到数据库
-	err := database.SaveTerminalSessionToDB(username, terminalID, buffer)
+	err := database.SaveTerminalSessionToDB(username, terminalID, buffer, start)
 	if err != nil {
 		log.Printf("Failed to save terminal session to database: %v", err)
 	}
@@ -148,19 +155,12 @@ func CleanInactiveSessions() {
 				}
 				session.ClientsMutex.Unlock()
 				
-				// 关闭PTY
-				if session.Ptmx != nil {
-					session.Ptmx.Close()
-				}
-				
-				// 关闭标准输入
-				if session.Stdin != nil {
-					session.Stdin.Close()
-				}
-				
-				// 发送完成信号
+				// 先发送完成信号，使读取协程能区分主动终止与连接断开
 				close(session.Done)
 				
+				// 关闭PTY、标准输入和远程连接
+				closeSessionIO(session)
+				
 				// 从映射中删除
 				delete(sessions, terminalID)
 				
@@ -181,6 +181,9 @@ func CleanInactiveSessions() {
 	if err != nil {
 		log.Printf("Failed to clean old sessions from database: %v", err)
 	}
+	
+	// 删除对应会话已被清理的输出日志
+	cleanOrphanOutputLogs()
 }
 
 // 列出终端会话
@@ -217,6 +220,9 @@ func ListTerminals(username string) []map[string]interface{} {
 					"active":      true,
 					"age":         time.Since(session.LastActive).String(),
 					"duration":    session.LastActive.Sub(session.Created).String(),
+					"kind":        session.Kind,
+					"remote_addr": session.RemoteAddr,
+					"listener_id": session.ListenerID,
 				})
 			}
 		}
@@ -241,23 +247,17 @@ func KillTerminalSession(username, terminalID string) error {
 	}
 	
 	// 终止进程
-	if session.Cmd != nil && session.Cmd.Process != nil {
+	if session.Backend != nil {
 		// 尝试先优雅地终止进程
-		err := session.Cmd.Process.Signal(syscall.SIGTERM)
-		if err != nil {
+		err := session.Backend.Signal(syscall.SIGTERM)
+		if err != nil && err != backend.ErrUnsupported && err != os.ErrProcessDone {
 			log.Printf("Failed to send SIGTERM: %v, attempting SIGKILL", err)
 			// If SIGTERM fails, use SIGKILL to force termination
-			err = session.Cmd.Process.Kill()
+			err = session.Backend.Signal(syscall.SIGKILL)
 			if err != nil {
 				return fmt.Errorf("Failed to terminate process: %v", err)
 			}
 		}
-		
-		// 等待进程退出
-		go func() {
-			session.Cmd.Wait()
-			log.Printf("Process for terminal session %s has been terminated", terminalID)
-		}()
 	}
 	
 	// 在这里完全从数据库中删除终端会话，而不是保存它
@@ -274,21 +274,26 @@ func KillTerminalSession(username, terminalID string) error {
 	}
 	session.ClientsMutex.Unlock()
 	
-	// 关闭PTY
-	if session.Ptmx != nil {
-		session.Ptmx.Close()
-	}
+	// 先发送完成信号，使读取协程能区分主动终止与连接断开
+	close(session.Done)
 	
-	// 关闭标准输入
-	if session.Stdin != nil {
-		session.Stdin.Close()
-	}
+	// 关闭PTY、标准输入和远程连接
+	closeSessionIO(session)
 	
-	// 发送完成信号
-	close(session.Done)
+	// 终止的会话不再保留输出日志
+	removeOutputLog(username, terminalID)
 	
 	// 从映射中删除
 	delete(sessions, terminalID)
 	
 	return nil
-} 
+}
+
+// closeSessionIO 关闭会话后端，并让会话保持进程关闭其副本
+func closeSessionIO(session *models.TerminalSession) {
+	if session.Backend != nil {
+		session.Backend.Close()
+		ReleaseSession(session.ID)
+	}
+	session.Buffer.CloseLog()
+}
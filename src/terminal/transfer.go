@@ -0,0 +1,173 @@
+package terminal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	
+	"ghosteye/database"
+	"ghosteye/models"
+	"ghosteye/utils"
+)
+
+// 流式传输的分块大小
+const (
+	rawChunkSize     = 32 * 1024 // 没有终端驱动的原始Shell
+	ttyChunkSize     = 2 * 1024  // PTY规范模式下单行不能超过4096字节
+	windowsChunkSize = 3 * 1024  // cmd.exe单行不能超过8191字符
+	chunkTimeout     = 30 * time.Second
+)
+
+// sha256Pattern 匹配命令输出中的SHA256值
+var sha256Pattern = regexp.MustCompile(`(?i)\b[0-9a-f]{64}\b`)
+
+// Transfer 一次流式文件传输
+type Transfer struct {
+	ID        string `json:"id"`
+	Direction string `json:"direction"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	LocalPath string `json:"-"`
+}
+
+// UploadFile 通过会话的终端流分块写入文件并校验SHA256，传输进度以transfer消息发送给客户端
+func UploadFile(username, terminalID string, session *models.TerminalSession, remotePath string, data []byte) (*Transfer, error) {
+	if session.Backend == nil || !session.Active {
+		return nil, fmt.Errorf("Terminal session %s is not active", terminalID)
+	}
+	
+	transfer := &Transfer{
+		ID:        utils.GenerateSessionID()[:12],
+		Direction: database.TransferUpload,
+		Path:      remotePath,
+		Size:      int64(len(data)),
+		SHA256:    sum256(data),
+	}
+	windows := session.OS == models.OSWindows
+	
+	chunkSize := rawChunkSize
+	if windows {
+		chunkSize = windowsChunkSize
+	} else if b, upgraded := session.CurrentBackend(); upgraded || b.TTY() {
+		chunkSize = ttyChunkSize
+	}
+	
+	// Windows先写入base64文本文件，最后用certutil解码
+	var target, staging string
+	if windows {
+		var err error
+		if target, err = utils.QuoteCmd(remotePath); err != nil {
+			return nil, err
+		}
+		if staging, err = utils.QuoteCmd(remotePath + ".b64"); err != nil {
+			return nil, err
+		}
+	}
+	for offset := 0; offset == 0 || offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		encoded := base64.StdEncoding.EncodeToString(data[offset:end])
+		
+		// 第一块创建文件，后续追加
+		redirect := ">>"
+		if offset == 0 {
+			redirect = ">"
+		}
+		command := fmt.Sprintf("printf '%%s' '%s' | base64 -d %s %s", encoded, redirect, utils.QuoteShell(remotePath))
+		if windows {
+			// 括号避免以数字结尾的分块被解析为文件描述符重定向
+			command = fmt.Sprintf(`(echo %s)%s%s`, encoded, redirect, staging)
+		}
+		
+		// 写入命令正常时没有输出，有输出说明出错
+		output, err := RunCommand(session, command, chunkTimeout, true)
+		if err == nil && strings.TrimSpace(output) != "" {
+			err = fmt.Errorf("%s", strings.TrimSpace(output))
+		}
+		if err != nil {
+			reportTransfer(session, terminalID, transfer, int64(offset), true, err)
+			return nil, fmt.Errorf("Failed to upload chunk at offset %d: %v", offset, err)
+		}
+		reportTransfer(session, terminalID, transfer, int64(end), false, nil)
+	}
+	
+	if windows {
+		command := fmt.Sprintf(`certutil -f -decode %s %s >nul & del /q %s`, staging, target, staging)
+		if _, err := RunCommand(session, command, chunkTimeout, true); err != nil {
+			reportTransfer(session, terminalID, transfer, transfer.Size, true, err)
+			return nil, fmt.Errorf("Failed to decode uploaded file: %v", err)
+		}
+	}
+	
+	// 校验远程文件的SHA256
+	remote, err := remoteHash(session, remotePath)
+	if err == nil && remote != transfer.SHA256 {
+		err = fmt.Errorf("SHA256 mismatch: local %s, remote %s", transfer.SHA256, remote)
+	}
+	if err != nil {
+		reportTransfer(session, terminalID, transfer, transfer.Size, true, err)
+		return nil, err
+	}
+	
+	if err := database.AddFileTransfer(username, terminalID, transfer.Direction, "stream", remotePath, transfer.Size, transfer.SHA256); err != nil {
+		log.Printf("Failed to log file transfer: %v", err)
+	}
+	reportTransfer(session, terminalID, transfer, transfer.Size, true, nil)
+	log.Printf("Uploaded %d bytes to %s via terminal session %s", transfer.Size, remotePath, terminalID)
+	
+	return transfer, nil
+}
+
+// remoteHash 在会话中计算远程文件的SHA256
+func remoteHash(session *models.TerminalSession, remotePath string) (string, error) {
+	command := fmt.Sprintf("sha256sum %s 2>/dev/null || openssl dgst -sha256 -r %s", utils.QuoteShell(remotePath), utils.QuoteShell(remotePath))
+	if session.OS == models.OSWindows {
+		quoted, err := utils.QuoteCmd(remotePath)
+		if err != nil {
+			return "", err
+		}
+		command = fmt.Sprintf(`certutil -hashfile %s SHA256`, quoted)
+	}
+	
+	output, err := RunCommand(session, command, chunkTimeout, true)
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash remote file: %v", err)
+	}
+	
+	// 旧版certutil输出的哈希值带有空格
+	hash := sha256Pattern.FindString(strings.ReplaceAll(output, " ", ""))
+	if hash == "" {
+		return "", fmt.Errorf("Failed to hash remote file: %s", strings.TrimSpace(output))
+	}
+	return strings.ToLower(hash), nil
+}
+
+// reportTransfer 向客户端发送传输进度
+func reportTransfer(session *models.TerminalSession, terminalID string, transfer *Transfer, done int64, finished bool, err error) {
+	progress := map[string]interface{}{
+		"id":        transfer.ID,
+		"direction": transfer.Direction,
+		"path":      transfer.Path,
+		"size":      transfer.Size,
+		"done":      done,
+		"finished":  finished,
+	}
+	if err != nil {
+		progress["error"] = err.Error()
+	}
+	BroadcastMessage(session, terminalID, "transfer", progress)
+}
+
+// sum256 计算数据的SHA256
+func sum256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
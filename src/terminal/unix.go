@@ -10,39 +10,33 @@ import (
 	"sync"
 	"syscall"
 	"time"
-	"unsafe"
+	"errors"
 	"encoding/json"
 	"encoding/base64"
 	
-	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
 	
+	"ghosteye/backend"
 	"ghosteye/database"
 	"ghosteye/models"
+	"ghosteye/upgrade"
 )
 
-// 处理Unix终端会话
-func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string, username string) {
+// 处理Unix终端会话，offset为客户端已收到输出的末尾偏移，为负数时回放全部缓冲
+func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string, username string, offset int64) {
 	// 创建新会话或获取现有会话
 	session := GetTerminalSession(username, terminalID)
 	
-	// 如果会话存在且有活跃的PTY，直接连接到现有会话
-	if session != nil && (session.Ptmx != nil || session.Cmd != nil) {
+	// 如果会话存在且有活跃的后端或为远程会话，直接连接到现有会话
+	if session != nil && (session.Backend != nil || isRemoteKind(session.Kind)) {
 		log.Printf("Client %s connected to existing session %s", clientIP, terminalID)
 		
-		// 将客户端添加到会话中
-		session.ClientsMutex.Lock()
-		session.Clients[clientIP] = conn
-		session.ClientsMutex.Unlock()
+		// 向客户端发送缓冲数据并将客户端添加到会话中
+		attachClient(conn, clientIP, session, terminalID, offset)
 		
 		// 更新会话活跃时间
 		session.LastActive = time.Now()
 		
-		// 向客户端发送缓冲数据
-		if len(session.Buffer.Data) > 0 {
-			conn.WriteMessage(websocket.BinaryMessage, session.Buffer.Data)
-		}
-		
 		// 处理WebSocket连接
 		handleWebSocketConnection(conn, clientIP, session, username, terminalID)
 		return
@@ -55,71 +49,80 @@ func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string
 		if err == nil && buffer != nil {
 			// Recover session from database
 			log.Printf("Recovering terminal session %s for user %s from database", terminalID, username)
+			kind, err := database.GetTerminalSessionKind(username, terminalID)
+			if err != nil {
+				log.Printf("Failed to get terminal session kind: %v", err)
+				kind = models.SessionKindLocal
+			}
 			session = &models.TerminalSession{
+				ID:         terminalID,
 				Done:       make(chan struct{}),
 				LastActive: time.Now(),
 				Clients:    make(map[string]*websocket.Conn),
 				Buffer: models.OutputBuffer{
-					Data: buffer,
-					Max:  100 * 1024, // 最大100KB
+					Data:     buffer,
+					Max:      outputMax(),
+					Restored: true,
 				},
-				Active:     true,
+				Active:     kind == models.SessionKindLocal,
 				Created:    time.Now(),
+				Kind:       kind,
 			}
 			SaveTerminalSession(username, terminalID, session)
 		} else {
 			// 创建新会话
 			session = &models.TerminalSession{
+				ID:         terminalID,
 				Done:       make(chan struct{}),
 				LastActive: time.Now(),
 				Clients:    make(map[string]*websocket.Conn),
 				Buffer: models.OutputBuffer{
 					Data: []byte{},
-					Max:  100 * 1024, // 最大100KB
+					Max:  outputMax(),
 				},
 				Active:     true,
 				Created:    time.Now(),
+				Kind:       models.SessionKindLocal,
 			}
 			SaveTerminalSession(username, terminalID, session)
 		}
 	}
 
-	// 将客户端添加到会话中
-	session.ClientsMutex.Lock()
-	session.Clients[clientIP] = conn
-	session.ClientsMutex.Unlock()
+	// 向客户端发送缓冲数据并将客户端添加到会话中
+	attachClient(conn, clientIP, session, terminalID, offset)
 	
 	log.Printf("Client %s connected to session %s, current client count: %d", clientIP, terminalID, len(session.Clients))
 
 	// 更新会话活跃时间
 	session.LastActive = time.Now()
 
-	// 向客户端发送缓冲数据
+	// 远程连接已断开的会话只回放历史，不启动本地shell
+	if isRemoteKind(session.Kind) {
+		conn.WriteMessage(websocket.BinaryMessage, []byte("\r\n--- Remote connection closed ---\r\n"))
+		handleWebSocketConnection(conn, clientIP, session, username, terminalID)
+		return
+	}
+
+	// 历史输出已在添加客户端时发送
 	if len(session.Buffer.Data) > 0 {
-		conn.WriteMessage(websocket.BinaryMessage, session.Buffer.Data)
 		conn.WriteMessage(websocket.BinaryMessage, []byte("\r\n--- History ends, new session begins ---\r\n"))
 	}
 
-	// 创建命令
-	cmd := exec.Command("/bin/bash")
-	
-	// 创建伪终端
-	ptmx, err := pty.Start(cmd)
+	// 创建本地PTY后端，无法分配PTY时退回到标准管道
+	b, err := backend.New("local", backend.Options{"command": "/bin/bash"})
+	if err != nil {
+		log.Printf("Failed to start PTY: %v, falling back to pipe, %s", err, clientIP)
+		b, err = backend.New("pipe", backend.Options{"command": "/bin/bash"})
+	}
 	if err != nil {
-		log.Printf("Failed to start PTY: %v, %s", err, clientIP)
+		log.Printf("Failed to start terminal: %v, %s", err, clientIP)
 		conn.WriteMessage(websocket.BinaryMessage, []byte(fmt.Sprintf("Failed to start terminal: %v\r\n", err)))
 		return
 	}
 	
-	// 将PTY和命令保存到会话中
-	session.Ptmx = ptmx
-	session.Cmd = cmd
-	
-	// 设置终端大小
-	pty.Setsize(ptmx, &pty.Winsize{
-		Rows: 24,
-		Cols: 80,
-	})
+	// 将后端保存到会话中，并交给会话保持进程使其能在GhostEye重启后继续运行
+	session.Backend = b
+	HoldSession(username, terminalID, session)
 
 	// 创建用于取消goroutine的上下文
 	ctx, cancel := context.WithCancel(context.Background())
@@ -128,7 +131,7 @@ func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string
 	// 创建WaitGroup等待所有goroutine
 	var wg sync.WaitGroup
 
-	// 从PTY读取并写入WebSocket
+	// 从后端读取并写入WebSocket
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -138,54 +141,21 @@ func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string
 			case <-ctx.Done():
 				return
 			default:
-				// 设置读取超时以避免阻塞
-				ptmx.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-				n, err := ptmx.Read(buf)
+				n, err := b.Read(buf)
 				if err != nil {
-					if err != io.EOF && !os.IsTimeout(err) {
-						log.Printf("Failed to read from PTY: %v, %s", err, clientIP)
-					}
-					// 超时错误是正常的，继续读取
-					if os.IsTimeout(err) {
+					if upgrade.WaitIfPaused(err) {
 						continue
 					}
-					// 其他错误，退出循环
+					if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+						log.Printf("Failed to read from PTY: %v, %s", err, clientIP)
+					}
+					ReleaseSession(terminalID)
 					return
 				}
 				
 				if n > 0 {
-					// 将输出添加到缓冲区
-					session.Buffer.Append(buf[:n])
-					
-					// 构造带终端ID的消息
-					message := struct {
-						Type       string `json:"type"`
-						TerminalID string `json:"terminalId"`
-						Data       string `json:"data"`
-					}{
-						Type:       "output",
-						TerminalID: terminalID,
-						// 使用Base64编码二进制数据
-						Data:       base64.StdEncoding.EncodeToString(buf[:n]),
-					}
-					
-					// 序列化消息
-					messageBytes, err := json.Marshal(message)
-					if err != nil {
-						log.Printf("Failed to serialize terminal output message: %v", err)
-						continue
-					}
-					
-					// 向所有客户端发送输出
-					session.ClientsMutex.Lock()
-					for clientAddr, clientConn := range session.Clients {
-						err := clientConn.WriteMessage(websocket.TextMessage, messageBytes)
-						if err != nil {
-							log.Printf("Failed to send message to client %s: %v", clientAddr, err)
-							// Don't remove client here to avoid concurrent map modification
-						}
-					}
-					session.ClientsMutex.Unlock()
+					// 写入缓冲区并广播给所有客户端
+					BroadcastOutput(session, terminalID, buf[:n])
 				}
 			}
 		}
@@ -196,6 +166,166 @@ func HandleUnixTerminal(conn *websocket.Conn, clientIP string, terminalID string
 	
 }
 
+// BroadcastOutput 将终端输出写入缓冲区并发送给会话的所有客户端
+func BroadcastOutput(session *models.TerminalSession, terminalID string, data []byte) {
+	// 交给进行中的命令截获，被隐藏的输出不显示也不写入缓冲区
+	data = filterCapture(session, data)
+	if len(data) == 0 {
+		return
+	}
+	
+	// 记录提示符，供行编辑器重绘时使用
+	if editor := session.Editor(); editor != nil {
+		editor.Observe(data)
+	}
+	
+	sendOutput(session, terminalID, data)
+}
+
+// outputMessage 构造带终端ID和输出流偏移的输出消息，msgType为output或snapshot
+func outputMessage(msgType string, terminalID string, offset int64, data []byte) ([]byte, error) {
+	message := struct {
+		Type       string `json:"type"`
+		TerminalID string `json:"terminalId"`
+		Data       string `json:"data"`
+		Offset     int64  `json:"offset"` // output为第一个字节在输出流中的偏移，snapshot为快照之后的下一个字节的偏移
+	}{
+		Type:       msgType,
+		TerminalID: terminalID,
+		// 使用Base64编码二进制数据
+		Data:       base64.StdEncoding.EncodeToString(data),
+		Offset:     offset,
+	}
+	
+	return json.Marshal(message)
+}
+
+// attachClient 向客户端补发输出并将其添加到会话中。
+// offset为负数时以二进制消息发送终端模拟器的屏幕快照；offset为0或部分输出已被淘汰时发送snapshot消息，
+// 后者先发送gap消息说明缺失的范围；否则只补发offset之后的原始输出
+func attachClient(conn *websocket.Conn, clientIP string, session *models.TerminalSession, terminalID string, offset int64) {
+	// 持有客户端锁，保证补发和之后广播的输出之间没有遗漏或重复
+	session.ClientsMutex.Lock()
+	defer session.ClientsMutex.Unlock()
+	
+	session.Clients[clientIP] = conn
+	
+	if offset < 0 {
+		if len(session.Buffer.Data) > 0 {
+			snapshot, _ := session.Buffer.Snapshot()
+			conn.WriteMessage(websocket.BinaryMessage, snapshot)
+		}
+		return
+	}
+	
+	data, start, gap := session.Buffer.Since(offset)
+	if gap {
+		messageBytes, _ := json.Marshal(models.Message{
+			Type:       "gap",
+			TerminalID: terminalID,
+			Data:       map[string]int64{"from": offset, "to": start},
+		})
+		conn.WriteMessage(websocket.TextMessage, messageBytes)
+	}
+	
+	// 客户端没有任何输出或缺失了一部分时，原始输出无法正确重现全屏程序的画面，改为发送快照
+	if gap || (offset == 0 && len(data) > 0) {
+		snapshot, end := session.Buffer.Snapshot()
+		messageBytes, err := outputMessage("snapshot", terminalID, end, snapshot)
+		if err != nil {
+			log.Printf("Failed to serialize terminal snapshot message: %v", err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, messageBytes)
+		return
+	}
+	
+	if len(data) > 0 {
+		messageBytes, err := outputMessage("output", terminalID, start, data)
+		if err != nil {
+			log.Printf("Failed to serialize terminal output message: %v", err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, messageBytes)
+	}
+}
+
+// sendOutput 将数据写入缓冲区并发送给所有客户端
+func sendOutput(session *models.TerminalSession, terminalID string, data []byte) {
+	// 写入缓冲区和发送都在客户端锁内完成，新客户端补发的输出与广播的输出按偏移衔接
+	session.ClientsMutex.Lock()
+	defer session.ClientsMutex.Unlock()
+	
+	// 将输出添加到缓冲区
+	offset := session.Buffer.Append(data)
+	
+	// 序列化消息
+	messageBytes, err := outputMessage("output", terminalID, offset, data)
+	if err != nil {
+		log.Printf("Failed to serialize terminal output message: %v", err)
+		return
+	}
+	
+	// 向所有客户端发送输出
+	for clientAddr, clientConn := range session.Clients {
+		err := clientConn.WriteMessage(websocket.TextMessage, messageBytes)
+		if err != nil {
+			log.Printf("Failed to send message to client %s: %v", clientAddr, err)
+			// Don't remove client here to avoid concurrent map modification
+		}
+	}
+}
+
+// BroadcastMessage 向会话的所有客户端发送控制消息
+func BroadcastMessage(session *models.TerminalSession, terminalID string, msgType string, data interface{}) {
+	messageBytes, err := json.Marshal(models.Message{
+		Type:       msgType,
+		TerminalID: terminalID,
+		Data:       data,
+	})
+	if err != nil {
+		log.Printf("Failed to serialize %s message: %v", msgType, err)
+		return
+	}
+	
+	session.ClientsMutex.Lock()
+	for clientAddr, clientConn := range session.Clients {
+		if err := clientConn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
+			log.Printf("Failed to send message to client %s: %v", clientAddr, err)
+		}
+	}
+	session.ClientsMutex.Unlock()
+}
+
+// resizeSession 调整会话的终端大小
+func resizeSession(session *models.TerminalSession, cols, rows uint16) {
+	session.SetSize(cols, rows)
+	session.Buffer.Resize(cols, rows)
+	
+	b, _ := session.CurrentBackend()
+	if b == nil {
+		return
+	}
+	
+	// 本地PTY和SSH等后端直接设置窗口大小，已升级的远程PTY在客户端停止调整后通过stty同步
+	err := b.Resize(cols, rows)
+	if err == backend.ErrUnsupported {
+		scheduleSizeSync(session, sizeSyncDelay)
+	} else if err != nil {
+		log.Printf("Failed to resize terminal: %v", err)
+	}
+}
+
+// writeToSession 将客户端输入写入会话后端
+func writeToSession(session *models.TerminalSession, p []byte) error {
+	b, _ := session.CurrentBackend()
+	if b == nil {
+		return nil
+	}
+	_, err := b.Write(p)
+	return err
+}
+
 // 处理WebSocket连接
 func handleWebSocketConnection(conn *websocket.Conn, clientIP string, session *models.TerminalSession, username string, terminalID string) {
 	// 从WebSocket读取并写入PTY
@@ -226,6 +356,11 @@ func handleWebSocketConnection(conn *websocket.Conn, clientIP string, session *m
 				log.Printf("Command still running for session %s, keeping active", terminalID)
 				// Save session to database
 				SaveSessionToDatabase(username, terminalID, session)
+				
+				// 远程连接已断开的会话保持非活跃状态
+				if !session.Active {
+					MarkSessionInactive(username, terminalID)
+				}
 			}
 			
 			return
@@ -245,16 +380,34 @@ func handleWebSocketConnection(conn *websocket.Conn, clientIP string, session *m
 						if cols, ok := resizeData["cols"].(float64); ok {
 							if rows, ok := resizeData["rows"].(float64); ok {
 								// 调整终端大小
-								if session.Ptmx != nil {
-									pty.Setsize(session.Ptmx, &pty.Winsize{
-										Rows: uint16(rows),
-										Cols: uint16(cols),
-									})
-								}
+								resizeSession(session, uint16(cols), uint16(rows))
 							}
 						}
 					}
 					continue
+				} else if message.Type == "upgrade" {
+					// 将反弹Shell升级为PTY，探测过程可能较慢，不阻塞输入处理
+					go func() {
+						method, err := UpgradeSession(username, terminalID)
+						result := map[string]interface{}{
+							"success": err == nil,
+							"method":  method,
+						}
+						if err != nil {
+							log.Printf("Failed to upgrade terminal session %s: %v", terminalID, err)
+							result["error"] = err.Error()
+						}
+						BroadcastMessage(session, terminalID, "upgrade", result)
+					}()
+					continue
+				} else if message.Type == "linemode" {
+					// 切换服务端行编辑
+					enabled, _ := message.Data.(bool)
+					SetLineMode(username, terminalID, session, enabled)
+					BroadcastMessage(session, terminalID, "linemode", map[string]interface{}{
+						"enabled": session.Editor() != nil,
+					})
+					continue
 				} else if message.Type == "heartbeat" {
 					// 处理心跳消息
 					// 更新会话活跃时间
@@ -297,11 +450,11 @@ func handleWebSocketConnection(conn *websocket.Conn, clientIP string, session *m
 						SaveSessionToDatabase(username, terminalID, session)
 						
 						// 如果用户明确请求关闭，终止进程
-						if session.Cmd != nil && session.Cmd.Process != nil {
+						if session.Backend != nil {
 							log.Printf("Terminating command for session %s", terminalID)
-							session.Cmd.Process.Signal(syscall.SIGTERM)
+							session.Backend.Signal(syscall.SIGTERM)
 							time.Sleep(100 * time.Millisecond)
-							session.Cmd.Process.Kill()
+							session.Backend.Signal(syscall.SIGKILL)
 						}
 						
 						// 标记为非活跃
@@ -315,20 +468,14 @@ func handleWebSocketConnection(conn *websocket.Conn, clientIP string, session *m
 				}
 			}
 			
-			// 其他文本消息，写入PTY
-			if session.Ptmx != nil {
-				_, err = session.Ptmx.Write(p)
-				if err != nil {
-					log.Printf("Failed to write to PTY: %v, %s", err, clientIP)
-				}
+			// 其他文本消息，写入PTY或远程连接
+			if err := handleInput(username, terminalID, session, p); err != nil {
+				log.Printf("Failed to write to terminal: %v, %s", err, clientIP)
 			}
 		} else if messageType == websocket.BinaryMessage {
-			// 二进制消息，直接写入PTY
-			if session.Ptmx != nil {
-				_, err = session.Ptmx.Write(p)
-				if err != nil {
-					log.Printf("Failed to write to PTY: %v, %s", err, clientIP)
-				}
+			// 二进制消息，直接写入PTY或远程连接
+			if err := handleInput(username, terminalID, session, p); err != nil {
+				log.Printf("Failed to write to terminal: %v, %s", err, clientIP)
 			}
 		}
 		
@@ -344,7 +491,7 @@ func createNewSession(conn *websocket.Conn, remoteAddr string, username string,
 		Done:         make(chan struct{}),
 		LastActive:   time.Now(),
 		Clients:      make(map[string]*websocket.Conn),
-		Buffer:       models.OutputBuffer{Max: 100 * 1024}, // 100KB缓冲区
+		Buffer:       models.OutputBuffer{Max: outputMax()},
 		Active:       true,
 		Created:      time.Now(),
 	}
@@ -374,26 +521,23 @@ func startTerminalCommand(session *models.TerminalSession, conn *websocket.Conn,
 	// 设置环境变量
 	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 	
-	var err error
-	
 	// 创建PTY
-	session.Ptmx, err = pty.Start(cmd)
+	b, err := backend.NewLocalPTY(cmd, 80, 24)
 	if err != nil {
 		log.Printf("Failed to start PTY: %v", err)
 		conn.WriteMessage(websocket.BinaryMessage, []byte("Failed to start terminal: "+err.Error()+"\r\n"))
 		conn.Close()
 		return
 	}
-	session.IsStandardPipe = false
 	
-	// 保存命令
-	session.Cmd = cmd
+	// 保存后端
+	session.Backend = b
 	
 	// 启动读取goroutine
 	go func() {
 		buf := make([]byte, 32*1024)
 		for {
-			n, err := session.Ptmx.Read(buf)
+			n, err := b.Read(buf)
 			if err != nil {
 				if err != io.EOF {
 					log.Printf("Failed to read from PTY: %v", err)
@@ -474,8 +618,8 @@ func ConnectToExistingSession(session *models.TerminalSession, conn *websocket.C
 							rows, _ := resizeData["rows"].(float64)
 							
 							// 调整终端大小
-							if !session.IsStandardPipe && session.Ptmx != nil {
-								ResizeTerminal(session.Ptmx, int(cols), int(rows))
+							if session.Backend != nil {
+								session.Backend.Resize(uint16(cols), uint16(rows))
 							}
 						}
 					} else if message.Type == "heartbeat" {
@@ -490,8 +634,8 @@ func ConnectToExistingSession(session *models.TerminalSession, conn *websocket.C
 				}
 			} else if messageType == websocket.BinaryMessage {
 				// 处理二进制消息（终端输入）
-				if !session.IsStandardPipe && session.Ptmx != nil {
-					session.Ptmx.Write(p)
+				if session.Backend != nil {
+					session.Backend.Write(p)
 				}
 			}
 		}
@@ -505,32 +649,3 @@ func ConnectToExistingSession(session *models.TerminalSession, conn *websocket.C
 		log.Printf("Client %s disconnected, %d clients remaining", remoteAddr, clientCount)
 	}()
 }
-
-// 调整终端大小
-func ResizeTerminal(ptmx *os.File, cols, rows int) {
-	ws := struct {
-		Rows    uint16
-		Cols    uint16
-		XPixel  uint16
-		YPixel  uint16
-	}{
-		Rows:   uint16(rows),
-		Cols:   uint16(cols),
-		XPixel: 0,
-		YPixel: 0,
-	}
-	
-	// TIOCSWINSZ是设置终端窗口大小的ioctl命令
-	const TIOCSWINSZ = 0x5414
-	
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		ptmx.Fd(),
-		uintptr(TIOCSWINSZ),
-		uintptr(unsafe.Pointer(&ws)),
-	)
-	
-	if errno != 0 {
-		log.Printf("Failed to resize terminal: %v", errno)
-	}
-} 
@@ -0,0 +1,188 @@
+package terminal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	
+	"ghosteye/models"
+)
+
+// UpgradeSession 将原始反弹Shell升级为远程PTY，返回使用的升级方式
+func UpgradeSession(username, terminalID string) (string, error) {
+	session := GetTerminalSession(username, terminalID)
+	if session == nil {
+		return "", fmt.Errorf("Terminal session %s does not exist", terminalID)
+	}
+	b, upgraded := session.CurrentBackend()
+	if b == nil || !session.Active || !isRemoteKind(session.Kind) {
+		return "", fmt.Errorf("Terminal session %s is not a live remote shell", terminalID)
+	}
+	if upgraded || b.TTY() {
+		return "", fmt.Errorf("Terminal session %s has already been upgraded", terminalID)
+	}
+	
+	// 探测远程主机上可用于分配PTY的工具
+	output, err := RunCommand(session, "for b in python3 python script socat bash; do command -v $b >/dev/null 2>&1 && echo $b; done", 10*time.Second, true)
+	if err != nil {
+		return "", fmt.Errorf("Failed to probe remote tools: %v", err)
+	}
+	
+	available := make(map[string]bool)
+	for _, name := range strings.Fields(output) {
+		available[name] = true
+	}
+	
+	shell := "/bin/sh"
+	if available["bash"] {
+		shell = "/bin/bash"
+	}
+	
+	var method, command string
+	switch {
+	case available["python3"]:
+		method = "python3"
+		command = fmt.Sprintf(`python3 -c 'import pty; pty.spawn("%s")'`, shell)
+	case available["python"]:
+		method = "python"
+		command = fmt.Sprintf(`python -c 'import pty; pty.spawn("%s")'`, shell)
+	case available["script"]:
+		method = "script"
+		command = fmt.Sprintf("script -qc %s /dev/null", shell)
+	case available["socat"]:
+		method = "socat"
+		command = fmt.Sprintf("socat stdio exec:'%s -li',pty,stderr,setsid,sigint,sane", shell)
+	default:
+		return "", fmt.Errorf("No PTY helper (python3, python, script, socat) found on remote host")
+	}
+	
+	if err := writeToSession(session, []byte(command+"\n")); err != nil {
+		return "", fmt.Errorf("Failed to spawn remote PTY: %v", err)
+	}
+	
+	// 远程PTY自带行编辑，关闭服务端行编辑
+	if session.Editor() != nil {
+		SetLineMode(username, terminalID, session, false)
+		BroadcastMessage(session, terminalID, "linemode", map[string]interface{}{
+			"enabled": false,
+		})
+	}
+	
+	// 等待远程PTY启动后同步终端类型和窗口大小
+	time.Sleep(500 * time.Millisecond)
+	session.SetUpgraded(true)
+	
+	cols, rows := clientSize(session)
+	setup := "export TERM=xterm-256color; " + sttySize(cols, rows)
+	if err := writeToSession(session, []byte(setup)); err != nil {
+		return method, fmt.Errorf("Failed to configure remote PTY: %v", err)
+	}
+	setRemoteSize(session, cols, rows)
+	
+	log.Printf("Terminal session %s upgraded to PTY using %s", terminalID, method)
+	return method, nil
+}
+
+// SyncRemoteSize 立即在已升级的远程PTY中执行stty，使远程窗口大小与客户端一致。
+// 等待进行中的截获命令完成，不检查前台程序，由用户在自动同步被跳过时显式触发
+func SyncRemoteSize(username, terminalID string) error {
+	session := GetTerminalSession(username, terminalID)
+	if session == nil {
+		return fmt.Errorf("Terminal session %s does not exist", terminalID)
+	}
+	if b, upgraded := session.CurrentBackend(); b == nil || !session.Active || !upgraded {
+		return fmt.Errorf("Terminal session %s is not an upgraded remote shell", terminalID)
+	}
+	
+	session.ExecMutex.Lock()
+	defer session.ExecMutex.Unlock()
+	
+	return runStty(session)
+}
+
+// 自动同步远程窗口大小的去抖延迟，以及远程Shell忙碌时的重试间隔
+const (
+	sizeSyncDelay = 500 * time.Millisecond
+	sizeSyncRetry = 2 * time.Second
+)
+
+// scheduleSizeSync 在delay之后自动同步远程窗口大小，期间再次调整窗口时重新计时
+func scheduleSizeSync(session *models.TerminalSession, delay time.Duration) {
+	session.Mutex.Lock()
+	defer session.Mutex.Unlock()
+	
+	if session.SizeTimer != nil {
+		session.SizeTimer.Stop()
+	}
+	session.SizeTimer = time.AfterFunc(delay, func() {
+		autoSyncSize(session)
+	})
+}
+
+// autoSyncSize 远程窗口大小与客户端不一致时执行stty。
+// stty会输入到前台程序中，截获命令执行期间或前台为全屏程序（备用屏幕）时不输入，稍后重试
+func autoSyncSize(session *models.TerminalSession) {
+	b, upgraded := session.CurrentBackend()
+	if b == nil || !session.Active || !upgraded || !sizeChanged(session) {
+		return
+	}
+	
+	if !session.ExecMutex.TryLock() {
+		scheduleSizeSync(session, sizeSyncRetry)
+		return
+	}
+	defer session.ExecMutex.Unlock()
+	
+	if session.Buffer.Contents(false).Alternate {
+		scheduleSizeSync(session, sizeSyncRetry)
+		return
+	}
+	
+	if err := runStty(session); err != nil {
+		log.Printf("Failed to sync remote terminal size: %v", err)
+	}
+}
+
+// runStty 以隐藏的截获命令执行stty，回显和输出不显示给客户端，调用者需持有ExecMutex
+func runStty(session *models.TerminalSession) error {
+	cols, rows := clientSize(session)
+	command := strings.TrimSuffix(sttySize(cols, rows), "\n")
+	if _, err := runCommand(session, command, 5*time.Second, true); err != nil {
+		return err
+	}
+	setRemoteSize(session, cols, rows)
+	return nil
+}
+
+// clientSize 返回客户端终端大小，尚未收到客户端大小时使用80x24
+func clientSize(session *models.TerminalSession) (uint16, uint16) {
+	cols, rows := session.Size()
+	if cols == 0 || rows == 0 {
+		cols, rows = 80, 24
+	}
+	return cols, rows
+}
+
+// sizeChanged 客户端终端大小是否与已同步到远程PTY的大小不同
+func sizeChanged(session *models.TerminalSession) bool {
+	cols, rows := clientSize(session)
+	
+	session.Mutex.Lock()
+	defer session.Mutex.Unlock()
+	
+	return cols != session.RemoteCols || rows != session.RemoteRows
+}
+
+// setRemoteSize 记录已同步到远程PTY的窗口大小
+func setRemoteSize(session *models.TerminalSession, cols, rows uint16) {
+	session.Mutex.Lock()
+	defer session.Mutex.Unlock()
+	
+	session.RemoteCols, session.RemoteRows = cols, rows
+}
+
+// sttySize 生成设置远程窗口大小的stty命令
+func sttySize(cols, rows uint16) string {
+	return fmt.Sprintf("stty rows %d cols %d\n", rows, cols)
+}
@@ -0,0 +1,190 @@
+package terminal
+
+import (
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"ghosteye/backend"
+	"ghosteye/models"
+)
+
+// fakeShell 记录写入的命令，对截获命令回应开始和结束标记
+type fakeShell struct {
+	mu      sync.Mutex
+	writes  []string
+	session *models.TerminalSession
+}
+
+var markers = regexp.MustCompile(`echo GE''(\w+)B; (.*); echo GE''(\w+)E`)
+
+func (f *fakeShell) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	f.writes = append(f.writes, string(p))
+	f.mu.Unlock()
+
+	if m := markers.FindStringSubmatch(string(p)); m != nil {
+		// 模拟远程PTY的回显、命令输出和新的提示符
+		go BroadcastOutput(f.session, "t", []byte(string(p)+"\r\nGE"+m[1]+"B\r\nGE"+m[3]+"E\r\n$ "))
+	}
+	return len(p), nil
+}
+
+// commands 返回截获命令中执行的命令
+func (f *fakeShell) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var commands []string
+	for _, w := range f.writes {
+		if m := markers.FindStringSubmatch(w); m != nil {
+			commands = append(commands, m[2])
+		}
+	}
+	return commands
+}
+
+func (f *fakeShell) Read(p []byte) (int, error)          { select {} }
+func (f *fakeShell) Close() error                        { return nil }
+func (f *fakeShell) Resize(cols, rows uint16) error      { return backend.ErrUnsupported }
+func (f *fakeShell) Signal(sig os.Signal) error          { return backend.ErrUnsupported }
+func (f *fakeShell) ExitStatus() (code int, exited bool) { return 0, false }
+func (f *fakeShell) TTY() bool                           { return false }
+
+// newUpgradedSession 创建已升级为远程PTY的会话，远程窗口大小为80x24
+func newUpgradedSession(t *testing.T) (*models.TerminalSession, *fakeShell) {
+	shell := &fakeShell{}
+	session := &models.TerminalSession{
+		ID:         "t",
+		Backend:    shell,
+		Done:       make(chan struct{}),
+		Active:     true,
+		Kind:       models.SessionKindReverse,
+		Upgraded:   true,
+		RemoteCols: 80,
+		RemoteRows: 24,
+		Buffer:     models.OutputBuffer{Max: 4096},
+	}
+	shell.session = session
+	t.Cleanup(func() {
+		session.Mutex.Lock()
+		if session.SizeTimer != nil {
+			session.SizeTimer.Stop()
+		}
+		session.Mutex.Unlock()
+	})
+	return session, shell
+}
+
+// waitCommands 等待会话执行want中的命令
+func waitCommands(t *testing.T, shell *fakeShell, want []string, within time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(within)
+	for {
+		got := shell.commands()
+		if len(got) >= len(want) || time.Now().After(deadline) {
+			if len(got) != len(want) {
+				t.Fatalf("commands = %q, want %q", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("commands = %q, want %q", got, want)
+				}
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSttySize(t *testing.T) {
+	tests := []struct {
+		cols, rows uint16
+		want       string
+	}{
+		{80, 24, "stty rows 24 cols 80\n"},
+		{213, 57, "stty rows 57 cols 213\n"},
+		{1, 1, "stty rows 1 cols 1\n"},
+	}
+	for _, tt := range tests {
+		if got := sttySize(tt.cols, tt.rows); got != tt.want {
+			t.Errorf("sttySize(%d, %d) = %q, want %q", tt.cols, tt.rows, got, tt.want)
+		}
+	}
+
+	session := &models.TerminalSession{}
+	if cols, rows := clientSize(session); cols != 80 || rows != 24 {
+		t.Errorf("clientSize without client size = %dx%d, want 80x24", cols, rows)
+	}
+}
+
+func TestResizeSyncsRemoteSize(t *testing.T) {
+	session, shell := newUpgradedSession(t)
+
+	// 连续调整窗口大小时只同步最后的大小，stty的回显不显示给客户端
+	resizeSession(session, 100, 30)
+	resizeSession(session, 120, 40)
+	resizeSession(session, 132, 43)
+	waitCommands(t, shell, []string{"stty rows 43 cols 132"}, 2*time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for sizeChanged(session) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sizeChanged(session) {
+		t.Errorf("remote size was not recorded after stty")
+	}
+	if c := session.Buffer.Contents(false); c.Screen[0] != "$" {
+		t.Errorf("screen after sync = %q, stty was echoed to the client", c.Screen)
+	}
+
+	// 大小未变化时不再输入stty
+	resizeSession(session, 132, 43)
+	time.Sleep(sizeSyncDelay + 200*time.Millisecond)
+	waitCommands(t, shell, []string{"stty rows 43 cols 132"}, 0)
+}
+
+func TestResizeSkipsBusyRemote(t *testing.T) {
+	t.Run("capture in flight", func(t *testing.T) {
+		session, shell := newUpgradedSession(t)
+
+		session.ExecMutex.Lock()
+		resizeSession(session, 100, 30)
+		time.Sleep(sizeSyncDelay + 200*time.Millisecond)
+		if got := shell.commands(); len(got) != 0 {
+			t.Fatalf("stty was typed during a capture: %q", got)
+		}
+		session.ExecMutex.Unlock()
+
+		// 截获结束后重试
+		waitCommands(t, shell, []string{"stty rows 30 cols 100"}, sizeSyncRetry+time.Second)
+	})
+
+	t.Run("full screen program", func(t *testing.T) {
+		session, shell := newUpgradedSession(t)
+
+		BroadcastOutput(session, "t", []byte("\x1b[?1049h"))
+		resizeSession(session, 100, 30)
+		time.Sleep(sizeSyncDelay + 200*time.Millisecond)
+		if got := shell.commands(); len(got) != 0 {
+			t.Fatalf("stty was typed into a full screen program: %q", got)
+		}
+
+		BroadcastOutput(session, "t", []byte("\x1b[?1049l"))
+		waitCommands(t, shell, []string{"stty rows 30 cols 100"}, sizeSyncRetry+time.Second)
+	})
+
+	t.Run("not upgraded", func(t *testing.T) {
+		session, shell := newUpgradedSession(t)
+
+		session.SetUpgraded(false)
+		resizeSession(session, 100, 30)
+		time.Sleep(sizeSyncDelay + 200*time.Millisecond)
+		if got := shell.commands(); len(got) != 0 {
+			t.Errorf("stty was typed into a raw shell: %q", got)
+		}
+	})
+}
@@ -0,0 +1,428 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"ghosteye/holder"
+)
+
+// envUpgrade 新进程通过该环境变量得知描述符3为移交清单，描述符4用于通知旧进程已就绪
+const envUpgrade = "GHOSTEYE_UPGRADE"
+
+const (
+	manifestFD   = 3
+	readyFD      = 4
+	readyTimeout = 30 * time.Second
+)
+
+// manifest 旧进程移交给新进程的描述符清单，描述符编号为新进程中的编号
+type manifest struct {
+	Listeners map[string]int    `json:"listeners"`
+	Packets   map[string]int    `json:"packets"`
+	Sessions  []sessionFD       `json:"sessions"`
+	Tokens    map[string]string `json:"tokens"`
+}
+
+// sessionFD 移交的会话
+type sessionFD struct {
+	ID   string          `json:"id"`
+	FD   int             `json:"fd"`
+	Meta json.RawMessage `json:"meta"`
+}
+
+// socket 可移交的监听套接字
+type socket struct {
+	listener *net.TCPListener
+	packet   *net.UDPConn
+}
+
+var (
+	// 当前进程打开的监听套接字，名称 -> 套接字
+	sockets    = make(map[string]*socket)
+	socketsMux sync.Mutex
+
+	// 从旧进程继承、尚未被取用的描述符
+	inheritedListeners = make(map[string]*os.File)
+	inheritedPackets   = make(map[string]*os.File)
+	inheritedSessions  []holder.Entry
+	inheritedTokens    map[string]string
+	readyFile          *os.File
+
+	// 移交期间暂停读取
+	paused    bool
+	resumed   = make(chan struct{})
+	pausedMux sync.Mutex
+)
+
+// Init 新进程启动时读取旧进程移交的描述符，普通启动时不做任何事
+func Init() error {
+	if os.Getenv(envUpgrade) == "" {
+		return nil
+	}
+	os.Unsetenv(envUpgrade)
+
+	manifestFile := os.NewFile(manifestFD, "upgrade-manifest")
+	readyFile = os.NewFile(readyFD, "upgrade-ready")
+	syscall.CloseOnExec(readyFD)
+
+	data, err := io.ReadAll(manifestFile)
+	manifestFile.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to read upgrade manifest: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("Invalid upgrade manifest: %v", err)
+	}
+
+	for name, fd := range m.Listeners {
+		inheritedListeners[name] = inheritFile(fd, name)
+	}
+	for name, fd := range m.Packets {
+		inheritedPackets[name] = inheritFile(fd, name)
+	}
+	for _, s := range m.Sessions {
+		inheritedSessions = append(inheritedSessions, holder.Entry{ID: s.ID, Meta: s.Meta, File: inheritFile(s.FD, s.ID)})
+	}
+
+	inheritedTokens = m.Tokens
+
+	log.Printf("Inherited %d listeners, %d packet sockets and %d sessions from the previous process", len(m.Listeners), len(m.Packets), len(m.Sessions))
+	return nil
+}
+
+// Upgrading 当前进程是否由升级启动
+func Upgrading() bool {
+	return readyFile != nil
+}
+
+// Listen 打开TCP监听，升级启动时优先使用旧进程移交的同名套接字
+func Listen(name, addr string) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+
+	socketsMux.Lock()
+	f := inheritedListeners[name]
+	delete(inheritedListeners, name)
+	socketsMux.Unlock()
+
+	if f != nil {
+		ln, err = net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to adopt inherited listener %s, listening again: %v", name, err)
+		}
+	}
+	if ln == nil {
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if tcp, ok := ln.(*net.TCPListener); ok {
+		socketsMux.Lock()
+		sockets[name] = &socket{listener: tcp}
+		socketsMux.Unlock()
+	}
+	return ln, nil
+}
+
+// ListenPacket 打开UDP监听，升级启动时优先使用旧进程移交的同名套接字
+func ListenPacket(name, addr string) (net.PacketConn, error) {
+	var conn net.PacketConn
+	var err error
+
+	socketsMux.Lock()
+	f := inheritedPackets[name]
+	delete(inheritedPackets, name)
+	socketsMux.Unlock()
+
+	if f != nil {
+		conn, err = net.FilePacketConn(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to adopt inherited packet socket %s, listening again: %v", name, err)
+		}
+	}
+	if conn == nil {
+		if conn, err = net.ListenPacket("udp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if udp, ok := conn.(*net.UDPConn); ok {
+		socketsMux.Lock()
+		sockets[name] = &socket{packet: udp}
+		socketsMux.Unlock()
+	}
+	return conn, nil
+}
+
+// Forget 套接字关闭后不再移交
+func Forget(name string) {
+	socketsMux.Lock()
+	defer socketsMux.Unlock()
+
+	delete(sockets, name)
+}
+
+// Sessions 取出旧进程移交的会话，只能取一次，调用方负责关闭返回的文件
+func Sessions() []holder.Entry {
+	socketsMux.Lock()
+	defer socketsMux.Unlock()
+
+	entries := inheritedSessions
+	inheritedSessions = nil
+	return entries
+}
+
+// Tokens 取出旧进程移交的登录会话token，token -> 用户名
+func Tokens() map[string]string {
+	socketsMux.Lock()
+	defer socketsMux.Unlock()
+
+	tokens := inheritedTokens
+	inheritedTokens = nil
+	return tokens
+}
+
+// Ready 新进程恢复完成后通知旧进程退出，并关闭未被取用的继承描述符
+func Ready() {
+	if readyFile == nil {
+		return
+	}
+
+	socketsMux.Lock()
+	for name, f := range inheritedListeners {
+		log.Printf("Closing unused inherited listener %s", name)
+		f.Close()
+	}
+	for name, f := range inheritedPackets {
+		log.Printf("Closing unused inherited packet socket %s", name)
+		f.Close()
+	}
+	inheritedListeners = make(map[string]*os.File)
+	inheritedPackets = make(map[string]*os.File)
+	socketsMux.Unlock()
+
+	readyFile.Write([]byte("ready\n"))
+	readyFile.Close()
+	readyFile = nil
+}
+
+// Pause 暂停接收连接和读取会话输出，读取因超时返回的协程在WaitIfPaused中等待
+func Pause() {
+	pausedMux.Lock()
+	paused = true
+	resumed = make(chan struct{})
+	pausedMux.Unlock()
+
+	now := time.Now()
+	socketsMux.Lock()
+	defer socketsMux.Unlock()
+	for _, s := range sockets {
+		if s.listener != nil {
+			s.listener.SetDeadline(now)
+		} else {
+			s.packet.SetReadDeadline(now)
+		}
+	}
+}
+
+// Resume 移交失败时恢复接收连接和读取
+func Resume() {
+	socketsMux.Lock()
+	for _, s := range sockets {
+		var rc syscall.RawConn
+		if s.listener != nil {
+			s.listener.SetDeadline(time.Time{})
+			rc, _ = s.listener.SyscallConn()
+		} else {
+			s.packet.SetReadDeadline(time.Time{})
+			rc, _ = s.packet.SyscallConn()
+		}
+		SetNonblock(rc)
+	}
+	socketsMux.Unlock()
+
+	pausedMux.Lock()
+	if paused {
+		paused = false
+		close(resumed)
+	}
+	pausedMux.Unlock()
+}
+
+// WaitIfPaused 读取或接收返回err后调用，err由暂停引起时等待恢复并返回true，调用方应重试
+func WaitIfPaused(err error) bool {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+
+	pausedMux.Lock()
+	wait := resumed
+	isPaused := paused
+	pausedMux.Unlock()
+
+	if isPaused {
+		<-wait
+	}
+	return true
+}
+
+// DupFile 复制原始连接的描述符，返回的文件在exec时不会被继承
+func DupFile(rc syscall.RawConn, name string) (*os.File, error) {
+	var fd int
+	var dupErr error
+	err := rc.Control(func(orig uintptr) {
+		fd, dupErr = syscall.Dup(int(orig))
+		if dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// SetNonblock 恢复描述符的非阻塞模式。exec传递描述符时会将其共享的打开文件设为阻塞模式
+func SetNonblock(rc syscall.RawConn) {
+	if rc == nil {
+		return
+	}
+	rc.Control(func(fd uintptr) {
+		syscall.SetNonblock(int(fd), true)
+	})
+}
+
+// Exec 暂停后启动新的可执行文件，移交所有监听套接字、会话和登录token，sessions中的文件由Exec关闭。
+// 新进程就绪后返回nil，此时当前进程应直接退出，不能关闭会话
+func Exec(sessions []holder.Entry, tokens map[string]string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to locate executable: %v", err)
+	}
+
+	manifestRead, manifestWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer manifestRead.Close()
+	defer manifestWrite.Close()
+
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyRead.Close()
+	defer readyWrite.Close()
+
+	files := []*os.File{manifestRead, readyWrite}
+	m := manifest{Listeners: make(map[string]int), Packets: make(map[string]int), Tokens: tokens}
+	// ExtraFiles中的第i个文件在新进程中的描述符为3+i
+	add := func(f *os.File) int {
+		files = append(files, f)
+		return manifestFD + len(files) - 1
+	}
+
+	socketsMux.Lock()
+	for name, s := range sockets {
+		var f *os.File
+		if s.listener != nil {
+			f, err = s.listener.File()
+		} else {
+			f, err = s.packet.File()
+		}
+		if err != nil {
+			log.Printf("Skipping socket %s: %v", name, err)
+			continue
+		}
+		if s.listener != nil {
+			m.Listeners[name] = add(f)
+		} else {
+			m.Packets[name] = add(f)
+		}
+	}
+	socketsMux.Unlock()
+
+	for _, s := range sessions {
+		m.Sessions = append(m.Sessions, sessionFD{ID: s.ID, FD: add(s.File), Meta: s.Meta})
+	}
+	defer func() {
+		for _, f := range files[2:] {
+			f.Close()
+		}
+	}()
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("Failed to encode upgrade manifest: %v", err)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), envUpgrade+"=1")
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start new process: %v", err)
+	}
+	log.Printf("Started new process %d with %d listeners, %d packet sockets and %d sessions", cmd.Process.Pid, len(m.Listeners), len(m.Packets), len(m.Sessions))
+
+	// 新进程持有副本后关闭父进程中的写端，新进程退出时读端才能收到EOF
+	readyWrite.Close()
+	manifestRead.Close()
+
+	go func() {
+		manifestWrite.Write(data)
+		manifestWrite.Close()
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		n, err := readyRead.Read(buf)
+		if n > 0 {
+			ready <- nil
+			return
+		}
+		ready <- fmt.Errorf("New process exited before becoming ready: %v", err)
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(readyTimeout):
+		err = fmt.Errorf("New process did not become ready within %s", readyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+		return err
+	}
+
+	// 新进程不再是需要等待的子进程，当前进程退出后由init接管
+	cmd.Process.Release()
+	return nil
+}
+
+// inheritFile 包装继承的描述符，恢复非阻塞模式使其可以设置超时
+func inheritFile(fd int, name string) *os.File {
+	syscall.SetNonblock(fd, true)
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), name)
+}
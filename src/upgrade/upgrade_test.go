@@ -0,0 +1,158 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ghosteye/holder"
+)
+
+// envReport 升级测试中新进程写入接管结果的文件
+const envReport = "GHOSTEYE_UPGRADE_TEST_REPORT"
+
+// report 新进程从移交清单中接管到的内容
+type report struct {
+	Error     string            `json:"error"`
+	Listener  string            `json:"listener"`
+	Packet    string            `json:"packet"`
+	Sessions  map[string]string `json:"sessions"` // 会话ID -> 元数据和从描述符读到的数据
+	Tokens    map[string]string `json:"tokens"`
+	Upgrading bool              `json:"upgrading"`
+}
+
+// TestMain 由Exec启动的测试程序作为新进程运行，接管描述符后写入结果并通知就绪
+func TestMain(m *testing.M) {
+	if os.Getenv(envUpgrade) != "" {
+		child()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// child 模拟升级后的新进程
+func child() {
+	var r report
+	if err := Init(); err != nil {
+		r.Error = err.Error()
+	}
+	r.Upgrading = Upgrading()
+
+	if ln, err := Listen("http", "127.0.0.1:0"); err == nil {
+		r.Listener = ln.Addr().String()
+		ln.Close()
+	}
+	if conn, err := ListenPacket("dns", "127.0.0.1:0"); err == nil {
+		r.Packet = conn.LocalAddr().String()
+		conn.Close()
+	}
+
+	r.Sessions = make(map[string]string)
+	for _, s := range Sessions() {
+		data, _ := io.ReadAll(s.File)
+		s.File.Close()
+		r.Sessions[s.ID] = string(s.Meta) + " " + string(data)
+	}
+	if Sessions() != nil {
+		r.Error = "sessions were returned twice"
+	}
+	r.Tokens = Tokens()
+
+	data, _ := json.Marshal(r)
+	os.WriteFile(os.Getenv(envReport), data, 0600)
+	Ready()
+}
+
+func TestExecHandsOffManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	t.Setenv(envReport, path)
+
+	ln, err := Listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer Forget("http")
+	conn, err := ListenPacket("dns", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer Forget("dns")
+
+	// 会话描述符用管道代替，新进程从中读到写入的数据说明描述符编号对应正确
+	var sessions []holder.Entry
+	for _, id := range []string{"first", "second"} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("data-" + id))
+		w.Close()
+		sessions = append(sessions, holder.Entry{ID: id, Meta: json.RawMessage(`{"id":"` + id + `"}`), File: r})
+	}
+	tokens := map[string]string{"token": "alice"}
+
+	if err := Exec(sessions, tokens); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	var got report
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(data, &got) == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("new process did not write its report: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := report{
+		Listener: ln.Addr().String(),
+		Packet:   conn.LocalAddr().String(),
+		Sessions: map[string]string{
+			"first":  `{"id":"first"} data-first`,
+			"second": `{"id":"second"} data-second`,
+		},
+		Tokens:    tokens,
+		Upgrading: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("new process adopted %+v, want %+v", got, want)
+	}
+
+	// 移交后的文件由Exec关闭
+	for _, s := range sessions {
+		if _, err := s.File.Stat(); err == nil {
+			t.Errorf("session file %s was not closed", s.ID)
+		}
+	}
+}
+
+func TestInitWithoutUpgrade(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if Upgrading() || Sessions() != nil || Tokens() != nil {
+		t.Error("normal start inherited state")
+	}
+
+	// 没有继承的套接字时重新监听
+	ln, err := Listen("other", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer Forget("other")
+	if _, ok := ln.(*net.TCPListener); !ok {
+		t.Errorf("listener is %T", ln)
+	}
+}
@@ -2,10 +2,15 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
+	"unicode/utf16"
 	
 	"ghosteye/models"
 )
@@ -49,4 +54,37 @@ func GetClientIP(r *http.Request) string {
 	}
 	
 	return remoteAddr
-} 
\ No newline at end of file
+}
+
+// EncodePowerShell 将PowerShell脚本编码为-EncodedCommand使用的UTF-16LE Base64
+func EncodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(buf[i*2:], u)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// ansiPattern 匹配CSI、OSC及其他ESC开头的终端控制序列
+var ansiPattern = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// StripANSI 去除终端输出中的控制序列和回车，得到可读的纯文本
+func StripANSI(text string) string {
+	text = ansiPattern.ReplaceAllString(text, "")
+	return strings.ReplaceAll(text, "\r", "")
+}
+
+// QuoteShell 使用单引号转义POSIX shell参数
+func QuoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteCmd 用双引号包裹cmd.exe参数，引号内的&、|等元字符按字面处理。
+// 双引号和换行无法转义，%在引号内仍会展开环境变量，含有这些字符时返回错误
+func QuoteCmd(s string) (string, error) {
+	if strings.ContainsAny(s, "\"%\r\n") {
+		return "", fmt.Errorf("Path %q contains characters that cannot be quoted for cmd.exe", s)
+	}
+	return `"` + s + `"`, nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestQuoteShell(t *testing.T) {
+	for _, s := range []string{"plain", "it's", "a b", `$HOME "x" \n`, "'';&|`id`", ""} {
+		out, err := exec.Command("/bin/sh", "-c", "printf '%s' "+QuoteShell(s)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("QuoteShell(%q) evaluated to %q", s, out)
+		}
+	}
+}
+
+func TestQuoteCmd(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{`C:\Users\a\file.txt`, `"C:\Users\a\file.txt"`, true},
+		{`C:\Program Files\Tom & Jerry\a.txt`, `"C:\Program Files\Tom & Jerry\a.txt"`, true},
+		{`C:\it's (1)^.txt`, `"C:\it's (1)^.txt"`, true},
+		{`C:\a" & calc & "b`, "", false},
+		{`C:\%PATH%\a.txt`, "", false},
+		{"C:\\a\r\ncalc", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := QuoteCmd(tt.path)
+		if (err == nil) != tt.ok {
+			t.Errorf("QuoteCmd(%q) error = %v, want ok %v", tt.path, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("QuoteCmd(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
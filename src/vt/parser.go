@@ -0,0 +1,572 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 解析器状态
+const (
+	stateGround = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateString // DCS、SOS、PM、APC，内容被忽略
+)
+
+// 控制序列参数和字符串的长度上限，超出的部分被忽略
+const (
+	maxParams    = 32
+	maxOSCLength = 4096
+)
+
+// parser 转义序列解析器的状态
+type parser struct {
+	state        int
+	intermediate []byte
+	params       []byte
+	private      byte
+	osc          []byte
+	stringEsc    bool   // 字符串中刚读到ESC，可能是ST的开始
+	utf8         []byte // 未读完整的UTF-8字符
+}
+
+// feed 处理一个输出字节
+func (s *Screen) feed(b byte) {
+	p := &s.parser
+
+	// 字符串状态只关心结束符
+	switch p.state {
+	case stateOSC:
+		s.feedOSC(b)
+		return
+	case stateString:
+		if b == 0x07 || (p.stringEsc && b == '\\') {
+			p.state = stateGround
+		} else if b == 0x18 || b == 0x1a {
+			p.state = stateGround
+		}
+		p.stringEsc = b == 0x1b
+		return
+	}
+
+	// 多字节UTF-8字符
+	if p.state == stateGround && (b >= 0x80 || len(p.utf8) > 0) {
+		if b < 0x80 || (len(p.utf8) > 0 && b&0xc0 != 0x80) {
+			// 不完整的字符后出现了新字符
+			p.utf8 = p.utf8[:0]
+			s.print(utf8.RuneError)
+			if b < 0x80 {
+				s.feed(b)
+				return
+			}
+		}
+		p.utf8 = append(p.utf8, b)
+		if utf8.FullRune(p.utf8) {
+			r, _ := utf8.DecodeRune(p.utf8)
+			p.utf8 = p.utf8[:0]
+			s.print(r)
+		}
+		return
+	}
+
+	// C0控制字符在任何状态下都立即执行
+	if b < 0x20 {
+		switch b {
+		case 0x1b:
+			s.enter(stateEscape)
+		case 0x18, 0x1a:
+			p.state = stateGround
+		default:
+			s.control(b)
+		}
+		return
+	}
+	if b == 0x7f {
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		s.print(rune(b))
+	case stateEscape:
+		switch {
+		case b >= 0x20 && b <= 0x2f:
+			p.intermediate = append(p.intermediate, b)
+			p.state = stateEscapeIntermediate
+		case b == '[':
+			s.enter(stateCSI)
+		case b == ']':
+			s.enter(stateOSC)
+		case b == 'P' || b == 'X' || b == '^' || b == '_':
+			s.enter(stateString)
+		default:
+			p.state = stateGround
+			s.escape(b)
+		}
+	case stateEscapeIntermediate:
+		if b >= 0x20 && b <= 0x2f {
+			p.intermediate = append(p.intermediate, b)
+			return
+		}
+		p.state = stateGround
+		s.escape(b)
+	case stateCSI:
+		switch {
+		case b >= '0' && b <= '?':
+			if b >= '<' && len(p.params) == 0 && p.private == 0 {
+				p.private = b
+			} else if len(p.params) < maxParams*8 {
+				p.params = append(p.params, b)
+			}
+		case b >= 0x20 && b <= 0x2f:
+			p.intermediate = append(p.intermediate, b)
+		case b >= 0x40 && b <= 0x7e:
+			p.state = stateGround
+			s.csi(b)
+		default:
+			p.state = stateGround
+		}
+	}
+}
+
+// enter 进入新的解析状态并清空参数
+func (s *Screen) enter(state int) {
+	p := &s.parser
+	p.state = state
+	p.intermediate = p.intermediate[:0]
+	p.params = p.params[:0]
+	p.private = 0
+	p.osc = p.osc[:0]
+	p.stringEsc = false
+}
+
+// feedOSC 读取操作系统命令，以BEL或ST结束
+func (s *Screen) feedOSC(b byte) {
+	p := &s.parser
+	switch {
+	case b == 0x07 || (p.stringEsc && b == '\\'):
+		p.state = stateGround
+		s.osc(string(p.osc))
+	case b == 0x18 || b == 0x1a:
+		p.state = stateGround
+	case b == 0x1b:
+		p.stringEsc = true
+		return
+	case p.stringEsc:
+		// ESC后不是'\'，按新的转义序列处理
+		p.state = stateGround
+		s.osc(string(p.osc))
+		s.enter(stateEscape)
+		s.feed(b)
+		return
+	default:
+		if len(p.osc) < maxOSCLength {
+			p.osc = append(p.osc, b)
+		}
+	}
+	p.stringEsc = false
+}
+
+// control 执行C0控制字符
+func (s *Screen) control(b byte) {
+	switch b {
+	case 0x08: // BS
+		if s.cur.x > 0 {
+			s.cur.x--
+		}
+		s.cur.wrapPending = false
+	case 0x09: // HT
+		s.tab(1)
+	case 0x0a, 0x0b, 0x0c: // LF VT FF
+		s.index()
+		s.cur.wrapPending = false
+	case 0x0d: // CR
+		s.cur.x = 0
+		s.cur.wrapPending = false
+	case 0x0e: // SO
+		s.cur.gl = 1
+	case 0x0f: // SI
+		s.cur.gl = 0
+	}
+}
+
+// escape 执行ESC开始的转义序列
+func (s *Screen) escape(final byte) {
+	p := &s.parser
+	if len(p.intermediate) > 0 {
+		switch p.intermediate[0] {
+		case '(', ')':
+			// 选择G0、G1字符集，0为DEC线条字符
+			g := 0
+			if p.intermediate[0] == ')' {
+				g = 1
+			}
+			s.cur.charsets[g] = final == '0'
+		case '#':
+			if final == '8' {
+				// DECALN 用E填满屏幕
+				for y := 0; y < s.rows; y++ {
+					for x := 0; x < s.cols; x++ {
+						s.lines[y][x] = Cell{Rune: 'E'}
+					}
+				}
+			}
+		}
+		return
+	}
+
+	switch final {
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+		s.cur.wrapPending = false
+	case 'E':
+		s.cur.x = 0
+		s.index()
+		s.cur.wrapPending = false
+	case 'M':
+		s.reverseIndex()
+		s.cur.wrapPending = false
+	case 'H':
+		s.tabs[s.cur.x] = true
+	case 'c':
+		s.reset()
+	case '=':
+		s.appKeypad = true
+	case '>':
+		s.appKeypad = false
+	}
+}
+
+// osc 执行操作系统命令，只记录窗口标题
+func (s *Screen) osc(command string) {
+	code, value, ok := strings.Cut(command, ";")
+	if !ok {
+		return
+	}
+	if code == "0" || code == "2" {
+		s.title = value
+	}
+}
+
+// csiParams 解析控制序列的参数，每个参数可能带有以冒号分隔的子参数
+func (s *Screen) csiParams() [][]int {
+	raw := string(s.parser.params)
+	if raw == "" {
+		return nil
+	}
+	var params [][]int
+	for _, field := range strings.Split(raw, ";") {
+		var group []int
+		for _, sub := range strings.Split(field, ":") {
+			n, err := strconv.Atoi(sub)
+			if err != nil || n < 0 {
+				n = 0
+			}
+			if n > 65535 {
+				n = 65535
+			}
+			group = append(group, n)
+		}
+		params = append(params, group)
+		if len(params) >= maxParams {
+			break
+		}
+	}
+	return params
+}
+
+// param 返回第i个参数，缺省或为0时返回def
+func param(params [][]int, i, def int) int {
+	if i < len(params) && params[i][0] != 0 {
+		return params[i][0]
+	}
+	return def
+}
+
+// csi 执行控制序列
+func (s *Screen) csi(final byte) {
+	p := &s.parser
+	params := s.csiParams()
+	if len(p.intermediate) > 0 {
+		// DECSTR 软复位，其余带中间字符的序列忽略
+		if p.intermediate[0] == '!' && final == 'p' {
+			s.softReset()
+		}
+		return
+	}
+
+	if p.private == '?' {
+		switch final {
+		case 'h', 'l':
+			for _, group := range params {
+				s.setPrivateMode(group[0], final == 'h')
+			}
+		}
+		return
+	}
+	if p.private != 0 {
+		return
+	}
+
+	n := param(params, 0, 1)
+	switch final {
+	case '@':
+		s.insertCells(n)
+	case 'A':
+		s.moveVertical(-n)
+	case 'B', 'e':
+		s.moveVertical(n)
+	case 'C', 'a':
+		s.moveTo(s.cur.x+n, s.cur.y)
+	case 'D':
+		s.moveTo(s.cur.x-n, s.cur.y)
+	case 'E':
+		s.moveVertical(n)
+		s.cur.x = 0
+	case 'F':
+		s.moveVertical(-n)
+		s.cur.x = 0
+	case 'G', '`':
+		s.moveTo(n-1, s.cur.y)
+	case 'H', 'f':
+		y := param(params, 0, 1) - 1
+		x := param(params, 1, 1) - 1
+		if s.cur.originMode {
+			y += s.top
+		}
+		s.moveTo(x, y)
+	case 'I':
+		s.tab(n)
+	case 'J':
+		s.eraseDisplay(param(params, 0, 0))
+	case 'K':
+		s.eraseLine(param(params, 0, 0))
+	case 'L':
+		s.insertLines(n)
+	case 'M':
+		s.deleteLines(n)
+	case 'P':
+		s.deleteCells(n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		s.scrollDown(n)
+	case 'X':
+		s.eraseCells(s.cur.y, s.cur.x, s.cur.x+n)
+		s.cur.wrapPending = false
+	case 'Z':
+		s.backTab(n)
+	case 'b':
+		// REP 重复上一个字符
+		if s.cur.x > 0 || s.cur.wrapPending {
+			x := s.cur.x
+			if !s.cur.wrapPending {
+				x--
+			}
+			if r := s.lines[s.cur.y][x].Rune; r > 0 {
+				for i := 0; i < n && i < s.cols*s.rows; i++ {
+					s.print(r)
+				}
+			}
+		}
+	case 'd':
+		y := n - 1
+		if s.cur.originMode {
+			y += s.top
+		}
+		s.moveTo(s.cur.x, y)
+	case 'g':
+		switch param(params, 0, 0) {
+		case 0:
+			s.tabs[s.cur.x] = false
+		case 3:
+			s.tabs = make([]bool, s.cols)
+		}
+	case 'h', 'l':
+		for _, group := range params {
+			if group[0] == 4 {
+				s.insertMode = final == 'h'
+			}
+		}
+	case 'm':
+		s.sgr(params)
+	case 'r':
+		s.setScrollRegion(param(params, 0, 1), param(params, 1, s.rows))
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+// setPrivateMode 设置DEC私有模式
+func (s *Screen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 1:
+		s.appCursor = on
+	case 6:
+		s.cur.originMode = on
+		if on {
+			s.moveTo(0, s.top)
+		} else {
+			s.moveTo(0, 0)
+		}
+	case 7:
+		s.autowrap = on
+		if !on {
+			s.cur.wrapPending = false
+		}
+	case 25:
+		s.cursorHidden = !on
+	case 47, 1047, 1049:
+		s.switchScreen(on, mode)
+	case 1048:
+		if on {
+			s.saveCursor()
+		} else {
+			s.restoreCursor()
+		}
+	case 2004:
+		s.bracketedPaste = on
+	case 9, 1000, 1002, 1003, 1005, 1006, 1015:
+		if on {
+			s.mouseModes[mode] = true
+		} else {
+			delete(s.mouseModes, mode)
+		}
+	}
+}
+
+// softReset 软复位（DECSTR），保留屏幕内容
+func (s *Screen) softReset() {
+	s.cur.pen = Attr{}
+	s.cur.originMode = false
+	s.cur.wrapPending = false
+	s.cur.charsets = [2]bool{}
+	s.cur.gl = 0
+	s.top, s.bottom = 0, s.rows-1
+	s.autowrap = true
+	s.insertMode = false
+	s.cursorHidden = false
+	s.appCursor = false
+	s.appKeypad = false
+	s.saved = cursor{}
+}
+
+// sgr 设置字符显示属性
+func (s *Screen) sgr(params [][]int) {
+	pen := &s.cur.pen
+	if len(params) == 0 {
+		*pen = Attr{}
+		return
+	}
+
+	for i := 0; i < len(params); i++ {
+		group := params[i]
+		switch code := group[0]; {
+		case code == 0:
+			*pen = Attr{}
+		case code == 1:
+			pen.Flags |= attrBold
+		case code == 2:
+			pen.Flags |= attrDim
+		case code == 3:
+			pen.Flags |= attrItalic
+		case code == 4:
+			if len(group) > 1 && group[1] == 0 {
+				pen.Flags &^= attrUnderline
+			} else {
+				pen.Flags |= attrUnderline
+			}
+		case code == 5 || code == 6:
+			pen.Flags |= attrBlink
+		case code == 7:
+			pen.Flags |= attrReverse
+		case code == 8:
+			pen.Flags |= attrHidden
+		case code == 9:
+			pen.Flags |= attrStrike
+		case code == 21:
+			pen.Flags |= attrUnderline
+		case code == 22:
+			pen.Flags &^= attrBold | attrDim
+		case code == 23:
+			pen.Flags &^= attrItalic
+		case code == 24:
+			pen.Flags &^= attrUnderline
+		case code == 25:
+			pen.Flags &^= attrBlink
+		case code == 27:
+			pen.Flags &^= attrReverse
+		case code == 28:
+			pen.Flags &^= attrHidden
+		case code == 29:
+			pen.Flags &^= attrStrike
+		case code >= 30 && code <= 37:
+			pen.Fg = colorIndexed | uint32(code-30)
+		case code == 38 || code == 48:
+			var color uint32
+			var ok bool
+			if len(group) > 1 {
+				color, ok = extendedColor(group[1:])
+			} else {
+				var used int
+				color, used, ok = extendedColorParams(params[i+1:])
+				i += used
+			}
+			if ok {
+				if code == 38 {
+					pen.Fg = color
+				} else {
+					pen.Bg = color
+				}
+			}
+		case code == 39:
+			pen.Fg = 0
+		case code >= 40 && code <= 47:
+			pen.Bg = colorIndexed | uint32(code-40)
+		case code == 49:
+			pen.Bg = 0
+		case code >= 90 && code <= 97:
+			pen.Fg = colorIndexed | uint32(code-90+8)
+		case code >= 100 && code <= 107:
+			pen.Bg = colorIndexed | uint32(code-100+8)
+		}
+	}
+}
+
+// extendedColor 解析冒号分隔的扩展颜色，如38:5:n、38:2::r:g:b
+func extendedColor(sub []int) (uint32, bool) {
+	switch {
+	case len(sub) >= 2 && sub[0] == 5:
+		return colorIndexed | uint32(sub[1]&0xff), true
+	case len(sub) >= 5 && sub[0] == 2:
+		// 带颜色空间ID的形式
+		return rgb(sub[2], sub[3], sub[4]), true
+	case len(sub) == 4 && sub[0] == 2:
+		return rgb(sub[1], sub[2], sub[3]), true
+	}
+	return 0, false
+}
+
+// extendedColorParams 解析分号分隔的扩展颜色，如38;5;n、38;2;r;g;b，返回使用的参数个数
+func extendedColorParams(rest [][]int) (uint32, int, bool) {
+	if len(rest) >= 2 && rest[0][0] == 5 {
+		return colorIndexed | uint32(rest[1][0]&0xff), 2, true
+	}
+	if len(rest) >= 4 && rest[0][0] == 2 {
+		return rgb(rest[1][0], rest[2][0], rest[3][0]), 4, true
+	}
+	return 0, len(rest), false
+}
+
+func rgb(r, g, b int) uint32 {
+	return colorRGB | uint32(r&0xff)<<16 | uint32(g&0xff)<<8 | uint32(b&0xff)
+}
@@ -0,0 +1,229 @@
+package vt
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Contents 屏幕的文本内容
+type Contents struct {
+	Cols       int      `json:"cols"`
+	Rows       int      `json:"rows"`
+	CursorX    int      `json:"cursor_x"`
+	CursorY    int      `json:"cursor_y"`
+	Alternate  bool     `json:"alternate"` // 是否正在显示备用屏幕（vim、top等全屏程序）
+	Title      string   `json:"title"`
+	Screen     []string `json:"screen"`
+	Scrollback []string `json:"scrollback,omitempty"`
+}
+
+// Contents 返回当前屏幕的文本，每行去掉行尾空白。scrollback为true时同时返回滚动缓冲
+func (s *Screen) Contents(scrollback bool) Contents {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := Contents{
+		Cols:      s.cols,
+		Rows:      s.rows,
+		CursorX:   s.cur.x,
+		CursorY:   s.cur.y,
+		Alternate: s.altActive,
+		Title:     s.title,
+		Screen:    make([]string, 0, s.rows),
+	}
+	for _, l := range s.lines {
+		c.Screen = append(c.Screen, l.text())
+	}
+	if scrollback {
+		c.Scrollback = make([]string, 0, len(s.scrollback))
+		for _, l := range s.scrollback {
+			c.Scrollback = append(c.Scrollback, l.text())
+		}
+	}
+	return c
+}
+
+// Text 返回当前屏幕的纯文本，行之间以换行分隔
+func (c Contents) Text() string {
+	lines := c.Screen
+	if len(c.Scrollback) > 0 {
+		lines = append(append([]string{}, c.Scrollback...), c.Screen...)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// Snapshot 生成在同样大小的空白终端上重现当前状态的输出：
+// 滚动缓冲和主屏幕内容、备用屏幕、滚动区域、光标位置、字符属性和终端模式
+func (s *Screen) Snapshot() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var buf bytes.Buffer
+
+	// 先复位客户端终端，重复接收快照时不会叠加旧内容
+	buf.WriteString("\x1bc")
+	if s.title != "" {
+		fmt.Fprintf(&buf, "\x1b]2;%s\x07", s.title)
+	}
+
+	// 主屏幕：逐行输出滚动缓冲和屏幕，多出的行自然滚入客户端的滚动缓冲
+	lines := append(append([]line{}, s.scrollback...), s.primary...)
+	for i, l := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		writeLine(&buf, l)
+	}
+	buf.WriteString("\x1b[0m")
+
+	// 备用屏幕：先把光标放到进入前的位置，离开备用屏幕时客户端能恢复到这里
+	if s.altActive {
+		fmt.Fprintf(&buf, "\x1b[%d;%dH\x1b[?1049h", s.altSaved.y+1, s.altSaved.x+1)
+		for y, l := range s.alt {
+			fmt.Fprintf(&buf, "\x1b[%dH", y+1)
+			writeLine(&buf, l)
+		}
+		buf.WriteString("\x1b[0m")
+	}
+
+	// 滚动区域，设置后光标回到左上角，因此在定位光标之前设置
+	if s.top != 0 || s.bottom != s.rows-1 {
+		fmt.Fprintf(&buf, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+
+	// 终端模式
+	if !s.autowrap {
+		buf.WriteString("\x1b[?7l")
+	}
+	if s.insertMode {
+		buf.WriteString("\x1b[4h")
+	}
+	if s.appCursor {
+		buf.WriteString("\x1b[?1h")
+	}
+	if s.appKeypad {
+		buf.WriteString("\x1b=")
+	}
+	if s.bracketedPaste {
+		buf.WriteString("\x1b[?2004h")
+	}
+	modes := make([]int, 0, len(s.mouseModes))
+	for mode := range s.mouseModes {
+		modes = append(modes, mode)
+	}
+	sort.Ints(modes)
+	for _, mode := range modes {
+		fmt.Fprintf(&buf, "\x1b[?%dh", mode)
+	}
+
+	// 光标位置，光标停在行尾等待换行时重新输出最后一个字符以恢复该状态
+	y := s.cur.y
+	if s.cur.originMode {
+		buf.WriteString("\x1b[?6h")
+		y -= s.top
+	}
+	if s.cur.wrapPending && s.cur.x == s.cols-1 && s.lines[s.cur.y][s.cur.x].Rune > 0 {
+		cell := s.lines[s.cur.y][s.cur.x]
+		fmt.Fprintf(&buf, "\x1b[%d;%dH%s%c", y+1, s.cur.x+1, sgr(cell.Attr), cell.Rune)
+	} else {
+		fmt.Fprintf(&buf, "\x1b[%d;%dH", y+1, s.cur.x+1)
+	}
+
+	// 当前字符属性和字符集
+	buf.WriteString(sgr(s.cur.pen))
+	if s.cur.charsets[0] {
+		buf.WriteString("\x1b(0")
+	}
+	if s.cur.charsets[1] {
+		buf.WriteString("\x1b)0")
+	}
+	if s.cur.gl == 1 {
+		buf.WriteString("\x0e")
+	}
+	if s.cursorHidden {
+		buf.WriteString("\x1b[?25l")
+	}
+
+	return buf.Bytes()
+}
+
+// writeLine 输出一行的字符和属性，省略行尾默认属性的空白
+func writeLine(buf *bytes.Buffer, l line) {
+	end := len(l)
+	for end > 0 && (l[end-1].Rune == 0 || l[end-1].Rune == ' ') && l[end-1].Attr == (Attr{}) {
+		end--
+	}
+
+	var attr Attr
+	for _, c := range l[:end] {
+		if c.Rune == wideTail {
+			continue
+		}
+		if c.Attr != attr {
+			buf.WriteString(sgr(c.Attr))
+			attr = c.Attr
+		}
+		if c.Rune == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteRune(c.Rune)
+		}
+	}
+	if attr != (Attr{}) {
+		buf.WriteString("\x1b[0m")
+	}
+}
+
+// text 返回一行的纯文本，去掉行尾空白
+func (l line) text() string {
+	var b strings.Builder
+	for _, c := range l {
+		switch c.Rune {
+		case wideTail:
+		case 0:
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(c.Rune)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// sgr 生成设置字符属性的控制序列
+func sgr(a Attr) string {
+	var b strings.Builder
+	b.WriteString("\x1b[0")
+	flags := []struct {
+		flag uint8
+		code string
+	}{
+		{attrBold, "1"}, {attrDim, "2"}, {attrItalic, "3"}, {attrUnderline, "4"},
+		{attrBlink, "5"}, {attrReverse, "7"}, {attrHidden, "8"}, {attrStrike, "9"},
+	}
+	for _, f := range flags {
+		if a.Flags&f.flag != 0 {
+			b.WriteString(";" + f.code)
+		}
+	}
+	writeColor(&b, a.Fg, 30, 90, 38)
+	writeColor(&b, a.Bg, 40, 100, 48)
+	b.WriteByte('m')
+	return b.String()
+}
+
+// writeColor 输出颜色参数，base为标准8色的起始编号，bright为高亮8色的起始编号，extended为扩展颜色编号
+func writeColor(b *strings.Builder, color uint32, base, bright, extended int) {
+	switch {
+	case color == 0:
+	case color&colorRGB != 0:
+		fmt.Fprintf(b, ";%d;2;%d;%d;%d", extended, color>>16&0xff, color>>8&0xff, color&0xff)
+	case color&0xff < 8:
+		fmt.Fprintf(b, ";%d", base+int(color&0xff))
+	case color&0xff < 16:
+		fmt.Fprintf(b, ";%d", bright+int(color&0xff)-8)
+	default:
+		fmt.Fprintf(b, ";%d;5;%d", extended, color&0xff)
+	}
+}
@@ -0,0 +1,597 @@
+package vt
+
+import (
+	"sync"
+)
+
+// 属性标志
+const (
+	attrBold uint8 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+)
+
+// 颜色编码：0为默认颜色，colorIndexed|n为256色中的第n色，colorRGB|0xRRGGBB为真彩色
+const (
+	colorIndexed uint32 = 1 << 24
+	colorRGB     uint32 = 1 << 25
+)
+
+// wideTail 宽字符占用的第二个单元格
+const wideTail rune = -1
+
+// Attr 单元格的显示属性
+type Attr struct {
+	Fg    uint32
+	Bg    uint32
+	Flags uint8
+}
+
+// Cell 屏幕上的一个单元格，Rune为0表示空白
+type Cell struct {
+	Rune rune
+	Attr Attr
+}
+
+// line 屏幕上的一行
+type line []Cell
+
+// cursor 光标位置及DECSC保存的状态
+type cursor struct {
+	x, y        int
+	pen         Attr
+	originMode  bool
+	wrapPending bool
+	charsets    [2]bool
+	gl          int
+}
+
+// Screen 无界面的VT100/xterm终端模拟器，记录屏幕内容、滚动缓冲、光标和终端模式，
+// 用于向重新连接的客户端发送当前屏幕的快照
+type Screen struct {
+	cols, rows int
+
+	primary    []line
+	alt        []line
+	lines      []line // 当前显示的屏幕，指向primary或alt
+	altActive  bool
+	scrollback []line
+	maxLines   int // 滚动缓冲最多保留的行数
+
+	cur      cursor
+	saved    cursor // DECSC保存的光标
+	altSaved cursor // 进入备用屏幕(1049)前保存的光标
+	top      int    // 滚动区域首行
+	bottom   int    // 滚动区域末行
+	tabs     []bool
+
+	// 终端模式
+	autowrap       bool
+	insertMode     bool
+	cursorHidden   bool
+	appCursor      bool
+	appKeypad      bool
+	bracketedPaste bool
+	mouseModes     map[int]bool
+
+	title string
+
+	parser parser
+	mutex  sync.Mutex
+}
+
+// New 创建指定大小的终端模拟器，scrollback为滚动缓冲保留的行数
+func New(cols, rows, scrollback int) *Screen {
+	if cols < 1 {
+		cols = 80
+	}
+	if rows < 1 {
+		rows = 24
+	}
+	s := &Screen{maxLines: scrollback}
+	s.cols, s.rows = cols, rows
+	s.reset()
+	return s
+}
+
+// reset 恢复初始状态（RIS），滚动缓冲一并清空
+func (s *Screen) reset() {
+	s.primary = newLines(s.cols, s.rows, Attr{})
+	s.alt = newLines(s.cols, s.rows, Attr{})
+	s.lines = s.primary
+	s.altActive = false
+	s.scrollback = nil
+	s.cur = cursor{}
+	s.saved = cursor{}
+	s.altSaved = cursor{}
+	s.top, s.bottom = 0, s.rows-1
+	s.resetTabs()
+	s.autowrap = true
+	s.insertMode = false
+	s.cursorHidden = false
+	s.appCursor = false
+	s.appKeypad = false
+	s.bracketedPaste = false
+	s.mouseModes = make(map[int]bool)
+	s.title = ""
+	s.parser = parser{}
+}
+
+// Write 处理终端输出，实现io.Writer
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, b := range p {
+		s.feed(b)
+	}
+	return len(p), nil
+}
+
+// Size 返回终端的列数和行数
+func (s *Screen) Size() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.cols, s.rows
+}
+
+// Resize 调整终端大小。行数减少时，主屏幕顶部的行移入滚动缓冲，保证光标仍在屏幕内
+func (s *Screen) Resize(cols, rows int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if cols < 1 || rows < 1 || (cols == s.cols && rows == s.rows) {
+		return
+	}
+
+	s.primary = s.resizeLines(s.primary, cols, rows, !s.altActive, true)
+	s.alt = s.resizeLines(s.alt, cols, rows, s.altActive, false)
+	for i, l := range s.scrollback {
+		s.scrollback[i] = resizeLine(l, cols)
+	}
+	if s.altActive {
+		s.lines = s.alt
+	} else {
+		s.lines = s.primary
+	}
+
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.resetTabs()
+	s.cur.x = clamp(s.cur.x, 0, cols-1)
+	s.cur.y = clamp(s.cur.y, 0, rows-1)
+	s.cur.wrapPending = false
+	s.saved.x = clamp(s.saved.x, 0, cols-1)
+	s.saved.y = clamp(s.saved.y, 0, rows-1)
+}
+
+// resizeLines 调整一个屏幕的大小，active表示该屏幕正在显示，光标随行的移动而移动
+func (s *Screen) resizeLines(lines []line, cols, rows int, active, keepScrollback bool) []line {
+	for i, l := range lines {
+		lines[i] = resizeLine(l, cols)
+	}
+
+	// 先去掉光标下方的空行，仍然过多时只从顶部移走保持光标可见所需的行，其余从底部截断
+	for len(lines) > rows && (!active || s.cur.y < len(lines)-1) && lines[len(lines)-1].blank() {
+		lines = lines[:len(lines)-1]
+	}
+	if excess := len(lines) - rows; excess > 0 {
+		top := excess
+		if active {
+			top = clamp(s.cur.y-(rows-1), 0, excess)
+			s.cur.y -= top
+		}
+		if keepScrollback {
+			s.pushScrollback(lines[:top])
+		}
+		lines = lines[top : top+rows]
+	}
+	for len(lines) < rows {
+		lines = append(lines, newLine(cols, Attr{}))
+	}
+	return lines
+}
+
+// resetTabs 每8列设置一个制表位
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+// pushScrollback 将滚出屏幕的行加入滚动缓冲
+func (s *Screen) pushScrollback(lines []line) {
+	if s.maxLines <= 0 {
+		return
+	}
+	for _, l := range lines {
+		s.scrollback = append(s.scrollback, append(line(nil), l...))
+	}
+	if excess := len(s.scrollback) - s.maxLines; excess > 0 {
+		s.scrollback = append([]line(nil), s.scrollback[excess:]...)
+	}
+}
+
+// blankCell 使用当前背景色的空白单元格（背景色擦除）
+func (s *Screen) blankCell() Cell {
+	return Cell{Attr: Attr{Bg: s.cur.pen.Bg}}
+}
+
+// print 在光标处输出一个字符
+func (s *Screen) print(r rune) {
+	if s.cur.charsets[s.cur.gl] {
+		r = lineDrawing(r)
+	}
+
+	width := runeWidth(r)
+	if width == 0 {
+		// 组合字符等零宽字符不单独占用单元格
+		return
+	}
+
+	if s.cur.wrapPending && s.autowrap {
+		s.cur.x = 0
+		s.index()
+	}
+	s.cur.wrapPending = false
+
+	// 宽字符放不下时换到下一行
+	if width == 2 && s.cur.x == s.cols-1 {
+		if !s.autowrap {
+			return
+		}
+		s.lines[s.cur.y][s.cur.x] = s.blankCell()
+		s.cur.x = 0
+		s.index()
+	}
+	if width > s.cols {
+		return
+	}
+
+	l := s.lines[s.cur.y]
+	if s.insertMode {
+		s.insertCells(width)
+	}
+	s.clearWide(l, s.cur.x)
+	if width == 2 {
+		s.clearWide(l, s.cur.x+1)
+	}
+
+	l[s.cur.x] = Cell{Rune: r, Attr: s.cur.pen}
+	if width == 2 {
+		l[s.cur.x+1] = Cell{Rune: wideTail, Attr: s.cur.pen}
+	}
+
+	s.cur.x += width
+	if s.cur.x >= s.cols {
+		s.cur.x = s.cols - 1
+		s.cur.wrapPending = s.autowrap
+	}
+}
+
+// clearWide 覆盖单元格前拆开它所属的宽字符
+func (s *Screen) clearWide(l line, x int) {
+	if x < 0 || x >= len(l) {
+		return
+	}
+	if l[x].Rune == wideTail && x > 0 {
+		l[x-1] = Cell{Attr: l[x-1].Attr}
+	}
+	if x+1 < len(l) && l[x+1].Rune == wideTail {
+		l[x+1] = Cell{Attr: l[x+1].Attr}
+	}
+}
+
+// index 光标下移一行，位于滚动区域底部时向上滚动（IND）
+func (s *Screen) index() {
+	if s.cur.y == s.bottom {
+		s.scrollUp(1)
+	} else if s.cur.y < s.rows-1 {
+		s.cur.y++
+	}
+}
+
+// reverseIndex 光标上移一行，位于滚动区域顶部时向下滚动（RI）
+func (s *Screen) reverseIndex() {
+	if s.cur.y == s.top {
+		s.scrollDown(1)
+	} else if s.cur.y > 0 {
+		s.cur.y--
+	}
+}
+
+// scrollUp 滚动区域向上滚动n行，主屏幕从首行滚出的行进入滚动缓冲
+func (s *Screen) scrollUp(n int) {
+	n = clamp(n, 0, s.bottom-s.top+1)
+	if n == 0 {
+		return
+	}
+	if s.top == 0 && !s.altActive {
+		s.pushScrollback(s.lines[:n])
+	}
+	region := s.lines[s.top : s.bottom+1]
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = newLine(s.cols, s.blankCell().Attr)
+	}
+}
+
+// scrollDown 滚动区域向下滚动n行
+func (s *Screen) scrollDown(n int) {
+	n = clamp(n, 0, s.bottom-s.top+1)
+	if n == 0 {
+		return
+	}
+	region := s.lines[s.top : s.bottom+1]
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = newLine(s.cols, s.blankCell().Attr)
+	}
+}
+
+// insertLines 在光标所在行插入n个空行（IL）
+func (s *Screen) insertLines(n int) {
+	if s.cur.y < s.top || s.cur.y > s.bottom {
+		return
+	}
+	n = clamp(n, 1, s.bottom-s.cur.y+1)
+	region := s.lines[s.cur.y : s.bottom+1]
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = newLine(s.cols, s.blankCell().Attr)
+	}
+	s.cur.x = 0
+	s.cur.wrapPending = false
+}
+
+// deleteLines 删除光标所在行开始的n行（DL）
+func (s *Screen) deleteLines(n int) {
+	if s.cur.y < s.top || s.cur.y > s.bottom {
+		return
+	}
+	n = clamp(n, 1, s.bottom-s.cur.y+1)
+	region := s.lines[s.cur.y : s.bottom+1]
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = newLine(s.cols, s.blankCell().Attr)
+	}
+	s.cur.x = 0
+	s.cur.wrapPending = false
+}
+
+// insertCells 在光标处插入n个空白单元格（ICH）
+func (s *Screen) insertCells(n int) {
+	l := s.lines[s.cur.y]
+	n = clamp(n, 1, s.cols-s.cur.x)
+	s.clearWide(l, s.cur.x)
+	copy(l[s.cur.x+n:], l[s.cur.x:])
+	for i := s.cur.x; i < s.cur.x+n; i++ {
+		l[i] = s.blankCell()
+	}
+	// 移出右边界的宽字符只剩一半时清除
+	if runeWidth(l[s.cols-1].Rune) == 2 {
+		l[s.cols-1] = s.blankCell()
+	}
+}
+
+// deleteCells 删除光标处的n个单元格（DCH）
+func (s *Screen) deleteCells(n int) {
+	l := s.lines[s.cur.y]
+	n = clamp(n, 1, s.cols-s.cur.x)
+	s.clearWide(l, s.cur.x)
+	s.clearWide(l, s.cur.x+n-1)
+	copy(l[s.cur.x:], l[s.cur.x+n:])
+	for i := s.cols - n; i < s.cols; i++ {
+		l[i] = s.blankCell()
+	}
+	s.cur.wrapPending = false
+}
+
+// eraseCells 擦除光标所在行[from, to)范围内的单元格
+func (s *Screen) eraseCells(y, from, to int) {
+	l := s.lines[y]
+	from = clamp(from, 0, s.cols)
+	to = clamp(to, 0, s.cols)
+	if from < to {
+		s.clearWide(l, from)
+		s.clearWide(l, to-1)
+	}
+	for i := from; i < to; i++ {
+		l[i] = s.blankCell()
+	}
+}
+
+// eraseDisplay 擦除屏幕（ED）
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.cur.y, s.cur.x, s.cols)
+		for y := s.cur.y + 1; y < s.rows; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+	case 1:
+		for y := 0; y < s.cur.y; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+		s.eraseCells(s.cur.y, 0, s.cur.x+1)
+	case 2:
+		for y := 0; y < s.rows; y++ {
+			s.eraseCells(y, 0, s.cols)
+		}
+	case 3:
+		s.scrollback = nil
+	}
+	s.cur.wrapPending = false
+}
+
+// eraseLine 擦除光标所在行（EL）
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.cur.y, s.cur.x, s.cols)
+	case 1:
+		s.eraseCells(s.cur.y, 0, s.cur.x+1)
+	case 2:
+		s.eraseCells(s.cur.y, 0, s.cols)
+	}
+	s.cur.wrapPending = false
+}
+
+// moveTo 移动光标到屏幕上的绝对位置，原点模式下限制在滚动区域内
+func (s *Screen) moveTo(x, y int) {
+	minY, maxY := 0, s.rows-1
+	if s.cur.originMode {
+		minY, maxY = s.top, s.bottom
+	}
+	s.cur.x = clamp(x, 0, s.cols-1)
+	s.cur.y = clamp(y, minY, maxY)
+	s.cur.wrapPending = false
+}
+
+// moveVertical 上下移动光标，不越过滚动区域边界
+func (s *Screen) moveVertical(n int) {
+	minY, maxY := 0, s.rows-1
+	if s.cur.y >= s.top && s.cur.y <= s.bottom {
+		minY, maxY = s.top, s.bottom
+	}
+	s.cur.y = clamp(s.cur.y+n, minY, maxY)
+	s.cur.wrapPending = false
+}
+
+// tab 移动到下一个制表位（HT）
+func (s *Screen) tab(n int) {
+	for ; n > 0 && s.cur.x < s.cols-1; n-- {
+		s.cur.x++
+		for s.cur.x < s.cols-1 && !s.tabs[s.cur.x] {
+			s.cur.x++
+		}
+	}
+	s.cur.wrapPending = false
+}
+
+// backTab 移动到上一个制表位（CBT）
+func (s *Screen) backTab(n int) {
+	for ; n > 0 && s.cur.x > 0; n-- {
+		s.cur.x--
+		for s.cur.x > 0 && !s.tabs[s.cur.x] {
+			s.cur.x--
+		}
+	}
+	s.cur.wrapPending = false
+}
+
+// setScrollRegion 设置滚动区域（DECSTBM），参数为从1开始的行号
+func (s *Screen) setScrollRegion(top, bottom int) {
+	if bottom <= 0 || bottom > s.rows {
+		bottom = s.rows
+	}
+	if top <= 0 {
+		top = 1
+	}
+	if top >= bottom {
+		return
+	}
+	s.top, s.bottom = top-1, bottom-1
+	if s.cur.originMode {
+		s.moveTo(0, s.top)
+	} else {
+		s.moveTo(0, 0)
+	}
+}
+
+// saveCursor 保存光标状态（DECSC）
+func (s *Screen) saveCursor() {
+	s.saved = s.cur
+}
+
+// restoreCursor 恢复光标状态（DECRC）
+func (s *Screen) restoreCursor() {
+	s.cur = s.saved
+	s.cur.x = clamp(s.cur.x, 0, s.cols-1)
+	s.cur.y = clamp(s.cur.y, 0, s.rows-1)
+}
+
+// switchScreen 切换主屏幕和备用屏幕，mode为47、1047或1049
+func (s *Screen) switchScreen(alt bool, mode int) {
+	if alt == s.altActive {
+		return
+	}
+	if alt {
+		if mode == 1049 {
+			s.altSaved = s.cur
+		}
+		s.alt = newLines(s.cols, s.rows, Attr{})
+		s.lines = s.alt
+	} else {
+		s.lines = s.primary
+		if mode == 1049 {
+			s.cur = s.altSaved
+			s.cur.x = clamp(s.cur.x, 0, s.cols-1)
+			s.cur.y = clamp(s.cur.y, 0, s.rows-1)
+		}
+	}
+	s.altActive = alt
+	s.top, s.bottom = 0, s.rows-1
+}
+
+// blank 该行是否全部为默认属性的空白
+func (l line) blank() bool {
+	for _, c := range l {
+		if (c.Rune != 0 && c.Rune != ' ') || c.Attr != (Attr{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// newLine 创建一行空白单元格
+func newLine(cols int, attr Attr) line {
+	l := make(line, cols)
+	if attr != (Attr{}) {
+		for i := range l {
+			l[i].Attr = Attr{Bg: attr.Bg}
+		}
+	}
+	return l
+}
+
+// newLines 创建空白屏幕
+func newLines(cols, rows int, attr Attr) []line {
+	lines := make([]line, rows)
+	for i := range lines {
+		lines[i] = newLine(cols, attr)
+	}
+	return lines
+}
+
+// resizeLine 调整一行的宽度，截断处的宽字符被清除
+func resizeLine(l line, cols int) line {
+	if len(l) > cols {
+		l = l[:cols]
+		if cols > 0 && runeWidth(l[cols-1].Rune) == 2 {
+			l[cols-1] = Cell{Attr: l[cols-1].Attr}
+		}
+		return l
+	}
+	for len(l) < cols {
+		l = append(l, Cell{})
+	}
+	return l
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package vt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// screenTests 在10x4的终端上依次输入，检查屏幕文本、光标和状态
+var screenTests = []struct {
+	name      string
+	input     string
+	screen    []string
+	x, y      int
+	title     string
+	alternate bool
+}{
+	{"plain", "ab\r\ncd", []string{"ab", "cd", "", ""}, 2, 1, "", false},
+	{"autowrap", "0123456789ab", []string{"0123456789", "ab", "", ""}, 2, 1, "", false},
+	{"wrap pending", "0123456789", []string{"0123456789", "", "", ""}, 9, 0, "", false},
+	{"no autowrap", "\x1b[?7l0123456789ab", []string{"012345678b", "", "", ""}, 9, 0, "", false},
+	{"cursor position", "\x1b[3;4Hx\x1b[Hy", []string{"y", "", "   x", ""}, 1, 0, "", false},
+	{"cursor moves", "\x1b[2B\x1b[5Cx\x1b[A\x1b[2Dy", []string{"", "    y", "     x", ""}, 5, 1, "", false},
+	{"erase line", "abcdef\x1b[3D\x1b[K", []string{"abc", "", "", ""}, 3, 0, "", false},
+	{"erase line start", "abcdef\x1b[3D\x1b[1K", []string{"    ef", "", "", ""}, 3, 0, "", false},
+	{"erase display", "a\r\nb\r\nc\x1b[2;1H\x1b[J", []string{"a", "", "", ""}, 0, 1, "", false},
+	{"insert delete chars", "abcd\x1b[3G\x1b[2@XY\x1b[G\x1b[P", []string{"bXYcd", "", "", ""}, 0, 0, "", false},
+	{"sgr keeps text", "\x1b[1;31mred\x1b[0m \x1b[38;2;1;2;3mrgb", []string{"red rgb", "", "", ""}, 7, 0, "", false},
+	{"wide chars", "你好x", []string{"你好x", "", "", ""}, 5, 0, "", false},
+	{"line drawing", "\x1b(0lqk\x1b(Bq", []string{"┌─┐q", "", "", ""}, 4, 0, "", false},
+	{"tabs", "a\tb", []string{"a       b", "", "", ""}, 9, 0, "", false},
+	{"title bel", "\x1b]0;host: ~\x07$ ", []string{"$", "", "", ""}, 2, 0, "host: ~", false},
+	{"title st", "\x1b]2;vim\x1b\\x", []string{"x", "", "", ""}, 1, 0, "vim", false},
+	{"icon name ignored", "\x1b]1;icon\x07", []string{"", "", "", ""}, 0, 0, "", false},
+	{"alt screen", "main\x1b[?1049h\x1b[2;2Halt", []string{"", " alt", "", ""}, 4, 1, "", true},
+	{"alt screen exit", "main\x1b[?1049h\x1b[2Jalt\x1b[?1049l!", []string{"main!", "", "", ""}, 5, 0, "", false},
+	{"alt screen 47", "main\x1b[?47halt\x1b[?47l", []string{"main", "", "", ""}, 7, 0, "", false},
+	{"scroll region", "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[3;1H\nX", []string{"1", "3", "X", "4"}, 1, 2, "", false},
+	{"scroll region reverse index", "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[2;1H\x1bM", []string{"1", "", "2", "4"}, 0, 1, "", false},
+	{"insert line", "1\r\n2\r\n3\r\n4\x1b[1;3r\x1b[2;1H\x1b[L", []string{"1", "", "2", "4"}, 0, 1, "", false},
+	{"delete line", "1\r\n2\r\n3\r\n4\x1b[2;1H\x1b[M", []string{"1", "3", "4", ""}, 0, 1, "", false},
+	{"scroll up", "1\r\n2\r\n3\r\n4\x1b[2S", []string{"3", "4", "", ""}, 1, 3, "", false},
+	{"origin mode", "\x1b[2;3r\x1b[?6h\x1b[1;1Hx", []string{"", "x", "", ""}, 1, 1, "", false},
+	{"save restore", "ab\x1b7\x1b[4;4Hc\x1b8d", []string{"abd", "", "", "   c"}, 3, 0, "", false},
+	{"reset", "\x1b]2;t\x07abc\x1b[?1049h\x1bc", []string{"", "", "", ""}, 0, 0, "", false},
+	{"split sequence", "\x1b[", []string{"", "", "", ""}, 0, 0, "", false},
+}
+
+func TestContents(t *testing.T) {
+	for _, tt := range screenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 4, 100)
+			s.Write([]byte(tt.input))
+
+			c := s.Contents(false)
+			if !reflect.DeepEqual(c.Screen, tt.screen) {
+				t.Errorf("screen = %q, want %q", c.Screen, tt.screen)
+			}
+			if c.CursorX != tt.x || c.CursorY != tt.y {
+				t.Errorf("cursor = %d,%d, want %d,%d", c.CursorX, c.CursorY, tt.x, tt.y)
+			}
+			if c.Title != tt.title || c.Alternate != tt.alternate {
+				t.Errorf("title %q alternate %v, want %q %v", c.Title, c.Alternate, tt.title, tt.alternate)
+			}
+		})
+	}
+}
+
+// TestSnapshotReplay 快照在同样大小的空白终端上应重现相同的状态
+func TestSnapshotReplay(t *testing.T) {
+	for _, tt := range screenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 4, 100)
+			s.Write([]byte("before\r\n1\r\n2\r\n3\r\n4\r\n"))
+			s.Write([]byte(tt.input))
+			snapshot := s.Snapshot()
+
+			replay := New(10, 4, 100)
+			replay.Write(snapshot)
+			if got, want := replay.Contents(true), s.Contents(true); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed contents = %+v, want %+v", got, want)
+			}
+			if got := replay.Snapshot(); string(got) != string(snapshot) {
+				t.Errorf("replayed snapshot = %q, want %q", got, snapshot)
+			}
+
+			// 继续输出时两者的行为一致
+			more := "\x1b[?1049lnext\r\n\x1b[1;1Hz\x1b[r"
+			s.Write([]byte(more))
+			replay.Write([]byte(more))
+			if got, want := replay.Contents(true), s.Contents(true); !reflect.DeepEqual(got, want) {
+				t.Errorf("after more output contents = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", "\x1bc\r\n\r\n\r\n\x1b[0m\x1b[1;1H\x1b[0m"},
+		{"text and pen", "ab\x1b[1;31mc", "\x1bcab\x1b[0;1;31mc\x1b[0m\r\n\r\n\r\n\x1b[0m\x1b[1;4H\x1b[0;1;31m"},
+		{"title", "\x1b]2;top\x07", "\x1bc\x1b]2;top\x07\r\n\r\n\r\n\x1b[0m\x1b[1;1H\x1b[0m"},
+		{"scroll region", "\x1b[2;3r", "\x1bc\r\n\r\n\r\n\x1b[0m\x1b[2;3r\x1b[1;1H\x1b[0m"},
+		{"alt screen", "sh\x1b[?1049h\x1b[Hvi", "\x1bcsh\r\n\r\n\r\n\x1b[0m\x1b[1;3H\x1b[?1049h\x1b[1Hvi\x1b[2H\x1b[3H\x1b[4H\x1b[0m\x1b[1;3H\x1b[0m"},
+		{"modes", "\x1b[?1h\x1b=\x1b[?2004h\x1b[?1006h\x1b[?1000h\x1b[?25l", "\x1bc\r\n\r\n\r\n\x1b[0m\x1b[?1h\x1b=\x1b[?2004h\x1b[?1000h\x1b[?1006h\x1b[1;1H\x1b[0m\x1b[?25l"},
+		{"wrap pending", "0123456789", "\x1bc0123456789\r\n\r\n\r\n\x1b[0m\x1b[1;10H\x1b[0m9\x1b[0m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 4, 0)
+			s.Write([]byte(tt.input))
+			if got := string(s.Snapshot()); got != tt.want {
+				t.Errorf("Snapshot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrollback(t *testing.T) {
+	s := New(10, 3, 3)
+	for _, line := range []string{"a", "b", "c", "d", "e", "f"} {
+		s.Write([]byte(line + "\r\n"))
+	}
+
+	c := s.Contents(true)
+	if want := []string{"b", "c", "d"}; !reflect.DeepEqual(c.Scrollback, want) {
+		t.Errorf("scrollback = %q, want %q", c.Scrollback, want)
+	}
+	if want := "b\nc\nd\ne\nf\n"; c.Text() != want {
+		t.Errorf("Text() = %q, want %q", c.Text(), want)
+	}
+	if c := s.Contents(false); c.Scrollback != nil || c.Text() != "e\nf\n" {
+		t.Errorf("Contents(false) = %+v", c)
+	}
+
+	// 滚动区域和备用屏幕中滚出的行不进入滚动缓冲
+	s.Write([]byte("\x1b[?1049h1\r\n2\r\n3\r\n\x1b[?1049l"))
+	s.Write([]byte("\x1b[2;3r\x1b[2;1Hx\ny\n"))
+	if got := s.Contents(true).Scrollback; !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Errorf("scrollback after alt screen and region = %q", got)
+	}
+}
+
+func TestResize(t *testing.T) {
+	s := New(10, 4, 100)
+	s.Write([]byte("1\r\n2\r\n3\r\n4567890abc"))
+
+	s.Resize(5, 2)
+	c := s.Contents(true)
+	if cols, rows := s.Size(); cols != 5 || rows != 2 {
+		t.Fatalf("Size() = %d,%d", cols, rows)
+	}
+	if len(c.Screen) != 2 || c.CursorY > 1 || c.CursorX > 4 {
+		t.Errorf("contents after shrink = %+v", c)
+	}
+	if !strings.HasSuffix(c.Text(), "\n") || !strings.Contains(c.Text(), "1") {
+		t.Errorf("text after shrink = %q", c.Text())
+	}
+}